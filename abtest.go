@@ -0,0 +1,90 @@
+package aduket
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sort"
+)
+
+// abTest assigns clients to named variants, see ABTest.
+type abTest struct {
+	names    []string // Sorted, so assignments do not depend on map order
+	variants map[string]Variant
+	stickyBy string
+}
+
+// ABTest makes the expectation respond with one of the named variants,
+// assigned according to their weights the way gradual rollouts do. Clients
+// are identified by the request header or, failing that, the cookie named
+// stickyBy and always get the same variant; clients without one get a
+// variant at random on every request. Captured requests are tagged with
+// "ab:" followed by the variant name.
+func (e *Expectation) ABTest(variants map[string]Variant, stickyBy string) *Expectation {
+	ab := newABTest(variants, stickyBy)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.abTest = ab
+	return e
+}
+
+func newABTest(variants map[string]Variant, stickyBy string) *abTest {
+	ab := &abTest{variants: make(map[string]Variant, len(variants)), stickyBy: stickyBy}
+	for name, v := range variants {
+		ab.names = append(ab.names, name)
+		ab.variants[name] = v
+	}
+	sort.Strings(ab.names)
+	return ab
+}
+
+// pick returns the variant assigned to the client of r.
+func (ab *abTest) pick(r *http.Request, rng randSource) (string, Variant) {
+	total := 0
+	for _, name := range ab.names {
+		total += variantWeight(ab.variants[name])
+	}
+
+	var n int
+	if id := ab.clientID(r); id != "" {
+		h := fnv.New32a()
+		h.Write([]byte(id))
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rng.Intn(total)
+	}
+	for _, name := range ab.names {
+		n -= variantWeight(ab.variants[name])
+		if n < 0 {
+			return name, ab.variants[name]
+		}
+	}
+	last := ab.names[len(ab.names)-1]
+	return last, ab.variants[last]
+}
+
+func (ab *abTest) clientID(r *http.Request) string {
+	if ab.stickyBy == "" {
+		return ""
+	}
+	if id := r.Header.Get(ab.stickyBy); id != "" {
+		return id
+	}
+	if cookie, err := r.Cookie(ab.stickyBy); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// applyVariant returns the status, headers and body of v, with the headers
+// of v added to a copy of headers.
+func applyVariant(v Variant, headers http.Header) (int, http.Header, []byte) {
+	headers = headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	for k, val := range v.Headers {
+		headers.Set(k, val)
+	}
+	return v.Status, headers, []byte(v.Body)
+}
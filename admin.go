@@ -0,0 +1,127 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// AdminPath is the prefix of the endpoints served by EnableAdminAPI.
+const AdminPath = "/__aduket__"
+
+// EnableAdminAPI serves a REST API on AdminPath+"/expectations" so external
+// tools and non-Go test harnesses can manage expectations while the server
+// is running:
+//
+//	GET    lists the expectations in the Expectation JSON format
+//	POST   registers the expectation, or array of expectations, in the body
+//	DELETE removes the expectations identified by ?name=, see
+//	       ResetExpectation, or all of them without a name
+//
+// Expectations registered by the server itself, such as Health, are neither
+// listed nor removed. AdminPath+"/chaos" reports the active chaos profile
+// and its alternatives on GET, switches to the profile in a
+// {"profile": "outage"} body on PUT or POST, and turns chaos off on DELETE,
+// see Chaos. Admin requests are not recorded.
+func (s *Server) EnableAdminAPI() {
+	s.handleInternal(AdminPath+"/expectations", s.serveAdminExpectations)
+	s.handleInternal(AdminPath+"/chaos", s.serveAdminChaos)
+}
+
+func (s *Server) serveAdminExpectations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.userExpectations())
+	case http.MethodPost:
+		exps, err := decodeExpectations(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.bindScenarios(exps)
+		s.Expectations = append(s.Expectations, exps...)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, exps)
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if !s.removeUserExpectations(name) && name != "" {
+			http.Error(w, fmt.Sprintf("aduket: no expectation named %q", name), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "aduket: method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeExpectations reads a single expectation or an array of them.
+func decodeExpectations(r io.Reader) ([]*Expectation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var exps []*Expectation
+		if err := json.Unmarshal(data, &exps); err != nil {
+			return nil, err
+		}
+		for i, exp := range exps {
+			if exp == nil {
+				return nil, fmt.Errorf("aduket: expectation %d is null", i)
+			}
+		}
+		return exps, nil
+	}
+	exp := &Expectation{}
+	if err := json.Unmarshal(data, exp); err != nil {
+		return nil, err
+	}
+	return []*Expectation{exp}, nil
+}
+
+// userExpectations returns the expectations not registered by the server
+// itself.
+func (s *Server) userExpectations() []*Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exps := make([]*Expectation, 0, len(s.Expectations))
+	for _, exp := range s.Expectations {
+		exp.mu.Lock()
+		builtin := exp.builtin
+		exp.mu.Unlock()
+		if !builtin {
+			exps = append(exps, exp)
+		}
+	}
+	return exps
+}
+
+// removeUserExpectations removes the expectations identified by name, see
+// ResetExpectation, or all of them if name is empty, leaving those registered
+// by the server itself. It reports whether anything was removed.
+func (s *Server) removeUserExpectations(name string) bool {
+	kept := make([]*Expectation, 0)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, exp := range s.Expectations {
+		exp.mu.Lock()
+		if exp.builtin || (name != "" && exp.id() != name) {
+			kept = append(kept, exp)
+		}
+		exp.mu.Unlock()
+	}
+	removed := len(kept) != len(s.Expectations)
+	s.Expectations = kept
+	return removed
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
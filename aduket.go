@@ -2,36 +2,99 @@ package aduket
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/ismailtsdln/aduket/auth"
 )
 
-// CapturedRequest stores a received request and its response.
+// CapturedRequest stores a received request and its response. Trailers sent
+// by the client are available in Trailer once the body has been read, and
+// the TLS connection state in TLS, see TLSVersion.
 type CapturedRequest struct {
 	*http.Request
-	BodyContent  []byte
-	StatusCode   int
-	ResponseBody []byte
+	BodyContent    []byte
+	StatusCode     int
+	ResponseBody   []byte
+	ResponseHeader http.Header  // Headers sent with the response
+	ReceivedAt     time.Time    // Time the request reached the handler
+	RespondedAt    time.Time    // Time the response was complete
+	Partition      string       // Client identity, see Server.PartitionBy
+	Expectation    *Expectation // Expectation that matched the request, nil if none did
+	ExpectContinue bool         // The client sent "Expect: 100-continue", see Server.RejectContinue
+	OriginalMethod string       // Method sent before X-HTTP-Method-Override, see Server.MethodOverride
+	LocalAddr      string       // Server address the request arrived on, next to RemoteAddr
+	ConnID         uint64       // Sequential ID of the connection the request arrived on
+	ClientAborted  bool         // The client went away during the Delay, so no response was sent
+
+	mu                 sync.Mutex
+	tags               []string
+	frames             []WebSocketFrame
+	compressedBody     []byte
+	compressedResponse []byte
 }
 
 // Server is a mock HTTP server.
 type Server struct {
 	*httptest.Server
+	Name               string // Label in merged histories, see MergeHistory
 	Expectations       []*Expectation
 	Requests           []*CapturedRequest
 	mu                 sync.Mutex
 	Upgrader           websocket.Upgrader
 	MaxRequestBodySize int64
+	MaxHeaders         int                    // Maximum number of request header values, 0 means unlimited (431)
+	MaxURLLength       int                    // Maximum length of the request URI, 0 means unlimited (414)
+	AllowedMethods     []string               // Methods accepted by the server, empty means all (405 with Allow)
 	OnRequest          func(*CapturedRequest) // Callback for real-time monitoring
+	RetryWindow        time.Duration          // Maximum gap between a request and its retry
+	compressHistory    bool
+	maxRequests        int  // See SetMaxCapturedRequests
+	requestCount       int  // Requests recorded, including those evicted from Requests
+	unmatchedCount     int  // Unmatched requests recorded, including evicted ones
+	discardBodies      bool // See CaptureBodies
+	autoContentType    bool
+	verboseFailures    bool
+	rand               *lockedRand
+	started            bool
+	historyStart       time.Time
+	partitionHeader    string
+	defaultExp         *Expectation // See Default
+	shaper             *shaper      // See Shape
+	chaos              string       // Active chaos profile, see Chaos
+	chaosProfiles      map[string]TrafficShape
+	jwtKey             *auth.Key      // See JWTKey
+	clientCAs          *x509.CertPool // See RequireClientCert
+	jsonrpc            []*JSONRPCExpectation
+	internal           map[string]http.HandlerFunc
+	health             *Health
+	failures           []string
+	versions           []*VersionGroup
+	scenarios          map[string]*Scenario
+	dependencies       map[string]*Dependency
+	proxy              *proxy
+	storage            Storage
+	conversationKey    KeyFunc
+	continueDelay      time.Duration
+	continueStatus     int
+	methodOverride     bool
+	connIDs            atomic.Uint64
+	inFlight           map[*CapturedRequest]struct{}
+	conns              map[net.Conn]http.ConnState
 }
 
 // NewServer creates and starts a new mock HTTP server.
@@ -43,21 +106,33 @@ func NewServer() *Server {
 
 // NewTLSServer creates and starts a new mock HTTPS server.
 func NewTLSServer() *Server {
-	s := createServer(true)
+	s := createServer()
+	s.StartTLS()
+	return s
+}
+
+// NewTLSServerWithCert creates and starts a new mock HTTPS server that
+// presents cert instead of the generated test certificate, so clients can
+// verify the hostname it was issued for rather than skipping verification.
+func NewTLSServerWithCert(cert tls.Certificate) *Server {
+	s := NewUnstartedServer()
+	s.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}})
 	s.StartTLS()
 	return s
 }
 
 // NewUnstartedServer creates a new mock HTTP server but does not start it.
 func NewUnstartedServer() *Server {
-	return createServer(false)
+	return createServer()
 }
 
-func createServer(tls bool) *Server {
+func createServer() *Server {
 	s := &Server{
 		Expectations:       make([]*Expectation, 0),
 		Requests:           make([]*CapturedRequest, 0),
 		MaxRequestBodySize: 10 * 1024 * 1024, // Default 10MB
+		RetryWindow:        DefaultRetryWindow,
+		rand:               newTimeSeededRand(),
 		Upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
@@ -65,29 +140,84 @@ func createServer(tls bool) *Server {
 
 	// Use the handler helper
 	s.Server = httptest.NewUnstartedServer(s.handler())
-	if tls {
-		s.Server.TLS = nil // It will be initialized by StartTLS
-	}
+	s.Server.Config.ConnContext = s.connContext
+	s.Server.Config.ConnState = s.connState
+	// StartTLS adds the certificate to this config.
+	s.Server.TLS = &tls.Config{GetConfigForClient: s.clientTLSConfig}
 
 	return s
 }
 
 func (s *Server) handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedAt := time.Now()
+
 		// Panic recovery
 		defer func() {
 			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, "mock server panic: %v", rec)
 			}
 		}()
 
 		s.mu.Lock()
-		defer s.mu.Unlock()
+		maxBodySize := s.MaxRequestBodySize
+		partitionHeader := s.partitionHeader
+		internal := s.internal[r.URL.Path]
+		continueDelay := s.continueDelay
+		continueStatus := s.continueStatus
+		methodOverride := s.methodOverride
+		limits := serverLimits{
+			maxHeaders:   s.MaxHeaders,
+			maxURLLength: s.MaxURLLength,
+			methods:      s.AllowedMethods,
+		}
+		s.mu.Unlock()
+
+		if internal != nil {
+			internal(w, r)
+			return
+		}
+
+		captured := &CapturedRequest{
+			ReceivedAt:     receivedAt,
+			ExpectContinue: strings.EqualFold(r.Header.Get("Expect"), "100-continue"),
+		}
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			captured.LocalAddr = addr.String()
+		}
+		captured.ConnID, _ = r.Context().Value(connIDKey{}).(uint64)
+		defer s.trackInFlight(captured)()
+		r = withCaptured(r, captured)
+		captured.Request = r
+		if partitionHeader != "" {
+			captured.Partition = r.Header.Get(partitionHeader)
+		}
+
+		if status, reason := limits.check(w, r); status != 0 {
+			s.reject(w, captured, status, reason)
+			return
+		}
+		if methodOverride {
+			overrideMethod(captured)
+		}
+		// net/http sends 100 Continue when the body is first read, so the
+		// decision has to be made before reading it.
+		if captured.ExpectContinue && continueStatus != 0 {
+			w.Header().Set("Connection", "close")
+			s.reject(w, captured, continueStatus, "")
+			return
+		}
+		if captured.ExpectContinue && continueDelay > 0 {
+			time.Sleep(continueDelay)
+		}
 
 		// Body size limit
-		if s.MaxRequestBodySize > 0 {
-			r.Body = http.MaxBytesReader(w, r.Body, s.MaxRequestBodySize)
+		if maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
 		}
 
 		// Record request body
@@ -103,149 +233,405 @@ func (s *Server) handler() http.Handler {
 			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 		}
 
-		// Record request
-		captured := &CapturedRequest{
-			Request:     r,
-			BodyContent: bodyBytes,
-		}
+		captured.BodyContent = bodyBytes
 
-		for _, exp := range s.Expectations {
-			if matchExpectation(exp, r) {
-				exp.MatchedTimes++
-
-				exp.mu.Lock()
-				delay := exp.DelayTime
-				responder := exp.Func
-				headers := exp.Header
-				statusCode := exp.StatusCode
-				body := exp.Body
-				exp.mu.Unlock()
-
-				captured.StatusCode = statusCode
-				captured.ResponseBody = body
-
-				// Handle delay
-				if delay > 0 {
-					s.mu.Unlock()
-					time.Sleep(delay)
-					s.mu.Lock()
-				}
+		exp, params := s.match(r, bodyBytes)
 
-				if s.OnRequest != nil {
-					s.OnRequest(captured)
+		s.mu.Lock()
+		autoContentType := s.autoContentType
+		var proxy *proxy
+		var proxyTransform jqFilter
+		if s.proxy != nil && s.proxy.upstream != nil {
+			proxy = s.proxy
+			proxyTransform = proxy.transform
+		}
+		captured.Expectation = exp
+		if exp == nil && proxy == nil && s.defaultExp != nil {
+			exp = s.defaultExp
+		}
+		shaper := s.shaper
+		s.mu.Unlock()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		aborted := false
+		faulted := false // No response was sent
+		if exp == nil && proxy != nil {
+			captured.Tag("proxied")
+			recorded, err := proxy.serve(rec, r, bodyBytes, proxyTransform)
+			if err != nil {
+				rec.WriteHeader(http.StatusBadGateway)
+				fmt.Fprintf(rec, "aduket: proxy error: %v", err)
+			} else if recorded != nil {
+				// The response is already sent, so a failure to save the
+				// recording can only be reported out of band.
+				if err := s.recordExchange(recorded); err != nil {
+					fmt.Fprintf(os.Stderr, "aduket: saving recording: %v\n", err)
+				}
+			}
+		} else if exp == nil {
+			// Default response if no expectation matches
+			rec.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rec, "aduket: no expectation matched for %s %s", r.Method, r.URL.Path)
+		} else {
+			exp.mu.Lock()
+			delay := exp.DelayTime
+			delayMax := exp.DelayMax
+			bodyTime := exp.BodyTime
+			responder := exp.Func
+			ctxResponder := exp.CtxFunc
+			headers := exp.Header
+			statusCode := exp.StatusCode
+			body := exp.Body
+			variants := exp.Variants
+			localized := exp.Localized
+			vary := exp.Vary
+			ab := exp.abTest
+			rng := exp.rand
+			mapRequest := exp.RequestMap
+			transform := exp.transform
+			tmpl := exp.template
+			schema := exp.schema
+			bomb := exp.bomb
+			stream := exp.stream
+			webSocket := exp.webSocket
+			fault := exp.fault
+			failure := exp.failure
+			breaker := exp.breaker
+			auth := exp.auth
+			dependency := exp.dependency
+			exp.mu.Unlock()
+
+			if rng == nil {
+				rng = s.rand
+			}
+			failed := false
+			if auth != nil {
+				if f := auth.check(r); f != nil {
+					failed, failure = true, f
+					captured.Tag("unauthorized")
+				}
+			}
+			if breaker != nil && !failed {
+				if wait := breaker.check(receivedAt); wait > 0 {
+					failed, failure = true, openFailure(wait)
+					captured.Tag("circuit-open")
+				}
+			}
+			if !failed && failure != nil && rng.Float64() < failure.probability {
+				failed = true
+				captured.Tag("injected-failure")
+			}
+			var latency LatencyDistribution
+			if dependency != nil {
+				dist, rate, errorResponse := dependency.settings()
+				latency = dist
+				captured.Tag("dependency:" + dependency.Name)
+				if !failed && rate > 0 && rng.Float64() < rate {
+					failed, failure = true, errorResponse
+					captured.Tag("injected-failure")
+				}
+			}
+			var spike time.Duration
+			if shaper != nil {
+				inSpike, inBurst := shaper.state(receivedAt, s.rand)
+				if inSpike {
+					spike = shaper.shape.SpikeLatency
+					captured.Tag("latency-spike")
+				}
+				if inBurst && !failed {
+					failed, failure = true, shaper.failure
+					captured.Tag("error-burst")
+				}
+			}
+			if len(variants) > 0 {
+				statusCode, headers, body = applyVariant(pickVariant(variants, rng), headers)
+			}
+			if ab != nil && len(ab.names) > 0 {
+				name, v := ab.pick(r, rng)
+				captured.Tag("ab:" + name)
+				statusCode, headers, body = applyVariant(v, headers)
+			}
+			if localized != nil {
+				lang, localizedBody := pickLanguage(r.Header.Get("Accept-Language"), localized)
+				headers = headers.Clone()
+				if headers == nil {
+					headers = make(http.Header)
+				}
+				if lang != "" {
+					headers.Set("Content-Language", lang)
 				}
+				headers.Add("Vary", "Accept-Language")
+				body = []byte(localizedBody)
+			}
+			if len(vary) > 0 {
+				statusCode, headers, body = applyVary(vary, r, statusCode, headers, body)
+			}
+			if schema != nil {
+				generated, err := json.Marshal(schema.generate(rng, 0))
+				if err != nil {
+					panic(err)
+				}
+				body = generated
+			}
+
+			// The server lock is not held from here on so that slow or
+			// long-lived responders do not block other requests.
+			delay = randomDelay(rng, delay, delayMax) + spike
+			if latency != nil {
+				delay += rng.sample(latency)
+			}
+			if delay > 0 && !sleepContext(r.Context(), delay) {
+				captured.ClientAborted = true
+			}
 
-				// Handle function responder
-				if responder != nil {
-					responder(w, r)
-					return
+			if mapRequest != nil {
+				if mapped := mapRequest(r); mapped != nil {
+					r = mapped
 				}
+			}
 
-				// Handle headers
-				for k, vv := range headers {
-					for _, v := range vv {
-						w.Header().Add(k, v)
-					}
+			// A body that cannot be rendered is answered with 500 and still
+			// recorded.
+			var bodyErr error
+			if tmpl != nil && !failed {
+				body, bodyErr = s.renderTemplate(tmpl, r, bodyBytes, params)
+				if bodyErr != nil {
+					bodyErr = fmt.Errorf("template error: %v", bodyErr)
+				}
+			}
+			if transform != nil && !failed && bodyErr == nil {
+				body, bodyErr = applyTransform(transform, body)
+				if bodyErr != nil {
+					bodyErr = fmt.Errorf("transform error: %v", bodyErr)
 				}
+			}
 
-				w.WriteHeader(statusCode)
-				w.Write(body)
-				s.Requests = append(s.Requests, captured)
-				return
+			switch {
+			case captured.ClientAborted:
+				// Nobody is left to respond to.
+				faulted = true
+			case bodyErr != nil:
+				rec.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(rec, "aduket: %v", bodyErr)
+			case failed:
+				addHeaders(rec.Header(), failure.header)
+				rec.WriteHeader(failure.status)
+				rec.Write(failure.body)
+			case ctxResponder != nil:
+				ctx := Ctx{
+					Context:     r.Context(),
+					Server:      s,
+					Expectation: exp,
+					Params:      params,
+				}
+				ctxResponder(ctx, rec, r)
+			case responder != nil:
+				responder(rec, r)
+			case fault != 0:
+				faulted = true
+				if !fault.apply(w) {
+					// HTTP/2 streams cannot be hijacked, abort them instead.
+					aborted = true
+				}
+			case webSocket != nil:
+				webSocket.serve(s, rec, r, captured)
+			case stream != nil:
+				addHeaders(rec.Header(), headers)
+				aborted = stream.write(rec, r, statusCode)
+			case bomb != nil:
+				addHeaders(rec.Header(), headers)
+				rec.discard = true
+				bomb.write(rec, statusCode, rng)
+			default:
+				addHeaders(rec.Header(), headers)
+				if autoContentType && len(body) > 0 && rec.Header().Get("Content-Type") == "" {
+					rec.Header().Set("Content-Type", inferContentType(body))
+				}
+				if bodyTime > 0 {
+					writeSlowly(rec, r, statusCode, body, bodyTime)
+					break
+				}
+				if len(body) > 0 && rec.Header().Get("Content-Length") == "" {
+					rec.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				}
+				rec.WriteHeader(statusCode)
+				rec.Write(body)
 			}
 		}
 
-		// Default response if no expectation matches
-		captured.StatusCode = http.StatusNotFound
-		captured.ResponseBody = []byte(fmt.Sprintf("aduket: no expectation matched for %s %s", r.Method, r.URL.Path))
-
-		if s.OnRequest != nil {
-			s.OnRequest(captured)
+		captured.StatusCode = rec.statusCode()
+		if faulted {
+			captured.StatusCode = 0
+		}
+		captured.ResponseBody = rec.body.Bytes()
+		captured.ResponseHeader = rec.Header().Clone()
+		captured.RespondedAt = time.Now()
+
+		s.record(captured)
+		if aborted {
+			// Drops the connection without finishing the response.
+			panic(http.ErrAbortHandler)
 		}
-
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "%s", captured.ResponseBody)
-		s.Requests = append(s.Requests, captured)
 	})
 }
 
-// Listen starts the server on a specific TCP address.
-func (s *Server) Listen(addr string) error {
+// addHeaders adds all values of src to dst.
+func addHeaders(dst, src http.Header) {
+	for k, vv := range src {
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// Clone returns a new unstarted server with copies of the expectations and
+// settings of s. Recorded requests and match counters are not copied.
+func (s *Server) Clone() *Server {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.Server != nil {
-		s.Server.Close()
+	c := NewUnstartedServer()
+	c.Name = s.Name
+	c.MaxRequestBodySize = s.MaxRequestBodySize
+	c.MaxHeaders = s.MaxHeaders
+	c.MaxURLLength = s.MaxURLLength
+	c.RetryWindow = s.RetryWindow
+	c.AllowedMethods = append([]string(nil), s.AllowedMethods...)
+	c.Upgrader = s.Upgrader
+	c.rand = s.rand.clone()
+	c.autoContentType = s.autoContentType
+	c.methodOverride = s.methodOverride
+	c.partitionHeader = s.partitionHeader
+	c.continueDelay = s.continueDelay
+	c.continueStatus = s.continueStatus
+	c.conversationKey = s.conversationKey
+	c.verboseFailures = s.verboseFailures
+	c.compressHistory = s.compressHistory
+	c.clientCAs = s.clientCAs
+	if s.jwtKey != nil {
+		c.jwtKey = s.jwtKey
+		c.handleInternal(JWKSPath, serveJWKS(s.jwtKey))
 	}
-
-	l, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
+	c.maxRequests = s.maxRequests
+	c.discardBodies = s.discardBodies
+	for _, v := range s.versions {
+		c.versions = append(c.versions, &VersionGroup{server: c, prefix: v.prefix, fallback: v.fallback})
 	}
-
-	s.Server = httptest.NewUnstartedServer(s.handler())
-	s.Server.Listener = l
-	s.Server.Start()
-	return nil
-}
-
-// matchExpectation internally checks if a request matches an expectation.
-func matchExpectation(exp *Expectation, r *http.Request) bool {
-	exp.mu.Lock()
-	defer exp.mu.Unlock()
-	if exp.Method != "" && exp.Method != r.Method {
-		return false
+	if s.defaultExp != nil {
+		c.defaultExp = s.defaultExp.clone()
 	}
-	if exp.Path != "" && exp.Path != r.URL.Path {
-		return false
+	if s.shaper != nil {
+		c.shaper = newShaper(s.shaper.shape)
 	}
-	if exp.Times > 0 && exp.MatchedTimes >= exp.Times {
-		return false
+	c.chaos = s.chaos
+	if s.chaosProfiles != nil {
+		c.chaosProfiles = make(map[string]TrafficShape, len(s.chaosProfiles))
+		for name, shape := range s.chaosProfiles {
+			c.chaosProfiles[name] = shape
+		}
 	}
-
-	// Match Query Params
-	if len(exp.QueryParams) > 0 {
-		query := r.URL.Query()
-		for k, v := range exp.QueryParams {
-			if query.Get(k) != v {
-				return false
-			}
+	for _, call := range s.jsonrpc {
+		c.jsonrpc = append(c.jsonrpc, call.clone())
+	}
+	for _, exp := range s.Expectations {
+		cloned := exp.clone()
+		if cloned.scenario != nil {
+			cloned.scenario = c.scenario(cloned.scenario.Name)
 		}
+		if cloned.dependency != nil {
+			cloned.dependency = cloned.dependency.copyTo(c)
+		}
+		if s.health != nil && exp == s.health.exp {
+			c.health = s.health.clone(cloned)
+		}
+		c.Expectations = append(c.Expectations, cloned)
 	}
-
-	return true
+	return c
 }
 
-// Expect registers a new expectation.
+// Expect registers a new expectation. Path segments written as {name} match
+// any value and are made available to responders as path parameters.
 func (s *Server) Expect(method, path string) *Expectation {
-	if method == "" {
-		panic("aduket: method cannot be empty")
-	}
+	exp := newExpectation(method, path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Expectations = append(s.Expectations, exp)
+	return exp
+}
 
+// Default returns the expectation answering requests that match no other
+// expectation, in place of the built-in 404, e.g.
+//
+//	s.Default().Response(503, "maintenance")
+//
+// It starts as an empty 404 and supports the same responses as other
+// expectations. Requests it answers still count as unmatched, and a proxy
+// set with ProxyTo takes precedence over it. Reset and ResetExpectations
+// restore the built-in 404.
+func (s *Server) Default() *Expectation {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	exp := &Expectation{
+	if s.defaultExp == nil {
+		s.defaultExp = &Expectation{
+			StatusCode: http.StatusNotFound,
+			Header:     make(http.Header),
+			builtin:    true,
+		}
+	}
+	return s.defaultExp
+}
+
+// MethodAny is the method of expectations matching every request method,
+// see ExpectAny.
+const MethodAny = "ANY"
+
+// ExpectAny registers an expectation matching path with any method, the
+// same as Expect(MethodAny, path). Expectations for a specific method win
+// over it, see Expectation.Priority.
+func (s *Server) ExpectAny(path string) *Expectation {
+	return s.Expect(MethodAny, path)
+}
+
+// newExpectation creates an expectation without registering it.
+func newExpectation(method, path string) *Expectation {
+	if method == "" {
+		panic("aduket: method cannot be empty")
+	}
+	return &Expectation{
 		Method: method,
 		Path:   path,
 		Header: make(http.Header),
 	}
-	s.Expectations = append(s.Expectations, exp)
-	return exp
 }
 
 // Verify checks if all registered expectations were met.
 func (s *Server) Verify(t *testing.T) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
+	var failures []string
 	for _, exp := range s.Expectations {
+		if exp.builtin {
+			continue
+		}
 		if exp.MatchedTimes == 0 {
-			t.Errorf("expected %s %s to be called, but it was not", exp.Method, exp.Path)
+			failures = append(failures, fmt.Sprintf("expected %s %s to be called, but it was not", exp.Method, exp.Path))
 		} else if exp.Times > 0 && exp.MatchedTimes < exp.Times {
-			t.Errorf("expected %s %s to be called %d times, but it was called %d times", exp.Method, exp.Path, exp.Times, exp.MatchedTimes)
+			failures = append(failures, fmt.Sprintf("expected %s %s to be called %d times, but it was called %d times", exp.Method, exp.Path, exp.Times, exp.MatchedTimes))
+		}
+	}
+	for _, call := range s.jsonrpc {
+		if call.matchedTimes() == 0 {
+			failures = append(failures, fmt.Sprintf("expected JSON-RPC method %s to be called, but it was not", call.Method))
 		}
 	}
+	reqs := append([]*CapturedRequest(nil), s.Requests...)
+	s.mu.Unlock()
+
+	for _, failure := range failures {
+		s.errorf(t, reqs, "%s", failure)
+	}
 }
 
 // Reset clears all expectations and recorded requests.
@@ -255,6 +641,79 @@ func (s *Server) Reset() {
 
 	s.Expectations = make([]*Expectation, 0)
 	s.Requests = make([]*CapturedRequest, 0)
+	s.requestCount, s.unmatchedCount = 0, 0
+	s.historyStart = time.Now()
+	s.defaultExp = nil
+	s.shaper = nil
+	s.chaos = ""
+	s.jsonrpc = nil
+	s.health = nil
+	s.failures = nil
+	s.versions = nil
+	s.scenarios = nil
+	s.dependencies = nil
+}
+
+// ResetRequests clears the recorded requests and the match counters of all
+// expectations, and moves every scenario back to its start, while keeping the
+// expectations themselves registered.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Requests = make([]*CapturedRequest, 0)
+	s.requestCount, s.unmatchedCount = 0, 0
+	s.historyStart = time.Now()
+	for _, exp := range s.Expectations {
+		exp.mu.Lock()
+		exp.MatchedTimes = 0
+		if exp.breaker != nil {
+			exp.breaker.reset()
+		}
+		exp.mu.Unlock()
+	}
+	for _, sc := range s.scenarios {
+		sc.Reset()
+	}
+	for _, call := range s.jsonrpc {
+		call.mu.Lock()
+		call.MatchedTimes = 0
+		call.mu.Unlock()
+	}
+}
+
+// ResetExpectations removes all expectations but keeps the recorded requests.
+func (s *Server) ResetExpectations() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Expectations = make([]*Expectation, 0)
+	s.defaultExp = nil
+	s.jsonrpc = nil
+	s.health = nil
+}
+
+// ResetExpectation removes the expectations identified by name. The name is
+// compared against the one given to Named or, for unnamed expectations,
+// against "METHOD path". It reports whether anything was removed.
+func (s *Server) ResetExpectation(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Build a new slice instead of filtering in place so that callers holding
+	// the previous slice are not affected.
+	kept := make([]*Expectation, 0, len(s.Expectations))
+	for _, exp := range s.Expectations {
+		exp.mu.Lock()
+		id := exp.id()
+		exp.mu.Unlock()
+		if id != name {
+			kept = append(kept, exp)
+		}
+	}
+	removed := len(kept) != len(s.Expectations)
+	s.Expectations = kept
+	return removed
 }
 
 // RequestCount returns the total number of requests received.
@@ -276,36 +735,44 @@ func (s *Server) GetRequest(i int) *CapturedRequest {
 
 // AssertCalled checks if an expectation for method and path was matched at least once.
 func (s *Server) AssertCalled(t *testing.T, method, path string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	for _, exp := range s.Expectations {
-		if exp.Method == method && exp.Path == path && exp.MatchedTimes > 0 {
-			return
-		}
+	if s.matchedTimes(method, path) > 0 {
+		return
 	}
-	t.Errorf("expected %s %s to be called, but it was not", method, path)
+	s.errorf(t, s.requestsSnapshot(), "expected %s %s to be called, but it was not", method, path)
 }
 
 // AssertNotCalled checks if an expectation for method and path was never matched.
 func (s *Server) AssertNotCalled(t *testing.T, method, path string) {
+	if n := s.matchedTimes(method, path); n > 0 {
+		var reqs []*CapturedRequest
+		for _, req := range s.requestsSnapshot() {
+			if req.matchesRoute(method, path) {
+				reqs = append(reqs, req)
+			}
+		}
+		s.errorf(t, reqs, "expected %s %s NOT to be called, but it was matched %d times", method, path, n)
+	}
+}
+
+// matchedTimes returns the match count of the first expectation for method
+// and path that was matched.
+func (s *Server) matchedTimes(method, path string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for _, exp := range s.Expectations {
 		if exp.Method == method && exp.Path == path && exp.MatchedTimes > 0 {
-			t.Errorf("expected %s %s NOT to be called, but it was matched %d times", method, path, exp.MatchedTimes)
-			return
+			return exp.MatchedTimes
 		}
 	}
+	return 0
 }
 
 // AssertRequestCount checks if the total number of requests matches expected count.
 func (s *Server) AssertRequestCount(t *testing.T, count int) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if len(s.Requests) != count {
-		t.Errorf("expected %d requests, got %d", count, len(s.Requests))
+	reqs := s.requestsSnapshot()
+	if len(reqs) != count {
+		s.errorf(t, reqs, "expected %d requests, got %d", count, len(reqs))
 	}
 }
 
@@ -313,19 +780,19 @@ func (s *Server) AssertRequestCount(t *testing.T, count int) {
 func (s *Server) AssertRequestBodyJSON(t *testing.T, i int, expected interface{}) {
 	req := s.GetRequest(i)
 	if req == nil {
-		t.Fatalf("request index %d not found", i)
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
 	}
 
 	var actual interface{}
-	if err := json.Unmarshal(req.BodyContent, &actual); err != nil {
-		t.Fatalf("failed to unmarshal request body: %v", err)
+	if err := json.Unmarshal(req.RequestBodyBytes(), &actual); err != nil {
+		s.fatalf(t, []*CapturedRequest{req}, "failed to unmarshal request body: %v", err)
 	}
 
-	expectedJSON, _ := json.Marshal(expected)
-	actualJSON, _ := json.Marshal(actual)
+	expectedJSON, _ := json.MarshalIndent(expected, "", "  ")
+	actualJSON, _ := json.MarshalIndent(actual, "", "  ")
 
 	if !bytes.Equal(expectedJSON, actualJSON) {
-		t.Errorf("expected body %s, got %s", string(expectedJSON), string(actualJSON))
+		s.errorf(t, []*CapturedRequest{req}, "request body mismatch:\n%s", unifiedDiff(string(expectedJSON), string(actualJSON), colorDiffs))
 	}
 }
 
@@ -338,12 +805,12 @@ func (s *Server) Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Con
 func (s *Server) AssertHeader(t *testing.T, i int, key, value string) {
 	req := s.GetRequest(i)
 	if req == nil {
-		t.Fatalf("request index %d not found", i)
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
 	}
 
 	actual := req.Header.Get(key)
 	if actual != value {
-		t.Errorf("expected header %s: %s, got %s", key, value, actual)
+		s.errorf(t, []*CapturedRequest{req}, "expected header %s: %s, got %s", key, value, actual)
 	}
 }
 
@@ -351,11 +818,11 @@ func (s *Server) AssertHeader(t *testing.T, i int, key, value string) {
 func (s *Server) AssertQueryParam(t *testing.T, i int, key, value string) {
 	req := s.GetRequest(i)
 	if req == nil {
-		t.Fatalf("request index %d not found", i)
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
 	}
 
 	actual := req.URL.Query().Get(key)
 	if actual != value {
-		t.Errorf("expected query param %s: %s, got %s", key, value, actual)
+		s.errorf(t, []*CapturedRequest{req}, "expected query param %s: %s, got %s", key, value, actual)
 	}
 }
@@ -0,0 +1,157 @@
+package aduket
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdminAPI(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.EnableAdminAPI()
+	s.Health()
+	s.Expect("GET", "/existing").Response(http.StatusOK, "old")
+	admin := s.URL + AdminPath + "/expectations"
+
+	resp, err := http.Post(admin, "application/json", strings.NewReader(
+		`[{"name":"users","method":"GET","path":"/users","status":200,"body":"[]"},{"method":"POST","path":"/users","status":201}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(s.URL + "/users")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "[]" {
+		t.Errorf("expected created expectation to be served, got %d %q", resp.StatusCode, body)
+	}
+
+	resp, _ = http.Get(admin)
+	var listed []map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if len(listed) != 3 {
+		t.Errorf("expected 3 listed expectations without the health check, got %d", len(listed))
+	}
+
+	req, _ := http.NewRequest("DELETE", admin+"?name=users", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", resp.StatusCode)
+	}
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for removed expectation, got %d", resp.StatusCode)
+	}
+	req, _ = http.NewRequest("DELETE", admin+"?name=GET%20/health", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for the health check, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("DELETE", admin, nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if exps := s.userExpectations(); len(exps) != 0 {
+		t.Errorf("expected all expectations removed, got %d", len(exps))
+	}
+	if resp, _ := http.Get(s.URL + "/health"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected health check to survive, got %d", resp.StatusCode)
+	}
+
+	if s.RequestCount() != 2 {
+		t.Errorf("expected admin requests not to be recorded, got %d requests", s.RequestCount())
+	}
+}
+
+func TestAdminAPIErrors(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.EnableAdminAPI()
+	admin := s.URL + AdminPath + "/expectations"
+
+	for _, body := range []string{`{"path":"/x"}`, `not json`, `[null]`} {
+		resp, _ := http.Post(admin, "application/json", strings.NewReader(body))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest("PUT", admin, nil)
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") == "" {
+		t.Errorf("expected 405 with Allow, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminChaos(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.EnableAdminAPI()
+	s.Expect("GET", "/orders").Response(http.StatusOK, "ok")
+	s.AddChaosProfile("teapot", TrafficShape{BurstProbability: 1, BurstStatus: http.StatusTeapot})
+	chaos := s.URL + AdminPath + "/chaos"
+
+	put := func(body string) (int, chaosState) {
+		req, _ := http.NewRequest(http.MethodPut, chaos, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var state chaosState
+		json.NewDecoder(resp.Body).Decode(&state)
+		return resp.StatusCode, state
+	}
+	status := func() int {
+		resp, err := http.Get(s.URL + "/orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code, state := put(`{"profile": "outage"}`); code != http.StatusOK || state.Active != "outage" || len(state.Profiles) != 5 {
+		t.Fatalf("unexpected chaos state %d %+v", code, state)
+	}
+	if got := status(); got != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 during an outage, got %d", got)
+	}
+	if code, _ := put(`{"profile": "meteor"}`); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown profile, got %d", code)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, chaos, nil)
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if got := status(); got != http.StatusOK || s.ActiveChaos() != ChaosOff {
+		t.Errorf("expected chaos off, got %d with %s", got, s.ActiveChaos())
+	}
+
+	// Cycling visits every profile in name order, then turns chaos off.
+	var visited []string
+	for i := 0; i < 6; i++ {
+		visited = append(visited, s.NextChaos())
+	}
+	if strings.Join(visited, ",") != "degraded,flaky,outage,slow,teapot,off" {
+		t.Errorf("unexpected chaos cycle %v", visited)
+	}
+	s.Chaos("teapot")
+	s.Shape(TrafficShape{})
+	if s.ActiveChaos() != ChaosOff {
+		t.Errorf("expected Shape to replace the chaos profile, got %s", s.ActiveChaos())
+	}
+}
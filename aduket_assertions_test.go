@@ -0,0 +1,291 @@
+package aduket
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssertCalledBefore(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("POST", "/auth").Response(http.StatusOK, "token")
+	s.Expect("GET", "/data/{id}").Response(http.StatusOK, "data")
+
+	http.Post(s.URL+"/auth", "text/plain", nil)
+	http.Get(s.URL + "/data/1")
+	http.Get(s.URL + "/data/2")
+
+	s.AssertCalledBefore(t, "POST /auth", "GET /data/{id}")
+	s.AssertSequence(t, []string{"POST /auth", "GET /data/1", "GET /data/2"})
+
+	mockT := &testing.T{}
+	s.AssertCalledBefore(mockT, "GET /data/{id}", "POST /auth")
+	if !mockT.Failed() {
+		t.Error("expected reversed ordering to fail")
+	}
+
+	mockT = &testing.T{}
+	s.AssertSequence(mockT, []string{"GET /data/2", "GET /data/1"})
+	if !mockT.Failed() {
+		t.Error("expected out of order sequence to fail")
+	}
+}
+
+func TestTimeWindowAssertions(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/ping").Response(http.StatusOK, "pong")
+	http.Get(s.URL + "/ping")
+	s.AssertCalledWithin(t, "GET", "/ping", time.Second)
+
+	cutoff := time.Now()
+	s.AssertNoRequestsAfter(t, cutoff)
+
+	time.Sleep(10 * time.Millisecond)
+	http.Get(s.URL + "/ping")
+	mockT := &testing.T{}
+	s.AssertNoRequestsAfter(mockT, cutoff)
+	if !mockT.Failed() {
+		t.Error("expected request after cutoff to fail the assertion")
+	}
+
+	s.ResetRequests()
+	time.Sleep(20 * time.Millisecond)
+	http.Get(s.URL + "/ping")
+	mockT = &testing.T{}
+	s.AssertCalledWithin(mockT, "GET", "/ping", 5*time.Millisecond)
+	if !mockT.Failed() {
+		t.Error("expected late call to fail the assertion")
+	}
+}
+
+func TestRetriesFor(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("POST", "/pay").Response(http.StatusServiceUnavailable, "busy")
+
+	wait := 10 * time.Millisecond
+	for i := 0; i < 4; i++ {
+		http.Post(s.URL+"/pay", "application/json", strings.NewReader(`{"amount":1}`))
+		time.Sleep(wait)
+		wait *= 2
+	}
+	http.Post(s.URL+"/pay", "application/json", strings.NewReader(`{"amount":2}`))
+
+	retries := s.RetriesFor("POST", "/pay")
+	if len(retries) != 3 {
+		t.Fatalf("expected 3 retries, got %d", len(retries))
+	}
+	if retries[0].Attempt != 1 || retries[2].Attempt != 3 {
+		t.Errorf("unexpected attempt numbers: %d, %d", retries[0].Attempt, retries[2].Attempt)
+	}
+
+	s.AssertExponentialBackoff(t, "POST", "/pay", 2, 0.5)
+
+	mockT := &testing.T{}
+	s.AssertExponentialBackoff(mockT, "GET", "/never", 2, 0.5)
+	if !mockT.Failed() {
+		t.Error("expected assertion to fail without retries")
+	}
+}
+
+func TestAssertNoDuplicateRequests(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("POST", "/orders").Response(http.StatusCreated, "created")
+
+	send := func(key, body string) {
+		req, _ := http.NewRequest("POST", s.URL+"/orders", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		http.DefaultClient.Do(req)
+	}
+	send("a", `{"item":1}`)
+	send("b", `{"item":2}`)
+	send("", `{"item":3}`)
+
+	s.AssertNoDuplicateRequests(t, HeaderKey("Idempotency-Key"))
+	s.AssertNoDuplicateRequests(t, BodyKey())
+
+	send("a", `{"item":1}`)
+	mockT := &testing.T{}
+	s.AssertNoDuplicateRequests(mockT, HeaderKey("Idempotency-Key"))
+	if !mockT.Failed() {
+		t.Error("expected duplicate idempotency key to be flagged")
+	}
+}
+
+func TestVerboseFailures(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("POST", "/orders").Response(http.StatusCreated, "")
+	req, _ := http.NewRequest("POST", s.URL+"/orders?dry=1", strings.NewReader(`{"sku":"abc"}`))
+	req.Header.Set("X-Tenant", "acme")
+	http.DefaultClient.Do(req)
+
+	reqs := s.requestsSnapshot()
+	if msg := s.failure(reqs, "expected %d requests", 2); msg != "expected 2 requests" {
+		t.Errorf("expected plain message, got %q", msg)
+	}
+
+	s.VerboseFailures(true)
+	msg := s.failure(reqs, "expected %d requests", 2)
+	for _, want := range []string{"expected 2 requests", "POST /orders?dry=1 -> 201", "X-Tenant: acme", `{"sku":"abc"}`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected dump to contain %q, got:\n%s", want, msg)
+		}
+	}
+
+	http.Post(s.URL+"/orders", "text/plain", strings.NewReader(strings.Repeat("x", 2*maxDumpedBody)))
+	msg = s.failure(s.requestsSnapshot()[1:], "failed")
+	if !strings.Contains(msg, fmt.Sprintf("(%d bytes truncated)", maxDumpedBody)) {
+		t.Errorf("expected truncated body, got:\n%s", msg)
+	}
+
+	mockT := &testing.T{}
+	s.AssertRequestCount(mockT, 3)
+	if !mockT.Failed() {
+		t.Error("expected AssertRequestCount to fail")
+	}
+}
+
+func TestMergeHistory(t *testing.T) {
+	orders := NewServer()
+	defer orders.Close()
+	orders.Name = "orders"
+	payments := NewServer()
+	defer payments.Close()
+	payments.Name = "payments"
+	orders.Expect("POST", "/orders").Response(http.StatusCreated, "")
+	orders.Expect("GET", "/orders/{id}").Response(http.StatusOK, "")
+	payments.Expect("POST", "/charges").Response(http.StatusOK, "")
+
+	for _, call := range []struct {
+		s            *Server
+		method, path string
+	}{
+		{orders, "POST", "/orders"},
+		{payments, "POST", "/charges"},
+		{orders, "GET", "/orders/1"},
+	} {
+		req, _ := http.NewRequest(call.method, call.s.URL+call.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	h := MergeHistory(payments, orders)
+	if got := h.String(); got != "orders POST /orders\npayments POST /charges\norders GET /orders/1\n" {
+		t.Errorf("unexpected merged history:\n%s", got)
+	}
+	if h[1].Server != payments {
+		t.Error("expected requests to reference their server")
+	}
+	h.AssertSequence(t, []string{"orders POST /orders", "payments POST /charges", "orders GET /orders/{id}"})
+
+	mockT := &testing.T{}
+	h.AssertSequence(mockT, []string{"payments POST /charges", "orders POST /orders"})
+	if !mockT.Failed() {
+		t.Error("expected out of order steps to fail")
+	}
+}
+
+func TestAssertHappenedBefore(t *testing.T) {
+	orders := NewServer()
+	defer orders.Close()
+	payments := NewServer()
+	defer payments.Close()
+	orders.Expect("POST", "/orders").Delay(200*time.Millisecond).Response(http.StatusCreated, "")
+	payments.Expect("POST", "/charges").Response(http.StatusOK, "")
+	payments.Expect("POST", "/refunds").Response(http.StatusOK, "")
+
+	post := func(url string) {
+		resp, err := http.Post(url, "application/json", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		post(orders.URL + "/orders")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	post(payments.URL + "/charges")
+	<-done
+	post(payments.URL + "/refunds")
+
+	order, charge, refund := orders.Find("POST /orders"), payments.Find("POST /charges"), payments.Find("POST /refunds")
+	AssertHappenedBefore(t, charge, order)
+	AssertCompletedBefore(t, order, refund)
+
+	mockT := &testing.T{}
+	AssertCompletedBefore(mockT, order, charge)
+	if !mockT.Failed() {
+		t.Error("expected overlapping requests to fail AssertCompletedBefore")
+	}
+	mockT = &testing.T{}
+	AssertHappenedBefore(mockT, refund, order)
+	if !mockT.Failed() {
+		t.Error("expected a later request to fail AssertHappenedBefore")
+	}
+	mockT = &testing.T{}
+	AssertHappenedBefore(mockT, payments.Find("GET /missing"), order)
+	if !mockT.Failed() {
+		t.Error("expected a missing request to fail")
+	}
+}
+
+func TestFormAssertions(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("POST", "/upload").Response(http.StatusOK, "")
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "holiday")
+	fw, _ := mw.CreateFormFile("photo", "beach.jpg")
+	fw.Write([]byte("jpeg bytes"))
+	mw.Close()
+	http.Post(s.URL+"/upload", mw.FormDataContentType(), &body)
+	http.PostForm(s.URL+"/upload", url.Values{"tags": {"sea", "sun"}})
+
+	s.AssertFormField(t, 0, "title", "holiday")
+	s.AssertUploadedFile(t, 0, "photo", "beach.jpg", []byte("jpeg bytes"))
+	s.AssertFormField(t, 1, "tags", "sun")
+
+	files, err := s.GetRequest(0).FormFiles()
+	if err != nil || len(files) != 1 || files[0].ContentType != "application/octet-stream" {
+		t.Errorf("unexpected files %+v, %v", files, err)
+	}
+
+	for name, assert := range map[string]func(*testing.T){
+		"wrong value":   func(mockT *testing.T) { s.AssertFormField(mockT, 0, "title", "work") },
+		"missing field": func(mockT *testing.T) { s.AssertFormField(mockT, 0, "author", "me") },
+		"wrong content": func(mockT *testing.T) { s.AssertUploadedFile(mockT, 0, "photo", "beach.jpg", []byte("png")) },
+		"wrong field":   func(mockT *testing.T) { s.AssertUploadedFile(mockT, 0, "avatar", "beach.jpg", []byte("jpeg bytes")) },
+		"not multipart": func(mockT *testing.T) { s.AssertUploadedFile(mockT, 1, "photo", "beach.jpg", nil) },
+	} {
+		mockT := &testing.T{}
+		assert(mockT)
+		if !mockT.Failed() {
+			t.Errorf("%s: expected assertion to fail", name)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package aduket
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestResponseBomb(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	const size = 10 << 20
+	s.Expect("GET", "/garbage").ResponseBomb(size, false)
+	s.Expect("GET", "/zip").ResponseBomb(size, true)
+
+	resp, err := http.Get(s.URL + "/garbage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if n != size || resp.ContentLength != size {
+		t.Errorf("expected %d bytes, got %d (Content-Length %d)", size, n, resp.ContentLength)
+	}
+
+	// Ask for gzip explicitly so the transport does not inflate the body.
+	req, _ := http.NewRequest("GET", s.URL+"/zip", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if enc := resp.Header.Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("expected gzip encoding, got %q", enc)
+	}
+	compressed, _ := io.ReadAll(resp.Body)
+	if len(compressed) > size/100 {
+		t.Errorf("expected a highly compressed body, got %d bytes", len(compressed))
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := io.Copy(io.Discard, zr); n != size {
+		t.Errorf("expected body to inflate to %d bytes, got %d", size, n)
+	}
+
+	for i := 0; i < 2; i++ {
+		if body := s.GetRequest(i).ResponseBody; len(body) != 0 {
+			t.Errorf("expected bomb body not to be recorded, got %d bytes", len(body))
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package aduket
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	RegisterCodec("text/x-aduket-lines", func(body []byte) (interface{}, error) {
+		return strings.Split(strings.TrimSpace(string(body)), "\n"), nil
+	})
+
+	s := NewServer()
+	defer s.Close()
+	s.Expect("POST", "/msgpack").
+		TemplateResponse(http.StatusOK, `{{index .Decoded "name"}}`)
+	s.Expect("POST", "/protobuf").
+		Response(http.StatusOK, "\x0a\x02ok").
+		Headers(map[string]string{"Content-Type": "application/x-protobuf"})
+	s.Expect("POST", "/lines").Response(http.StatusOK, "")
+
+	post := func(path, contentType string, body []byte) string {
+		resp, err := http.Post(s.URL+path, contentType, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return string(out)
+	}
+
+	// {"name": "bob", "tags": [1, -2], "ok": true}
+	msgpack := []byte("\x83\xa4name\xa3bob\xa4tags\x92\x01\xfe\xa2ok\xc3")
+	if got := post("/msgpack", "application/msgpack", msgpack); got != "bob" {
+		t.Errorf("expected template to read the decoded body, got %q", got)
+	}
+	s.AssertDecodedBody(t, 0, map[string]interface{}{"name": "bob", "tags": []int{1, -2}, "ok": true})
+
+	// Field 1 = 150, field 2 = "hi", field 3 = {1: 1}, field 4 repeated.
+	protobuf := []byte("\x08\x96\x01\x12\x02hi\x1a\x02\x08\x01\x20\x01\x20\x02")
+	post("/protobuf", "application/x-protobuf", protobuf)
+	s.AssertDecodedBody(t, 1, map[string]interface{}{
+		"1": 150,
+		"2": "hi",
+		"3": map[string]interface{}{"1": 1},
+		"4": []int{1, 2},
+	})
+	resp, err := s.GetRequest(1).DecodedResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normalizedJSON(resp) != normalizedJSON(map[string]string{"1": "ok"}) {
+		t.Errorf("unexpected decoded response %v", resp)
+	}
+
+	post("/lines", "text/x-aduket-lines; charset=utf-8", []byte("a\nb\n"))
+	s.AssertDecodedBody(t, 2, []string{"a", "b"})
+
+	if _, err := decodeBody("application/octet-stream", []byte("x")); err == nil {
+		t.Error("expected unknown content types not to decode")
+	}
+	if _, err := decodeMsgpack([]byte("\xa5ab")); err == nil {
+		t.Error("expected truncated MessagePack to fail")
+	}
+	if _, err := decodeProtobufWire([]byte("\x12\x05hi")); err == nil {
+		t.Error("expected truncated protobuf to fail")
+	}
+	if v, err := decodeBody("application/problem+json", []byte(`{"a":1}`)); err != nil || v.(map[string]interface{})["a"] != 1.0 {
+		t.Errorf("expected +json types to decode as JSON, got %v, %v", v, err)
+	}
+}
+
+func TestBinaryResponses(t *testing.T) {
+	type reading struct {
+		Sensor string    `json:"sensor"`
+		Values []float64 `json:"values"`
+		Count  int       `json:"count"`
+		Raw    []byte    `json:"-"`
+	}
+
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/msgpack").MsgpackResponse(map[string]interface{}{"a": 1})
+	s.Expect("GET", "/cbor").CBORResponse(map[string]interface{}{"a": 1})
+	s.Expect("GET", "/msgpack/struct").MsgpackResponse(reading{Sensor: "t1", Values: []float64{1.5, -300}, Count: 70000})
+	s.Expect("GET", "/cbor/struct").CBORResponse(reading{Sensor: "t1", Values: []float64{1.5, -300}, Count: 70000})
+
+	get := func(path string) (string, []byte) {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200 for %s, got %d", path, resp.StatusCode)
+		}
+		return resp.Header.Get("Content-Type"), body
+	}
+
+	if ct, body := get("/msgpack"); ct != "application/msgpack" || string(body) != "\x81\xa1a\x01" {
+		t.Errorf("unexpected MessagePack response %q %x", ct, body)
+	}
+	if ct, body := get("/cbor"); ct != "application/cbor" || string(body) != "\xa1aa\x01" {
+		t.Errorf("unexpected CBOR response %q %x", ct, body)
+	}
+
+	want := normalizedJSON(map[string]interface{}{"sensor": "t1", "values": []float64{1.5, -300}, "count": 70000})
+	for i, path := range []string{"/msgpack/struct", "/cbor/struct"} {
+		get(path)
+		decoded, err := s.GetRequest(i + 2).DecodedResponse()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if got := normalizedJSON(decoded); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+
+	// Round trips through every encoded width.
+	values := []interface{}{
+		nil, true, false, int64(-1), int64(-33), int64(-200), int64(-40000), int64(-3000000000),
+		int64(200), int64(40000), int64(3000000000), uint64(1 << 63), 2.5, "héllo",
+		strings.Repeat("s", 300), []byte{1, 2, 3}, make([]interface{}, 20),
+	}
+	formats := []struct {
+		name   string
+		encode func(interface{}) ([]byte, error)
+		decode Codec
+	}{
+		{"msgpack", encodeMsgpack, decodeMsgpack},
+		{"cbor", encodeCBOR, decodeCBOR},
+	}
+	for _, v := range values {
+		for _, f := range formats {
+			data, err := f.encode(v)
+			if err != nil {
+				t.Fatalf("%s: encoding %v: %v", f.name, v, err)
+			}
+			got, err := f.decode(data)
+			if err != nil {
+				t.Fatalf("%s: decoding %v: %v", f.name, v, err)
+			}
+			if normalizedJSON(got) != normalizedJSON(v) {
+				t.Errorf("%s: expected %v to round trip, got %v", f.name, v, got)
+			}
+		}
+	}
+}
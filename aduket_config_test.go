@@ -0,0 +1,259 @@
+package aduket
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+expectations:
+  - name: search
+    method: GET
+    path: /users/{id}
+    query:
+      q: alice
+    status: 200
+    template: '{"id": "{{.Params.id}}", "q": "{{.Request.URL.Query.Get "q"}}"}'
+    headers:
+      Content-Type: application/json
+    delay: 10ms
+    times: 1
+`), 0o644)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := cfg.Rules()
+	if len(rules) != 1 || rules[0].Delay != 10*time.Millisecond || rules[0].Times != 1 || rules[0].Query["q"] != "alice" {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+
+	s := NewServer()
+	defer s.Close()
+	s.ExpectAll(rules)
+
+	resp, err := http.Get(s.URL + "/users/7?q=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"id": "7", "q": "alice"}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response %q", body)
+	}
+	s.Verify(t)
+}
+
+func TestLoadConfigDirectory(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"expectations": [{"method": "GET", "path": "/a", "response": "a", "delay": "1s"}]}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.yml"), []byte("expectations:\n  - {method: GET, path: /b, status: 201}\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644)
+
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := cfg.Rules()
+	if len(rules) != 2 || rules[0].Path != "/a" || rules[0].Delay != time.Second || rules[1].Path != "/b" || rules[1].Status != 201 {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	os.WriteFile(filepath.Join(dir, "c.yaml"), []byte("expectations: [{delay: soon}]"), 0o644)
+	if _, err := LoadConfig(dir); err == nil {
+		t.Error("expected invalid delay to fail")
+	}
+}
+
+func TestLoadConfigInvalidExpectation(t *testing.T) {
+	dir := t.TempDir()
+	for name, tt := range map[string]struct {
+		config string
+		err    string
+	}{
+		"method":    {"expectations:\n  - {path: /a}\n", "expectation 0: method cannot be empty"},
+		"transform": {"expectations:\n  - {method: GET, path: /a}\n  - {method: GET, path: /b, transform: '.items |= ['}\n", "expectation 1: invalid transform"},
+		"template":  {"expectations:\n  - {method: GET, path: /a, template: '{{.Params.id'}\n", "expectation 0: invalid template"},
+	} {
+		path := filepath.Join(dir, name+".yaml")
+		os.WriteFile(path, []byte(tt.config), 0o644)
+		_, err := LoadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error %q naming the file, got %v", name, tt.err, err)
+		}
+	}
+}
+
+func TestWriteConfigResponseFile(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "fixtures"), 0o755)
+	os.WriteFile(filepath.Join(dir, "fixtures", "users.json"), []byte(`[{"id": 1}]`), 0o644)
+	path := filepath.Join(dir, "aduket.yaml")
+	err := WriteConfig(path, &Config{Expectations: []ConfigExpectation{
+		{Name: "list users", Method: "GET", Path: "/users", Status: 200, ResponseFile: "fixtures/users.json", Delay: duration(time.Second)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fixture paths are relative to the config, not the working directory.
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := cfg.Rules()
+	if len(rules) != 1 || rules[0].Name != "list users" || rules[0].Delay != time.Second || rules[0].File != filepath.Join(dir, "fixtures", "users.json") {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+
+	s := NewServer()
+	defer s.Close()
+	s.ExpectAll(rules)
+	resp, err := http.Get(s.URL + "/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `[{"id": 1}]` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected fixture as JSON, got %q (%s)", body, resp.Header.Get("Content-Type"))
+	}
+
+	os.Remove(filepath.Join(dir, "fixtures", "users.json"))
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected missing response file to fail")
+	}
+}
+
+func TestPlayTimeline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	os.WriteFile(path, []byte(`
+phases:
+  - name: healthy
+    duration: 200ms
+    expectations:
+      - {method: GET, path: /orders, status: 200, response: ok}
+  - name: degraded
+    duration: 200ms
+    shape:
+      burstProbability: 1
+      burstBody: down
+  - name: recovered
+`), 0o644)
+
+	tl, err := LoadTimeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tl.Phases) != 3 || time.Duration(tl.Phases[0].Duration) != 200*time.Millisecond {
+		t.Fatalf("unexpected timeline %+v", tl)
+	}
+
+	s := NewServer()
+	defer s.Close()
+	phases := make(chan string, len(tl.Phases))
+	stop := s.Play(tl, func(i int, phase TimelinePhase) {
+		phases <- phase.Name
+	})
+	defer stop()
+
+	get := func() string {
+		resp, err := http.Get(s.URL + "/orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	for _, want := range []struct{ phase, body string }{
+		{"healthy", "ok"},
+		{"degraded", "down"},
+		{"recovered", "ok"},
+	} {
+		if name := <-phases; name != want.phase {
+			t.Fatalf("expected phase %s, got %s", want.phase, name)
+		}
+		if body := get(); body != want.body {
+			t.Errorf("expected %q during %s, got %q", want.body, want.phase, body)
+		}
+	}
+
+	os.WriteFile(path, []byte("phases:\n  - name: forever\n  - name: never\n    duration: 1s\n"), 0o644)
+	if _, err := LoadTimeline(path); err == nil {
+		t.Error("expected error for a phase without duration before the last")
+	}
+}
+
+func TestLoadTimelineInvalidPhase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	for name, tt := range map[string]struct {
+		timeline string
+		err      string
+	}{
+		"probability": {"phases:\n  - name: ok\n    duration: 1s\n  - name: broken\n    shape: {burstProbability: 2}\n", "out of range"},
+		"window":      {"phases:\n  - name: broken\n    shape: {window: -1s}\n", "invalid traffic shape window"},
+		"expectation": {"phases:\n  - name: broken\n    expectations: [{path: /a}]\n", "method cannot be empty"},
+	} {
+		os.WriteFile(path, []byte(tt.timeline), 0o644)
+		_, err := LoadTimeline(path)
+		if err == nil || !strings.Contains(err.Error(), `phase "broken"`) || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected error %q for the broken phase, got %v", name, tt.err, err)
+		}
+	}
+}
+
+func TestWatchConfigInvalidReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aduket.yaml")
+	os.WriteFile(path, []byte("expectations:\n  - {method: GET, path: /a, status: 200, response: a}\n"), 0o644)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer()
+	defer s.Close()
+	s.ExpectAll(cfg.Rules())
+
+	reports := make(chan string, 10)
+	done := make(chan struct{})
+	defer close(done)
+	go watchConfig(s, path, 10*time.Millisecond, func(msg string) { reports <- msg }, done)
+	time.Sleep(50 * time.Millisecond)
+
+	os.WriteFile(path, []byte("expectations:\n  - {method: GET, path: /a, transform: '.items |= ['}\n"), 0o644)
+	select {
+	case msg := <-reports:
+		if !strings.HasPrefix(msg, "config error") {
+			t.Errorf("expected invalid config to be reported, got %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the reload to be reported")
+	}
+	resp, err := http.Get(s.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "a" {
+		t.Errorf("expected the previous expectations to stay, got %q", body)
+	}
+
+	if err := replaceExpectations(s, []Rule{{Path: "/b"}}); err == nil {
+		t.Error("expected a rule without method to be reported")
+	}
+	s.mu.Lock()
+	kept := len(s.Expectations)
+	s.mu.Unlock()
+	if kept != 1 {
+		t.Errorf("expected a failed replace to keep the expectations, got %d", kept)
+	}
+}
@@ -0,0 +1,96 @@
+package aduket
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// continueClient returns a client that waits for 100 Continue before
+// sending request bodies.
+func continueClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+}
+
+func continueRequest(t *testing.T, url, body string) *http.Request {
+	req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Expect", "100-continue")
+	return req
+}
+
+func TestExpectContinue(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("PUT", "/upload").Response(http.StatusCreated, "")
+	s.DelayContinue(50 * time.Millisecond)
+
+	start := time.Now()
+	resp, err := continueClient().Do(continueRequest(t, s.URL+"/upload", "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected 201, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected 100 Continue to be delayed, took %v", elapsed)
+	}
+	req := s.GetRequest(0)
+	if !req.ExpectContinue || string(req.BodyContent) != "data" {
+		t.Errorf("expected captured continue request with body, got %v %q", req.ExpectContinue, req.BodyContent)
+	}
+
+	s.RejectContinue(http.StatusExpectationFailed)
+	resp, err = continueClient().Do(continueRequest(t, s.URL+"/upload", "more"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusExpectationFailed {
+		t.Errorf("expected 417, got %d", resp.StatusCode)
+	}
+	req = s.GetRequest(1)
+	if req.StatusCode != http.StatusExpectationFailed || req.Expectation != nil || len(req.BodyContent) != 0 {
+		t.Errorf("expected rejected request to be captured without body, got %d %q", req.StatusCode, req.BodyContent)
+	}
+
+	// Requests without the header are not affected.
+	resp, _ = http.Post(s.URL+"/upload", "text/plain", strings.NewReader("x"))
+	resp.Body.Close()
+	if s.GetRequest(2).ExpectContinue {
+		t.Error("expected plain request not to be marked")
+	}
+}
+
+func TestRequestTrailers(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("POST", "/upload").Response(http.StatusOK, "")
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("chunked body"))
+		pw.Close()
+	}()
+	req, _ := http.NewRequest("POST", s.URL+"/upload", pr)
+	req.Trailer = http.Header{"X-Checksum": {"abc123"}}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	got := s.GetRequest(0)
+	if got.Trailer.Get("X-Checksum") != "abc123" || string(got.BodyContent) != "chunked body" {
+		t.Errorf("expected trailer to be captured, got %v", got.Trailer)
+	}
+	if stored := got.stored(); stored.Trailer.Get("X-Checksum") != "abc123" {
+		t.Error("expected trailer in stored form")
+	}
+}
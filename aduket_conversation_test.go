@@ -0,0 +1,74 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConversations(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.ThreadBy(HeaderKey("X-Correlation-ID"))
+	s.Expect("POST", "/login").Response(http.StatusOK, "")
+	s.Expect("POST", "/cart").Response(http.StatusOK, "")
+	s.Expect("POST", "/checkout").Response(http.StatusOK, "")
+
+	send := func(id, path, body string) {
+		req, _ := http.NewRequest("POST", s.URL+path, strings.NewReader(body))
+		if id != "" {
+			req.Header.Set("X-Correlation-ID", id)
+		}
+		http.DefaultClient.Do(req)
+	}
+	send("a", "/login", "")
+	send("b", "/login", "")
+	send("a", "/cart", "item=1")
+	send("a", "/cart", "item=1") // Retry
+	send("", "/cart", "")
+	send("a", "/checkout", "")
+
+	convs := s.Conversations()
+	if len(convs) != 2 || convs[0].ID != "a" || convs[1].ID != "b" {
+		t.Fatalf("expected conversations a and b, got %v", convs)
+	}
+	a := s.Conversation("a")
+	a.AssertRequestCount(t, 4)
+	a.AssertSequence(t, []string{"POST /login", "POST /cart", "POST /checkout"})
+	if unique := a.Unique(BodyKey()); len(unique) != 3 {
+		t.Errorf("expected the retry to be dropped, got %v", a.Routes())
+	}
+	if got := s.Conversation("b").Routes(); len(got) != 1 || got[0] != "POST /login" {
+		t.Errorf("unexpected routes %v", got)
+	}
+	if s.Conversation("c") != nil {
+		t.Error("expected no conversation c")
+	}
+	if unique := s.UniqueRequests(BodyKey()); len(unique) != 4 {
+		t.Errorf("expected 4 unique requests, got %d", len(unique))
+	}
+
+	mockT := &testing.T{}
+	s.Conversation("b").AssertSequence(mockT, []string{"POST /login", "POST /checkout"})
+	if !mockT.Failed() {
+		t.Error("expected incomplete conversation to fail")
+	}
+}
+
+func TestConversationsByCookie(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	if s.Conversations() != nil {
+		t.Error("expected no conversations without ThreadBy")
+	}
+	s.ThreadBy(CookieKey("session"))
+
+	req, _ := http.NewRequest("GET", s.URL+"/a", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	http.DefaultClient.Do(req)
+	http.Get(s.URL + "/b")
+
+	if convs := s.Conversations(); len(convs) != 1 || convs[0].ID != "s1" || len(convs[0].Requests) != 1 {
+		t.Errorf("expected one conversation s1, got %v", convs)
+	}
+}
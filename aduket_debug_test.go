@@ -0,0 +1,69 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.EnableDebugEndpoints()
+
+	req, _ := http.NewRequest("PUT", s.URL+"/__echo?a=1", strings.NewReader(`{"x":1}`))
+	req.Header.Set("X-Test", "yes")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var echo struct {
+		Method  string
+		URL     string
+		Query   map[string][]string
+		Headers http.Header
+		Body    string
+		JSON    map[string]int
+	}
+	json.NewDecoder(resp.Body).Decode(&echo)
+	resp.Body.Close()
+	if echo.Method != "PUT" || echo.URL != "/__echo?a=1" || echo.Query["a"][0] != "1" ||
+		echo.Headers.Get("X-Test") != "yes" || echo.JSON["x"] != 1 {
+		t.Errorf("unexpected echo %+v", echo)
+	}
+
+	resp, _ = http.Get(s.URL + "/__headers")
+	var headers struct{ Headers http.Header }
+	json.NewDecoder(resp.Body).Decode(&headers)
+	resp.Body.Close()
+	if headers.Headers.Get("User-Agent") == "" {
+		t.Errorf("expected headers to be echoed, got %v", headers)
+	}
+
+	for path, want := range map[string]int{
+		"/__status/418": http.StatusTeapot,
+		"/__status/abc": http.StatusBadRequest,
+		"/__status/42":  http.StatusBadRequest,
+		"/__delay/-1":   http.StatusBadRequest,
+	} {
+		resp, _ := http.Post(s.URL+path, "text/plain", nil)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d", path, want, resp.StatusCode)
+		}
+	}
+
+	start := time.Now()
+	resp, _ = http.Get(s.URL + "/__delay/30")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || time.Since(start) < 30*time.Millisecond {
+		t.Errorf("expected delayed echo, got %d after %v", resp.StatusCode, time.Since(start))
+	}
+
+	if req := s.GetRequest(0); req.Method != "PUT" || string(req.BodyContent) != `{"x":1}` {
+		t.Error("expected debug requests to be recorded")
+	}
+	s.Verify(t)
+}
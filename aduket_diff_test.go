@@ -0,0 +1,59 @@
+package aduket
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	expected := "{\n  \"a\": 1,\n  \"b\": 2,\n  \"c\": 3,\n  \"d\": 4,\n  \"e\": 5,\n  \"f\": 6,\n  \"g\": 7,\n  \"h\": 8,\n  \"i\": 9\n}"
+	actual := strings.Replace(strings.Replace(expected, `"b": 2`, `"b": 20`, 1), `"i": 9`, `"i": 9,`+"\n  \"j\": 10", 1)
+
+	want := `--- expected
++++ actual
+@@ -1,11 +1,12 @@
+ {
+   "a": 1,
+-  "b": 2,
++  "b": 20,
+   "c": 3,
+   "d": 4,
+   "e": 5,
+   "f": 6,
+   "g": 7,
+   "h": 8,
+-  "i": 9
++  "i": 9,
++  "j": 10
+ }`
+	if got := unifiedDiff(expected, actual, false); got != want {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+
+	if got := unifiedDiff(expected, expected, false); got != "" {
+		t.Errorf("expected no diff for equal input, got:\n%s", got)
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	lines := make([]string, 20)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", i+1)
+	}
+	expected := strings.Join(lines, "\n")
+	lines[1], lines[18] = "changed", "changed"
+	actual := strings.Join(lines, "\n")
+
+	diff := unifiedDiff(expected, actual, false)
+	if n := strings.Count(diff, "@@ -"); n != 2 {
+		t.Errorf("expected 2 hunks, got %d:\n%s", n, diff)
+	}
+	if !strings.Contains(diff, "@@ -1,5 +1,5 @@") || !strings.Contains(diff, "@@ -16,5 +16,5 @@") {
+		t.Errorf("unexpected hunk headers:\n%s", diff)
+	}
+
+	colored := unifiedDiff(expected, actual, true)
+	if !strings.Contains(colored, colorRed+"-xx"+colorReset) || !strings.Contains(colored, colorGreen+"+changed"+colorReset) {
+		t.Errorf("expected colored lines, got %q", colored)
+	}
+}
@@ -0,0 +1,42 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscovery(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.EnableDiscovery()
+
+	s.Expect("GET", "/users").Named("users").Response(http.StatusOK, "[]")
+
+	resp, err := http.Get(s.URL + DiscoveryPath)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var info DiscoveryInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("invalid discovery document: %v", err)
+	}
+	if info.URL != s.URL || len(info.Services) != 1 || info.Services[0].Name != "users" {
+		t.Errorf("unexpected discovery info %+v", info)
+	}
+	if s.RequestCount() != 0 {
+		t.Errorf("expected discovery requests not to be recorded, got %d", s.RequestCount())
+	}
+
+	path := filepath.Join(t.TempDir(), "aduket.json")
+	if err := s.WriteDiscoveryFile(path); err != nil {
+		t.Fatalf("failed to write discovery file: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var fromFile DiscoveryInfo
+	if err := json.Unmarshal(data, &fromFile); err != nil || fromFile.URL != s.URL {
+		t.Errorf("unexpected discovery file %s", data)
+	}
+}
@@ -0,0 +1,94 @@
+package aduket
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerEngineOverUnixSocket(t *testing.T) {
+	s := NewUnstartedServer()
+	if err := s.ListenUnix(filepath.Join(t.TempDir(), "docker.sock")); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	docker := s.DockerEngine()
+	docker.Image("alpine").Logs("hello\n", "oops\n").ExitCode(3)
+
+	client := s.Client()
+	do := func(method, path, body string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+
+	if resp, body := do("GET", "/_ping", ""); string(body) != "OK" || resp.Header.Get("Api-Version") != DockerAPIVersion {
+		t.Errorf("unexpected ping %q %v", body, resp.Header)
+	}
+	var version struct{ ApiVersion string }
+	_, body := do("GET", "/v1.43/version", "")
+	if json.Unmarshal(body, &version); version.ApiVersion != DockerAPIVersion {
+		t.Errorf("unexpected version %s", body)
+	}
+
+	resp, body := do("POST", "/v1.43/containers/create?name=job", `{"Image":"alpine","Cmd":["echo","hello"]}`)
+	var created struct{ Id string }
+	json.Unmarshal(body, &created)
+	if resp.StatusCode != http.StatusCreated || len(created.Id) != 64 {
+		t.Fatalf("unexpected create response %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := do("POST", "/containers/create?name=job", `{"Image":"alpine"}`); resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected duplicate names to conflict, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := do("POST", "/v1.43/containers/job/start", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 on start, got %d", resp.StatusCode)
+	}
+	if resp, _ := do("POST", "/containers/"+created.Id[:12]+"/start", ""); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 when already running, got %d", resp.StatusCode)
+	}
+	if _, body := do("GET", "/containers/json", ""); !strings.Contains(string(body), `"/job"`) {
+		t.Errorf("expected running container to be listed, got %s", body)
+	}
+
+	_, body = do("POST", "/containers/job/wait", "")
+	if string(body) != "{\"StatusCode\":3}\n" {
+		t.Errorf("unexpected wait response %s", body)
+	}
+
+	_, body = do("GET", "/containers/job/logs?stdout=1&stderr=1", "")
+	var frames []string
+	for len(body) >= 8 {
+		size := binary.BigEndian.Uint32(body[4:8])
+		frames = append(frames, string(rune('0'+body[0]))+":"+string(body[8:8+size]))
+		body = body[8+size:]
+	}
+	if strings.Join(frames, "|") != "1:hello\n|2:oops\n" {
+		t.Errorf("unexpected log frames %q", frames)
+	}
+
+	if resp, _ := do("DELETE", "/containers/job", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204 on remove, got %d", resp.StatusCode)
+	}
+	if resp, _ := do("GET", "/containers/job/json", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected removed container to be gone, got %d", resp.StatusCode)
+	}
+
+	containers := docker.Containers()
+	if len(containers) != 1 || containers[0].Name != "job" || containers[0].State != "removed" || containers[0].Cmd[0] != "echo" {
+		t.Errorf("unexpected containers %+v", containers)
+	}
+	s.Verify(t)
+}
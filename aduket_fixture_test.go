@@ -0,0 +1,99 @@
+package aduket
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pngHeader is the signature of a PNG file followed by non UTF-8 bytes.
+var pngHeader = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0xff, 0xfe, 0x80}
+
+func TestResponseBytes(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/logo").ResponseBytes(http.StatusOK, pngHeader)
+
+	resp, err := http.Get(s.URL + "/logo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if !bytes.Equal(body, pngHeader) {
+		t.Errorf("binary body mangled: %x", body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected image/png, got %q", ct)
+	}
+	if resp.ContentLength != int64(len(pngHeader)) {
+		t.Errorf("expected Content-Length %d, got %d", len(pngHeader), resp.ContentLength)
+	}
+}
+
+func TestResponseFile(t *testing.T) {
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "invoice.pdf")
+	os.WriteFile(pdf, []byte("%PDF-1.4 fake"), 0o644)
+	blob := filepath.Join(dir, "logo")
+	os.WriteFile(blob, pngHeader, 0o644)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"ok":true}`))
+	zw.Close()
+	compressed := filepath.Join(dir, "data.json.gz")
+	os.WriteFile(compressed, gz.Bytes(), 0o644)
+
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/invoice").ResponseFile(http.StatusOK, pdf)
+	s.Expect("GET", "/blob").ResponseFile(http.StatusOK, blob)
+	s.Expect("GET", "/proto").
+		Headers(map[string]string{"Content-Type": "application/x-protobuf"}).
+		ResponseFile(http.StatusOK, blob)
+	s.Expect("GET", "/data").ResponseFile(http.StatusOK, compressed)
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        []byte
+	}{
+		{"/invoice", "application/pdf", []byte("%PDF-1.4 fake")},
+		{"/blob", "image/png", pngHeader},
+		{"/proto", "application/x-protobuf", pngHeader},
+		{"/data", "application/json", []byte(`{"ok":true}`)},
+	}
+
+	for _, tt := range tests {
+		resp, err := http.Get(s.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", tt.path, tt.contentType, ct)
+		}
+		if !bytes.Equal(body, tt.body) {
+			t.Errorf("%s: unexpected body %q", tt.path, body)
+		}
+	}
+}
+
+func TestResponseFileMissing(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for missing fixture")
+		}
+	}()
+	newExpectation("GET", "/").ResponseFile(http.StatusOK, filepath.Join(t.TempDir(), "missing.png"))
+}
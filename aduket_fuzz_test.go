@@ -0,0 +1,56 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func FuzzMatching(f *testing.F) {
+	s := NewUnstartedServer()
+	s.Expect("GET", "/users/{id}").Response(http.StatusOK, "{}")
+	s.Expect("GET", "/search").WithQuery("q", "aduket").Response(http.StatusOK, "[]")
+	s.Expect("POST", "/users").
+		MatchFunc(func(r *http.Request, body []byte) bool {
+			return strings.Contains(string(body), "name") && r.Header.Get("X-Tenant") != ""
+		}).
+		Response(http.StatusCreated, "")
+	s.Health()
+
+	FuzzSeeds(f, s)
+	f.Add("POST", "/users", "X-Tenant: acme", []byte(`{"name":"x"}`))
+	f.Add("GET", "/users/", "", []byte(nil))
+	f.Fuzz(FuzzTarget(s))
+}
+
+func TestFuzzTargetDetectsInconsistencies(t *testing.T) {
+	calls := 0
+	s := NewUnstartedServer()
+	s.Expect("GET", "/flaky").MatchFunc(func(r *http.Request, body []byte) bool {
+		calls++
+		return calls%2 == 1
+	}).Response(http.StatusOK, "")
+	s.Expect("GET", "/panic").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	s.Expect("GET", "/ok").Response(http.StatusOK, "")
+	target := FuzzTarget(s)
+
+	tests := []struct {
+		target string
+		fail   bool
+	}{
+		{"/flaky", true},
+		{"/panic", true},
+		{"/ok", false},
+		{"/unknown", false},
+		{"no-slash", false},
+	}
+	for _, tt := range tests {
+		mockT := &testing.T{}
+		target(mockT, "GET", tt.target, "", nil)
+		if mockT.Failed() != tt.fail {
+			t.Errorf("%s: expected failed=%v, got %v", tt.target, tt.fail, mockT.Failed())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package aduket
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchInteractionsGolden(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("POST", "/checkout").
+		Headers(map[string]string{"Content-Type": "application/json"}).
+		Response(http.StatusCreated, `{"orderId": 42, "createdAt": "2024-01-01T00:00:00Z"}`)
+
+	req, _ := http.NewRequest("POST", s.URL+"/checkout?dry=1", strings.NewReader(`{"items": [{"sku": "a", "qty": 2}]}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Request-Id", "abc")
+	http.DefaultClient.Do(req)
+
+	opts := []GoldenOption{
+		RedactFields("request.header.Authorization"),
+		IgnoreFields("request.header.X-Request-Id", "response.body.createdAt"),
+	}
+	path := filepath.Join(t.TempDir(), "testdata", "checkout_flow.json")
+
+	t.Setenv(GoldenUpdateEnv, "1")
+	s.MatchInteractionsGolden(t, path, opts...)
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Authorization": "[REDACTED]"`, `"orderId": 42`, `"qty": 2`, `"query": "dry=1"`} {
+		if !strings.Contains(string(golden), want) {
+			t.Errorf("expected golden file to contain %s:\n%s", want, golden)
+		}
+	}
+	for _, unwanted := range []string{"secret", "X-Request-Id", "createdAt", "User-Agent"} {
+		if strings.Contains(string(golden), unwanted) {
+			t.Errorf("expected golden file not to contain %s:\n%s", unwanted, golden)
+		}
+	}
+
+	t.Setenv(GoldenUpdateEnv, "")
+	s.MatchInteractionsGolden(t, path, opts...)
+
+	// A changed client request no longer matches.
+	http.Post(s.URL+"/checkout", "application/json", strings.NewReader(`{}`))
+	mockT := &testing.T{}
+	s.MatchInteractionsGolden(mockT, path, opts...)
+	if !mockT.Failed() {
+		t.Error("expected extra interaction to fail the golden comparison")
+	}
+}
+
+func TestAssertReplayEquivalent(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/users/{id}").Response(http.StatusOK, `{"id": "7", "name": "alice"}`)
+	http.Get(s.URL + "/users/7")
+
+	results := s.Replay(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	if len(results) != 1 || results[0].Response.Body.String() != "/users/7" {
+		t.Fatalf("unexpected replay results %+v", results)
+	}
+
+	real := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"alice","id":"7"}`))
+	})
+	s.AssertReplayEquivalent(t, real)
+
+	broken := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	mockT := &testing.T{}
+	s.AssertReplayEquivalent(mockT, broken)
+	if !mockT.Failed() {
+		t.Error("expected differing handler to fail")
+	}
+}
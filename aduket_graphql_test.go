@@ -0,0 +1,54 @@
+package aduket
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGraphQLMatching(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("POST", "/graphql").WithGraphQLOperation("GetUser").Response(http.StatusOK, `{"data":{"user":{}}}`)
+	s.Expect("POST", "/graphql").WithGraphQLQueryContains("createOrder(input: $input)").Response(http.StatusOK, `{"data":{"order":{}}}`)
+	s.Expect("GET", "/graphql").WithGraphQLOperation("Ping").Response(http.StatusOK, `{"data":"pong"}`)
+
+	post := func(body string) string {
+		resp, err := http.Post(s.URL+"/graphql", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return string(out)
+	}
+
+	if got := post(`{"query":"query GetUser($id: ID!) { user(id: $id) { name } }","variables":{"id":"42","limit":10}}`); got != `{"data":{"user":{}}}` {
+		t.Errorf("expected user response, got %s", got)
+	}
+	if got := post(`{"query":"mutation { createOrder(input:   $input) { id } }","variables":{"input":{"sku":"a"}}}`); got != `{"data":{"order":{}}}` {
+		t.Errorf("expected order response, got %s", got)
+	}
+	if got := post(`{"query":"query Other { x }"}`); !strings.Contains(got, "no expectation matched") {
+		t.Errorf("expected unknown operation not to match, got %s", got)
+	}
+	if got := post(`{"operationName":"GetUser","query":"query A { a } query GetUser { b }"}`); got != `{"data":{"user":{}}}` {
+		t.Errorf("expected operationName to take precedence, got %s", got)
+	}
+
+	resp, _ := http.Get(s.URL + "/graphql?query=" + url.QueryEscape("query Ping { ping }"))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"data":"pong"}` {
+		t.Errorf("expected GET operation to match, got %s", body)
+	}
+
+	s.AssertGraphQLVariables(t, 0, map[string]interface{}{"id": "42", "limit": 10})
+	mockT := &testing.T{}
+	s.AssertGraphQLVariables(mockT, 0, map[string]interface{}{"id": "43"})
+	if !mockT.Failed() {
+		t.Error("expected variables mismatch to fail")
+	}
+}
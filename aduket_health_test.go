@@ -0,0 +1,80 @@
+package aduket
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthTimeline(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Health().Degrade(50 * time.Millisecond).Down(50 * time.Millisecond)
+
+	check := func(wantStatus int, wantState HealthState) {
+		t.Helper()
+		resp, err := http.Get(s.URL + "/health")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Errorf("expected status %d, got %d", wantStatus, resp.StatusCode)
+		}
+		if state := s.Health().State(); state != wantState {
+			t.Errorf("expected state %s, got %s", wantState, state)
+		}
+	}
+
+	check(http.StatusOK, HealthDegraded)
+	time.Sleep(60 * time.Millisecond)
+	check(http.StatusServiceUnavailable, HealthDown)
+	time.Sleep(60 * time.Millisecond)
+	check(http.StatusOK, HealthOK)
+
+	s.Health().Path("/ready").Set(HealthDown)
+	resp, _ := http.Get(s.URL + "/ready")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected moved endpoint to report down, got %d", resp.StatusCode)
+	}
+
+	// The simulated endpoint does not need to be called for Verify to pass.
+	s.Verify(t)
+}
+
+func TestHealthClone(t *testing.T) {
+	s := NewUnstartedServer()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Health()
+		}()
+	}
+	wg.Wait()
+	if len(s.Expectations) != 1 {
+		t.Fatalf("expected one health expectation, got %d", len(s.Expectations))
+	}
+	s.Health().Set(HealthDown)
+
+	c := s.Clone()
+	c.Start()
+	defer c.Close()
+	c.Health()
+	if len(c.Expectations) != 1 {
+		t.Errorf("expected the clone to reuse its health expectation, got %d", len(c.Expectations))
+	}
+	c.Health().Set(HealthOK)
+
+	resp, err := http.Get(c.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || s.Health().State() != HealthDown {
+		t.Errorf("expected the clone to report its own state, got %d", resp.StatusCode)
+	}
+}
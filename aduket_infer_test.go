@@ -0,0 +1,61 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInferRequestSchema(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("POST", "/users/{org}").Response(http.StatusCreated, "")
+	bodies := []string{
+		`{"id":"0d9e4c3e-2b7a-4f7e-9a39-3c2f1b2a8e11","email":"a@example.com","age":30,"score":1,"tags":["x"],"created_at":"2024-01-02T03:04:05Z","address":{"city":"Izmir"}}`,
+		`{"id":"5b1f3c0a-7e2d-4c8b-8f6a-1d2e3f4a5b6c","email":"b@example.com","age":41,"score":0.5,"tags":[],"created_at":"2024-02-03T04:05:06Z","nickname":null}`,
+	}
+	for _, body := range bodies {
+		http.Post(s.URL+"/users/acme", "application/json", strings.NewReader(body))
+	}
+	http.Post(s.URL+"/users/acme", "application/json", nil)
+
+	schema, err := s.InferRequestSchema("POST", "/users/{org}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := json.Marshal(schema)
+	want := `{"type":"object","properties":{` +
+		`"address":{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]},` +
+		`"age":{"type":"integer"},` +
+		`"created_at":{"type":"string","format":"date-time"},` +
+		`"email":{"type":"string","format":"email"},` +
+		`"id":{"type":"string","format":"uuid"},` +
+		`"nickname":{"type":"null"},` +
+		`"score":{"type":"number"},` +
+		`"tags":{"type":"array","items":{"type":"string"}}},` +
+		`"required":["age","created_at","email","id","score","tags"]}`
+	if string(got) != want {
+		t.Errorf("unexpected schema:\n%s\nwant:\n%s", got, want)
+	}
+
+	src := schema.GoStruct("User")
+	for _, field := range []string{
+		"ID        string",
+		"CreatedAt time.Time",
+		"`json:\"age\"`",
+		"`json:\"address,omitempty\"`",
+		"Tags      []string",
+		"City string `json:\"city\"`",
+	} {
+		if !strings.Contains(src, field) {
+			t.Errorf("expected Go struct to contain %q:\n%s", field, src)
+		}
+	}
+
+	if _, err := s.InferRequestSchema("GET", "/nothing"); err == nil {
+		t.Error("expected an error without captured bodies")
+	}
+}
@@ -0,0 +1,172 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpectationJSONRoundTrip(t *testing.T) {
+	s := NewUnstartedServer()
+	exp := s.Expect("POST", "/items").
+		Named("create").
+		WithQuery("dry", "1").
+		WithHeader("Accept", "application/json").
+		WithHeaderRegex("Authorization", "^Bearer ").
+		Headers(map[string]string{"Content-Type": "application/json"}).
+		Delay(150*time.Millisecond).
+		TimesSet(2).
+		Response(201, `{"id":1}`)
+
+	data, err := json.Marshal(exp)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	var decoded Expectation
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	again, _ := json.Marshal(&decoded)
+	if !bytes.Equal(data, again) {
+		t.Errorf("round trip mismatch:\n%s\n%s", data, again)
+	}
+	if decoded.DelayTime != 150*time.Millisecond || decoded.QueryParams["dry"] != "1" ||
+		decoded.RequestHeaders["Accept"] != "application/json" ||
+		!decoded.RequestHeaderPatterns["Authorization"].MatchString("Bearer x") {
+		t.Errorf("unexpected decoded expectation: %s", again)
+	}
+}
+
+func TestExpectationJSONBinaryBody(t *testing.T) {
+	exp := &Expectation{Method: "GET", Body: []byte{0xff, 0x00, 0xfe}}
+	data, _ := json.Marshal(exp)
+
+	var decoded Expectation
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !bytes.Equal(decoded.Body, exp.Body) {
+		t.Errorf("expected binary body to survive, got %v", decoded.Body)
+	}
+}
+
+func TestExpectationJSONOptions(t *testing.T) {
+	s := NewUnstartedServer()
+	schema, _ := ParseSchema([]byte(`{"type": "object", "properties": {"id": {"type": "integer"}}}`))
+	for name, tt := range map[string]struct {
+		build func(*Expectation)
+		check func(*Expectation) bool
+	}{
+		"scenario": {
+			func(e *Expectation) { e.scenario = s.Scenario("checkout"); e.WhenState("started").WillSetState("paid") },
+			func(e *Expectation) bool {
+				return e.scenario.Name == "checkout" && e.RequiredState == "started" && e.NewState == "paid"
+			},
+		},
+		"failure": {
+			func(e *Expectation) { e.FailWithProbability(0.25, 503, "down") },
+			func(e *Expectation) bool {
+				return e.failure.probability == 0.25 && e.failure.status == 503 && string(e.failure.body) == "down"
+			},
+		},
+		"breaker": {
+			func(e *Expectation) { e.CircuitBreaker(3, time.Second) },
+			func(e *Expectation) bool { return e.breaker.threshold == 3 && e.breaker.openFor == time.Second },
+		},
+		"basic auth": {
+			func(e *Expectation) { e.RequireBasicAuth("user", "pass") },
+			func(e *Expectation) bool {
+				return *e.auth == credentials{Scheme: authBasic, User: "user", Password: "pass"}
+			},
+		},
+		"bearer auth": {
+			func(e *Expectation) { e.RequireBearerToken("secret") },
+			func(e *Expectation) bool { return *e.auth == credentials{Scheme: authBearer, Token: "secret"} },
+		},
+		"stream": {
+			func(e *Expectation) {
+				e.StreamResponse([][]byte{[]byte("a"), {0xff}}, 10*time.Millisecond).AbortStreamAfter(1)
+			},
+			func(e *Expectation) bool {
+				return len(e.stream.chunks) == 2 && e.stream.chunks[1][0] == 0xff &&
+					e.stream.interval == 10*time.Millisecond && e.stream.abortAfter == 1
+			},
+		},
+		"bomb": {
+			func(e *Expectation) { e.ResponseBomb(1<<20, true) },
+			func(e *Expectation) bool { return *e.bomb == bomb{size: 1 << 20, compressed: true} },
+		},
+		"generate": {
+			func(e *Expectation) { e.GenerateFrom(schema) },
+			func(e *Expectation) bool { return e.schema.Properties["id"].Type == "integer" },
+		},
+		"reset": {
+			func(e *Expectation) { e.ResetConnection() },
+			func(e *Expectation) bool { return e.fault == faultReset },
+		},
+		"close": {
+			func(e *Expectation) { e.CloseWithoutResponse() },
+			func(e *Expectation) bool { return e.fault == faultClose },
+		},
+		"ab test": {
+			func(e *Expectation) {
+				e.ABTest(map[string]Variant{"a": {Status: 200, Body: "a"}, "b": {Status: 200, Body: "b", Weight: 3}}, "X-User")
+			},
+			func(e *Expectation) bool {
+				return len(e.abTest.names) == 2 && e.abTest.variants["b"].Weight == 3 && e.abTest.stickyBy == "X-User"
+			},
+		},
+	} {
+		exp := s.Expect("GET", "/"+name)
+		tt.build(exp)
+		data, err := json.Marshal(exp)
+		if err != nil {
+			t.Fatalf("%s: marshal failed: %v", name, err)
+		}
+		var decoded Expectation
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v", name, err)
+		}
+		again, _ := json.Marshal(&decoded)
+		if !bytes.Equal(data, again) {
+			t.Errorf("%s: round trip mismatch:\n%s\n%s", name, data, again)
+		}
+		if !tt.check(&decoded) {
+			t.Errorf("%s: option lost in %s", name, data)
+		}
+	}
+}
+
+func TestExpectationJSONScenarioBinding(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	var exps []*Expectation
+	err := json.Unmarshal([]byte(`[
+		{"method": "POST", "path": "/pay", "status": 201, "scenario": "checkout", "willSetState": "paid"},
+		{"method": "GET", "path": "/order", "status": 200, "body": "paid", "scenario": "checkout", "whenState": "paid"}
+	]`), &exps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.bindScenarios(exps)
+	s.Expectations = append(s.Expectations, exps...)
+	s.mu.Unlock()
+
+	if exps[0].scenario != exps[1].scenario || exps[0].scenario != s.Scenario("checkout") {
+		t.Fatal("expected decoded expectations to share the server's scenario")
+	}
+	http.Post(s.URL+"/pay", "", nil)
+	if state := s.Scenario("checkout").State(); state != "paid" {
+		t.Errorf("expected the scenario to move on, got %q", state)
+	}
+
+	var bad Expectation
+	if err := json.Unmarshal([]byte(`{"method": "GET", "whenState": "paid"}`), &bad); err == nil {
+		t.Error("expected whenState without scenario to fail")
+	}
+}
@@ -0,0 +1,85 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestJSONRPC(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.ExpectJSONRPC("eth_getBalance").
+		WithParams([]string{"0xabc", "latest"}).
+		Respond("0x10")
+	s.ExpectJSONRPC("eth_call").RespondError(-32000, "execution reverted", nil)
+
+	resp, err := http.Post(s.URL+"/", "application/json", strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0xabc","latest"]}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	var single jsonrpcResponse
+	json.NewDecoder(resp.Body).Decode(&single)
+	if single.Result != "0x10" || string(single.ID) != "1" {
+		t.Errorf("unexpected response %+v", single)
+	}
+
+	resp, _ = http.Post(s.URL+"/rpc", "application/json", strings.NewReader(`[
+		{"jsonrpc":"2.0","id":1,"method":"eth_call"},
+		{"jsonrpc":"2.0","id":2,"method":"eth_unknown"},
+		{"jsonrpc":"2.0","method":"eth_getBalance","params":["0xabc","latest"]}
+	]`))
+	var batch []jsonrpcResponse
+	json.NewDecoder(resp.Body).Decode(&batch)
+	if len(batch) != 2 {
+		t.Fatalf("expected 2 responses for batch with a notification, got %d", len(batch))
+	}
+	if batch[0].Error == nil || batch[0].Error.Code != -32000 {
+		t.Errorf("expected execution error, got %+v", batch[0])
+	}
+	if batch[1].Error == nil || batch[1].Error.Code != JSONRPCMethodNotFound {
+		t.Errorf("expected method not found, got %+v", batch[1])
+	}
+
+	s.Verify(t)
+}
+
+func TestJSONRPCClone(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.ExpectJSONRPC("ping").TimesSet(1).Respond("pong")
+
+	c := s.Clone()
+	c.Start()
+	defer c.Close()
+
+	call := func(srv *Server) jsonrpcResponse {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out jsonrpcResponse
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out
+	}
+	if out := call(c); out.Result != "pong" {
+		t.Errorf("expected the clone to answer, got %+v", out)
+	}
+	if out := call(s); out.Result != "pong" {
+		t.Errorf("expected the clone to leave the budget of the original, got %+v", out)
+	}
+	if out := call(c); out.Error == nil || out.Error.Code != JSONRPCMethodNotFound {
+		t.Errorf("expected the clone to use up its own budget, got %+v", out)
+	}
+
+	mockT := &testing.T{}
+	d := s.Clone()
+	d.Verify(mockT)
+	if !mockT.Failed() {
+		t.Error("expected Verify of a clone to check its JSON-RPC methods")
+	}
+}
@@ -0,0 +1,57 @@
+package aduket
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/ismailtsdln/aduket/auth"
+)
+
+func TestJWT(t *testing.T) {
+	idp := NewServer()
+	defer idp.Close()
+	api := NewServer()
+	defer api.Close()
+
+	token := idp.IssueJWT(auth.Claims{"sub": "42", "aud": "orders"})
+
+	// The API fetches the keys from the issuer, as a real service would.
+	resp, err := http.Get(idp.URL + JWKSPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	jwks, err := auth.ParseJWKS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api.Expect("GET", "/orders").
+		WithValidJWT(auth.RequireClaims(jwks, auth.Claims{"aud": "orders", "iss": idp.URL})).
+		Response(http.StatusOK, "[]")
+
+	for _, tt := range []struct {
+		token  string
+		status int
+	}{
+		{token, http.StatusOK},
+		{idp.IssueJWT(auth.Claims{"aud": "billing"}), http.StatusNotFound},
+		{api.IssueJWT(auth.Claims{"aud": "orders"}), http.StatusNotFound},
+		{"", http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest("GET", api.URL+"/orders", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package aduket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func pod(namespace, name, app string) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]string{"app": app},
+		},
+	}
+}
+
+func TestKubernetesListAndGet(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	pods := s.KubernetesResource("v1", "Pod", "pods")
+	pods.Add(pod("default", "web-1", "web"))
+	pods.Add(pod("default", "db-1", "db"))
+	pods.Add(pod("kube-system", "dns-1", "dns"))
+
+	getJSON := func(path string) (int, map[string]interface{}) {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var v map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&v)
+		return resp.StatusCode, v
+	}
+	names := func(list map[string]interface{}) []string {
+		var out []string
+		for _, item := range list["items"].([]interface{}) {
+			out = append(out, item.(map[string]interface{})["metadata"].(map[string]interface{})["name"].(string))
+		}
+		return out
+	}
+
+	_, list := getJSON("/api/v1/pods")
+	if list["kind"] != "PodList" || list["metadata"].(map[string]interface{})["resourceVersion"] != "3" || len(names(list)) != 3 {
+		t.Errorf("unexpected list %v", list)
+	}
+	if _, list := getJSON("/api/v1/namespaces/default/pods?labelSelector=app%3Dweb"); len(names(list)) != 1 || names(list)[0] != "web-1" {
+		t.Errorf("expected label selector to filter, got %v", names(list))
+	}
+	if _, list := getJSON("/api/v1/pods?fieldSelector=metadata.namespace!%3Ddefault"); len(names(list)) != 1 || names(list)[0] != "dns-1" {
+		t.Errorf("expected field selector to filter, got %v", names(list))
+	}
+
+	pods.Update(pod("default", "web-1", "frontend"))
+	status, obj := getJSON("/api/v1/namespaces/default/pods/web-1")
+	meta := obj["metadata"].(map[string]interface{})
+	if status != http.StatusOK || obj["kind"] != "Pod" || meta["resourceVersion"] != "4" || meta["labels"].(map[string]interface{})["app"] != "frontend" {
+		t.Errorf("unexpected object %d %v", status, obj)
+	}
+	pods.Delete("default", "web-1")
+	if status, obj := getJSON("/api/v1/namespaces/default/pods/web-1"); status != http.StatusNotFound || obj["reason"] != "NotFound" {
+		t.Errorf("expected 404 Status, got %d %v", status, obj)
+	}
+
+	deployments := s.KubernetesResource("apps/v1", "Deployment", "deployments")
+	deployments.Add(pod("default", "web", "web"))
+	if status, _ := getJSON("/apis/apps/v1/namespaces/default/deployments/web"); status != http.StatusOK {
+		t.Errorf("expected group resources under /apis, got %d", status)
+	}
+
+	s.Verify(t)
+}
+
+func TestKubernetesWatch(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	pods := s.KubernetesResource("v1", "Pod", "pods")
+	pods.Add(pod("default", "a", "web"))
+	rv := pods.ResourceVersion()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", s.URL+"/api/v1/namespaces/default/pods?watch=true&resourceVersion="+rv, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	events := make(chan map[string]interface{})
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var ev map[string]interface{}
+			json.Unmarshal(scanner.Bytes(), &ev)
+			events <- ev
+		}
+	}()
+	next := func() (string, string) {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return "", ""
+			}
+			meta := ev["object"].(map[string]interface{})["metadata"].(map[string]interface{})
+			return ev["type"].(string), meta["name"].(string)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a watch event")
+			return "", ""
+		}
+	}
+
+	pods.Add(pod("other", "ignored", "web"))
+	pods.Add(pod("default", "b", "web"))
+	pods.Update(pod("default", "a", "web"))
+	pods.Delete("default", "b")
+	for _, want := range [][2]string{{"ADDED", "b"}, {"MODIFIED", "a"}, {"DELETED", "b"}} {
+		if typ, name := next(); typ != want[0] || name != want[1] {
+			t.Errorf("expected %s %s, got %s %s", want[0], want[1], typ, name)
+		}
+	}
+	pods.StopWatches()
+	if _, ok := <-events; ok {
+		t.Error("expected StopWatches to end the watch")
+	}
+
+	// Watching from an expired version.
+	pods.Compact()
+	resp, err = http.Get(s.URL + "/api/v1/pods?watch=1&resourceVersion=" + rv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev struct {
+		Type   string
+		Object struct{ Code int }
+	}
+	json.NewDecoder(resp.Body).Decode(&ev)
+	resp.Body.Close()
+	if ev.Type != "ERROR" || ev.Object.Code != http.StatusGone {
+		t.Errorf("expected a 410 ERROR event, got %+v", ev)
+	}
+
+	// Watching without a version starts with the current state.
+	resp, err = http.Get(s.URL + "/api/v1/pods?watch=true&timeoutSeconds=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(&ev)
+	if ev.Type != "ADDED" {
+		t.Errorf("expected initial ADDED events, got %+v", ev)
+	}
+}
@@ -0,0 +1,37 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVerifyNoLeaks(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/small").Response(http.StatusOK, "ok")
+	s.Expect("GET", "/large").Response(http.StatusOK, strings.Repeat("x", 8<<20))
+
+	resp, err := http.Get(s.URL + "/small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	VerifyNoLeaks(t, s)
+
+	// A large response that is never read keeps the connection busy.
+	client := &http.Client{Transport: &http.Transport{}}
+	resp, err = client.Get(s.URL + "/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockT := &testing.T{}
+	VerifyNoLeaks(mockT, s)
+	if !mockT.Failed() {
+		t.Error("expected unread response body to be reported")
+	}
+
+	resp.Body.Close()
+	client.CloseIdleConnections()
+	VerifyNoLeaks(t, s)
+}
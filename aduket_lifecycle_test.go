@@ -1,8 +1,20 @@
 package aduket
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestUnstartedServer(t *testing.T) {
@@ -18,9 +30,12 @@ func TestUnstartedServer(t *testing.T) {
 }
 
 func TestListen(t *testing.T) {
-	s := NewServer()
+	s := NewUnstartedServer()
 	defer s.Close()
 
+	// Expectations may be registered before the server listens.
+	s.Expect("GET", "/early").Response(200, "early")
+
 	// Pick a random free port for testing Listen
 	if err := s.Listen("127.0.0.1:0"); err != nil {
 		t.Fatalf("failed to listen on random port: %v", err)
@@ -35,4 +50,299 @@ func TestListen(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf("expected 200, got %d", resp.StatusCode)
 	}
+
+	resp, err = http.Get(s.URL + "/early")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("expected expectation registered before Listen to match")
+	}
+}
+
+func TestLifecycleErrors(t *testing.T) {
+	s := NewUnstartedServer()
+	defer s.Close()
+
+	if _, err := s.Addr(); err != ErrNotStarted {
+		t.Errorf("expected ErrNotStarted, got %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error starting server: %v", err)
+	}
+	if err := s.Start(); err != ErrAlreadyStarted {
+		t.Errorf("expected ErrAlreadyStarted from Start, got %v", err)
+	}
+	if err := s.StartTLS(); err != ErrAlreadyStarted {
+		t.Errorf("expected ErrAlreadyStarted from StartTLS, got %v", err)
+	}
+	if err := s.Listen("127.0.0.1:0"); err != ErrAlreadyStarted {
+		t.Errorf("expected ErrAlreadyStarted from Listen, got %v", err)
+	}
+	if addr, err := s.Addr(); err != nil || addr == nil {
+		t.Errorf("expected address of running server, got %v, %v", addr, err)
+	}
+}
+
+func TestListenTLS(t *testing.T) {
+	s := NewUnstartedServer()
+	defer s.Close()
+
+	if err := s.ListenTLS("127.0.0.1:0"); err != nil {
+		t.Fatalf("failed to listen with TLS: %v", err)
+	}
+	if !strings.HasPrefix(s.URL, "https://") {
+		t.Errorf("expected https URL, got %s", s.URL)
+	}
+
+	s.Expect("GET", "/secure").Response(200, "ok")
+	resp, err := s.Client().Get(s.URL + "/secure")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestResetVariants(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/a").Response(http.StatusOK, "a")
+	s.Expect("GET", "/b").Named("b").Response(http.StatusOK, "b")
+
+	http.Get(s.URL + "/a")
+	s.ResetRequests()
+	if s.RequestCount() != 0 {
+		t.Errorf("expected history to be cleared, got %d requests", s.RequestCount())
+	}
+	s.AssertNotCalled(t, "GET", "/a")
+
+	if !s.ResetExpectation("b") {
+		t.Error("expected named expectation to be removed")
+	}
+	if !s.ResetExpectation("GET /a") {
+		t.Error("expected expectation to be removed by method and path")
+	}
+	if len(s.Expectations) != 0 {
+		t.Errorf("expected no expectations, got %d", len(s.Expectations))
+	}
+
+	s.Expect("GET", "/c").Response(http.StatusOK, "c")
+	http.Get(s.URL + "/c")
+	s.ResetExpectations()
+	if len(s.Expectations) != 0 || s.RequestCount() != 1 {
+		t.Errorf("expected expectations cleared and history kept")
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/shared").Response(http.StatusOK, "shared")
+	http.Get(s.URL + "/shared")
+
+	c := s.Clone()
+	if c.URL != "" {
+		t.Errorf("expected clone to be unstarted, got URL %s", c.URL)
+	}
+	c.Start()
+	defer c.Close()
+
+	if c.RequestCount() != 0 {
+		t.Errorf("expected clone to have no history, got %d requests", c.RequestCount())
+	}
+	c.AssertNotCalled(t, "GET", "/shared")
+
+	resp, err := http.Get(c.URL + "/shared")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 from clone, got %d", resp.StatusCode)
+	}
+	if s.RequestCount() != 1 {
+		t.Errorf("expected original history to be untouched, got %d", s.RequestCount())
+	}
+}
+
+func TestCloneSettings(t *testing.T) {
+	s := NewUnstartedServer()
+	s.PartitionBy("X-Test-ID")
+	key := s.JWTKey()
+	s.DelayContinue(time.Second)
+	s.RejectContinue(http.StatusExpectationFailed)
+	s.ThreadBy(CookieKey("session"))
+	s.VerboseFailures(true)
+	s.RetryWindow = time.Minute
+	s.CompressHistory(true)
+
+	c := s.Clone()
+	if c.partitionHeader != "X-Test-ID" {
+		t.Errorf("expected partition header to be copied, got %q", c.partitionHeader)
+	}
+	if c.JWTKey() != key || c.internal[JWKSPath] == nil {
+		t.Error("expected the JWT key and its JWKS to be copied")
+	}
+	if c.continueDelay != time.Second || c.continueStatus != http.StatusExpectationFailed {
+		t.Errorf("expected continue settings to be copied, got %v and %d", c.continueDelay, c.continueStatus)
+	}
+	if c.conversationKey == nil {
+		t.Error("expected conversation key to be copied")
+	}
+	if !c.verboseFailures {
+		t.Error("expected verbose failures to be copied")
+	}
+	if c.RetryWindow != time.Minute {
+		t.Errorf("expected retry window to be copied, got %v", c.RetryWindow)
+	}
+	if !c.compressHistory {
+		t.Error("expected history compression to be copied")
+	}
+}
+
+func TestCloneSeeded(t *testing.T) {
+	variants := []Variant{{Status: http.StatusOK, Body: "a"}, {Status: http.StatusOK, Body: "b"}, {Status: http.StatusOK, Body: "c"}}
+	s := NewUnstartedServer()
+	s.Seed(1)
+	s.Expect("GET", "/server").ResponseOneOf(variants...)
+	s.Expect("GET", "/own").Seed(2).ResponseOneOf(variants...)
+	c := s.Clone()
+
+	sequence := func(srv *Server) string {
+		srv.Start()
+		defer srv.Close()
+		var seq strings.Builder
+		for i := 0; i < 20; i++ {
+			for _, path := range []string{"/server", "/own"} {
+				resp, err := http.Get(srv.URL + path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				seq.Write(body)
+			}
+		}
+		return seq.String()
+	}
+	if want, got := sequence(s), sequence(c); got != want {
+		t.Errorf("expected the clone to repeat the seeded choices %s, got %s", want, got)
+	}
+}
+
+func TestListenOnPortRange(t *testing.T) {
+	// Hold two consecutive ports so the range has to be walked.
+	var held []net.Listener
+	var port int
+	for attempt := 0; attempt < 20 && len(held) < 2; attempt++ {
+		for _, l := range held {
+			l.Close()
+		}
+		held = nil
+		first, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port = first.Addr().(*net.TCPAddr).Port
+		held = append(held, first)
+		if second, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port+1)); err == nil {
+			held = append(held, second)
+		}
+	}
+	if len(held) < 2 {
+		t.Skip("could not hold two consecutive ports")
+	}
+	defer func() {
+		for _, l := range held {
+			l.Close()
+		}
+	}()
+
+	s := NewUnstartedServer()
+	defer s.Close()
+	err := s.ListenOn("127.0.0.1", fmt.Sprintf("%d-%d", port, port+1))
+
+	var conflict *PortConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a PortConflictError, got %v", err)
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("expected the bind error to be wrapped, got %v", err)
+	}
+	if runtime.GOOS == "linux" && conflict.PID != os.Getpid() {
+		t.Errorf("expected conflict to name this process, got %v", err)
+	}
+	if !strings.Contains(err.Error(), strconv.Itoa(port+1)) {
+		t.Errorf("expected every tried port to be reported, got %v", err)
+	}
+
+	held[1].Close()
+	if err := s.ListenOn("127.0.0.1", fmt.Sprintf("%d-%d", port, port+1)); err != nil {
+		t.Fatalf("expected the free port of the range to be used, got %v", err)
+	}
+	if addr, _ := s.Addr(); addr.(*net.TCPAddr).Port != port+1 {
+		t.Errorf("expected port %d, got %v", port+1, addr)
+	}
+}
+
+func TestListenInvalidPortRange(t *testing.T) {
+	for _, ports := range []string{"abc", "90-80", "1-70000"} {
+		s := NewUnstartedServer()
+		if err := s.ListenOn("127.0.0.1", ports); err == nil {
+			t.Errorf("expected %q to be rejected", ports)
+		}
+		s.Close()
+	}
+}
+
+func TestStartStandalone(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "mocks.yaml")
+	os.WriteFile(config, []byte("expectations:\n  - {method: GET, path: /users, status: 200, response: '[]'}\n"), 0o644)
+	junit := filepath.Join(dir, "junit.xml")
+
+	st, err := StartStandalone(StandaloneOptions{
+		Addr:      "127.0.0.1:0",
+		Config:    config,
+		AdminAPI:  true,
+		JUnitFile: junit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]int{"/users": http.StatusOK, AdminPath + "/expectations": http.StatusOK, "/": http.StatusNotFound} {
+		resp, err := http.Get(st.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("expected %d for %s, got %d", want, path, resp.StatusCode)
+		}
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(junit); err != nil {
+		t.Errorf("expected JUnit report on close: %v", err)
+	}
+
+	if _, err := StartStandalone(StandaloneOptions{Addr: "127.0.0.1:0", Config: filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("expected error for a missing config")
+	}
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	if _, err := StartStandalone(StandaloneOptions{Addr: busy.Addr().String(), Config: config}); err == nil {
+		t.Error("expected error for an address in use")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := RunStandalone(ctx, StandaloneOptions{Addr: "127.0.0.1:0"}); err != nil {
+		t.Errorf("expected canceled standalone server to stop cleanly, got %v", err)
+	}
 }
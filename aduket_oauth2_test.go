@@ -0,0 +1,159 @@
+package aduket
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ismailtsdln/aduket/auth"
+)
+
+func TestOAuth2Server(t *testing.T) {
+	idp := NewOAuth2Server()
+	defer idp.Close()
+	idp.AddClient("web", "s3cret", "https://app.example/callback").
+		AddClient("cli", "", "http://localhost/cb").
+		User("alice", auth.Claims{"email": "alice@example.com"}).
+		TokenLifetime(5*time.Minute, time.Hour)
+
+	var discovery map[string]interface{}
+	getJSON(t, idp.URL+OIDCDiscoveryPath, &discovery)
+	if discovery["issuer"] != idp.URL || discovery["jwks_uri"] != idp.URL+JWKSPath {
+		t.Errorf("unexpected discovery document %v", discovery)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	authorize := func(query url.Values) url.Values {
+		resp, err := noRedirect.Get(idp.URL + OAuth2AuthorizePath + "?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("expected a redirect, got %d", resp.StatusCode)
+		}
+		location, _ := url.Parse(resp.Header.Get("Location"))
+		return location.Query()
+	}
+	token := func(form url.Values) (int, map[string]interface{}) {
+		resp, err := http.PostForm(idp.URL+OAuth2TokenPath, form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	// Authorization code flow of a public client with PKCE.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	callback := authorize(url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"cli"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-1"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	})
+	if callback.Get("state") != "xyz" || callback.Get("code") == "" {
+		t.Fatalf("unexpected callback %v", callback)
+	}
+	exchange := url.Values{"grant_type": {"authorization_code"}, "client_id": {"cli"}, "code": {callback.Get("code")}, "code_verifier": {"wrong"}}
+	if status, body := token(exchange); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("expected a wrong verifier to fail, got %d %v", status, body)
+	}
+
+	callback = authorize(url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"cli"},
+		"scope":                 {"openid email"},
+		"nonce":                 {"n-1"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	})
+	exchange.Set("code", callback.Get("code"))
+	exchange.Set("code_verifier", verifier)
+	status, tokens := token(exchange)
+	if status != http.StatusOK || tokens["token_type"] != "Bearer" || tokens["expires_in"] != float64(300) {
+		t.Fatalf("unexpected token response %d %v", status, tokens)
+	}
+	if status, _ := token(exchange); status != http.StatusBadRequest {
+		t.Errorf("expected a code to be single use, got %d", status)
+	}
+
+	jwks := fetchJWKS(t, idp.URL+JWKSPath)
+	idClaims, err := auth.RequireClaims(jwks, auth.Claims{"iss": idp.URL, "aud": "cli", "nonce": "n-1"}).Verify(tokens["id_token"].(string))
+	if err != nil || idClaims["sub"] != "alice" || idClaims["email"] != "alice@example.com" {
+		t.Errorf("unexpected ID token claims %v, %v", idClaims, err)
+	}
+
+	req, _ := http.NewRequest("GET", idp.URL+OAuth2UserInfoPath, nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	var info map[string]interface{}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if info["sub"] != "alice" || info["email"] != "alice@example.com" {
+		t.Errorf("unexpected user info %v", info)
+	}
+
+	// Refresh tokens are rotated.
+	refresh := url.Values{"grant_type": {"refresh_token"}, "client_id": {"cli"}, "refresh_token": {tokens["refresh_token"].(string)}}
+	if status, body := token(refresh); status != http.StatusOK || body["refresh_token"] == tokens["refresh_token"] {
+		t.Errorf("unexpected refresh response %d %v", status, body)
+	}
+	if status, _ := token(refresh); status != http.StatusBadRequest {
+		t.Errorf("expected a used refresh token to fail, got %d", status)
+	}
+
+	// Client credentials of a confidential client, with Basic authentication.
+	req, _ = http.NewRequest("POST", idp.URL+OAuth2TokenPath, strings.NewReader("grant_type=client_credentials&scope=orders"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("web", "s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cc map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&cc)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || cc["scope"] != "orders" || cc["refresh_token"] != nil {
+		t.Errorf("unexpected client credentials response %d %v", resp.StatusCode, cc)
+	}
+	if status, body := token(url.Values{"grant_type": {"client_credentials"}, "client_id": {"web"}, "client_secret": {"wrong"}}); status != http.StatusUnauthorized || body["error"] != "invalid_client" {
+		t.Errorf("expected a wrong secret to fail, got %d %v", status, body)
+	}
+
+	// The endpoints do not count as unmet expectations.
+	idp.Verify(t)
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fetchJWKS(t *testing.T, url string) *auth.JWKS {
+	t.Helper()
+	var jwks auth.JWKS
+	getJSON(t, url, &jwks)
+	return &jwks
+}
@@ -0,0 +1,35 @@
+package aduket
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPartitionBy(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.PartitionBy("X-Tenant")
+
+	s.Expect("GET", "/items").Response(http.StatusOK, "items")
+	s.Expect("POST", "/items").Response(http.StatusCreated, "created")
+
+	send := func(tenant, method string) {
+		req, _ := http.NewRequest(method, s.URL+"/items", nil)
+		req.Header.Set("X-Tenant", tenant)
+		http.DefaultClient.Do(req)
+	}
+	send("acme", "GET")
+	send("globex", "POST")
+	send("acme", "GET")
+
+	acme := s.Partition("acme")
+	acme.AssertRequestCount(t, 2)
+	acme.AssertCalled(t, "GET", "/items")
+	acme.AssertNotCalled(t, "POST", "/items")
+	s.Partition("globex").AssertCalled(t, "POST", "/items")
+
+	if ids := s.Partitions(); !reflect.DeepEqual(ids, []string{"acme", "globex"}) {
+		t.Errorf("unexpected partitions %v", ids)
+	}
+}
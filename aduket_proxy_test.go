@@ -0,0 +1,106 @@
+package aduket
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxyRecordReplay(t *testing.T) {
+	upstreamCalls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Upstream", "yes")
+		if r.URL.Path == "/api/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"path":"` + r.URL.Path + `","q":"` + r.URL.Query().Get("q") + `"}`))
+	}))
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+	get := func(s *Server, path string) (int, string, http.Header) {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), resp.Header
+	}
+
+	// First run: record through the proxy.
+	s := NewServer()
+	s.Expect("GET", "/local").Response(http.StatusOK, "local")
+	if err := s.ProxyTo(upstream.URL + "/api"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordTo(cassette); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, body, header := get(s, "/users?q=1"); status != http.StatusOK || body != `{"path":"/api/users","q":"1"}` || header.Get("X-Upstream") != "yes" {
+		t.Errorf("unexpected proxied response %d %s %v", status, body, header)
+	}
+	get(s, "/users?q=1")
+	get(s, "/missing")
+	if _, body, _ := get(s, "/local"); body != "local" {
+		t.Errorf("expected expectations to take precedence, got %q", body)
+	}
+	if upstreamCalls != 2 {
+		t.Errorf("expected recorded exchanges to be replayed, upstream was called %d times", upstreamCalls)
+	}
+	if n := len(s.RequestsTagged("proxied")); n != 2 {
+		t.Errorf("expected 2 proxied requests, got %d", n)
+	}
+	s.Close()
+
+	data, _ := os.ReadFile(cassette)
+	var recorded []map[string]interface{}
+	if err := json.Unmarshal(data, &recorded); err != nil || len(recorded) != 2 {
+		t.Fatalf("expected 2 recordings, got %s (%v)", data, err)
+	}
+
+	// Second run: replay without the upstream.
+	upstream.Close()
+	s = NewServer()
+	defer s.Close()
+	if err := s.ReplayFrom(cassette); err != nil {
+		t.Fatal(err)
+	}
+	if status, body, header := get(s, "/users?q=1"); status != http.StatusOK || body != `{"path":"/api/users","q":"1"}` || header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected replayed response %d %s %v", status, body, header)
+	}
+	if status, _, _ := get(s, "/missing"); status != http.StatusNotFound {
+		t.Errorf("expected recorded 404, got %d", status)
+	}
+	if status, _, _ := get(s, "/users?q=2"); status != http.StatusNotFound {
+		t.Errorf("expected other queries not to match, got %d", status)
+	}
+}
+
+func TestProxyUpstreamDown(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	s := NewServer()
+	defer s.Close()
+	s.ProxyTo(upstream.URL)
+
+	resp, err := http.Get(s.URL + "/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d", resp.StatusCode)
+	}
+	if err := s.ProxyTo("not a url"); err == nil {
+		t.Error("expected relative upstream to be rejected")
+	}
+}
@@ -0,0 +1,82 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("POST", "/orders").Response(http.StatusCreated, "")
+	s.Expect("POST", "/fail").Response(http.StatusInternalServerError, "")
+	s.Expect("GET", "/users/{id}").Response(http.StatusOK, "")
+
+	http.Post(s.URL+"/orders", "application/json", strings.NewReader(`{"id":1}`))
+	http.Post(s.URL+"/fail", "application/json", nil)
+	http.Post(s.URL+"/fail", "application/json", nil)
+	http.Get(s.URL + "/users/1")
+	req, _ := http.NewRequest("GET", s.URL+"/users/2?full=1", nil)
+	req.Header.Set("X-Trace", "abc")
+	http.DefaultClient.Do(req)
+	s.GetRequest(0).Tag("first")
+
+	tests := []struct {
+		query string
+		count int
+	}{
+		{"SELECT count(*) WHERE method='POST' AND status>=500", 2},
+		{"select count(*) from requests", 5},
+		{"SELECT * WHERE path LIKE '/users/%'", 2},
+		{"method = 'GET' OR status = 201", 3},
+		{"method = 'get'", 2},
+		{"method LIKE 'po%'", 3},
+		{"NOT (method = 'POST')", 2},
+		{"header.X-Trace = 'abc'", 1},
+		{"query = 'full=1'", 1},
+		{"tag = 'first'", 1},
+		{"tag != 'first' AND body LIKE '%id%'", 0},
+		{"status <> 404", 5},
+		{"expectation = 'GET /users/{id}'", 2},
+		{"SELECT * LIMIT 2", 2},
+		{"", 5},
+	}
+	for _, tt := range tests {
+		res, err := s.Query(tt.query)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if res.Count != tt.count {
+			t.Errorf("%q: expected %d, got %d", tt.query, tt.count, res.Count)
+		}
+	}
+
+	res, _ := s.Query("SELECT * WHERE method = 'POST' ORDER BY status DESC")
+	if len(res.Requests) != 3 || res.Requests[0].StatusCode != 500 || res.Requests[2].StatusCode != 201 {
+		t.Errorf("expected requests ordered by status, got %v", res.Requests)
+	}
+	if res, _ := s.Query("SELECT count(*)"); res.Requests != nil {
+		t.Error("expected count(*) to return no requests")
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, q := range []string{
+		"SELECT name",
+		"method = ",
+		"colour = 'red'",
+		"method = 'GET",
+		"status > 1 AND",
+		"(method = 'GET'",
+		"tag > 'x'",
+		"SELECT * FROM users",
+		"method = 'GET' extra",
+	} {
+		if _, err := ParseQuery(q); err == nil {
+			t.Errorf("%q: expected error", q)
+		}
+	}
+}
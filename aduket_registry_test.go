@@ -0,0 +1,119 @@
+package aduket
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// deadPID returns the pid of a process that has exited.
+func deadPID(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := OpenRegistry(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/users").Response(200, "[]")
+
+	if err := r.Register("users", s); err != nil {
+		t.Fatal(err)
+	}
+	info, ok := r.Lookup("users")
+	if !ok || info.URL != s.URL || len(info.Services) != 1 {
+		t.Errorf("unexpected lookup result %+v", info)
+	}
+	if err := r.Register("users", s); err != nil {
+		t.Errorf("expected re-registration by the same process to succeed, got %v", err)
+	}
+	if err := r.Register("../escape", s); err == nil {
+		t.Error("expected invalid name to be rejected")
+	}
+
+	stale := fmt.Sprintf(`{"url":"http://127.0.0.1:1","pid":%d}`, deadPID(t))
+	os.WriteFile(filepath.Join(r.dir, "gone.json"), []byte(stale), 0o644)
+
+	instances, err := r.Instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances["users"].URL != s.URL {
+		t.Errorf("expected only the live instance, got %+v", instances)
+	}
+	if _, err := os.Stat(filepath.Join(r.dir, "gone.json")); !os.IsNotExist(err) {
+		t.Error("expected stale entry to be removed")
+	}
+
+	if err := r.Unregister("users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Lookup("users"); ok {
+		t.Error("expected entry to be removed")
+	}
+}
+
+func TestRegistryPorts(t *testing.T) {
+	r, err := OpenRegistry(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := r.ReservePort(18080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReservePort(18080); err == nil {
+		t.Error("expected reserved port to be refused")
+	}
+	release()
+	release, err = r.ReservePort(18080)
+	if err != nil {
+		t.Fatalf("expected released port to be reservable, got %v", err)
+	}
+	defer release()
+
+	lock := filepath.Join(r.dir, "port-18081.lock")
+	os.WriteFile(lock, []byte(fmt.Sprintf("%d\n", deadPID(t))), 0o644)
+	port, releaseFree, err := r.ReserveFreePort(18080, 18090)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseFree()
+	if port != 18081 {
+		t.Errorf("expected the stale reservation of 18081 to be reclaimed, got %d", port)
+	}
+
+	// A lock still being written by its owner is not reclaimed.
+	os.WriteFile(filepath.Join(r.dir, "port-18082.lock"), nil, 0o644)
+	if _, err := r.ReservePort(18082); err == nil {
+		t.Error("expected a fresh unreadable reservation to be refused")
+	}
+}
+
+func TestRegistryReclaimLive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	live := fmt.Sprintf(`{"url":"http://127.0.0.1:1","pid":%d}`, os.Getpid())
+	os.WriteFile(path, []byte(live), 0o644)
+
+	if err := reclaim(path, entryPID); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != live {
+		t.Errorf("expected the live entry to be put back, got %q, %v", data, err)
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) != 0 {
+		t.Errorf("expected no files left aside, got %v", matches)
+	}
+}
@@ -0,0 +1,154 @@
+package aduket
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/users").Named("list").Response(http.StatusOK, "[]")
+	s.Expect("POST", "/users").TimesSet(2).Response(http.StatusCreated, "")
+	s.Health()
+
+	http.Get(s.URL + "/users")
+	http.Post(s.URL+"/users", "application/json", nil)
+	http.Get(s.URL + "/missing?x=1")
+	http.Get(s.URL + "/health")
+
+	report := s.Report()
+	if report.Passed {
+		t.Error("expected report to fail")
+	}
+	if report.Requests != 4 {
+		t.Errorf("expected 4 requests, got %d", report.Requests)
+	}
+	if len(report.Expectations) != 2 {
+		t.Fatalf("expected builtin expectations to be skipped, got %+v", report.Expectations)
+	}
+	if e := report.Expectations[0]; e.Name != "list" || e.MatchedTimes != 1 || !e.Satisfied {
+		t.Errorf("unexpected report for GET /users: %+v", e)
+	}
+	if e := report.Expectations[1]; e.MatchedTimes != 1 || e.Satisfied {
+		t.Errorf("expected POST /users to be unsatisfied: %+v", e)
+	}
+	if len(report.Unmatched) != 1 || report.Unmatched[0].URL != "/missing?x=1" || report.Unmatched[0].StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected unmatched traffic: %+v", report.Unmatched)
+	}
+
+	mockT := &testing.T{}
+	s.AssertRequestCount(mockT, 1)
+	if failures := s.Report().Failures; len(failures) != 1 || failures[0] != "expected 1 requests, got 4" {
+		t.Errorf("expected failed assertion in report, got %q", failures)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := s.WriteReport(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("invalid report %s: %v", data, err)
+	}
+	for _, key := range []string{"generatedAt", "passed", "expectations", "requests", "unmatched", "failures"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("expected %q in report", key)
+		}
+	}
+}
+
+func TestReportPassed(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/").Response(http.StatusOK, "ok")
+	http.Get(s.URL)
+
+	if report := s.Report(); !report.Passed {
+		t.Errorf("expected report to pass: %+v", report)
+	}
+}
+
+func TestReportJUnit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/users").Named("list").Response(http.StatusOK, "[]")
+	s.Expect("DELETE", "/users/{id}").Response(http.StatusNoContent, "")
+	http.Get(s.URL + "/users")
+	http.Get(s.URL + "/unknown")
+
+	data, err := s.Report().JUnit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var suites struct {
+		Suites []struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Cases    []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Message string `xml:"message,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("invalid JUnit XML: %v\n%s", err, data)
+	}
+	if len(suites.Suites) != 1 {
+		t.Fatalf("expected one suite, got %d", len(suites.Suites))
+	}
+	suite := suites.Suites[0]
+	if suite.Tests != 3 || suite.Failures != 2 {
+		t.Errorf("expected 3 tests with 2 failures, got %d/%d", suite.Tests, suite.Failures)
+	}
+	if c := suite.Cases[0]; c.Name != "list (GET /users)" || c.Failure != nil {
+		t.Errorf("unexpected first case: %+v", c)
+	}
+	if c := suite.Cases[1]; c.Failure == nil || c.Failure.Message != "expected DELETE /users/{id} to be called, but it was not" {
+		t.Errorf("unexpected second case: %+v", c)
+	}
+	if c := suite.Cases[2]; c.Failure == nil || !strings.Contains(c.Failure.Text, "GET /unknown -> 404") {
+		t.Errorf("expected unmatched traffic failure, got %+v", c)
+	}
+}
+
+func TestReportEvictedRequests(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetMaxCapturedRequests(2)
+	s.Expect("GET", "/known").Response(http.StatusOK, "")
+
+	http.Get(s.URL + "/missing")
+	for i := 0; i < 3; i++ {
+		http.Get(s.URL + "/known")
+	}
+
+	report := s.Report()
+	if report.Requests != 4 || report.UnmatchedCount != 1 || len(report.Unmatched) != 0 {
+		t.Errorf("expected 4 requests with 1 evicted unmatched one, got %d, %d and %v",
+			report.Requests, report.UnmatchedCount, report.Unmatched)
+	}
+	if report.Passed {
+		t.Error("expected an evicted unmatched request to fail the report")
+	}
+	data, err := report.JUnit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "1 requests matched no expectation") || !strings.Contains(string(data), "1 more evicted") {
+		t.Errorf("expected JUnit to count the evicted request, got %s", data)
+	}
+}
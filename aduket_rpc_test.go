@@ -0,0 +1,75 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGRPCWeb(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.ExpectRPC("acme.v1.UserService", "GetUser").RPCResponse([]byte("user-1"))
+
+	req := frame(0, []byte("request"))
+	resp, err := http.Post(s.URL+"/acme.v1.UserService/GetUser", "application/grpc-web+proto", bytes.NewReader(req))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	messages, err := decodeFrames(body)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(messages) != 1 || string(messages[0]) != "user-1" {
+		t.Errorf("unexpected messages %q", messages)
+	}
+	if !bytes.Contains(body, []byte("grpc-status: 0")) {
+		t.Error("expected trailers in body")
+	}
+
+	captured, err := s.GetRequest(0).RPCMessages()
+	if err != nil || len(captured) != 1 || string(captured[0]) != "request" {
+		t.Errorf("unexpected captured messages %q (%v)", captured, err)
+	}
+}
+
+func TestGRPCWebText(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.ExpectRPC("acme.v1.UserService", "GetUser").RPCError(RPCNotFound, "missing")
+
+	req := base64.StdEncoding.EncodeToString(frame(0, []byte("request")))
+	resp, _ := http.Post(s.URL+"/acme.v1.UserService/GetUser", "application/grpc-web-text", strings.NewReader(req))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	decoded, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		t.Fatalf("expected base64 response: %v", err)
+	}
+	if !bytes.Contains(decoded, []byte("grpc-status: 5")) {
+		t.Errorf("expected not found status in trailers, got %q", decoded)
+	}
+}
+
+func TestConnectUnaryError(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.ExpectRPC("acme.v1.UserService", "GetUser").RPCError(RPCNotFound, "missing")
+
+	resp, _ := http.Post(s.URL+"/acme.v1.UserService/GetUser", "application/json", strings.NewReader(`{}`))
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), `"code":"not_found"`) {
+		t.Errorf("unexpected error body %s", body)
+	}
+}
@@ -0,0 +1,78 @@
+package aduket
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestScenario(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	todo := s.Scenario("todo")
+	todo.Expect("GET", "/todo").WhenState(ScenarioStarted).Response(http.StatusNotFound, "none")
+	todo.Expect("POST", "/todo").WhenState(ScenarioStarted).WillSetState("created").Response(http.StatusCreated, "")
+	todo.Expect("GET", "/todo").WhenState("created").Response(http.StatusOK, "buy milk")
+	todo.Expect("DELETE", "/todo").WhenState("created").WillSetState("deleted").Response(http.StatusNoContent, "")
+	todo.Expect("GET", "/todo").WhenState("deleted").Response(http.StatusGone, "gone")
+
+	do := func(method string) (int, string) {
+		req, _ := http.NewRequest(method, s.URL+"/todo", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	steps := []struct {
+		method string
+		status int
+		body   string
+		state  string
+	}{
+		{"GET", http.StatusNotFound, "none", ScenarioStarted},
+		{"POST", http.StatusCreated, "", "created"},
+		{"POST", http.StatusNotFound, "", "created"}, // Only allowed once started
+		{"GET", http.StatusOK, "buy milk", "created"},
+		{"DELETE", http.StatusNoContent, "", "deleted"},
+		{"GET", http.StatusGone, "gone", "deleted"},
+	}
+	for i, step := range steps {
+		status, body := do(step.method)
+		if status != step.status || (step.body != "" && body != step.body) {
+			t.Errorf("step %d: expected %d %q, got %d %q", i, step.status, step.body, status, body)
+		}
+		if state := todo.State(); state != step.state {
+			t.Errorf("step %d: expected state %q, got %q", i, step.state, state)
+		}
+	}
+
+	if s.Scenario("todo") != todo {
+		t.Error("expected the same scenario for the same name")
+	}
+
+	s.ResetRequests()
+	if todo.State() != ScenarioStarted {
+		t.Errorf("expected ResetRequests to restart scenarios, got %q", todo.State())
+	}
+
+	c := s.Clone()
+	defer c.Close()
+	todo.SetState("created")
+	if state := c.Scenario("todo").State(); state != ScenarioStarted {
+		t.Errorf("expected clone to have its own scenario state, got %q", state)
+	}
+}
+
+func TestWhenStateWithoutScenario(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	newExpectation("GET", "/").WhenState("x")
+}
@@ -0,0 +1,116 @@
+package aduket
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"testing"
+	"testing/quick"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["id", "email", "roles"],
+	"properties": {
+		"id": {"type": "string", "format": "uuid"},
+		"email": {"type": "string", "format": "email"},
+		"age": {"type": "integer", "minimum": 18, "maximum": 99},
+		"score": {"type": "number", "minimum": 0, "maximum": 1},
+		"status": {"enum": ["active", "banned"]},
+		"nickname": {"type": "string", "minLength": 3, "maxLength": 8},
+		"roles": {"type": "array", "minItems": 1, "maxItems": 3, "items": {"type": "string", "enum": ["admin", "user"]}}
+	}
+}`
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// checkUser reports whether v satisfies userSchema.
+func checkUser(v map[string]interface{}) bool {
+	id, ok := v["id"].(string)
+	if !ok || !uuidPattern.MatchString(id) {
+		return false
+	}
+	if email, ok := v["email"].(string); !ok || !regexp.MustCompile(`^\w+@example\.com$`).MatchString(email) {
+		return false
+	}
+	if age, ok := v["age"]; ok {
+		if n := age.(float64); n < 18 || n > 99 || n != float64(int(n)) {
+			return false
+		}
+	}
+	if score, ok := v["score"]; ok {
+		if n := score.(float64); n < 0 || n > 1 {
+			return false
+		}
+	}
+	if status, ok := v["status"]; ok && status != "active" && status != "banned" {
+		return false
+	}
+	if nick, ok := v["nickname"]; ok {
+		if n := len(nick.(string)); n < 3 || n > 8 {
+			return false
+		}
+	}
+	roles, ok := v["roles"].([]interface{})
+	if !ok || len(roles) < 1 || len(roles) > 3 {
+		return false
+	}
+	return true
+}
+
+func TestGenerateFrom(t *testing.T) {
+	schema, err := ParseSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/user").Seed(1).GenerateFrom(schema)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get(s.URL + "/user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("expected application/json, got %s", ct)
+		}
+		var user map[string]interface{}
+		if err := json.Unmarshal(body, &user); err != nil {
+			t.Fatalf("invalid JSON %s: %v", body, err)
+		}
+		if !checkUser(user) {
+			t.Errorf("generated value violates schema: %s", body)
+		}
+		seen[string(body)] = true
+	}
+	if len(seen) < 45 {
+		t.Errorf("expected varied payloads, got %d distinct values", len(seen))
+	}
+}
+
+func TestSchemaGenerateQuick(t *testing.T) {
+	schema, _ := ParseSchema([]byte(userSchema))
+
+	property := func(seed int64) bool {
+		data, _ := json.Marshal(schema.Generate(rand.New(rand.NewSource(seed))))
+		var user map[string]interface{}
+		return json.Unmarshal(data, &user) == nil && checkUser(user)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+
+	a, _ := json.Marshal(schema.Generate(rand.New(rand.NewSource(7))))
+	b, _ := json.Marshal(schema.Generate(rand.New(rand.NewSource(7))))
+	if string(a) != string(b) {
+		t.Errorf("expected the same seed to generate the same value, got %s and %s", a, b)
+	}
+}
@@ -75,3 +75,45 @@ func TestMethodValidation(t *testing.T) {
 }
 
 // ... rest of the existing tests ...
+
+func TestStrictLimits(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.MaxURLLength = 20
+	s.MaxHeaders = 8
+	s.AllowedMethods = []string{"GET", "POST"}
+	s.Expect("GET", "/ok").Response(http.StatusOK, "ok")
+
+	resp, _ := http.Get(s.URL + "/ok?" + strings.Repeat("a", 30))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestURITooLong {
+		t.Errorf("expected 414, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", s.URL+"/ok", nil)
+	for i := 0; i < 10; i++ {
+		req.Header.Add("X-Extra", "v")
+	}
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("expected 431, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("DELETE", s.URL+"/ok", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, POST" {
+		t.Errorf("expected 405 with Allow, got %d %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+
+	resp, _ = http.Get(s.URL + "/ok")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 within limits, got %d", resp.StatusCode)
+	}
+
+	if s.RequestCount() != 4 || s.GetRequest(2).Expectation != nil {
+		t.Errorf("expected rejected requests to be recorded unmatched, got %d", s.RequestCount())
+	}
+}
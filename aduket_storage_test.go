@@ -0,0 +1,87 @@
+package aduket
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	st, err := OpenFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer()
+	s.CompressHistory(true)
+	s.UseStorage(st)
+	s.Expect("POST", "/orders").Named("create order").Response(http.StatusCreated, `{"id":1}`)
+
+	large := strings.Repeat("x", 2*minCompressSize)
+	http.Post(s.URL+"/orders?dry=1", "text/plain", strings.NewReader(large))
+	http.Get(s.URL + "/missing")
+	s.ResetRequests()
+	s.Close()
+	st.Close()
+
+	stored, err := LoadStoredRequests(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("expected 2 stored requests, got %d", len(stored))
+	}
+	first := stored[0]
+	if first.Method != "POST" || first.StatusCode != http.StatusCreated || first.Expectation != "create order" {
+		t.Errorf("unexpected stored request %+v", first)
+	}
+	if string(first.Body) != large || string(first.ResponseBody) != `{"id":1}` {
+		t.Error("expected bodies to be stored uncompressed")
+	}
+	if stored[1].StatusCode != http.StatusNotFound || stored[1].Expectation != "" {
+		t.Errorf("unexpected stored request %+v", stored[1])
+	}
+
+	c, err := first.Captured()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, _ := ParseQuery("path = '/orders' AND query = 'dry=1' AND header.Content-Type = 'text/plain'")
+	if !q.Match(c) {
+		t.Error("expected rebuilt request to match query")
+	}
+
+	// Reopening keeps the history and appends to it.
+	st, err = OpenFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	st.Append(StoredRequest{Method: "GET", URL: "/later"})
+	if stored, _ := st.Load(); len(stored) != 3 {
+		t.Errorf("expected 3 stored requests after reopening, got %d", len(stored))
+	}
+	st.Clear()
+	if stored, _ := st.Load(); len(stored) != 0 {
+		t.Errorf("expected cleared storage, got %d", len(stored))
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	st := NewMemoryStorage()
+	s := NewServer()
+	defer s.Close()
+	s.UseStorage(st)
+	s.OnRequest = func(c *CapturedRequest) { c.Tag("seen") }
+
+	http.Get(s.URL + "/a")
+	s.UseStorage(nil)
+	http.Get(s.URL + "/b")
+
+	stored, _ := st.Load()
+	if len(stored) != 1 || !strings.HasSuffix(stored[0].URL, "/a") || len(stored[0].Tags) != 1 {
+		t.Errorf("expected only the first request with its tag, got %+v", stored)
+	}
+}
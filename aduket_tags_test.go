@@ -0,0 +1,56 @@
+package aduket
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequestTags(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/items").
+		MatchFunc(func(r *http.Request, body []byte) bool {
+			if r.Header.Get("X-Retry") != "" {
+				TagRequest(r, "retry")
+			}
+			return true
+		}).
+		RespondWith(func(w http.ResponseWriter, r *http.Request) {
+			TagRequest(r, "served")
+			w.WriteHeader(http.StatusOK)
+		})
+	s.OnRequest = func(c *CapturedRequest) {
+		if c.URL.Query().Get("slow") != "" {
+			c.Tag("slow", "slow")
+		}
+	}
+
+	http.Get(s.URL + "/items")
+	req, _ := http.NewRequest("GET", s.URL+"/items?slow=1", nil)
+	req.Header.Set("X-Retry", "1")
+	http.DefaultClient.Do(req)
+	http.Get(s.URL + "/missing")
+
+	if reqs := s.RequestsTagged("retry"); len(reqs) != 1 || reqs[0].URL.RawQuery != "slow=1" {
+		t.Errorf("expected one retry, got %d", len(reqs))
+	}
+	if reqs := s.RequestsTagged("served"); len(reqs) != 2 {
+		t.Errorf("expected two served requests, got %d", len(reqs))
+	}
+	if tags := s.GetRequest(1).Tags(); len(tags) != 3 {
+		t.Errorf("expected tags retry, served and slow once each, got %v", tags)
+	}
+	if s.GetRequest(2).HasTag("served") {
+		t.Error("expected unmatched request to be untagged")
+	}
+
+	s.GetRequest(2).Tag("unmatched")
+	if reqs := s.RequestsTagged("unmatched"); len(reqs) != 1 {
+		t.Errorf("expected tags added after the fact to be found, got %d", len(reqs))
+	}
+
+	// Requests not served by aduket are ignored.
+	plain, _ := http.NewRequest("GET", "/", nil)
+	TagRequest(plain, "x")
+}
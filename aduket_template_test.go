@@ -0,0 +1,92 @@
+package aduket
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	s := NewUnstartedServer()
+	s.Seed(1)
+
+	tmpl := template.Must(template.New("t").Funcs(s.TemplateFuncs()).Parse(
+		`{{uuid}}|{{randInt 5 6}}|{{b64 "hi"}}|{{hmac "k" "v"}}|{{signJWT "secret" (dict "sub" "42")}}|{{json (dict "a" 1)}}`))
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, nil); err != nil {
+		t.Fatalf("template failed: %v", err)
+	}
+	parts := strings.Split(out.String(), "|")
+
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(parts[0]) {
+		t.Errorf("invalid uuid %q", parts[0])
+	}
+	if parts[1] != "5" || parts[2] != "aGk=" {
+		t.Errorf("unexpected randInt/b64 output %q %q", parts[1], parts[2])
+	}
+	if parts[3] != "c5d4be1992d50d3b41f9a21292fc67a28a1486fc64a0517d37f9af847e0732de" {
+		t.Errorf("unexpected hmac %q", parts[3])
+	}
+	if strings.Count(parts[4], ".") != 2 || !strings.HasPrefix(parts[4], "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.") {
+		t.Errorf("unexpected jwt %q", parts[4])
+	}
+	if parts[5] != `{"a":1}` {
+		t.Errorf("unexpected json %q", parts[5])
+	}
+}
+
+func TestTemplateResponse(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("POST", "/users/{id}").
+		TemplateResponse(http.StatusOK, `{"echo":"{{.Request.URL.Query.Get "q"}}","id":"{{.Params.id}}","name":{{json .JSON.name}},"len":{{len .Body}}}`)
+
+	resp, err := http.Post(s.URL+"/users/42?q=hi", "application/json", strings.NewReader(`{"name":"ada"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := `{"echo":"hi","id":"42","name":"ada","len":14}`; string(body) != want {
+		t.Errorf("expected %s, got %s", want, body)
+	}
+
+	s.Expect("GET", "/broken").TemplateResponse(http.StatusOK, `{{.Missing.Field}}`)
+	resp, _ = http.Get(s.URL + "/broken")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500 for failing template, got %d", resp.StatusCode)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected invalid template to panic")
+		}
+	}()
+	s.Expect("GET", "/invalid").TemplateResponse(http.StatusOK, `{{.Unclosed`)
+}
+
+func TestTemplateResponseJSON(t *testing.T) {
+	var exp Expectation
+	if err := json.Unmarshal([]byte(`{"method":"GET","path":"/t","status":200,"template":"{{uuid}}"}`), &exp); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer()
+	defer s.Close()
+	s.Expectations = append(s.Expectations, &exp)
+
+	resp, _ := http.Get(s.URL + "/t")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != 36 {
+		t.Errorf("expected rendered uuid, got %q", body)
+	}
+	if err := json.Unmarshal([]byte(`{"method":"GET","template":"{{"}`), &exp); err == nil {
+		t.Error("expected invalid template to fail decoding")
+	}
+}
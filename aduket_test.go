@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -54,6 +59,103 @@ func TestDelay(t *testing.T) {
 	}
 }
 
+func TestDelayClientAborted(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/slow").Delay(5*time.Second).Response(http.StatusOK, "slow")
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := client.Get(s.URL + "/slow"); err == nil {
+		t.Fatal("expected client timeout")
+	}
+
+	// The server stops waiting once the client is gone.
+	deadline := time.Now().Add(time.Second)
+	for s.RequestCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	req := s.GetRequest(0)
+	if req == nil {
+		t.Fatal("expected aborted request to be recorded without waiting for the delay")
+	}
+	if !req.ClientAborted || req.StatusCode != 0 {
+		t.Errorf("expected client aborted request without status, got %v %d", req.ClientAborted, req.StatusCode)
+	}
+}
+
+func TestDelayRange(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetRandSeed(7)
+
+	s.Expect("GET", "/jitter").DelayRange(20*time.Millisecond, 60*time.Millisecond).Response(http.StatusOK, "ok")
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		resp, err := http.Get(s.URL + "/jitter")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > 200*time.Millisecond {
+			t.Errorf("expected a delay between 20ms and 60ms, got %v", elapsed)
+		}
+	}
+
+	a, b := newLockedRand(7), newLockedRand(7)
+	distinct := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		d := randomDelay(a, 20*time.Millisecond, 60*time.Millisecond)
+		if d != randomDelay(b, 20*time.Millisecond, 60*time.Millisecond) {
+			t.Fatal("expected equal seeds to produce equal delays")
+		}
+		distinct[d] = true
+	}
+	if len(distinct) < 2 {
+		t.Error("expected delays to vary")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected an inverted range to panic")
+		}
+	}()
+	s.Expect("GET", "/bad").DelayRange(time.Second, time.Millisecond)
+}
+
+func TestTTFBAndBodyDuration(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/stream").
+		TTFB(50*time.Millisecond).
+		BodyDuration(200*time.Millisecond).
+		Response(http.StatusOK, strings.Repeat("x", 100))
+
+	start := time.Now()
+	resp, err := http.Get(s.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ttfb := time.Since(start)
+	body, _ := ioutil.ReadAll(resp.Body)
+	total := time.Since(start)
+
+	if ttfb < 50*time.Millisecond || ttfb > 150*time.Millisecond {
+		t.Errorf("expected headers after ~50ms, got %v", ttfb)
+	}
+	if total < 250*time.Millisecond {
+		t.Errorf("expected body to complete after ~250ms, got %v", total)
+	}
+	if len(body) != 100 || resp.ContentLength != 100 {
+		t.Errorf("expected 100 byte body, got %d (Content-Length %d)", len(body), resp.ContentLength)
+	}
+	if got := s.GetRequest(0).ResponseBody; len(got) != 100 {
+		t.Errorf("expected streamed body to be recorded, got %d bytes", len(got))
+	}
+}
+
 func TestDynamicResponder(t *testing.T) {
 	s := NewServer()
 	defer s.Close()
@@ -93,6 +195,136 @@ func TestQueryParams(t *testing.T) {
 	}
 }
 
+func TestPriority(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/items/{id}").Response(http.StatusOK, "default")
+	s.Expect("GET", "/items/{id}").WithQuery("fields", "all").Response(http.StatusOK, "specific")
+	s.Expect("GET", "/items/42").Response(http.StatusGone, "gone").Priority(10)
+	s.Expect("GET", "").Response(http.StatusServiceUnavailable, "maintenance").Priority(-1)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/items/1", http.StatusOK, "default"},
+		{"/items/1?fields=all", http.StatusOK, "specific"},
+		{"/items/42?fields=all", http.StatusGone, "gone"},
+		{"/other", http.StatusServiceUnavailable, "maintenance"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(s.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || string(body) != tt.body {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.path, tt.status, tt.body, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestExpectAny(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.ExpectAny("/health").Response(http.StatusOK, "up")
+	s.Expect("DELETE", "/health").Response(http.StatusMethodNotAllowed, "")
+	s.Expect("ANY", "/ping").Response(http.StatusOK, "pong")
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/health", http.StatusOK},
+		{"POST", "/health", http.StatusOK},
+		{"PATCH", "/health", http.StatusOK},
+		{"DELETE", "/health", http.StatusMethodNotAllowed},
+		{"PUT", "/ping", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(tt.method, s.URL+tt.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.status, resp.StatusCode)
+		}
+	}
+	s.Verify(t)
+}
+
+func TestDefaultResponse(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/ok").Response(http.StatusOK, "ok")
+	s.Default().Response(http.StatusServiceUnavailable, "maintenance").Headers(map[string]string{"Retry-After": "120"})
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(body)
+	}
+
+	if resp, body := get("/ok"); resp.StatusCode != http.StatusOK || body != "ok" {
+		t.Errorf("expected matched requests to be unaffected, got %d %q", resp.StatusCode, body)
+	}
+	resp, body := get("/missing")
+	if resp.StatusCode != http.StatusServiceUnavailable || body != "maintenance" || resp.Header.Get("Retry-After") != "120" {
+		t.Errorf("expected the default response, got %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+	if req := s.GetRequest(1); req.Expectation != nil || req.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the request to be recorded as unmatched, got %+v", req.Expectation)
+	}
+
+	s.ResetExpectations()
+	if resp, _ := get("/missing"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected ResetExpectations to restore the 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestHeaderMatching(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/report").WithHeader("accept", "text/csv").Response(http.StatusOK, "csv")
+	s.Expect("GET", "/report").WithHeaderRegex("Authorization", `^Bearer \S+$`).Response(http.StatusOK, "json")
+	s.Expect("GET", "/report").Response(http.StatusUnauthorized, "")
+
+	tests := []struct {
+		headers map[string][]string
+		status  int
+		body    string
+	}{
+		{map[string][]string{"Accept": {"application/json", "text/csv"}}, http.StatusOK, "csv"},
+		{map[string][]string{"Authorization": {"Bearer abc"}}, http.StatusOK, "json"},
+		{map[string][]string{"Authorization": {"Basic abc"}}, http.StatusUnauthorized, ""},
+		{nil, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", s.URL+"/report", nil)
+		req.Header = tt.headers
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || string(body) != tt.body {
+			t.Errorf("%v: expected %d %q, got %d %q", tt.headers, tt.status, tt.body, resp.StatusCode, body)
+		}
+	}
+}
+
 func TestTLSServer(t *testing.T) {
 	s := NewTLSServer()
 	defer s.Close()
@@ -117,6 +349,121 @@ func TestTLSServer(t *testing.T) {
 	}
 }
 
+func TestTLSServerClient(t *testing.T) {
+	s := NewTLSServer()
+	defer s.Close()
+
+	s.Expect("GET", "/secure").Response(http.StatusOK, "secure")
+
+	client := s.Client(WithCookieJar())
+	if client.Jar == nil {
+		t.Error("expected cookie jar to be configured")
+	}
+
+	// Relative URLs are resolved against the server.
+	req, _ := http.NewRequest("GET", "/secure", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	resp2, err := client.Get(s.URL + "/secure")
+	if err != nil {
+		t.Fatalf("failed to make absolute request: %v", err)
+	}
+	resp2.Body.Close()
+}
+
+func TestCookies(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("POST", "/login").
+		SetCookie(&http.Cookie{Name: "session", Value: "abc", Path: "/", HttpOnly: true}).
+		SetCookie(&http.Cookie{Name: "theme", Value: "dark"}).
+		Response(http.StatusNoContent, "")
+	s.Expect("GET", "/profile").WithCookie("session", "abc").Response(http.StatusOK, "profile")
+
+	client := s.Client(WithCookieJar())
+	resp, err := client.Post(s.URL+"/login", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(resp.Cookies()) != 2 {
+		t.Fatalf("expected 2 cookies, got %v", resp.Header["Set-Cookie"])
+	}
+
+	resp, err = client.Get(s.URL + "/profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected session cookie to match, got %d", resp.StatusCode)
+	}
+	s.AssertCookie(t, 1, "session", "abc")
+
+	resp, err = http.Get(s.URL + "/profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected request without cookie not to match, got %d", resp.StatusCode)
+	}
+	mockT := &testing.T{}
+	s.AssertCookie(mockT, 2, "session", "abc")
+	if !mockT.Failed() {
+		t.Error("expected missing cookie to fail")
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/admin").RequireBasicAuth("admin", "s3cret").Response(http.StatusOK, "admin")
+	s.Expect("GET", "/api").RequireBearerToken("token").Response(http.StatusOK, "api")
+
+	tests := []struct {
+		path, user, pass, authorization string
+		status                          int
+		challenge                       string
+	}{
+		{path: "/admin", user: "admin", pass: "s3cret", status: http.StatusOK},
+		{path: "/admin", user: "admin", pass: "wrong", status: http.StatusUnauthorized, challenge: `Basic realm="aduket", charset="UTF-8"`},
+		{path: "/admin", status: http.StatusUnauthorized, challenge: `Basic realm="aduket", charset="UTF-8"`},
+		{path: "/api", authorization: "Bearer token", status: http.StatusOK},
+		{path: "/api", authorization: "Bearer other", status: http.StatusUnauthorized, challenge: `Bearer realm="aduket", error="invalid_token"`},
+		{path: "/api", status: http.StatusUnauthorized, challenge: `Bearer realm="aduket"`},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", s.URL+tt.path, nil)
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.pass)
+		}
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || resp.Header.Get("WWW-Authenticate") != tt.challenge {
+			t.Errorf("%s %q: expected %d with challenge %q, got %d with %q", tt.path, tt.authorization, tt.status, tt.challenge, resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+	if rejected := len(s.RequestsTagged("unauthorized")); rejected != 4 {
+		t.Errorf("expected 4 requests tagged unauthorized, got %d", rejected)
+	}
+}
+
 func TestJSONAssertion(t *testing.T) {
 	s := NewServer()
 	defer s.Close()
@@ -174,3 +521,896 @@ func TestWebSocket(t *testing.T) {
 		t.Errorf("expected message '%s', got '%s'", string(msg), string(received))
 	}
 }
+
+func TestCompressHistory(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.CompressHistory(true)
+
+	large := strings.Repeat(`{"key":"value"},`, 200)
+	s.Expect("POST", "/big").Response(http.StatusOK, large)
+
+	http.Post(s.URL+"/big", "application/json", strings.NewReader(large))
+
+	req := s.GetRequest(0)
+	if req.BodyContent != nil || req.ResponseBody != nil {
+		t.Error("expected raw bodies to be released after compression")
+	}
+	if string(req.RequestBodyBytes()) != large {
+		t.Error("expected request body to be decompressed transparently")
+	}
+	if string(req.ResponseBodyBytes()) != large {
+		t.Error("expected response body to be decompressed transparently")
+	}
+}
+
+func TestMaxCapturedRequests(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetMaxCapturedRequests(3)
+	exp := s.Expect("GET", "/items/{id}").Response(http.StatusOK, "item")
+
+	for i := 0; i < 10; i++ {
+		resp, err := http.Get(fmt.Sprintf("%s/items/%d", s.URL, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	var paths []string
+	for i := 0; i < s.RequestCount(); i++ {
+		paths = append(paths, s.GetRequest(i).URL.Path)
+	}
+	if strings.Join(paths, " ") != "/items/7 /items/8 /items/9" {
+		t.Errorf("expected the 3 most recent requests, got %v", paths)
+	}
+	if exp.MatchedTimes != 10 {
+		t.Errorf("expected eviction to keep the match count, got %d", exp.MatchedTimes)
+	}
+
+	s.SetMaxCapturedRequests(1)
+	if s.RequestCount() != 1 || s.GetRequest(0).URL.Path != "/items/9" {
+		t.Errorf("expected lowering the limit to keep the newest request, got %d", s.RequestCount())
+	}
+}
+
+func TestCaptureBodies(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.CaptureBodies(false)
+	s.Expect("POST", "/echo").MatchFunc(func(r *http.Request, body []byte) bool {
+		return string(body) == "ping"
+	}).Response(http.StatusOK, "pong")
+
+	resp, err := http.Post(s.URL+"/echo", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "pong" {
+		t.Fatalf("expected body to be matched and answered, got %d %q", resp.StatusCode, body)
+	}
+
+	req := s.GetRequest(0)
+	if len(req.RequestBodyBytes()) != 0 || len(req.ResponseBodyBytes()) != 0 {
+		t.Errorf("expected no bodies in the history, got %q and %q", req.RequestBodyBytes(), req.ResponseBodyBytes())
+	}
+}
+
+func TestRespondWithCtx(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/users/{id}").RespondWithCtx(func(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+		if ctx.Server != s {
+			t.Error("expected server reference in context")
+		}
+		fmt.Fprintf(w, "user %s matched %d", ctx.Param("id"), ctx.Expectation.MatchedTimes)
+	})
+
+	resp, err := http.Get(s.URL + "/users/42")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "user 42 matched 1" {
+		t.Errorf("unexpected body %q", string(body))
+	}
+
+	// Responses written by responders are recorded as well.
+	req := s.GetRequest(0)
+	if req == nil || req.StatusCode != http.StatusOK || string(req.ResponseBody) != "user 42 matched 1" {
+		t.Errorf("expected responder output to be recorded, got %v", req)
+	}
+}
+
+func TestRewriteTransport(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/v1/charges").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	})
+
+	client := &http.Client{Transport: s.RewriteTransport("api.example.com")}
+	resp, err := client.Get("https://api.example.com/v1/charges")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "api.example.com" {
+		t.Errorf("expected original Host header to be preserved, got %q", string(body))
+	}
+}
+
+func TestStubJSON(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.StubJSON("GET /users/1", `{"id": 1}`)
+	s.StubJSON("get /users", []map[string]int{{"id": 1}})
+	s.StubJSON("GET /text", "plain text")
+
+	resp, _ := http.Get(s.URL + "/users/1")
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %s", ct)
+	}
+
+	resp, _ = http.Get(s.URL + "/users")
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != `[{"id":1}]` {
+		t.Errorf("expected encoded payload, got %s", string(body))
+	}
+
+	resp, _ = http.Get(s.URL + "/text")
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected text/plain, got %s", ct)
+	}
+}
+
+func TestInferContentType(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/json").Response(http.StatusOK, `{"id": 1}`)
+	s.Expect("GET", "/html").Response(http.StatusOK, "<html><body>hi</body></html>")
+	s.Expect("GET", "/explicit").
+		Response(http.StatusOK, `{"id": 1}`).
+		Headers(map[string]string{"Content-Type": "application/vnd.api+json"})
+
+	resp, _ := http.Get(s.URL + "/json")
+	if ct := resp.Header.Get("Content-Type"); ct == "application/json" {
+		t.Errorf("expected no inference before it is enabled, got %s", ct)
+	}
+
+	s.InferContentType(true)
+
+	tests := map[string]string{
+		"/json":     "application/json",
+		"/html":     "text/html; charset=utf-8",
+		"/explicit": "application/vnd.api+json",
+	}
+	for path, want := range tests {
+		resp, _ := http.Get(s.URL + path)
+		if ct := resp.Header.Get("Content-Type"); ct != want {
+			t.Errorf("%s: expected %s, got %s", path, want, ct)
+		}
+	}
+}
+
+func TestExpectAll(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	exps := s.ExpectAll([]Rule{
+		{Method: "GET", Path: "/a", Status: http.StatusOK, Body: "a"},
+		{Method: "GET", Path: "/b", Query: map[string]string{"x": "1"}, Status: http.StatusAccepted, Body: "b"},
+		{Name: "created", Method: "POST", Path: "/c", Status: http.StatusCreated, Headers: map[string]string{"Location": "/c/1"}},
+	})
+	if len(exps) != 3 {
+		t.Fatalf("expected 3 expectations, got %d", len(exps))
+	}
+
+	resp, _ := http.Get(s.URL + "/b?x=1")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected 202, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Post(s.URL+"/c", "text/plain", nil)
+	if resp.Header.Get("Location") != "/c/1" {
+		t.Errorf("expected Location header, got %q", resp.Header.Get("Location"))
+	}
+}
+
+func TestResponseOneOf(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/variant").Seed(7).ResponseOneOf(
+		Variant{Status: http.StatusOK, Body: "a", Weight: 3},
+		Variant{Status: http.StatusAccepted, Body: "b", Headers: map[string]string{"X-Variant": "b"}},
+	)
+
+	seen := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		resp, err := http.Get(s.URL + "/variant")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) == "b" && resp.Header.Get("X-Variant") != "b" {
+			t.Error("expected variant headers to be applied")
+		}
+		seen[string(body)]++
+	}
+	if seen["a"] == 0 || seen["b"] == 0 {
+		t.Errorf("expected both variants to be returned, got %v", seen)
+	}
+}
+
+func TestServerSeed(t *testing.T) {
+	run := func() string {
+		s := NewServer()
+		defer s.Close()
+		s.Seed(42)
+		s.Expect("GET", "/r").ResponseOneOf(
+			Variant{Status: http.StatusOK, Body: "a"},
+			Variant{Status: http.StatusOK, Body: "b"},
+			Variant{Status: http.StatusOK, Body: "c"},
+		)
+
+		var out string
+		for i := 0; i < 10; i++ {
+			resp, _ := http.Get(s.URL + "/r")
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			out += string(body)
+		}
+		return out
+	}
+
+	if first, second := run(), run(); first != second {
+		t.Errorf("expected identical sequences for the same seed, got %s and %s", first, second)
+	}
+}
+
+func TestMapRequest(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/mapped").
+		MapRequest(func(r *http.Request) *http.Request {
+			r = r.Clone(r.Context())
+			r.Header.Set("X-Injected", "yes")
+			return r
+		}).
+		RespondWith(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get("X-Injected")))
+		})
+
+	resp, _ := http.Get(s.URL + "/mapped")
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "yes" {
+		t.Errorf("expected responder to see mapped request, got %q", string(body))
+	}
+	if s.GetRequest(0).Header.Get("X-Injected") != "" {
+		t.Error("expected recorded request to be unchanged")
+	}
+}
+
+func TestReplaceExpectations(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/old").Response(http.StatusOK, "old")
+	s.Health()
+
+	s.ReplaceExpectations([]Rule{{Method: "GET", Path: "/new", Status: http.StatusOK, Body: "new"}})
+
+	resp, _ := http.Get(s.URL + "/old")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected old expectation to be removed, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(s.URL + "/new")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected new expectation to match, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(s.URL + "/health")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected health endpoint to survive replacement, got %d", resp.StatusCode)
+	}
+}
+
+func TestMethodOverride(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("DELETE", "/items/1").Response(http.StatusNoContent, "")
+
+	send := func(method string) int {
+		req, _ := http.NewRequest(method, s.URL+"/items/1", nil)
+		req.Header.Set(MethodOverrideHeader, "delete")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := send("POST"); status != http.StatusNotFound {
+		t.Errorf("expected override to be opt-in, got %d", status)
+	}
+
+	s.MethodOverride(true)
+	if status := send("POST"); status != http.StatusNoContent {
+		t.Errorf("expected overridden POST to match DELETE, got %d", status)
+	}
+	if status := send("GET"); status != http.StatusNotFound {
+		t.Errorf("expected override to apply to POST only, got %d", status)
+	}
+
+	req := s.GetRequest(1)
+	if req.Method != "DELETE" || req.OriginalMethod != "POST" {
+		t.Errorf("expected DELETE overriding POST, got %s over %s", req.Method, req.OriginalMethod)
+	}
+	s.AssertCalled(t, "DELETE", "/items/1")
+}
+
+func TestVaryBy(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Expect("GET", "/asset").
+		Response(http.StatusOK, "plain").
+		VaryBy("Accept-Encoding", map[string]Variant{
+			"br":   {Body: "brotli", Headers: map[string]string{"Content-Encoding": "br"}},
+			"gzip": {Body: "gzipped", Headers: map[string]string{"Content-Encoding": "gzip"}},
+		}).
+		VaryBy("Origin", map[string]Variant{
+			"https://app.example": {Headers: map[string]string{"Access-Control-Allow-Origin": "https://app.example"}},
+		})
+
+	tests := []struct {
+		encoding, origin string
+		body, allowed    string
+	}{
+		{encoding: "gzip", body: "gzipped"},
+		{encoding: "deflate, GZIP;q=0.8", body: "gzipped"},
+		{encoding: "identity", body: "plain"},
+		{origin: "https://app.example", body: "plain", allowed: "https://app.example"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", s.URL+"/asset", nil)
+		// Keep the transport from asking for and decoding gzip itself.
+		req.Header.Set("Accept-Encoding", tt.encoding)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.body || resp.Header.Get("Access-Control-Allow-Origin") != tt.allowed {
+			t.Errorf("%q %q: expected %q, got %q", tt.encoding, tt.origin, tt.body, body)
+		}
+		if vary := resp.Header.Values("Vary"); len(vary) != 2 || vary[0] != "Accept-Encoding" || vary[1] != "Origin" {
+			t.Errorf("expected Vary for both headers, got %v", vary)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected variants to keep the status, got %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestLocalizedResponse(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/greeting").LocalizedResponse(map[string]string{
+		"en":    "Hello",
+		"tr":    "Merhaba",
+		"pt-BR": "Olá",
+	})
+
+	tests := []struct {
+		accept, body, lang string
+	}{
+		{"tr", "Merhaba", "tr"},
+		{"de;q=1, tr;q=0.5, en;q=0.8", "Hello", "en"},
+		{"en-GB,tr;q=0.9", "Hello", "en"},
+		{"PT-br", "Olá", "pt-BR"},
+		{"tr;q=0, de", "Hello", "en"}, // No match, first language alphabetically
+		{"", "Hello", "en"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", s.URL+"/greeting", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept-Language", tt.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.body || resp.Header.Get("Content-Language") != tt.lang {
+			t.Errorf("%q: expected %s in %s, got %s in %s", tt.accept, tt.body, tt.lang, body, resp.Header.Get("Content-Language"))
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Vary") != "Accept-Language" {
+			t.Errorf("%q: unexpected status %d or Vary %q", tt.accept, resp.StatusCode, resp.Header.Get("Vary"))
+		}
+	}
+
+	s.Expect("GET", "/fallback").LocalizedResponse(map[string]string{"tr": "Merhaba", "*": "Hi"})
+	resp, _ := http.Get(s.URL + "/fallback")
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "Hi" || resp.Header.Get("Content-Language") != "" {
+		t.Errorf("expected wildcard fallback, got %s", body)
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	chunks := [][]byte{[]byte("data: 1\n"), []byte("data: 2\n"), []byte("data: 3\n")}
+	s.Expect("GET", "/events").StreamResponse(chunks, 20*time.Millisecond)
+	s.Expect("GET", "/truncated").StreamResponse(chunks, 0).AbortStreamAfter(2)
+
+	start := time.Now()
+	resp, err := http.Get(s.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("expected chunked encoding, got %v", resp.TransferEncoding)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "data: 1\ndata: 2\ndata: 3\n" {
+		t.Errorf("unexpected body %q (%v)", body, err)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("expected chunks to be spaced out, took %v", elapsed)
+	}
+
+	resp, err = http.Get(s.URL + "/truncated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil || string(body) != "data: 1\ndata: 2\n" {
+		t.Errorf("expected truncated body with an error, got %q (%v)", body, err)
+	}
+	if got := s.GetRequest(1); got == nil || string(got.ResponseBody) != "data: 1\ndata: 2\n" {
+		t.Error("expected aborted stream to be recorded")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected AbortStreamAfter without StreamResponse to panic")
+		}
+	}()
+	s.Expect("GET", "/plain").AbortStreamAfter(1)
+}
+
+func TestNDJSONStream(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/watch").NDJSONStream([]interface{}{
+		map[string]string{"type": "ADDED", "name": "a"},
+		map[string]string{"type": "DELETED", "name": "a"},
+	}, 10*time.Millisecond)
+
+	resp, err := http.Get(s.URL + "/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("expected application/x-ndjson, got %q", ct)
+	}
+	dec := json.NewDecoder(resp.Body)
+	var events []map[string]string
+	for dec.More() {
+		var ev map[string]string
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 2 || events[0]["type"] != "ADDED" || events[1]["type"] != "DELETED" {
+		t.Errorf("unexpected events %v", events)
+	}
+	if got := string(s.GetRequest(0).ResponseBody); got != "{\"name\":\"a\",\"type\":\"ADDED\"}\n{\"name\":\"a\",\"type\":\"DELETED\"}\n" {
+		t.Errorf("unexpected recorded body %q", got)
+	}
+}
+
+func TestABTest(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/home").ABTest(map[string]Variant{
+		"control": {Status: http.StatusOK, Body: "old", Weight: 3},
+		"new":     {Status: http.StatusOK, Body: "new", Weight: 1, Headers: map[string]string{"X-Variant": "new"}},
+	}, "X-User")
+
+	get := func(user, cookie string) string {
+		req, _ := http.NewRequest("GET", s.URL+"/home", nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "X-User", Value: cookie})
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if (string(body) == "new") != (resp.Header.Get("X-Variant") == "new") {
+			t.Errorf("expected variant headers with body %q", body)
+		}
+		return string(body)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		first := get(user, "")
+		if again := get(user, ""); again != first {
+			t.Fatalf("expected %s to stick to %s, got %s", user, first, again)
+		}
+		counts[first]++
+	}
+	if counts["new"] < 20 || counts["new"] > 80 {
+		t.Errorf("expected about a quarter of users on the new variant, got %v", counts)
+	}
+
+	if get("", "user-7") != get("user-7", "") {
+		t.Error("expected the cookie to identify the client as well")
+	}
+	if reqs := s.RequestsTagged("ab:new"); len(reqs) == 0 {
+		t.Error("expected requests tagged with their variant")
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/ping").Response(http.StatusOK, "pong")
+
+	pooled := &http.Client{Transport: &http.Transport{}}
+	fresh := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for _, client := range []*http.Client{pooled, pooled, fresh} {
+		resp, err := client.Get(s.URL + "/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	if s.GetRequest(0).ConnID == 0 {
+		t.Error("expected connection IDs to be recorded")
+	}
+	s.AssertNewConnection(t, 0)
+	s.AssertConnectionReused(t, 0, 1)
+	s.AssertNewConnection(t, 2)
+
+	mockT := &testing.T{}
+	s.AssertConnectionReused(mockT, 1, 2)
+	if !mockT.Failed() {
+		t.Error("expected different connections to fail AssertConnectionReused")
+	}
+	mockT = &testing.T{}
+	s.AssertNewConnection(mockT, 1)
+	if !mockT.Failed() {
+		t.Error("expected reused connection to fail AssertNewConnection")
+	}
+}
+
+func TestConnectionFaults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/reset").ResetConnection()
+	s.Expect("GET", "/close").CloseWithoutResponse()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	_, err := client.Get(s.URL + "/reset")
+	if err == nil || !strings.Contains(err.Error(), "reset") {
+		t.Errorf("expected connection reset, got %v", err)
+	}
+	_, err = client.Get(s.URL + "/close")
+	if err == nil || !strings.Contains(err.Error(), "EOF") {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	if s.RequestCount() != 2 || s.GetRequest(0).StatusCode != 0 || s.GetRequest(1).StatusCode != 0 {
+		t.Errorf("expected failed requests to be recorded without status")
+	}
+	s.AssertCalled(t, "GET", "/reset")
+}
+
+func TestFailWithProbability(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Seed(3)
+
+	s.Expect("GET", "/flaky").
+		Response(http.StatusOK, "ok").
+		FailWithProbability(0.3, http.StatusServiceUnavailable, "unavailable")
+	s.Expect("GET", "/down").Response(http.StatusOK, "ok").FailWithProbability(1, http.StatusInternalServerError, "")
+
+	failures := 0
+	for i := 0; i < 200; i++ {
+		resp, err := http.Get(s.URL + "/flaky")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusServiceUnavailable && string(body) == "unavailable":
+			failures++
+		case resp.StatusCode != http.StatusOK || string(body) != "ok":
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+		}
+	}
+	if failures < 30 || failures > 90 {
+		t.Errorf("expected about 60 of 200 requests to fail, got %d", failures)
+	}
+	if tagged := len(s.RequestsTagged("injected-failure")); tagged != failures {
+		t.Errorf("expected %d requests tagged, got %d", failures, tagged)
+	}
+
+	resp, err := http.Get(s.URL + "/down")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a probability of 1 to always fail, got %d", resp.StatusCode)
+	}
+}
+
+func TestTrafficShape(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Seed(5)
+	s.Expect("GET", "/orders").Response(http.StatusOK, "ok")
+
+	get := func() (int, string, time.Duration) {
+		start := time.Now()
+		resp, err := http.Get(s.URL + "/orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, string(body), time.Since(start)
+	}
+
+	// Every request of a window shares its state.
+	s.Shape(TrafficShape{Window: time.Hour, BurstProbability: 0.5})
+	first, _, _ := get()
+	for i := 0; i < 20; i++ {
+		if status, _, _ := get(); status != first {
+			t.Fatalf("expected all requests of a window to get %d, got %d", first, status)
+		}
+	}
+
+	s.Shape(TrafficShape{
+		Window:           time.Hour,
+		SpikeProbability: 1,
+		SpikeLatency:     30 * time.Millisecond,
+		BurstProbability: 1,
+		BurstBody:        "overloaded",
+	})
+	status, body, elapsed := get()
+	if status != http.StatusServiceUnavailable || body != "overloaded" || elapsed < 30*time.Millisecond {
+		t.Errorf("expected a slow 503 during a spike and burst, got %d %q after %v", status, body, elapsed)
+	}
+	last := s.GetRequest(len(s.Requests) - 1)
+	if !last.HasTag("latency-spike") || !last.HasTag("error-burst") {
+		t.Errorf("expected shaped request to be tagged, got %v", last.Tags())
+	}
+
+	s.Shape(TrafficShape{})
+	if status, body, _ := get(); status != http.StatusOK || body != "ok" {
+		t.Errorf("expected shaping to be removed, got %d %q", status, body)
+	}
+}
+
+func TestDependency(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Seed(7)
+
+	billing := s.Dependency("billing").Latency(Constant(20 * time.Millisecond)).ErrorRate(0.5)
+	billing.Expect("POST", "/invoices").Response(http.StatusCreated, "created")
+	billing.Expect("GET", "/invoices").Response(http.StatusOK, "[]")
+	s.Dependency("billing").ErrorResponse(http.StatusBadGateway, "billing down")
+	s.Expect("GET", "/health").Response(http.StatusOK, "ok")
+
+	failures := 0
+	for i := 0; i < 40; i++ {
+		method := []string{"POST", "GET"}[i%2]
+		req, _ := http.NewRequest(method, s.URL+"/invoices", nil)
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("expected the dependency latency, got %v", elapsed)
+		}
+		if resp.StatusCode == http.StatusBadGateway && string(body) == "billing down" {
+			failures++
+		}
+	}
+	if failures < 8 || failures > 32 {
+		t.Errorf("expected about half of 40 requests to fail, got %d", failures)
+	}
+	if tagged := len(s.RequestsTagged("dependency:billing")); tagged != 40 {
+		t.Errorf("expected 40 requests tagged, got %d", tagged)
+	}
+
+	http.Get(s.URL + "/health")
+	if last := s.GetRequest(40); last.HasTag("dependency:billing") || last.StatusCode != http.StatusOK {
+		t.Errorf("expected other expectations to be unaffected, got %d %v", last.StatusCode, last.Tags())
+	}
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	samples := make([]time.Duration, 1001)
+	for i := range samples {
+		samples[i] = LogNormal(100*time.Millisecond, 0.5)(r)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	if median := samples[500]; median < 90*time.Millisecond || median > 110*time.Millisecond {
+		t.Errorf("expected a median near 100ms, got %v", median)
+	}
+	if samples[990] < 2*samples[500] {
+		t.Errorf("expected a long tail, got p99 %v", samples[990])
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := Uniform(time.Millisecond, 2*time.Millisecond)(r); d < time.Millisecond || d > 2*time.Millisecond {
+			t.Fatalf("uniform draw %v out of range", d)
+		}
+		if d := Normal(time.Millisecond, time.Second)(r); d < 0 {
+			t.Fatalf("expected negative draws to be clamped, got %v", d)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/pay").Response(http.StatusOK, "ok").CircuitBreaker(2, 50*time.Millisecond)
+
+	get := func() *http.Response {
+		resp, err := http.Get(s.URL + "/pay")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 2; i++ {
+			if resp := get(); resp.StatusCode != http.StatusOK {
+				t.Fatalf("round %d: expected request %d to be served, got %d", round, i, resp.StatusCode)
+			}
+		}
+		for i := 0; i < 2; i++ {
+			resp := get()
+			if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+				t.Fatalf("round %d: expected open breaker, got %d with Retry-After %q", round, resp.StatusCode, resp.Header.Get("Retry-After"))
+			}
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+	if open := len(s.RequestsTagged("circuit-open")); open != 4 {
+		t.Errorf("expected 4 requests tagged circuit-open, got %d", open)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	release := make(chan struct{})
+	s.Expect("GET", "/slow").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := http.Get(s.URL + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	for s.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	mockT := &testing.T{}
+	s.AssertNoInFlight(mockT)
+	if !mockT.Failed() {
+		t.Error("expected pending request to fail AssertNoInFlight")
+	}
+	if reqs := s.InFlightRequests(); len(reqs) != 1 || reqs[0].URL.Path != "/slow" {
+		t.Errorf("expected /slow in flight, got %v", reqs)
+	}
+
+	close(release)
+	<-done
+	s.AssertNoInFlight(t)
+	if s.RequestCount() != 1 {
+		t.Errorf("expected finished request to be recorded, got %d", s.RequestCount())
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	const n = 10
+	const wait = 100 * time.Millisecond
+	s.Expect("GET", "/slow").MatchFunc(func(r *http.Request, body []byte) bool {
+		time.Sleep(wait)
+		return true
+	}).Response(200, "ok")
+	s.Expect("GET", "/once").TimesSet(1).Response(200, "once")
+
+	get := func(path string) int {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get("/slow")
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > n*wait/2 {
+		t.Errorf("expected slow matchers to run concurrently, %d requests took %s", n, elapsed)
+	}
+
+	var matched int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if get("/once") == 200 {
+				atomic.AddInt32(&matched, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if matched != 1 {
+		t.Errorf("expected Times(1) expectation to match once, matched %d times", matched)
+	}
+	if s.RequestCount() != 2*n {
+		t.Errorf("expected %d recorded requests, got %d", 2*n, s.RequestCount())
+	}
+}
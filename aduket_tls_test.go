@@ -0,0 +1,202 @@
+package aduket
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSDetails(t *testing.T) {
+	s := NewUnstartedServer()
+	s.EnableHTTP2 = true
+	if err := s.StartTLS(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Expect("GET", "/secure").Response(http.StatusOK, "ok")
+
+	resp, err := s.Client().Get(s.URL + "/secure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	req := s.GetRequest(0)
+	if req.TLSVersion() == "" || req.CipherSuite() == "" {
+		t.Errorf("expected TLS details, got %q %q", req.TLSVersion(), req.CipherSuite())
+	}
+	if req.LocalAddr == "" || !strings.HasSuffix(s.URL, req.LocalAddr[strings.LastIndex(req.LocalAddr, ":"):]) {
+		t.Errorf("expected local address of the server, got %q", req.LocalAddr)
+	}
+	if req.RemoteAddr == "" {
+		t.Error("expected remote address")
+	}
+	s.AssertMinTLSVersion(t, 0, tls.VersionTLS12)
+	s.AssertALPN(t, 0, "h2")
+
+	mockT := &testing.T{}
+	s.AssertALPN(mockT, 0, "http/1.1")
+	if !mockT.Failed() {
+		t.Error("expected ALPN mismatch to fail")
+	}
+}
+
+func TestTLSDetailsPlainHTTP(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	http.Get(s.URL + "/plain")
+
+	if req := s.GetRequest(0); req.TLSVersion() != "" || req.ALPN() != "" || req.LocalAddr == "" {
+		t.Errorf("unexpected TLS details for plain request: %q %q", req.TLSVersion(), req.ALPN())
+	}
+	mockT := &testing.T{}
+	s.AssertMinTLSVersion(mockT, 0, tls.VersionTLS12)
+	if !mockT.Failed() {
+		t.Error("expected plain HTTP request to fail the TLS assertion")
+	}
+}
+
+// newClientCert returns a CA and a client certificate for cn signed by it.
+func newClientCert(t *testing.T, cn string) (*x509.CertPool, tls.Certificate) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	s := NewTLSServer()
+	defer s.Close()
+	s.Expect("GET", "/secure").Response(http.StatusOK, "ok")
+	caPool, cert := newClientCert(t, "billing-service")
+	s.RequireClientCert(caPool)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+
+	if resp, err := client().Get(s.URL + "/secure"); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected handshake without a client certificate to fail")
+	}
+	resp, err := client(cert).Get(s.URL + "/secure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	s.AssertClientCertCN(t, 0, "billing-service")
+
+	mockT := &testing.T{}
+	s.AssertClientCertCN(mockT, 0, "orders-service")
+	if !mockT.Failed() {
+		t.Error("expected common name mismatch to fail")
+	}
+
+	s.RequireClientCert(nil)
+	resp, err = client().Get(s.URL + "/secure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if s.GetRequest(1).ClientCert() != nil {
+		t.Error("expected no client certificate")
+	}
+	mockT = &testing.T{}
+	s.AssertClientCertCN(mockT, 1, "billing-service")
+	if !mockT.Failed() {
+		t.Error("expected request without a client certificate to fail")
+	}
+}
+
+func TestNewTLSServerWithCert(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "api.example.test"},
+		DNSNames:              []string{"api.example.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+
+	s := NewTLSServerWithCert(tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key})
+	defer s.Close()
+	s.Expect("GET", "/secure").Response(http.StatusOK, "ok")
+	if s.Certificate().Subject.CommonName != "api.example.test" {
+		t.Errorf("expected custom certificate, got %q", s.Certificate().Subject.CommonName)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "api.example.test"},
+	}}
+	resp, err := client.Get(s.URL + "/secure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// A new client, so the verified connection above is not reused.
+	client = &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "other.example.test"},
+	}}
+	if resp, err := client.Get(s.URL + "/secure"); err == nil {
+		resp.Body.Close()
+		t.Error("expected hostname verification to fail for another name")
+	}
+
+	if err := s.SetTLSConfig(&tls.Config{}); err != ErrAlreadyStarted {
+		t.Errorf("expected ErrAlreadyStarted, got %v", err)
+	}
+}
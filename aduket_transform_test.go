@@ -0,0 +1,138 @@
+package aduket
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransformJSON(t *testing.T) {
+	recorded := `{"items":[{"id":1,"secret":"a"},{"id":2,"secret":"b"},{"id":3,"secret":"c"}],"total":3,"meta":{"page":1}}`
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{".", recorded},
+		{".meta.page", `1`},
+		{".items[1].id", `2`},
+		{`.["total"]`, `3`},
+		{".items |= .[0:2] | .items | length", `2`},
+		{".total = 10 | .total", `10`},
+		{".items |= map(del(.secret)) | .items", `[{"id":1},{"id":2},{"id":3}]`},
+		{"del(.items) | keys", `["meta","total"]`},
+		{".items[-1] |= del(.secret) | .items[2]", `{"id":3}`},
+		{`.meta.source = "mock" | .meta`, `{"page":1,"source":"mock"}`},
+		{".items |= .[0:-10] | .items", `[]`},
+		{".items |= .[-10:1] | .items | length", `1`},
+		{".items |= .[5:] | .items", `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s := NewServer()
+			defer s.Close()
+
+			s.Expect("GET", "/items").Response(200, recorded).TransformJSON(tt.expr)
+
+			resp, err := http.Get(s.URL + "/items")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			var got, want interface{}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("invalid response %q: %v", body, err)
+			}
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %s, got %s", tt.want, body)
+			}
+		})
+	}
+}
+
+func TestTransformJSONError(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/transform").Response(200, "not json").TransformJSON(".a")
+	s.Expect("GET", "/template").TemplateResponse(200, `{{template "missing"}}`)
+
+	for _, path := range []string{"/transform", "/template"} {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(string(body), "error") {
+			t.Errorf("expected 500 with the error for %s, got %d %q", path, resp.StatusCode, body)
+		}
+	}
+	if s.RequestCount() != 2 {
+		t.Errorf("expected failed responses to be recorded, got %d requests", s.RequestCount())
+	}
+}
+
+func TestTransformProxied(t *testing.T) {
+	upstream := NewServer()
+	defer upstream.Close()
+	upstream.Expect("GET", "/items").Response(200, `{"items":[1,2,3],"secret":"x"}`)
+	upstream.Expect("GET", "/text").Response(200, "plain")
+
+	s := NewServer()
+	defer s.Close()
+	if err := s.ProxyTo(upstream.URL); err != nil {
+		t.Fatal(err)
+	}
+	s.TransformProxied("del(.secret) | .items |= .[0:1]")
+
+	resp, err := http.Get(s.URL + "/items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"items":[1]}` {
+		t.Errorf("expected transformed upstream response, got %s", body)
+	}
+
+	resp, err = http.Get(s.URL + "/text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected 502 for a non-JSON upstream response, got %d", resp.StatusCode)
+	}
+}
+
+func TestTransformJSONInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid expression")
+		}
+	}()
+	newExpectation("GET", "/").TransformJSON(".items[")
+}
+
+func TestTransformJSONRoundTrip(t *testing.T) {
+	exp := newExpectation("GET", "/").Response(200, `{"a":1}`).TransformJSON(".a")
+	data, err := json.Marshal(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Expectation
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Transform != ".a" || decoded.transform == nil {
+		t.Errorf("transform not restored from %s", data)
+	}
+}
@@ -0,0 +1,51 @@
+package aduket
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestVersionFallback(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Version("/v3").FallbackTo("v2")
+	v2 := s.Version("/v2").FallbackTo("/v1")
+	v1 := s.Version("/v1")
+
+	v1.Expect("GET", "/users").Response(http.StatusOK, "v1 users")
+	v1.Expect("GET", "/users/{id}").Response(http.StatusOK, "v1 user")
+	v1.Expect("GET", "/").Response(http.StatusOK, "v1 root")
+	v2.Expect("GET", "users").Response(http.StatusOK, "v2 users")
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/v2/users", http.StatusOK, "v2 users"},
+		{"/v2/users/7", http.StatusOK, "v1 user"},
+		{"/v3/users", http.StatusOK, "v2 users"},
+		{"/v3/users/7", http.StatusOK, "v1 user"},
+		{"/v2/", http.StatusOK, "v1 root"},
+		{"/v2x/users", http.StatusNotFound, ""},
+		{"/v2/orders", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(s.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || (tt.body != "" && string(body) != tt.body) {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.path, tt.status, tt.body, resp.StatusCode, body)
+		}
+	}
+
+	if got := s.GetRequest(1).URL.Path; got != "/v2/users/7" {
+		t.Errorf("expected the original path to be recorded, got %s", got)
+	}
+	s.AssertCalled(t, "GET", "/v1/users/{id}")
+}
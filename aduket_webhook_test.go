@@ -0,0 +1,86 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignatures(t *testing.T) {
+	body := []byte(`{"event":"push"}`)
+	now := time.Unix(1700000000, 0)
+
+	// Known GitHub signature for secret "It's a Secret to Everybody".
+	h := make(http.Header)
+	GitHubSignature.Sign(h, []byte("Hello, World!"), "It's a Secret to Everybody", now)
+	if got := h.Get("X-Hub-Signature-256"); got != "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17" {
+		t.Errorf("unexpected GitHub signature %s", got)
+	}
+
+	for name, scheme := range map[string]WebhookScheme{
+		"github": GitHubSignature,
+		"stripe": StripeSignature,
+		"slack":  SlackSignature,
+		"custom": HMACSignature("X-Signature", ""),
+	} {
+		h := make(http.Header)
+		scheme.Sign(h, body, "secret", now)
+		if err := scheme.Verify(h, body, "secret"); err != nil {
+			t.Errorf("%s: expected signature to verify: %v", name, err)
+		}
+		if err := scheme.Verify(h, []byte(`{"event":"tampered"}`), "secret"); err != ErrInvalidSignature {
+			t.Errorf("%s: expected tampered body to fail, got %v", name, err)
+		}
+		if err := scheme.Verify(h, body, "other"); err != ErrInvalidSignature {
+			t.Errorf("%s: expected wrong secret to fail, got %v", name, err)
+		}
+		if err := scheme.Verify(make(http.Header), body, "secret"); err == nil {
+			t.Errorf("%s: expected missing headers to fail", name)
+		}
+	}
+
+	h = make(http.Header)
+	StripeSignature.Sign(h, body, "secret", now)
+	if sig := h.Get("Stripe-Signature"); !strings.HasPrefix(sig, "t=1700000000,v1=") {
+		t.Errorf("unexpected Stripe signature %s", sig)
+	}
+}
+
+func TestWebhookExpectations(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("POST", "/hooks").WithWebhookSignature(StripeSignature, "whsec").Response(http.StatusOK, "accepted")
+	s.Expect("POST", "/hooks").Response(http.StatusBadRequest, "bad signature")
+
+	req, err := NewWebhookRequest(s.URL+"/hooks", []byte(`{"type":"charge.succeeded"}`), StripeSignature, "whsec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected signed delivery to match, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("POST", s.URL+"/hooks", strings.NewReader(`{"type":"charge.succeeded"}`))
+	if err := SignWebhook(req, StripeSignature, "wrong"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected badly signed delivery to fall through, got %d", resp.StatusCode)
+	}
+
+	s.AssertWebhookSignature(t, 0, StripeSignature, "whsec")
+	if err := s.GetRequest(1).VerifyWebhookSignature(StripeSignature, "whsec"); err != ErrInvalidSignature {
+		t.Errorf("expected captured request with a wrong secret to fail, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package aduket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketScript(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/ws").WebSocket().
+		Send("welcome").
+		OnMessage("ping").Reply("pong").
+		Then().Echo()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	expect := func(want string) {
+		t.Helper()
+		_, msg, err := conn.ReadMessage()
+		if err != nil || string(msg) != want {
+			t.Fatalf("expected %q, got %q (%v)", want, msg, err)
+		}
+	}
+	expect("welcome")
+	conn.WriteMessage(websocket.TextMessage, []byte("noise"))
+	conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+	expect("pong")
+	conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+	expect("hello")
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.RequestCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	req := s.GetRequest(0)
+	if req == nil {
+		t.Fatal("expected the connection to be recorded")
+	}
+	var got []string
+	for _, f := range req.Frames() {
+		dir := "<"
+		if f.Inbound {
+			dir = ">"
+		}
+		got = append(got, dir+f.Text())
+	}
+	if want := "<welcome >noise >ping <pong >hello <hello"; strings.Join(got, " ") != want {
+		t.Errorf("expected frames %s, got %s", want, strings.Join(got, " "))
+	}
+	if req.StatusCode != 101 {
+		t.Errorf("expected 101, got %d", req.StatusCode)
+	}
+}
+
+func TestWebSocketScriptClose(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Expect("GET", "/ws").WebSocket().Send("bye").Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, msg, _ := conn.ReadMessage(); string(msg) != "bye" {
+		t.Fatalf("expected bye, got %q", msg)
+	}
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("expected normal closure, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package aduket
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// AssertCalledBefore checks that a request matching route a was received
+// before the first request matching route b. Routes are written as
+// "METHOD /path" and may use {name} path segments.
+func (s *Server) AssertCalledBefore(t *testing.T, a, b string) {
+	reqs := s.requestsSnapshot()
+
+	first := firstRouteIndex(t, reqs, a, 0)
+	second := firstRouteIndex(t, reqs, b, 0)
+	switch {
+	case first < 0:
+		s.errorf(t, reqs, "expected %s to be called before %s, but %s was not called", a, b, a)
+	case second < 0:
+		s.errorf(t, reqs, "expected %s to be called before %s, but %s was not called", a, b, b)
+	case first > second:
+		s.errorf(t, []*CapturedRequest{reqs[second], reqs[first]}, "expected %s to be called before %s, but it was called after (request %d vs %d)", a, b, first, second)
+	}
+}
+
+// AssertSequence checks that requests matching the routes were received in
+// the given order. Other requests may be interleaved.
+func (s *Server) AssertSequence(t *testing.T, routes []string) {
+	reqs := s.requestsSnapshot()
+	if route, step := missingStep(t, reqs, routes); step > 0 {
+		s.errorf(t, reqs, "expected sequence %s, but %s (step %d) was not called in order", strings.Join(routes, " -> "), route, step)
+	}
+}
+
+// missingStep returns the first route of the sequence not found in order in
+// reqs and its 1-based step, or a zero step if the whole sequence is found.
+func missingStep(t *testing.T, reqs []*CapturedRequest, routes []string) (string, int) {
+	next := 0
+	for i, route := range routes {
+		idx := firstRouteIndex(t, reqs, route, next)
+		if idx < 0 {
+			return route, i + 1
+		}
+		next = idx + 1
+	}
+	return "", 0
+}
+
+// AssertCalledWithin checks that method and path were called no later than
+// window after the server started or its history was last reset.
+func (s *Server) AssertCalledWithin(t *testing.T, method, path string, window time.Duration) {
+	s.mu.Lock()
+	start := s.historyStart
+	s.mu.Unlock()
+
+	var first *CapturedRequest
+	for _, req := range s.requestsSnapshot() {
+		if req.matchesRoute(method, path) {
+			first = req
+			break
+		}
+	}
+	switch {
+	case first == nil:
+		s.errorf(t, s.requestsSnapshot(), "expected %s %s to be called within %v, but it was not called", method, path, window)
+	case first.ReceivedAt.Sub(start) > window:
+		s.errorf(t, []*CapturedRequest{first}, "expected %s %s to be called within %v, but it was first called after %v", method, path, window, first.ReceivedAt.Sub(start))
+	}
+}
+
+// AssertNoRequestsAfter checks that no request was received after the given
+// time.
+func (s *Server) AssertNoRequestsAfter(t *testing.T, after time.Time) {
+	for i, req := range s.requestsSnapshot() {
+		if req.ReceivedAt.After(after) {
+			s.errorf(t, []*CapturedRequest{req}, "expected no requests after %s, but request %d (%s %s) was received %v later",
+				after.Format(time.RFC3339Nano), i, req.Method, req.URL.Path, req.ReceivedAt.Sub(after))
+			return
+		}
+	}
+}
+
+// KeyFunc derives a key from a captured request. An empty key means the
+// request has no key.
+type KeyFunc func(*CapturedRequest) string
+
+// HeaderKey returns a KeyFunc using the value of a request header.
+func HeaderKey(name string) KeyFunc {
+	return func(c *CapturedRequest) string {
+		return c.Header.Get(name)
+	}
+}
+
+// BodyKey returns a KeyFunc using the method, path and body of a request.
+func BodyKey() KeyFunc {
+	return func(c *CapturedRequest) string {
+		return c.Method + " " + c.URL.Path + "\n" + string(c.RequestBodyBytes())
+	}
+}
+
+// AssertNoDuplicateRequests checks that no two requests share the same key,
+// e.g. the same idempotency key or body. Requests with an empty key are
+// ignored.
+func (s *Server) AssertNoDuplicateRequests(t *testing.T, key KeyFunc) {
+	reqs := s.requestsSnapshot()
+	seen := make(map[string]int)
+	for i, req := range reqs {
+		k := key(req)
+		if k == "" {
+			continue
+		}
+		if first, ok := seen[k]; ok {
+			s.errorf(t, []*CapturedRequest{reqs[first], req}, "expected no duplicate requests, but request %d (%s %s) duplicates request %d",
+				i, req.Method, req.URL.Path, first)
+			continue
+		}
+		seen[k] = i
+	}
+}
+
+// requestsSnapshot returns a copy of the recorded requests.
+func (s *Server) requestsSnapshot() []*CapturedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*CapturedRequest(nil), s.Requests...)
+}
+
+// firstRouteIndex returns the index of the first request at or after from that
+// matches route, or -1.
+func firstRouteIndex(t *testing.T, reqs []*CapturedRequest, route string, from int) int {
+	method, path, err := parseRoute(route)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := from; i < len(reqs); i++ {
+		if reqs[i].matchesRoute(method, path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matchesRoute reports whether the request was made with method to path.
+func (c *CapturedRequest) matchesRoute(method, path string) bool {
+	if c.Method != method {
+		return false
+	}
+	_, ok := matchPath(path, c.URL.Path)
+	return ok
+}
@@ -0,0 +1,92 @@
+package aduket
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authRealm is the realm announced in WWW-Authenticate challenges.
+const authRealm = "aduket"
+
+// Schemes of the credentials an expectation requires.
+const (
+	authBasic  = "basic"
+	authBearer = "bearer"
+)
+
+// credentials are what RequireBasicAuth and RequireBearerToken require of
+// requests, in the form the Expectation JSON format encodes them.
+type credentials struct {
+	Scheme   string `json:"scheme"` // authBasic or authBearer
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// RequireBasicAuth makes the expectation answer 401 Unauthorized with a
+// Basic WWW-Authenticate challenge to requests without the given
+// credentials. Rejected requests are tagged "unauthorized". It replaces any
+// earlier RequireBasicAuth or RequireBearerToken.
+func (e *Expectation) RequireBasicAuth(user, pass string) *Expectation {
+	return e.requireAuth(&credentials{Scheme: authBasic, User: user, Password: pass})
+}
+
+// RequireBearerToken makes the expectation answer 401 Unauthorized with a
+// Bearer WWW-Authenticate challenge to requests without the token in their
+// Authorization header. Requests with a wrong token are told so with
+// error="invalid_token", as in RFC 6750. Rejected requests are tagged
+// "unauthorized". It replaces any earlier RequireBasicAuth or
+// RequireBearerToken.
+func (e *Expectation) RequireBearerToken(token string) *Expectation {
+	return e.requireAuth(&credentials{Scheme: authBearer, Token: token})
+}
+
+func (e *Expectation) requireAuth(c *credentials) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.auth = c
+	return e
+}
+
+// check returns the response for a request lacking the credentials, or nil
+// if the request may proceed.
+func (c *credentials) check(r *http.Request) *failure {
+	if c.Scheme == authBasic {
+		u, p, ok := r.BasicAuth()
+		if ok && secureEqual(u, c.User) && secureEqual(p, c.Password) {
+			return nil
+		}
+		return unauthorized(`Basic realm="` + authRealm + `", charset="UTF-8"`)
+	}
+	got, ok := bearerToken(r)
+	switch {
+	case !ok:
+		return unauthorized(`Bearer realm="` + authRealm + `"`)
+	case !secureEqual(got, c.Token):
+		return unauthorized(`Bearer realm="` + authRealm + `", error="invalid_token"`)
+	}
+	return nil
+}
+
+// bearerToken returns the token of a "Bearer" Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func unauthorized(challenge string) *failure {
+	return &failure{
+		probability: 1,
+		status:      http.StatusUnauthorized,
+		header:      http.Header{"Www-Authenticate": {challenge}},
+		body:        []byte("aduket: unauthorized"),
+	}
+}
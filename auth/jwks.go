@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a JSON Web Key, the public part of a Key as published in a JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // EC curve
+	X   string `json:"x,omitempty"`   // EC point
+	Y   string `json:"y,omitempty"`
+	K   string `json:"k,omitempty"` // HMAC secret
+}
+
+// JWK returns the public part of the key. For HS256 keys, which have no
+// public part, it holds the shared secret.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Alg: k.Algorithm, Use: "sig"}
+	switch pub := k.publicKey().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		jwk.X, jwk.Y = encode(x), encode(y)
+	default:
+		jwk.Kty = "oct"
+		jwk.K = encode(k.secret)
+	}
+	return jwk
+}
+
+// Key returns a key verifying tokens with the JWK.
+func (j JWK) Key() (*Key, error) {
+	key := &Key{ID: j.Kid, Algorithm: j.Alg}
+	switch j.Kty {
+	case "RSA":
+		n, err1 := decode(j.N)
+		e, err2 := decode(j.E)
+		if err1 != nil || err2 != nil || len(n) == 0 || len(e) == 0 {
+			return nil, fmt.Errorf("auth: invalid RSA key %q", j.Kid)
+		}
+		key.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.Algorithm == "" {
+			key.Algorithm = RS256
+		}
+	case "EC":
+		x, err1 := decode(j.X)
+		y, err2 := decode(j.Y)
+		if j.Crv != "P-256" || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("auth: invalid or unsupported EC key %q", j.Kid)
+		}
+		key.public = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if key.Algorithm == "" {
+			key.Algorithm = ES256
+		}
+	case "oct":
+		secret, err := decode(j.K)
+		if err != nil {
+			return nil, fmt.Errorf("auth: invalid HMAC key %q", j.Kid)
+		}
+		key.secret = secret
+		if key.Algorithm == "" {
+			key.Algorithm = HS256
+		}
+	default:
+		return nil, fmt.Errorf("auth: unsupported key type %q", j.Kty)
+	}
+	return key, nil
+}
+
+// JWKS is a JSON Web Key Set, as served by identity providers at
+// /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWKS returns a set holding the public parts of keys.
+func NewJWKS(keys ...*Key) *JWKS {
+	set := &JWKS{Keys: make([]JWK, 0, len(keys))}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+	return set
+}
+
+// ParseJWKS parses a JSON Web Key Set.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("auth: invalid JWKS: %v", err)
+	}
+	return &set, nil
+}
+
+// Verify checks token against the key of the set named by its "kid"
+// header, or against every key with the token's algorithm if it names
+// none, and returns its claims.
+func (s *JWKS) Verify(token string) (Claims, error) {
+	h, _, _, _, err := parse(token)
+	if err != nil {
+		return nil, err
+	}
+	err = ErrInvalidToken
+	for _, jwk := range s.Keys {
+		if h.Kid != "" && jwk.Kid != h.Kid {
+			continue
+		}
+		key, keyErr := jwk.Key()
+		if keyErr != nil || key.Algorithm != h.Alg {
+			continue
+		}
+		claims, verifyErr := key.Verify(token)
+		if verifyErr == nil {
+			return claims, nil
+		}
+		err = verifyErr
+	}
+	return nil, err
+}
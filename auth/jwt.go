@@ -0,0 +1,270 @@
+// Package auth mints and verifies JSON Web Tokens, for mocking
+// OAuth-protected APIs with aduket. Tokens are signed with RS256, ES256 or
+// HS256 keys, and verified against a single key or a JWKS.
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Signing algorithms.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	HS256 = "HS256"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed or whose
+	// signature does not verify.
+	ErrInvalidToken = errors.New("auth: invalid token")
+	// ErrExpired is returned for tokens past their "exp" claim.
+	ErrExpired = errors.New("auth: token expired")
+	// ErrNotYetValid is returned for tokens before their "nbf" claim.
+	ErrNotYetValid = errors.New("auth: token not yet valid")
+)
+
+// now is the clock tokens are checked against.
+var now = time.Now
+
+// Claims are the claims of a token. Numeric claims decode as float64.
+type Claims map[string]interface{}
+
+// Verifier checks a token and returns its claims.
+type Verifier interface {
+	Verify(token string) (Claims, error)
+}
+
+// Key is a key signing and verifying tokens with one algorithm.
+type Key struct {
+	ID        string // Key ID, sent as "kid" in token headers
+	Algorithm string // RS256, ES256 or HS256
+
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+	secret []byte
+	public crypto.PublicKey // Set instead of a private key for keys read from a JWKS
+}
+
+// NewRSAKey generates a 2048-bit RS256 key.
+func NewRSAKey(id string) (*Key, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: id, Algorithm: RS256, rsa: priv}, nil
+}
+
+// NewECKey generates a P-256 ES256 key.
+func NewECKey(id string) (*Key, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: id, Algorithm: ES256, ec: priv}, nil
+}
+
+// NewHMACKey returns an HS256 key using a shared secret.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: HS256, secret: secret}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Sign returns a compact token carrying claims.
+func (k *Key) Sign(claims Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: k.Algorithm, Typ: "JWT", Kid: k.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := encode(h) + "." + encode(payload)
+	sig, err := k.sign([]byte(unsigned))
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + encode(sig), nil
+}
+
+func (k *Key) sign(data []byte) ([]byte, error) {
+	switch {
+	case k.Algorithm == HS256 && k.secret != nil:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case k.Algorithm == RS256 && k.rsa != nil:
+		sum := sha256.Sum256(data)
+		return rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, sum[:])
+	case k.Algorithm == ES256 && k.ec != nil:
+		sum := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, sum[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed size concatenation of r and s, not ASN.1.
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, fmt.Errorf("auth: key %q cannot sign with %s", k.ID, k.Algorithm)
+}
+
+// Verify checks the signature of token and its "exp" and "nbf" claims, and
+// returns its claims.
+func (k *Key) Verify(token string) (Claims, error) {
+	h, claims, signed, sig, err := parse(token)
+	if err != nil {
+		return nil, err
+	}
+	// The algorithm comes from the key, never from the token, so tokens
+	// cannot downgrade to "none" or swap RS256 for HS256.
+	if h.Alg != k.Algorithm || !k.verify(signed, sig) {
+		return nil, ErrInvalidToken
+	}
+	if err := checkTimes(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (k *Key) verify(data, sig []byte) bool {
+	sum := sha256.Sum256(data)
+	switch k.Algorithm {
+	case HS256:
+		if k.secret == nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(data)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case RS256:
+		pub, ok := k.publicKey().(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case ES256:
+		pub, ok := k.publicKey().(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, sum[:], r, s)
+	}
+	return false
+}
+
+func (k *Key) publicKey() crypto.PublicKey {
+	switch {
+	case k.rsa != nil:
+		return &k.rsa.PublicKey
+	case k.ec != nil:
+		return &k.ec.PublicKey
+	}
+	return k.public
+}
+
+// RequireClaims wraps v so tokens must also carry every claim of want with
+// an equal value. Numbers compare by value, and a string claim wanted in a
+// token whose claim is a list, as "aud" may be, must be one of its items.
+func RequireClaims(v Verifier, want Claims) Verifier {
+	return claimsVerifier{v, want}
+}
+
+type claimsVerifier struct {
+	Verifier
+	want Claims
+}
+
+func (c claimsVerifier) Verify(token string) (Claims, error) {
+	claims, err := c.Verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	for name, want := range c.want {
+		if !claimMatches(claims[name], want) {
+			return nil, fmt.Errorf("auth: claim %s is %v, want %v", name, claims[name], want)
+		}
+	}
+	return claims, nil
+}
+
+func claimMatches(got, want interface{}) bool {
+	if list, ok := got.([]interface{}); ok {
+		if _, wantList := want.([]interface{}); !wantList {
+			for _, item := range list {
+				if claimMatches(item, want) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	// Compare through JSON so that e.g. 1 and float64(1) are equal.
+	g, err1 := json.Marshal(got)
+	w, err2 := json.Marshal(want)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	var gv, wv interface{}
+	json.Unmarshal(g, &gv)
+	json.Unmarshal(w, &wv)
+	return reflect.DeepEqual(gv, wv)
+}
+
+// parse splits token into its decoded parts, without verifying it.
+func parse(token string) (h header, claims Claims, signed, sig []byte, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return h, nil, nil, nil, ErrInvalidToken
+	}
+	rawHeader, err1 := decode(parts[0])
+	rawClaims, err2 := decode(parts[1])
+	sig, err3 := decode(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return h, nil, nil, nil, ErrInvalidToken
+	}
+	if json.Unmarshal(rawHeader, &h) != nil || json.Unmarshal(rawClaims, &claims) != nil {
+		return h, nil, nil, nil, ErrInvalidToken
+	}
+	return h, claims, []byte(parts[0] + "." + parts[1]), sig, nil
+}
+
+func checkTimes(claims Claims) error {
+	t := float64(now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && t >= exp {
+		return ErrExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && t < nbf {
+		return ErrNotYetValid
+	}
+	return nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	rsaKey, err := NewRSAKey("rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := NewECKey("ec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := NewHMACKey("hmac", []byte("secret"))
+
+	for _, key := range []*Key{rsaKey, ecKey, hmacKey} {
+		token, err := key.Sign(Claims{"sub": "42"})
+		if err != nil {
+			t.Fatalf("%s: %v", key.Algorithm, err)
+		}
+		claims, err := key.Verify(token)
+		if err != nil || claims["sub"] != "42" {
+			t.Errorf("%s: expected token to verify, got %v, %v", key.Algorithm, claims, err)
+		}
+
+		// A tampered payload breaks the signature.
+		parts := strings.Split(token, ".")
+		parts[1] = encode([]byte(`{"sub":"admin"}`))
+		if _, err := key.Verify(strings.Join(parts, ".")); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected tampered token to fail, got %v", key.Algorithm, err)
+		}
+	}
+
+	// A token cannot pick a weaker algorithm than its key, here by signing
+	// with the public RSA modulus as an HMAC secret.
+	forged, _ := NewHMACKey("rsa", []byte(rsaKey.JWK().N)).Sign(Claims{"sub": "42"})
+	if _, err := rsaKey.Verify(forged); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected algorithm confusion to fail, got %v", err)
+	}
+	unsigned := encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(`{"sub":"42"}`)) + "."
+	if _, err := rsaKey.Verify(unsigned); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected unsigned token to fail, got %v", err)
+	}
+}
+
+func TestVerifyTimes(t *testing.T) {
+	key := NewHMACKey("", []byte("secret"))
+	past := time.Now().Add(-time.Minute).Unix()
+	future := time.Now().Add(time.Minute).Unix()
+
+	expired, _ := key.Sign(Claims{"exp": past})
+	if _, err := key.Verify(expired); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+	early, _ := key.Sign(Claims{"nbf": future})
+	if _, err := key.Verify(early); !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("expected ErrNotYetValid, got %v", err)
+	}
+	valid, _ := key.Sign(Claims{"nbf": past, "exp": future})
+	if _, err := key.Verify(valid); err != nil {
+		t.Errorf("expected token to be valid, got %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	first, _ := NewRSAKey("first")
+	second, _ := NewECKey("second")
+	data, err := json.Marshal(NewJWKS(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := ParseJWKS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"d"`) {
+		t.Error("expected JWKS to hold public keys only")
+	}
+
+	for _, key := range []*Key{first, second} {
+		token, _ := key.Sign(Claims{"aud": []string{"api", "web"}, "scope": "read"})
+		if _, err := set.Verify(token); err != nil {
+			t.Errorf("%s: expected JWKS to verify token, got %v", key.ID, err)
+		}
+		if _, err := RequireClaims(set, Claims{"aud": "api", "scope": "read"}).Verify(token); err != nil {
+			t.Errorf("%s: expected claims to match, got %v", key.ID, err)
+		}
+		if _, err := RequireClaims(set, Claims{"aud": "admin"}).Verify(token); err == nil {
+			t.Errorf("%s: expected wrong audience to fail", key.ID)
+		}
+	}
+
+	other, _ := NewRSAKey("first")
+	token, _ := other.Sign(Claims{})
+	if _, err := set.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected token of an unknown key to fail, got %v", err)
+	}
+}
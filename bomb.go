@@ -0,0 +1,65 @@
+package aduket
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// bomb describes a very large response body, see ResponseBomb.
+type bomb struct {
+	size       int64
+	compressed bool
+}
+
+// bombChunk is the size of the buffer a bomb body is written from.
+const bombChunk = 32 << 10
+
+// ResponseBomb makes the expectation respond with a body of size bytes, to
+// exercise response size limits and decompression guards of clients. Without
+// compression the body is random bytes with a Content-Length. With
+// compression it is gzip encoded zeros that inflate to size bytes, sent with
+// Content-Encoding: gzip. Bodies are streamed, never held in memory, and are
+// not recorded in the request history.
+func (e *Expectation) ResponseBomb(size int64, compressed bool) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bomb = &bomb{size: size, compressed: compressed}
+	if e.StatusCode == 0 {
+		e.StatusCode = http.StatusOK
+	}
+	return e
+}
+
+// write streams the bomb body to w.
+func (b *bomb) write(w http.ResponseWriter, status int, rng randSource) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	chunk := make([]byte, bombChunk)
+	var dst io.Writer = w
+	if b.compressed {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		defer zw.Close()
+		dst = zw
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(b.size, 10))
+		for i := range chunk {
+			chunk[i] = byte(rng.Intn(256))
+		}
+	}
+	w.WriteHeader(status)
+
+	for remaining := b.size; remaining > 0; {
+		n := int64(len(chunk))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := dst.Write(chunk[:n]); err != nil {
+			return // The client gave up.
+		}
+		remaining -= n
+	}
+}
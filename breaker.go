@@ -0,0 +1,82 @@
+package aduket
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// circuitBreaker opens after a number of served requests, see
+// Expectation.CircuitBreaker.
+type circuitBreaker struct {
+	threshold int
+	openFor   time.Duration
+
+	mu        sync.Mutex
+	served    int       // Requests served since the breaker last closed
+	openUntil time.Time // End of the current open period
+}
+
+// CircuitBreaker makes the expectation behave like an endpoint protected by
+// a circuit breaker: after failThreshold consecutive matched requests it
+// trips and answers 503 Service Unavailable, with a Retry-After header, for
+// openDuration, then serves normally again and the count starts over. This
+// lets the interplay of a client's own breaker and retries with a
+// breaker-equipped server be tested. Rejected requests are tagged
+// "circuit-open".
+func (e *Expectation) CircuitBreaker(failThreshold int, openDuration time.Duration) *Expectation {
+	if failThreshold <= 0 || openDuration <= 0 {
+		panic(fmt.Sprintf("aduket: invalid circuit breaker threshold %d or open duration %v", failThreshold, openDuration))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.breaker = &circuitBreaker{threshold: failThreshold, openFor: openDuration}
+	return e
+}
+
+// clone returns a closed breaker with the same settings.
+func (b *circuitBreaker) clone() *circuitBreaker {
+	if b == nil {
+		return nil
+	}
+	return &circuitBreaker{threshold: b.threshold, openFor: b.openFor}
+}
+
+// reset closes the breaker and starts the count over.
+func (b *circuitBreaker) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.served = 0
+	b.openUntil = time.Time{}
+}
+
+// check counts a request arriving at now and returns how long the breaker
+// stays open, or 0 if the request is served.
+func (b *circuitBreaker) check(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.openUntil) {
+		return b.openUntil.Sub(now)
+	}
+	if b.served == b.threshold {
+		b.served = 0
+		b.openUntil = now.Add(b.openFor)
+		return b.openFor
+	}
+	b.served++
+	return 0
+}
+
+// openFailure is the response served while a breaker is open for wait.
+func openFailure(wait time.Duration) *failure {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	return &failure{
+		probability: 1,
+		status:      http.StatusServiceUnavailable,
+		header:      http.Header{"Retry-After": {strconv.Itoa(seconds)}},
+		body:        []byte("aduket: circuit open"),
+	}
+}
@@ -0,0 +1,330 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBORResponse serves v encoded as CBOR (RFC 8949) with the application/cbor
+// content type. Values are converted like for MsgpackResponse. The status
+// defaults to 200 OK.
+func (e *Expectation) CBORResponse(v interface{}) *Expectation {
+	return e.binaryResponse(v, "application/cbor", encodeCBOR)
+}
+
+// CBOR major types.
+const (
+	cborUint = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// encodeCBOR encodes a value made of the types returned by toGeneric. Maps
+// are written with sorted keys.
+func encodeCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCBOR(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case int:
+		writeCBORInt(buf, int64(v))
+	case int8:
+		writeCBORInt(buf, int64(v))
+	case int16:
+		writeCBORInt(buf, int64(v))
+	case int32:
+		writeCBORInt(buf, int64(v))
+	case int64:
+		writeCBORInt(buf, v)
+	case uint:
+		writeCBORHead(buf, cborUint, uint64(v))
+	case uint8:
+		writeCBORHead(buf, cborUint, uint64(v))
+	case uint16:
+		writeCBORHead(buf, cborUint, uint64(v))
+	case uint32:
+		writeCBORHead(buf, cborUint, uint64(v))
+	case uint64:
+		writeCBORHead(buf, cborUint, v)
+	case float32:
+		buf.WriteByte(0xfa)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(v))
+	case float64:
+		buf.WriteByte(0xfb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		writeCBORHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, k := range sortedKeys(v) {
+			writeCBOR(buf, k)
+			if err := writeCBOR(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("aduket: cannot encode %T as CBOR", v)
+	}
+	return nil
+}
+
+func writeCBORInt(buf *bytes.Buffer, n int64) {
+	if n < 0 {
+		writeCBORHead(buf, cborNegInt, uint64(-1-n))
+		return
+	}
+	writeCBORHead(buf, cborUint, uint64(n))
+}
+
+// writeCBORHead writes a major type with its argument in the shortest form.
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+var errShortCBOR = errors.New("aduket: truncated CBOR data")
+
+// errCBORBreak is returned for the break code ending indefinite-length items.
+var errCBORBreak = errors.New("aduket: unexpected CBOR break")
+
+// decodeCBOR decodes a CBOR document. Map keys are converted to strings and
+// tags are dropped, keeping the tagged value.
+func decodeCBOR(data []byte) (interface{}, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("aduket: %d trailing bytes after CBOR value", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errShortCBOR
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head reads the major type and argument of the next item. Indefinite
+// lengths are reported with indefinite set.
+func (d *cborDecoder) head() (major byte, info byte, n uint64, indefinite bool, err error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info <= 27:
+		arg, err := d.take(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		for _, c := range arg {
+			n = n<<8 | uint64(c)
+		}
+		return major, info, n, false, nil
+	case info == 31:
+		return major, info, 0, true, nil
+	}
+	return 0, 0, 0, false, fmt.Errorf("aduket: invalid CBOR additional info %d", info)
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("aduket: CBOR data nested too deeply")
+	}
+	major, info, n, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("aduket: CBOR negative integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		var raw []byte
+		if indefinite {
+			raw, err = d.chunks(major)
+		} else {
+			var b []byte
+			b, err = d.take(n)
+			raw = append([]byte(nil), b...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if major == cborText {
+			return string(raw), nil
+		}
+		return raw, nil
+	case cborArray:
+		if !indefinite && n > uint64(len(d.data)-d.pos) {
+			return nil, errShortCBOR
+		}
+		arr := []interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			v, err := d.value(depth + 1)
+			if err == errCBORBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case cborMap:
+		if !indefinite && n > uint64(len(d.data)-d.pos) {
+			return nil, errShortCBOR
+		}
+		m := make(map[string]interface{})
+		for i := uint64(0); indefinite || i < n; i++ {
+			k, err := d.value(depth + 1)
+			if err == errCBORBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = v
+		}
+		return m, nil
+	case cborTag:
+		return d.value(depth + 1)
+	}
+
+	// Simple values and floats.
+	switch {
+	case indefinite:
+		return nil, errCBORBreak
+	case info == 20:
+		return false, nil
+	case info == 21:
+		return true, nil
+	case info == 22, info == 23:
+		return nil, nil
+	case info == 25:
+		return halfToFloat(uint16(n)), nil
+	case info == 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case info == 27:
+		return math.Float64frombits(n), nil
+	}
+	return int64(n), nil // Unassigned simple value
+}
+
+// chunks reads the definite-length chunks of an indefinite byte or text
+// string up to the break code.
+func (d *cborDecoder) chunks(major byte) ([]byte, error) {
+	var out []byte
+	for {
+		m, _, n, indefinite, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m == cborSimple && indefinite {
+			return out, nil
+		}
+		if m != major || indefinite {
+			return nil, errors.New("aduket: invalid CBOR string chunk")
+		}
+		b, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+}
+
+// halfToFloat converts an IEEE 754 half-precision float.
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,140 @@
+package aduket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ChaosOff is the name under which no chaos profile is active.
+const ChaosOff = "off"
+
+// defaultChaosProfiles are the profiles every server starts with, see
+// Server.Chaos.
+var defaultChaosProfiles = map[string]TrafficShape{
+	"slow":     {SpikeProbability: 1, SpikeLatency: 2 * time.Second},
+	"degraded": {SpikeProbability: 0.5, SpikeLatency: 500 * time.Millisecond, BurstProbability: 0.1},
+	"flaky":    {Window: 100 * time.Millisecond, BurstProbability: 0.3},
+	"outage":   {BurstProbability: 1, BurstBody: "aduket: chaos outage"},
+}
+
+// AddChaosProfile registers a chaos profile that Chaos can switch to, or
+// replaces the profile of that name. The built-in profiles are "slow",
+// "degraded", "flaky" and "outage".
+func (s *Server) AddChaosProfile(name string, shape TrafficShape) {
+	if name == "" || name == ChaosOff {
+		panic(fmt.Sprintf("aduket: invalid chaos profile name %q", name))
+	}
+	checkShape(shape)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chaosProfiles == nil {
+		s.chaosProfiles = make(map[string]TrafficShape, len(defaultChaosProfiles))
+		for k, v := range defaultChaosProfiles {
+			s.chaosProfiles[k] = v
+		}
+	}
+	s.chaosProfiles[name] = shape
+}
+
+// ChaosProfiles returns the names of the chaos profiles, sorted.
+func (s *Server) ChaosProfiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.profiles()))
+	for name := range s.profiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profiles returns the chaos profiles. The caller must hold s.mu.
+func (s *Server) profiles() map[string]TrafficShape {
+	if s.chaosProfiles == nil {
+		return defaultChaosProfiles
+	}
+	return s.chaosProfiles
+}
+
+// Chaos switches the server to a predefined fault profile, applied with
+// Shape, so demos can show failure handling without editing expectations.
+// ChaosOff or "" removes the faults. A later call to Shape replaces the
+// profile.
+func (s *Server) Chaos(name string) error {
+	if name == "" || name == ChaosOff {
+		s.Shape(TrafficShape{})
+		return nil
+	}
+	s.mu.Lock()
+	shape, ok := s.profiles()[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("aduket: unknown chaos profile %q", name)
+	}
+	s.Shape(shape)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chaos = name
+	return nil
+}
+
+// ActiveChaos returns the name of the active chaos profile, or ChaosOff.
+func (s *Server) ActiveChaos() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.chaos == "" {
+		return ChaosOff
+	}
+	return s.chaos
+}
+
+// NextChaos switches to the chaos profile after the active one, in name
+// order and wrapping around through ChaosOff, and returns its name. It backs
+// the chaos key of the CLI.
+func (s *Server) NextChaos() string {
+	names := append([]string{ChaosOff}, s.ChaosProfiles()...)
+	active := s.ActiveChaos()
+	next := names[0]
+	for i, name := range names {
+		if name == active {
+			next = names[(i+1)%len(names)]
+		}
+	}
+	s.Chaos(next)
+	return next
+}
+
+// chaosState is the body of the chaos admin endpoint.
+type chaosState struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+func (s *Server) serveAdminChaos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Profile string `json:"profile"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Chaos(body.Profile); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	case http.MethodDelete:
+		s.Chaos(ChaosOff)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, "aduket: method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, chaosState{Active: s.ActiveChaos(), Profiles: s.ChaosProfiles()})
+}
@@ -0,0 +1,87 @@
+package aduket
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+)
+
+// ClientOption configures a client returned by Server.Client.
+type ClientOption func(*http.Client)
+
+// WithCookieJar gives the client an in-memory cookie jar.
+func WithCookieJar() ClientOption {
+	return func(c *http.Client) {
+		jar, _ := cookiejar.New(nil)
+		c.Jar = jar
+	}
+}
+
+// Client returns an http.Client pre-pointed at the server. It trusts the
+// certificate of a TLS server and resolves relative request URLs such as
+// "/users" against the server URL.
+func (s *Server) Client(opts ...ClientOption) *http.Client {
+	c := &http.Client{
+		Transport: &rewriteTransport{server: s},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// RewriteTransport returns a RoundTripper that redirects requests for the
+// given hosts to the server while preserving the original Host header, so
+// code using absolute production URLs can be pointed at the mock. A host may
+// include a port. Without hosts every request is redirected.
+func (s *Server) RewriteTransport(hosts ...string) http.RoundTripper {
+	return &rewriteTransport{
+		server:   s,
+		hosts:    hosts,
+		allHosts: len(hosts) == 0,
+	}
+}
+
+// rewriteTransport sends requests without a host, and requests for the
+// configured hosts, to the server.
+type rewriteTransport struct {
+	server   *Server
+	hosts    []string
+	allHosts bool
+}
+
+func (t *rewriteTransport) shouldRewrite(u *url.URL) bool {
+	if u.Host == "" || t.allHosts {
+		return true
+	}
+	for _, h := range t.hosts {
+		if h == u.Host || h == u.Hostname() {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The server URL and client may change after Listen, so look them up
+	// for every request.
+	base := t.server.Server.Client().Transport
+	if !t.shouldRewrite(req.URL) {
+		return base.RoundTrip(req)
+	}
+
+	target, err := url.Parse(t.server.URL)
+	if err != nil {
+		return nil, err
+	}
+	out := req.Clone(req.Context())
+	if out.Host == "" {
+		out.Host = req.URL.Host
+	}
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	if out.Host == "" {
+		out.Host = target.Host
+	}
+	return base.RoundTrip(out)
+}
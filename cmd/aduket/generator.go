@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ismailtsdln/aduket"
+)
+
+// sendTimeout bounds requests sent from the generator, so a slow external
+// URL cannot leave the form waiting forever.
+const sendTimeout = 30 * time.Second
+
+var (
+	formLabelStyle = lipgloss.NewStyle().Foreground(accent).Bold(true).Width(9)
+	formBoxStyle   = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(purple).
+			Padding(1, 2)
+)
+
+// Fields of the request form, in tab order.
+const (
+	fieldMethod = iota
+	fieldURL
+	fieldHeaders
+	fieldBody
+	fieldCount
+)
+
+var fieldLabels = [fieldCount]string{"Method", "URL", "Headers", "Body"}
+
+// requestForm crafts a request to send from the TUI, to the mock or to any
+// other URL, while captures keep arriving in the traffic list.
+type requestForm struct {
+	inputs  [fieldCount]textinput.Model
+	focused int
+}
+
+func newRequestForm() *requestForm {
+	f := &requestForm{}
+	for i := range f.inputs {
+		in := textinput.New()
+		in.Prompt = ""
+		// A static cursor needs no blink messages routed back to the form.
+		in.Cursor.SetMode(cursor.CursorStatic)
+		f.inputs[i] = in
+	}
+	f.inputs[fieldMethod].SetValue("GET")
+	f.inputs[fieldURL].SetValue("/")
+	f.inputs[fieldURL].Placeholder = "/path or https://host/path"
+	f.inputs[fieldHeaders].Placeholder = "Name: value; Other: value"
+	f.inputs[fieldBody].Placeholder = `{"key": "value"}`
+	f.focus(fieldURL)
+	return f
+}
+
+func (f *requestForm) focus(i int) {
+	f.inputs[f.focused].Blur()
+	f.focused = (i + fieldCount) % fieldCount
+	f.inputs[f.focused].Focus()
+	f.inputs[f.focused].CursorEnd()
+}
+
+// update passes a key to the focused field; tab and shift+tab move between
+// fields.
+func (f *requestForm) update(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "tab", "down":
+		f.focus(f.focused + 1)
+		return nil
+	case "shift+tab", "up":
+		f.focus(f.focused - 1)
+		return nil
+	}
+	var cmd tea.Cmd
+	f.inputs[f.focused], cmd = f.inputs[f.focused].Update(msg)
+	return cmd
+}
+
+func (f *requestForm) view(width, height int) string {
+	rows := []string{detailTitleStyle.Render("New Request")}
+	for i, in := range f.inputs {
+		in.Width = width - 16
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, formLabelStyle.Render(fieldLabels[i]), in.View()))
+	}
+	rows = append(rows, "", statusStyle.Render("[enter: send] [tab: next field] [esc: cancel]"))
+	return formBoxStyle.Width(width - 2).Height(height - 2).Render(lipgloss.JoinVertical(lipgloss.Left, rows...))
+}
+
+// request builds the request described by the form. Relative URLs are sent
+// to the mock server.
+func (f *requestForm) request() (*http.Request, error) {
+	method := strings.ToUpper(strings.TrimSpace(f.inputs[fieldMethod].Value()))
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if b := f.inputs[fieldBody].Value(); b != "" {
+		body = strings.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimSpace(f.inputs[fieldURL].Value()), body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range strings.Split(f.inputs[fieldHeaders].Value(), ";") {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q, want Name: value", strings.TrimSpace(h))
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return req, nil
+}
+
+// sendRequest sends req in the background and reports the outcome as a
+// status message. Requests for the mock go through its client, which trusts
+// the certificate of a TLS server.
+func sendRequest(s *aduket.Server, req *http.Request) tea.Cmd {
+	return func() tea.Msg {
+		client := &http.Client{Timeout: sendTimeout}
+		if req.URL.Host == "" || strings.HasPrefix(req.URL.String(), s.URL) {
+			client = s.Client()
+			client.Timeout = sendTimeout
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return statusMsg(fmt.Sprintf("%s %s failed: %v", req.Method, req.URL, err))
+		}
+		n, _ := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return statusMsg(fmt.Sprintf("%s %s → %d, %d bytes in %s", req.Method, req.URL, resp.StatusCode, n, time.Since(start).Round(time.Millisecond)))
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ismailtsdln/aduket"
+)
+
+const initUsage = "usage: aduket init [flags] [dir]"
+
+// Credentials the scaffolded config accepts.
+const (
+	initToken    = "dev-token"
+	initUser     = "dev"
+	initPassword = "dev"
+)
+
+var resourceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// initOptions describes the starter config aduket init scaffolds.
+type initOptions struct {
+	resources []string // REST resources, each with list, get, create and delete endpoints
+	auth      string   // "none", "bearer" or "basic"
+	cors      string   // Origin allowed by CORS, "" for none
+	fixtures  bool     // Serve bodies from fixture files instead of inline
+	format    string   // "yaml" or "json"
+}
+
+func (o initOptions) validate() error {
+	if len(o.resources) == 0 {
+		return errors.New("at least one resource is needed")
+	}
+	for _, r := range o.resources {
+		if !resourceName.MatchString(r) {
+			return fmt.Errorf("invalid resource name %q", r)
+		}
+	}
+	switch o.auth {
+	case "none", "bearer", "basic":
+	default:
+		return fmt.Errorf("unknown auth %q, want none, bearer or basic", o.auth)
+	}
+	switch o.format {
+	case "yaml", "json":
+	default:
+		return fmt.Errorf("unknown format %q, want yaml or json", o.format)
+	}
+	return nil
+}
+
+// runInit implements "aduket init": it asks for the options on a terminal,
+// unless -y is given, and writes the starter config and its fixtures to the
+// directory argument. It returns the exit code.
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	resources := fs.String("resources", "users", "comma separated REST resources to mock")
+	auth := fs.String("auth", "bearer", "authentication the resources require: none, bearer or basic")
+	cors := fs.String("cors", "*", "origin allowed by CORS, empty for no CORS headers")
+	fixtures := fs.Bool("fixtures", true, "serve response bodies from files in a fixtures directory")
+	format := fs.String("format", "yaml", "config format: yaml or json")
+	yes := fs.Bool("y", false, "use the flags without asking")
+	force := fs.Bool("force", false, "overwrite existing files")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), initUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+
+	opts := initOptions{
+		resources: splitList(*resources),
+		auth:      *auth,
+		cors:      *cors,
+		fixtures:  *fixtures,
+		format:    *format,
+	}
+	if !*yes && isTerminal(os.Stdin) {
+		p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+		opts = p.initOptions(opts)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	files, err := scaffold(dir, opts, *force)
+	if err != nil {
+		fmt.Printf("Error scaffolding config: %v\n", err)
+		return 1
+	}
+	for _, file := range files {
+		fmt.Println("created", file)
+	}
+	fmt.Printf("\nStart the server with:\n  aduket -config %s\n", files[0])
+	switch opts.auth {
+	case "bearer":
+		fmt.Printf("Authenticate with:\n  Authorization: Bearer %s\n", initToken)
+	case "basic":
+		fmt.Printf("Authenticate as %s:%s\n", initUser, initPassword)
+	}
+	return 0
+}
+
+func splitList(s string) []string {
+	var fields []string
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// prompter asks questions on a terminal. An empty answer keeps the default
+// shown in brackets.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	eof bool // Input ended, every further answer is the default
+}
+
+func (p *prompter) ask(question, def string) string {
+	if p.eof {
+		return def
+	}
+	fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	line, err := p.in.ReadString('\n')
+	if err != nil {
+		p.eof = true
+		fmt.Fprintln(p.out)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	switch strings.ToLower(p.ask(question, hint)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// choose asks until the answer is one of choices.
+func (p *prompter) choose(question, def string, choices ...string) string {
+	for {
+		answer := p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(choices, ", ")), def)
+		for _, choice := range choices {
+			if answer == choice {
+				return answer
+			}
+		}
+		if p.eof {
+			return answer
+		}
+		fmt.Fprintf(p.out, "Please answer one of %s.\n", strings.Join(choices, ", "))
+	}
+}
+
+// initOptions asks for every option, offering the ones given as defaults.
+func (p *prompter) initOptions(def initOptions) initOptions {
+	opts := def
+	opts.resources = splitList(p.ask("Resources to mock, comma separated", strings.Join(def.resources, ",")))
+	opts.auth = p.choose("Authentication", def.auth, "none", "bearer", "basic")
+	opts.cors = ""
+	if p.confirm("Send CORS headers", def.cors != "") {
+		origin := def.cors
+		if origin == "" {
+			origin = "*"
+		}
+		opts.cors = p.ask("Allowed origin", origin)
+	}
+	opts.fixtures = p.confirm("Serve bodies from a fixtures directory", def.fixtures)
+	opts.format = p.choose("Config format", def.format, "yaml", "json")
+	return opts
+}
+
+// scaffold writes the config described by opts to dir, with its fixtures,
+// and returns the written files, the config first. Existing files are only
+// overwritten if force is set.
+func scaffold(dir string, opts initOptions, force bool) ([]string, error) {
+	cfg, fixtures := opts.config()
+	configFile := filepath.Join(dir, "aduket."+opts.format)
+	files := []string{configFile}
+	for name := range fixtures {
+		files = append(files, filepath.Join(dir, name))
+	}
+	if !force {
+		for _, file := range files {
+			if _, err := os.Stat(file); err == nil {
+				return nil, fmt.Errorf("%s already exists, use -force to overwrite it", file)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for name, body := range fixtures {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(file, body, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	if err := aduket.WriteConfig(configFile, cfg); err != nil {
+		return nil, err
+	}
+	sort.Strings(files[1:])
+	return files, nil
+}
+
+// config builds the starter config and its fixture files, keyed by their
+// path relative to the config.
+func (o initOptions) config() (*aduket.Config, map[string][]byte) {
+	cfg := &aduket.Config{}
+	fixtures := make(map[string][]byte)
+	headers := func() map[string]string {
+		h := map[string]string{"Content-Type": "application/json"}
+		if o.cors != "" {
+			h["Access-Control-Allow-Origin"] = o.cors
+		}
+		return h
+	}
+	add := func(exp aduket.ConfigExpectation) {
+		cfg.Expectations = append(cfg.Expectations, exp)
+	}
+
+	if o.cors != "" {
+		add(aduket.ConfigExpectation{
+			Name:   "cors-preflight",
+			Method: http.MethodOptions,
+			Status: http.StatusNoContent,
+			Headers: map[string]string{
+				"Access-Control-Allow-Origin":  o.cors,
+				"Access-Control-Allow-Methods": "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+				"Access-Control-Allow-Headers": "Authorization, Content-Type",
+				"Access-Control-Max-Age":       "600",
+			},
+		})
+	}
+	add(aduket.ConfigExpectation{
+		Name:     "health",
+		Method:   http.MethodGet,
+		Path:     "/health",
+		Status:   http.StatusOK,
+		Response: `{"status": "ok"}`,
+		Headers:  headers(),
+	})
+
+	var credentials map[string]string
+	challenge := ""
+	switch o.auth {
+	case "bearer":
+		credentials = map[string]string{"Authorization": "Bearer " + initToken}
+		challenge = "Bearer"
+		add(aduket.ConfigExpectation{
+			Name:     "token",
+			Method:   http.MethodPost,
+			Path:     "/auth/token",
+			Status:   http.StatusOK,
+			Response: fmt.Sprintf(`{"access_token": %q, "token_type": "Bearer", "expires_in": 3600}`, initToken),
+			Headers:  headers(),
+		})
+	case "basic":
+		basic := base64.StdEncoding.EncodeToString([]byte(initUser + ":" + initPassword))
+		credentials = map[string]string{"Authorization": "Basic " + basic}
+		challenge = `Basic realm="aduket"`
+	}
+
+	for _, r := range o.resources {
+		one := strings.TrimSuffix(r, "s")
+		item, _ := json.Marshal(map[string]interface{}{"id": 1, "name": "Example " + one})
+		bodies := map[string][]byte{"list": append(append([]byte("["), item...), ']'), "item": item}
+
+		endpoint := func(name, method, path string, status int, body string) {
+			exp := aduket.ConfigExpectation{
+				Name:           name,
+				Method:         method,
+				Path:           path,
+				RequestHeaders: credentials,
+				Status:         status,
+				Headers:        headers(),
+			}
+			switch {
+			case body == "":
+				delete(exp.Headers, "Content-Type")
+			case o.fixtures:
+				var indented bytes.Buffer
+				json.Indent(&indented, bodies[body], "", "  ")
+				indented.WriteByte('\n')
+				exp.ResponseFile = fmt.Sprintf("fixtures/%s/%s.json", r, body)
+				fixtures[exp.ResponseFile] = indented.Bytes()
+			default:
+				exp.Response = string(bodies[body])
+			}
+			add(exp)
+		}
+		endpoint("list-"+r, http.MethodGet, "/"+r, http.StatusOK, "list")
+		endpoint("get-"+one, http.MethodGet, "/"+r+"/{id}", http.StatusOK, "item")
+		endpoint("create-"+one, http.MethodPost, "/"+r, http.StatusCreated, "item")
+		endpoint("delete-"+one, http.MethodDelete, "/"+r+"/{id}", http.StatusNoContent, "")
+
+		if credentials == nil {
+			continue
+		}
+		// Requests without the credentials fall through to these.
+		for _, path := range []string{"/" + r, "/" + r + "/{id}"} {
+			unauthorized := headers()
+			unauthorized["WWW-Authenticate"] = challenge
+			add(aduket.ConfigExpectation{
+				Name:     r + "-unauthorized",
+				Method:   aduket.MethodAny,
+				Path:     path,
+				Status:   http.StatusUnauthorized,
+				Response: `{"error": "unauthorized"}`,
+				Headers:  unauthorized,
+				Priority: -1,
+			})
+		}
+	}
+	return cfg, fixtures
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/viewport"
@@ -49,25 +54,20 @@ var (
 	statusStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#7AA2F7")).
 			Italic(true)
-)
 
-type Config struct {
-	Expectations []struct {
-		Method   string            `json:"method"`
-		Path     string            `json:"path"`
-		Status   int               `json:"status"`
-		Response string            `json:"response"`
-		Headers  map[string]string `json:"headers"`
-	} `json:"expectations"`
-}
+	chaosStyle = lipgloss.NewStyle().
+			Foreground(white).
+			Background(lipgloss.Color("#F7768E")).
+			Bold(true).
+			Padding(0, 1)
+)
 
 type item struct {
-	method       string
-	path         string
-	status       int
-	headers      http.Header
-	requestBody  string
-	responseBody string
+	method  string
+	path    string
+	status  int
+	headers http.Header
+	req     *aduket.CapturedRequest
 }
 
 func (i item) Title() string {
@@ -98,74 +98,215 @@ func (i item) Description() string {
 }
 func (i item) FilterValue() string { return i.path }
 
+// traffic mirrors the order of the list items so the search bar can run
+// queries against the captured requests; list filters only see FilterValue.
+type traffic struct {
+	mu   sync.Mutex
+	reqs []*aduket.CapturedRequest
+}
+
+// prepend adds req in front of the requests, dropping the oldest beyond
+// limit, unless it is 0.
+func (t *traffic) prepend(req *aduket.CapturedRequest, limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reqs = append([]*aduket.CapturedRequest{req}, t.reqs...)
+	if limit > 0 && len(t.reqs) > limit {
+		t.reqs = t.reqs[:limit]
+	}
+}
+
+// filter runs terms that parse as a query, such as
+// "method='POST' AND status>=500", against the captured requests and falls
+// back to fuzzy matching on the path otherwise.
+func (t *traffic) filter(term string, targets []string) []list.Rank {
+	q, err := aduket.ParseQuery(term)
+	if err != nil || strings.TrimSpace(term) == "" {
+		return list.DefaultFilter(term, targets)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ranks []list.Rank
+	for i := range targets {
+		if i < len(t.reqs) && q.Match(t.reqs[i]) {
+			ranks = append(ranks, list.Rank{Index: i})
+		}
+	}
+	return ranks
+}
+
+// statusMsg is a short notice shown next to the key help.
+type statusMsg string
+
 type model struct {
-	list         list.Model
-	viewport     viewport.Model
-	server       *aduket.Server
-	selectedItem *item
+	tabs     []*tab // One per server, the first is the main server
+	active   int
+	viewport viewport.Model
+	status   string
+	phases   int // Number of timeline phases, 0 if none is playing
+	phase    phaseMsg
+	form     *requestForm // Open request generator, nil if closed
+}
+
+// tab returns the active tab.
+func (m model) tab() *tab {
+	return m.tabs[m.active]
+}
+
+// closeServers closes the servers of all tabs.
+func (m model) closeServers() {
+	for _, t := range m.tabs {
+		t.server.Close()
+	}
+}
+
+// switchTab activates tab i, showing its selected request.
+func (m *model) switchTab(i int) {
+	m.active = (i + len(m.tabs)) % len(m.tabs)
+	m.viewport.SetContent(m.tab().detail)
+}
+
+// displayBody renders a body decoded by its codec as indented JSON, falling
+// back to the raw bytes for unknown content types.
+func displayBody(raw []byte, decode func() (interface{}, error)) string {
+	if v, err := decode(); err == nil {
+		if out, err := json.MarshalIndent(v, "", "  "); err == nil {
+			return string(out)
+		}
+	}
+	return string(raw)
 }
 
 func (m model) Init() tea.Cmd {
+	if m.phases > 0 {
+		return phaseTick()
+	}
 	return nil
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.form != nil {
+			switch msg.String() {
+			case "ctrl+c":
+				m.closeServers()
+				return m, tea.Quit
+			case "esc":
+				m.form = nil
+				return m, nil
+			case "enter":
+				req, err := m.form.request()
+				if err != nil {
+					m.status = err.Error()
+					return m, nil
+				}
+				m.status = fmt.Sprintf("sending %s %s...", req.Method, req.URL)
+				return m, sendRequest(m.tab().server, req)
+			}
+			return m, m.form.update(msg)
+		}
+		t := m.tab()
+		filtering := t.list.FilterState() == list.Filtering
 		switch msg.String() {
 		case "q", "ctrl+c":
-			m.server.Close()
+			m.closeServers()
 			return m, tea.Quit
+		case "n":
+			if !filtering {
+				m.form = newRequestForm()
+				return m, nil
+			}
+		case "c":
+			if !filtering {
+				m.status = "chaos: " + t.server.NextChaos()
+				return m, nil
+			}
+		case "tab", "shift+tab":
+			if !filtering && len(m.tabs) > 1 {
+				if msg.String() == "tab" {
+					m.switchTab(m.active + 1)
+				} else {
+					m.switchTab(m.active - 1)
+				}
+				return m, nil
+			}
 		case "enter", " ":
-			if i, ok := m.list.SelectedItem().(item); ok {
-				m.selectedItem = &i
+			if i, ok := t.list.SelectedItem().(item); ok {
+				t.selectedItem = &i
 				detail := fmt.Sprintf("Path: %s\nStatus: %d\n\nHeaders:\n", i.path, i.status)
 				for k, v := range i.headers {
 					detail += fmt.Sprintf("  %s: %s\n", k, strings.Join(v, ", "))
 				}
+				// Bodies are read lazily since the server keeps them compressed.
 				detail += "\nRequest Body:\n"
-				if i.requestBody != "" {
-					detail += i.requestBody
+				if body := i.req.RequestBodyBytes(); len(body) > 0 {
+					detail += displayBody(body, i.req.DecodedBody)
 				} else {
 					detail += "[empty]"
 				}
 				detail += "\n\nResponse Body:\n"
-				if i.responseBody != "" {
-					detail += i.responseBody
+				if body := i.req.ResponseBodyBytes(); len(body) > 0 {
+					detail += displayBody(body, i.req.DecodedResponse)
 				} else {
 					detail += "[empty]"
 				}
-				m.viewport.SetContent(bodyStyle.Render(detail))
+				t.detail = bodyStyle.Render(detail)
+				m.viewport.SetContent(t.detail)
 			}
 		}
-	case *aduket.CapturedRequest:
+	case captureMsg:
+		req := msg.req
 		i := item{
-			method:       msg.Method,
-			path:         msg.URL.Path,
-			status:       msg.StatusCode,
-			headers:      msg.Header,
-			requestBody:  string(msg.BodyContent),
-			responseBody: string(msg.ResponseBody),
+			method:  req.Method,
+			path:    req.URL.Path,
+			status:  req.StatusCode,
+			headers: req.Header,
+			req:     req,
 		}
-		return m, m.list.InsertItem(0, i)
+		t := m.tabs[msg.tab]
+		t.traffic.prepend(req, t.limit)
+		cmd := t.list.InsertItem(0, i)
+		if t.limit > 0 && len(t.list.Items()) > t.limit {
+			t.list.RemoveItem(t.limit)
+		}
+		return m, cmd
+	case statusMsg:
+		m.status = string(msg)
+		return m, nil
+	case phaseMsg:
+		m.phase = msg
+		return m, nil
+	case phaseTickMsg:
+		return m, phaseTick()
 	case tea.WindowSizeMsg:
 		h, v := docStyle.GetFrameSize()
-		m.list.SetSize(msg.Width/2-h, msg.Height-v-6)
+		if len(m.tabs) > 1 {
+			v++ // Tab bar
+		}
+		for _, t := range m.tabs {
+			t.list.SetSize(msg.Width/2-h, msg.Height-v-6)
+		}
 		m.viewport.Width = msg.Width/2 - h
 		m.viewport.Height = msg.Height - v - 6
 	}
 
 	var cmd tea.Cmd
-	m.list, cmd = m.list.Update(msg)
+	t := m.tab()
+	t.list, cmd = t.list.Update(msg)
 	return m, cmd
 }
 
 func (m model) View() string {
-	sideBar := m.list.View()
+	t := m.tab()
+	sideBar := t.list.View()
 	detailView := ""
-	if m.selectedItem != nil {
+	if m.form != nil {
+		detailView = m.form.view(m.viewport.Width, m.viewport.Height)
+	} else if t.selectedItem != nil {
 		detailView = lipgloss.JoinVertical(lipgloss.Left,
-			detailTitleStyle.Width(m.viewport.Width).Render(fmt.Sprintf("%s %s", m.selectedItem.method, m.selectedItem.path)),
+			detailTitleStyle.Width(m.viewport.Width).Render(fmt.Sprintf("%s %s", t.selectedItem.method, t.selectedItem.path)),
 			m.viewport.View(),
 		)
 	} else {
@@ -184,12 +325,30 @@ func (m model) View() string {
 	)
 
 	banner := titleStyle.Render(" ADUKET ")
-	urlInfo := headerStyle.Render(fmt.Sprintf("Mock Server: %s", m.server.URL))
-	helpInfo := statusStyle.Render(" [q: quit] [enter: inspect] [/: search] ")
+	urlInfo := headerStyle.Render(fmt.Sprintf("Mock Server: %s", t.server.URL))
+	if m.phases > 0 && m.phase.name != "" {
+		urlInfo += phaseStyle.Render(m.phase.label(m.phases))
+	}
+	if chaos := t.server.ActiveChaos(); chaos != aduket.ChaosOff {
+		urlInfo += " " + chaosStyle.Render("CHAOS: "+chaos)
+	}
+	help := " [q: quit] [enter: inspect] [/: search] [n: new request] [c: chaos] "
+	if len(m.tabs) > 1 {
+		help += "[tab: next server] "
+	}
+	helpInfo := statusStyle.Render(help)
+	if m.status != "" {
+		helpInfo += statusStyle.Render(" " + m.status)
+	}
+
+	header := lipgloss.JoinHorizontal(lipgloss.Center, banner, urlInfo)
+	if len(m.tabs) > 1 {
+		header = lipgloss.JoinVertical(lipgloss.Left, header, tabBar(m.tabs, m.active))
+	}
 
 	return docStyle.Render(
 		lipgloss.JoinVertical(lipgloss.Left,
-			lipgloss.JoinHorizontal(lipgloss.Center, banner, urlInfo),
+			header,
 			"",
 			mainContent,
 			"",
@@ -199,58 +358,184 @@ func (m model) View() string {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		os.Exit(runInit(os.Args[2:]))
+	}
+
 	port := flag.Int("port", 8080, "port to run the mock server on")
-	configFile := flag.String("config", "", "path to json config file")
-	flag.Parse()
+	unixSocket := flag.String("unix", "", "listen on this unix socket instead of the port")
+	configFile := flag.String("config", "", "path to a JSON or YAML config file, or a directory of config files")
+	watch := flag.Bool("watch", true, "reload the config when it changes (e.g. a mounted ConfigMap)")
+	admin := flag.Bool("admin", false, "serve the expectation admin API on "+aduket.AdminPath+"/expectations")
+	docker := flag.Bool("docker", false, "serve common Docker Engine API endpoints, e.g. with -unix /tmp/docker.sock")
+	debugEndpoints := flag.Bool("debug-endpoints", false, "serve httpbin-style /__echo, /__headers, /__status/{code} and /__delay/{ms}")
+	discovery := flag.Bool("discovery", false, "serve mocked services on "+aduket.DiscoveryPath)
+	discoveryFile := flag.String("discovery-file", "", "write server URL and mocked services to this file")
+	proxy := flag.String("proxy", "", "forward unmatched requests to this upstream URL")
+	record := flag.String("record", "", "record proxied exchanges to this file and replay them on later runs")
+	history := flag.String("history", "", "append captured requests to this file as JSON lines")
+	junit := flag.String("junit", "", "write verification results as JUnit XML to this file on exit")
+	alert := flag.String("alert", "", "alert on traffic: comma separated unmatched, 5xx and match=NAME (default unmatched,5xx with a notifier)")
+	bell := flag.Bool("bell", false, "ring the terminal bell on alerts")
+	notifyCmd := flag.String("notify-cmd", "", "run this command with the alert message as last argument, e.g. notify-send aduket")
+	notifyWebhook := flag.String("notify-webhook", "", "post alerts as JSON to this URL")
+	headless := flag.Bool("headless", false, "print traffic instead of showing the TUI")
+	maxRequests := flag.Int("max-requests", 10000, "keep at most this many requests in memory and in the TUI, 0 for no limit")
+	captureBodies := flag.Bool("capture-bodies", true, "keep request and response bodies of captured requests")
+	var tabs tabFlags
+	flag.Var(&tabs, "tab", "also run a server shown as its own tab, as NAME=PORT[:CONFIG]; repeatable")
+	// "aduket play [flags] scenario.yaml" plays a timeline; everything
+	// else is the plain server.
+	args := os.Args[1:]
+	play := len(args) > 0 && args[0] == "play"
+	if play {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
-	s := aduket.NewUnstartedServer()
-	addr := fmt.Sprintf(":%d", *port)
-	if err := s.Listen(addr); err != nil {
-		fmt.Printf("Error starting server on %s: %v\n", addr, err)
-		os.Exit(1)
+	if *alert == "" && (*bell || *notifyCmd != "" || *notifyWebhook != "") {
+		*alert = "unmatched,5xx"
+	}
+	triggers, err := parseAlerts(*alert)
+	if err != nil {
+		fmt.Printf("Error parsing alerts: %v\n", err)
+		os.Exit(2)
 	}
 
-	if *configFile != "" {
-		data, err := os.ReadFile(*configFile)
-		if err != nil {
-			fmt.Printf("Error reading config: %v\n", err)
-			os.Exit(1)
+	var timeline string
+	if play {
+		if flag.NArg() != 1 {
+			fmt.Println(playUsage)
+			os.Exit(2)
 		}
-		var cfg Config
-		if err := json.Unmarshal(data, &cfg); err != nil {
-			fmt.Printf("Error parsing config: %v\n", err)
-			os.Exit(1)
+		timeline = flag.Arg(0)
+	}
+	if *headless && len(tabs) > 0 {
+		fmt.Println("-tab needs the TUI, it cannot be combined with -headless")
+		os.Exit(2)
+	}
+
+	// Notices from the server are shown by the TUI, which starts after the
+	// server; Send blocks until it runs. Without the TUI they are printed.
+	var p *tea.Program
+	ready := make(chan struct{})
+	send := func(msg tea.Msg) {
+		go func() {
+			<-ready
+			p.Send(msg)
+		}()
+	}
+	if *headless {
+		send = func(msg tea.Msg) { fmt.Println(msg) }
+	}
+	var alerts *notifier
+	if len(triggers) > 0 {
+		alerts = &notifier{
+			triggers: triggers,
+			bell:     *bell,
+			command:  strings.Fields(*notifyCmd),
+			webhook:  *notifyWebhook,
+			report:   func(status string) { send(statusMsg(status)) },
 		}
-		for _, exp := range cfg.Expectations {
-			s.Expect(exp.Method, exp.Path).
-				Response(exp.Status, exp.Response).
-				Headers(exp.Headers)
+	}
+
+	// The callbacks are set before the servers listen, as they are read
+	// while serving. Captured requests wait for the TUI like the notices.
+	onRequest := func(tab int) func(*aduket.CapturedRequest) {
+		return func(req *aduket.CapturedRequest) {
+			<-ready
+			p.Send(captureMsg{tab: tab, req: req})
+			if alerts != nil {
+				alerts.observe(req)
+			}
+		}
+	}
+	if *headless {
+		onRequest = func(int) func(*aduket.CapturedRequest) {
+			return func(req *aduket.CapturedRequest) {
+				fmt.Printf("%s %s %s -> %d\n", req.ReceivedAt.Format(time.TimeOnly), req.Method, req.URL.RequestURI(), req.StatusCode)
+				if alerts != nil {
+					alerts.observe(req)
+				}
+			}
 		}
-	} else {
-		s.Expect("GET", "/").Response(200, "{\"message\": \"Aduket CLI is running!\"}")
 	}
 
-	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
-	l.Title = "Traffic"
-	l.SetShowHelp(false)
-	l.Styles.Title = lipgloss.NewStyle().Foreground(purple).Bold(true)
+	opts := aduket.StandaloneOptions{
+		Addr:           fmt.Sprintf(":%d", *port),
+		UnixSocket:     *unixSocket,
+		Config:         *configFile,
+		WatchConfig:    *watch,
+		Timeline:       timeline,
+		AdminAPI:       *admin,
+		DockerEngine:   *docker,
+		DebugEndpoints: *debugEndpoints,
+		Discovery:      *discovery,
+		DiscoveryFile:  *discoveryFile,
+		ProxyTo:        *proxy,
+		RecordTo:       *record,
+		HistoryFile:    *history,
+		JUnitFile:      *junit,
 
-	vp := viewport.New(0, 0)
+		MaxCapturedRequests: *maxRequests,
+		DiscardBodies:       !*captureBodies,
 
-	m := model{
-		list:     l,
-		viewport: vp,
-		server:   s,
+		OnRequest: onRequest(0),
+		OnStatus:  func(status string) { send(statusMsg(status)) },
+		OnPhase:   func(i int, phase aduket.TimelinePhase) { send(newPhaseMsg(i, phase)) },
+	}
+	st, err := aduket.StartStandalone(opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	p := tea.NewProgram(m, tea.WithAltScreen())
+	if *headless {
+		runHeadless(st)
+		return
+	}
 
-	s.OnRequest = func(req *aduket.CapturedRequest) {
-		p.Send(req)
+	m := model{
+		tabs:     []*tab{newTab("main", st.Server, *maxRequests)},
+		viewport: viewport.New(0, 0),
+	}
+	if st.Timeline != nil {
+		m.phases = len(st.Timeline.Phases)
 	}
+	for i, spec := range tabs {
+		ts, err := startTab(spec, opts, onRequest(i+1))
+		if err != nil {
+			fmt.Printf("Error starting tab: %v\n", err)
+			m.closeServers()
+			st.Close()
+			os.Exit(1)
+		}
+		m.tabs = append(m.tabs, newTab(spec.name, ts, *maxRequests))
+	}
+
+	p = tea.NewProgram(m, tea.WithAltScreen())
+	close(ready)
 
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Alas, there's been an error: %v", err)
 		os.Exit(1)
 	}
+	if err := st.Close(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runHeadless prints the traffic of st instead of showing the TUI, until
+// the process is interrupted.
+func runHeadless(st *aduket.Standalone) {
+	fmt.Printf("Mock Server: %s\n", st.URL)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	if err := st.Close(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ismailtsdln/aduket"
+)
+
+// alertCooldown is the minimum gap between two alerts of the same trigger,
+// so a burst of failing traffic raises one alert rather than hundreds.
+const alertCooldown = 5 * time.Second
+
+// alertTrigger decides whether a captured request raises an alert. It
+// returns the reason, or "" if it does not.
+type alertTrigger struct {
+	spec  string
+	match func(*aduket.CapturedRequest) string
+}
+
+// parseAlerts parses a comma separated list of triggers: "unmatched" for
+// requests no expectation matched, "5xx" for server error responses, and
+// "match=NAME" for requests matching the expectation named NAME or written
+// as "METHOD /path".
+func parseAlerts(spec string) ([]alertTrigger, error) {
+	var triggers []alertTrigger
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			continue
+		case field == "unmatched":
+			triggers = append(triggers, alertTrigger{field, func(req *aduket.CapturedRequest) string {
+				if req.Expectation != nil {
+					return ""
+				}
+				return "unmatched request"
+			}})
+		case field == "5xx":
+			triggers = append(triggers, alertTrigger{field, func(req *aduket.CapturedRequest) string {
+				if req.StatusCode < 500 {
+					return ""
+				}
+				return fmt.Sprintf("server error %d", req.StatusCode)
+			}})
+		case strings.HasPrefix(field, "match="):
+			name := strings.TrimPrefix(field, "match=")
+			triggers = append(triggers, alertTrigger{field, func(req *aduket.CapturedRequest) string {
+				exp := req.Expectation
+				if exp == nil || (exp.Name != name && exp.Method+" "+exp.Path != name) {
+					return ""
+				}
+				return "matched " + name
+			}})
+		default:
+			return nil, fmt.Errorf("unknown alert %q, want unmatched, 5xx or match=NAME", field)
+		}
+	}
+	return triggers, nil
+}
+
+// alertPayload is the JSON body posted to an alert webhook.
+type alertPayload struct {
+	Message string    `json:"message"`
+	Trigger string    `json:"trigger"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Status  int       `json:"status"`
+	Time    time.Time `json:"time"`
+}
+
+// notifier raises alerts for captured requests: it rings the terminal bell,
+// runs a command such as notify-send with the message as last argument,
+// and posts to a webhook, whichever are configured. Every alert is also
+// passed to report for the TUI status line.
+type notifier struct {
+	triggers []alertTrigger
+	bell     bool
+	command  []string
+	webhook  string
+	report   func(string)
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+func (n *notifier) observe(req *aduket.CapturedRequest) {
+	for _, trigger := range n.triggers {
+		reason := trigger.match(req)
+		if reason == "" || !n.due(trigger.spec) {
+			continue
+		}
+		msg := fmt.Sprintf("alert: %s: %s %s", reason, req.Method, req.URL.Path)
+		n.report(msg)
+		if n.bell {
+			fmt.Fprint(os.Stdout, "\a")
+		}
+		go n.deliver(msg, alertPayload{
+			Message: msg,
+			Trigger: trigger.spec,
+			Method:  req.Method,
+			Path:    req.URL.Path,
+			Status:  req.StatusCode,
+			Time:    req.ReceivedAt,
+		})
+	}
+}
+
+// due reports whether trigger may alert now, and if so starts its cooldown.
+func (n *notifier) due(trigger string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	if now.Sub(n.lastSent[trigger]) < alertCooldown {
+		return false
+	}
+	if n.lastSent == nil {
+		n.lastSent = make(map[string]time.Time)
+	}
+	n.lastSent[trigger] = now
+	return true
+}
+
+func (n *notifier) deliver(msg string, payload alertPayload) {
+	if len(n.command) > 0 {
+		args := append(append([]string(nil), n.command[1:]...), msg)
+		if err := exec.Command(n.command[0], args...).Run(); err != nil {
+			n.report(fmt.Sprintf("notify command failed: %v", err))
+		}
+	}
+	if n.webhook != "" {
+		body, _ := json.Marshal(payload)
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Post(n.webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			n.report(fmt.Sprintf("alert webhook failed: %v", err))
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			n.report(fmt.Sprintf("alert webhook answered %s", resp.Status))
+		}
+	}
+}
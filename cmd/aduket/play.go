@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ismailtsdln/aduket"
+)
+
+const playUsage = "usage: aduket play [flags] scenario.yaml"
+
+var phaseStyle = lipgloss.NewStyle().
+	Foreground(dark).
+	Background(accent).
+	Bold(true).
+	Padding(0, 1)
+
+// phaseMsg announces the timeline phase that just started.
+type phaseMsg struct {
+	index int
+	name  string
+	ends  time.Time // Zero for a last phase that lasts forever
+}
+
+func newPhaseMsg(i int, phase aduket.TimelinePhase) phaseMsg {
+	msg := phaseMsg{index: i, name: phase.Name}
+	if phase.Duration > 0 {
+		msg.ends = time.Now().Add(time.Duration(phase.Duration))
+	}
+	if msg.name == "" {
+		msg.name = fmt.Sprintf("#%d", i+1)
+	}
+	return msg
+}
+
+func (p phaseMsg) String() string {
+	return p.label(0)
+}
+
+// label describes the phase as phase index of count, leaving out the count
+// if it is 0, with the time it has left.
+func (p phaseMsg) label(count int) string {
+	s := fmt.Sprintf("Phase %d: %s", p.index+1, p.name)
+	if count > 0 {
+		s = fmt.Sprintf("Phase %d/%d: %s", p.index+1, count, p.name)
+	}
+	if !p.ends.IsZero() {
+		left := time.Until(p.ends).Round(time.Second)
+		if left < 0 {
+			left = 0
+		}
+		s += fmt.Sprintf(" (%s left)", left)
+	}
+	return s
+}
+
+// phaseTickMsg redraws the countdown of the current phase.
+type phaseTickMsg struct{}
+
+func phaseTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return phaseTickMsg{} })
+}
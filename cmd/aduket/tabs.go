@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ismailtsdln/aduket"
+)
+
+var (
+	tabStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("#A9B1D6")).Padding(0, 1)
+	activeTabStyle = tabStyle.Foreground(white).Background(gray).Bold(true)
+)
+
+// tab is one mock server shown in the TUI, with its own traffic list and
+// selection, so a whole mocked environment fits in one terminal.
+type tab struct {
+	name         string
+	server       *aduket.Server
+	list         list.Model
+	traffic      *traffic
+	selectedItem *item
+	detail       string // Rendered details of selectedItem
+	limit        int    // Requests listed at most, 0 for no limit
+}
+
+func newTab(name string, s *aduket.Server, limit int) *tab {
+	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	l.Title = "Traffic"
+	l.SetShowHelp(false)
+	l.Styles.Title = lipgloss.NewStyle().Foreground(purple).Bold(true)
+	t := &traffic{}
+	l.Filter = t.filter
+	return &tab{name: name, server: s, list: l, traffic: t, limit: limit}
+}
+
+// captureMsg carries a captured request to the tab of the server that
+// received it.
+type captureMsg struct {
+	tab int
+	req *aduket.CapturedRequest
+}
+
+// tabSpec is an additional server given with -tab NAME=PORT[:CONFIG].
+type tabSpec struct {
+	name   string
+	port   int
+	config string
+}
+
+// tabFlags collects repeated -tab flags.
+type tabFlags []tabSpec
+
+func (f *tabFlags) String() string {
+	specs := make([]string, 0, len(*f))
+	for _, spec := range *f {
+		specs = append(specs, fmt.Sprintf("%s=%d", spec.name, spec.port))
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f *tabFlags) Set(value string) error {
+	name, rest, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want NAME=PORT[:CONFIG], got %q", value)
+	}
+	portText, config, _ := strings.Cut(rest, ":")
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return fmt.Errorf("invalid port in %q: %v", value, err)
+	}
+	*f = append(*f, tabSpec{name: name, port: port, config: config})
+	return nil
+}
+
+// startTab starts the server of an additional tab, loading its config if
+// one was given, and reports its requests to onRequest. Its history is
+// bounded like that of the main server.
+func startTab(spec tabSpec, opts aduket.StandaloneOptions, onRequest func(*aduket.CapturedRequest)) (*aduket.Server, error) {
+	s := aduket.NewUnstartedServer()
+	s.Name = spec.name
+	s.CompressHistory(true)
+	s.SetMaxCapturedRequests(opts.MaxCapturedRequests)
+	s.CaptureBodies(!opts.DiscardBodies)
+	s.OnRequest = onRequest
+	if spec.config != "" {
+		cfg, err := aduket.LoadConfig(spec.config)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("reading config of %s: %v", spec.name, err)
+		}
+		s.ExpectAll(cfg.Rules())
+	}
+	if err := s.Listen(fmt.Sprintf(":%d", spec.port)); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("starting %s on port %d: %v", spec.name, spec.port, err)
+	}
+	return s, nil
+}
+
+// tabBar renders the names of the tabs, highlighting the active one.
+func tabBar(tabs []*tab, active int) string {
+	names := make([]string, 0, len(tabs))
+	for i, t := range tabs {
+		style := tabStyle
+		if i == active {
+			style = activeTabStyle
+		}
+		names = append(names, style.Render(fmt.Sprintf("%d %s", i+1, t.name)))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Center, names...)
+}
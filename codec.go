@@ -0,0 +1,221 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Codec decodes a body of a given media type into structured form, made of
+// maps, slices and scalars like those produced by encoding/json.
+type Codec func(body []byte) (interface{}, error)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"application/json":                  decodeJSONBody,
+		"application/x-www-form-urlencoded": decodeFormBody,
+		"application/msgpack":               decodeMsgpack,
+		"application/x-msgpack":             decodeMsgpack,
+		"application/vnd.msgpack":           decodeMsgpack,
+		"application/protobuf":              decodeProtobufWire,
+		"application/x-protobuf":            decodeProtobufWire,
+		"application/vnd.google.protobuf":   decodeProtobufWire,
+		"application/cbor":                  decodeCBOR,
+	}
+)
+
+// RegisterCodec registers the codec used for bodies of mediaType, e.g. an
+// Avro or schema-aware protobuf decoder, replacing any previous one.
+// Captured bodies are decoded with it for assertions, templates and the TUI.
+// JSON, including "+json" types, form, MessagePack, CBOR and protobuf bodies are
+// supported out of the box; protobuf bodies are decoded without a schema,
+// into objects keyed by field number.
+func RegisterCodec(mediaType string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(mediaType)] = c
+}
+
+// codecFor returns the codec for a Content-Type header, or nil.
+func codecFor(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, ok := codecs[mediaType]; ok {
+		return c
+	}
+	if strings.HasSuffix(mediaType, "+json") {
+		return codecs["application/json"]
+	}
+	return nil
+}
+
+// decodeBody decodes body according to contentType.
+func decodeBody(contentType string, body []byte) (interface{}, error) {
+	c := codecFor(contentType)
+	if c == nil {
+		return nil, fmt.Errorf("aduket: no codec for content type %q", contentType)
+	}
+	return c(body)
+}
+
+// DecodedBody decodes the request body with the codec registered for its
+// Content-Type, see RegisterCodec.
+func (c *CapturedRequest) DecodedBody() (interface{}, error) {
+	return decodeBody(c.Header.Get("Content-Type"), c.RequestBodyBytes())
+}
+
+// DecodedResponse decodes the response body with the codec registered for
+// its Content-Type, see RegisterCodec.
+func (c *CapturedRequest) DecodedResponse() (interface{}, error) {
+	return decodeBody(c.ResponseHeader.Get("Content-Type"), c.ResponseBodyBytes())
+}
+
+// AssertDecodedBody checks the decoded body of the i-th request, see
+// DecodedBody. Values are compared by their JSON encoding.
+func (s *Server) AssertDecodedBody(t *testing.T, i int, expected interface{}) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+	actual, err := req.DecodedBody()
+	if err != nil {
+		s.fatalf(t, []*CapturedRequest{req}, "failed to decode request body: %v", err)
+	}
+	expectedJSON, actualJSON := normalizedJSON(expected), normalizedJSON(actual)
+	if expectedJSON != actualJSON {
+		s.errorf(t, []*CapturedRequest{req}, "decoded request body mismatch:\n%s", unifiedDiff(expectedJSON, actualJSON, colorDiffs))
+	}
+}
+
+func decodeJSONBody(body []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func decodeFormBody(body []byte) (interface{}, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if len(v) == 1 {
+			m[k] = v[0]
+		} else {
+			m[k] = v
+		}
+	}
+	return m, nil
+}
+
+// toGeneric converts v into the maps, slices and scalars understood by the
+// binary encoders. Values other than those are converted through their JSON
+// encoding, so struct tags apply; integral JSON numbers stay integers.
+func toGeneric(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, bool, string, []byte, float32, float64,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			g, err := toGeneric(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = g
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			g, err := toGeneric(item)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = g
+		}
+		return out, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return fromJSONNumbers(generic), nil
+}
+
+// fromJSONNumbers replaces json.Number values with int64 or float64.
+func fromJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJSONNumbers(item)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = fromJSONNumbers(item)
+		}
+	}
+	return v
+}
+
+// sortedKeys returns the keys of m in order, so encodings are deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// binaryResponse encodes v with encode and serves it with contentType. The
+// status defaults to 200 OK. Values that cannot be encoded panic, like other
+// configuration errors.
+func (e *Expectation) binaryResponse(v interface{}, contentType string, encode func(interface{}) ([]byte, error)) *Expectation {
+	generic, err := toGeneric(v)
+	var body []byte
+	if err == nil {
+		body, err = encode(generic)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("aduket: encoding %s response: %v", contentType, err))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.StatusCode == 0 {
+		e.StatusCode = http.StatusOK
+	}
+	e.Body = body
+	e.Header.Set("Content-Type", contentType)
+	return e
+}
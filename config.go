@@ -0,0 +1,235 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a set of expectations loaded from a JSON or YAML file, see
+// LoadConfig.
+type Config struct {
+	Expectations []ConfigExpectation `json:"expectations"`
+}
+
+// ConfigExpectation is a single expectation of a Config. Durations are
+// written as strings such as "150ms".
+type ConfigExpectation struct {
+	Name           string            `json:"name,omitempty"`
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	Query          map[string]string `json:"query,omitempty"`
+	RequestHeaders map[string]string `json:"requestHeaders,omitempty"`
+	Status         int               `json:"status,omitempty"`
+	Response       string            `json:"response,omitempty"`
+	ResponseFile   string            `json:"responseFile,omitempty"` // Fixture file relative to the config file, see Expectation.ResponseFile
+	Template       string            `json:"template,omitempty"`     // See Expectation.TemplateResponse
+	Transform      string            `json:"transform,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Delay          duration          `json:"delay,omitempty"`
+	Times          int               `json:"times,omitempty"`
+	Priority       int               `json:"priority,omitempty"`
+}
+
+// Rules converts the config into rules for Server.ExpectAll or
+// Server.ReplaceExpectations.
+func (c *Config) Rules() []Rule {
+	rules := make([]Rule, 0, len(c.Expectations))
+	for _, exp := range c.Expectations {
+		rules = append(rules, Rule{
+			Name:           exp.Name,
+			Method:         exp.Method,
+			Path:           exp.Path,
+			Query:          exp.Query,
+			RequestHeaders: exp.RequestHeaders,
+			Status:         exp.Status,
+			Body:           exp.Response,
+			File:           exp.ResponseFile,
+			Headers:        exp.Headers,
+			Delay:          time.Duration(exp.Delay),
+			Times:          exp.Times,
+			Priority:       exp.Priority,
+			Transform:      exp.Transform,
+			Template:       exp.Template,
+		})
+	}
+	return rules
+}
+
+// LoadConfig reads a config file, YAML if its extension is .yaml or .yml and
+// JSON otherwise. If path is a directory, such as a mounted Kubernetes
+// ConfigMap, every config file in it is loaded and merged in name order.
+func LoadConfig(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return loadConfigFile(path)
+	}
+
+	files, err := ConfigFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	merged := &Config{}
+	for _, file := range files {
+		cfg, err := loadConfigFile(file)
+		if err != nil {
+			return nil, err
+		}
+		merged.Expectations = append(merged.Expectations, cfg.Expectations...)
+	}
+	return merged, nil
+}
+
+// ConfigFiles lists the config files LoadConfig reads from dir. Hidden
+// entries are skipped, which covers the ..data and timestamped directories
+// Kubernetes uses to swap ConfigMap contents atomically.
+func ConfigFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch filepath.Ext(name) {
+		case ".json", ".yaml", ".yml":
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func loadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := validateExpectations(cfg.Expectations); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := resolveResponseFiles(cfg.Expectations, filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// validateExpectations checks the expectations for what Server.ExpectAll
+// would otherwise panic on, so a broken config is reported when it is
+// loaded.
+func validateExpectations(exps []ConfigExpectation) error {
+	for i, exp := range exps {
+		if exp.Method == "" {
+			return fmt.Errorf("expectation %d: method cannot be empty", i)
+		}
+		if exp.Transform != "" {
+			if _, err := parseJQ(exp.Transform); err != nil {
+				return fmt.Errorf("expectation %d: invalid transform %q: %v", i, exp.Transform, err)
+			}
+		}
+		if exp.Template != "" {
+			if _, err := parseTemplate(exp.Template); err != nil {
+				return fmt.Errorf("expectation %d: invalid template: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveResponseFiles makes the fixture files of exps relative to dir, the
+// directory of their config file, and checks that they can be read, so a
+// broken config is reported rather than panicking in Server.ExpectAll.
+func resolveResponseFiles(exps []ConfigExpectation, dir string) error {
+	for i := range exps {
+		file := exps[i].ResponseFile
+		if file == "" {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("response file of %s %s: %v", exps[i].Method, exps[i].Path, err)
+		}
+		exps[i].ResponseFile = file
+	}
+	return nil
+}
+
+// WriteConfig writes cfg to a config file that LoadConfig reads back, YAML
+// if its extension is .yaml or .yml and JSON otherwise.
+func WriteConfig(path string, cfg *Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		if data, err = jsonToYAML(data); err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// jsonToYAML converts a JSON document to block style YAML. JSON is valid
+// YAML, so decoding it into nodes keeps the field order of the structs.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var block func(*yaml.Node)
+	block = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			block(child)
+		}
+	}
+	block(&doc)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// yamlToJSON converts a YAML document to JSON, so both formats share the
+// field names and decoding rules of Config.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,45 @@
+package aduket
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// connIDKey is the context key under which the server stores the ID of the
+// connection a request arrived on.
+type connIDKey struct{}
+
+// connContext assigns every accepted connection a sequential ID, see
+// CapturedRequest.ConnID.
+func (s *Server) connContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connIDKey{}, s.connIDs.Add(1))
+}
+
+// AssertConnectionReused checks that the i-th and j-th requests arrived on
+// the same connection, e.g. to verify that a client pools keep-alive
+// connections.
+func (s *Server) AssertConnectionReused(t *testing.T, i, j int) {
+	a, b := s.GetRequest(i), s.GetRequest(j)
+	if a == nil || b == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d or %d not found", i, j)
+	}
+	if a.ConnID != b.ConnID {
+		s.errorf(t, []*CapturedRequest{a, b}, "expected requests %d and %d to share a connection, got connections %d and %d", i, j, a.ConnID, b.ConnID)
+	}
+}
+
+// AssertNewConnection checks that the i-th request arrived on a connection
+// no earlier request used.
+func (s *Server) AssertNewConnection(t *testing.T, i int) {
+	reqs := s.requestsSnapshot()
+	if i < 0 || i >= len(reqs) {
+		s.fatalf(t, reqs, "request index %d not found", i)
+	}
+	for j := 0; j < i; j++ {
+		if reqs[j].ConnID == reqs[i].ConnID {
+			s.errorf(t, []*CapturedRequest{reqs[j], reqs[i]}, "expected request %d to open a new connection, but it reused the connection of request %d", i, j)
+			return
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package aduket
+
+import "time"
+
+// DelayContinue makes the server wait d before sending 100 Continue to
+// clients that sent "Expect: 100-continue", e.g. to test that they honor
+// their continue timeout and send the body anyway.
+func (s *Server) DelayContinue(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.continueDelay = d
+}
+
+// RejectContinue makes the server answer requests carrying "Expect:
+// 100-continue" with status, e.g. http.StatusExpectationFailed or
+// http.StatusRequestEntityTooLarge, without reading their body or matching
+// them against expectations. The rejected requests are still captured.
+// A status of 0 sends 100 Continue again.
+func (s *Server) RejectContinue(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.continueStatus = status
+}
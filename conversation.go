@@ -0,0 +1,127 @@
+package aduket
+
+import (
+	"strings"
+	"testing"
+)
+
+// CookieKey returns a KeyFunc using the value of a request cookie.
+func CookieKey(name string) KeyFunc {
+	return func(c *CapturedRequest) string {
+		cookie, err := c.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// ThreadBy groups captured requests into conversations by key, e.g.
+// HeaderKey("X-Correlation-ID") or CookieKey("session"), so multi-step
+// client flows can be asserted as a unit, see Conversations.
+func (s *Server) ThreadBy(key KeyFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversationKey = key
+}
+
+// Conversation is a group of requests sharing a key, see ThreadBy.
+type Conversation struct {
+	ID       string
+	Requests []*CapturedRequest
+	server   *Server
+}
+
+// Conversations returns the conversations captured so far, ordered by their
+// first request. Requests without a key belong to no conversation. Without
+// ThreadBy, there are no conversations.
+func (s *Server) Conversations() []*Conversation {
+	s.mu.Lock()
+	key := s.conversationKey
+	s.mu.Unlock()
+	if key == nil {
+		return nil
+	}
+
+	var convs []*Conversation
+	byID := make(map[string]*Conversation)
+	for _, req := range s.requestsSnapshot() {
+		id := key(req)
+		if id == "" {
+			continue
+		}
+		conv := byID[id]
+		if conv == nil {
+			conv = &Conversation{ID: id, server: s}
+			byID[id] = conv
+			convs = append(convs, conv)
+		}
+		conv.Requests = append(conv.Requests, req)
+	}
+	return convs
+}
+
+// Conversation returns the conversation with the given ID, or nil if no
+// request carried it.
+func (s *Server) Conversation(id string) *Conversation {
+	for _, conv := range s.Conversations() {
+		if conv.ID == id {
+			return conv
+		}
+	}
+	return nil
+}
+
+// UniqueRequests returns the captured requests with duplicates removed,
+// keeping the first request for every key, e.g. BodyKey() to drop retries.
+// Requests with an empty key are always kept.
+func (s *Server) UniqueRequests(key KeyFunc) []*CapturedRequest {
+	return uniqueRequests(s.requestsSnapshot(), key)
+}
+
+// Unique returns the requests of the conversation with duplicates removed,
+// see Server.UniqueRequests.
+func (c *Conversation) Unique(key KeyFunc) []*CapturedRequest {
+	return uniqueRequests(c.Requests, key)
+}
+
+// Routes returns the "METHOD /path" of every request of the conversation.
+func (c *Conversation) Routes() []string {
+	routes := make([]string, len(c.Requests))
+	for i, req := range c.Requests {
+		routes[i] = req.Method + " " + req.URL.Path
+	}
+	return routes
+}
+
+// AssertRequestCount checks the number of requests in the conversation.
+func (c *Conversation) AssertRequestCount(t *testing.T, count int) {
+	if len(c.Requests) != count {
+		c.server.errorf(t, c.Requests, "expected %d requests in conversation %q, got %d", count, c.ID, len(c.Requests))
+	}
+}
+
+// AssertSequence checks that the conversation contains requests matching
+// the routes in the given order. Other requests may be interleaved.
+func (c *Conversation) AssertSequence(t *testing.T, routes []string) {
+	if route, step := missingStep(t, c.Requests, routes); step > 0 {
+		c.server.errorf(t, c.Requests, "expected conversation %q to follow %s, but %s (step %d) was not called in order",
+			c.ID, strings.Join(routes, " -> "), route, step)
+	}
+}
+
+func uniqueRequests(reqs []*CapturedRequest, key KeyFunc) []*CapturedRequest {
+	seen := make(map[string]bool)
+	var unique []*CapturedRequest
+	for _, req := range reqs {
+		k := key(req)
+		if k != "" {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+		}
+		unique = append(unique, req)
+	}
+	return unique
+}
@@ -0,0 +1,47 @@
+package aduket
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// WithCookie makes the expectation match only requests carrying the cookie
+// with the given value.
+func (e *Expectation) WithCookie(name, value string) *Expectation {
+	return e.MatchFunc(func(r *http.Request, body []byte) bool {
+		cookie, err := r.Cookie(name)
+		return err == nil && cookie.Value == value
+	})
+}
+
+// SetCookie adds a Set-Cookie header for cookie to the response. Several
+// cookies can be set by calling it repeatedly. It panics if the cookie is
+// invalid, like other configuration errors.
+func (e *Expectation) SetCookie(cookie *http.Cookie) *Expectation {
+	if err := cookie.Valid(); err != nil {
+		panic(fmt.Sprintf("aduket: invalid cookie: %v", err))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Header.Add("Set-Cookie", cookie.String())
+	return e
+}
+
+// AssertCookie checks that the i-th request carried the cookie with the
+// given value.
+func (s *Server) AssertCookie(t *testing.T, i int, name, value string) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		s.errorf(t, []*CapturedRequest{req}, "expected cookie %s: %s, got none", name, value)
+		return
+	}
+	if cookie.Value != value {
+		s.errorf(t, []*CapturedRequest{req}, "expected cookie %s: %s, got %s", name, value, cookie.Value)
+	}
+}
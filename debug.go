@@ -0,0 +1,93 @@
+package aduket
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EnableDebugEndpoints registers httpbin-style endpoints answering any
+// method, for ad-hoc client testing without registering expectations:
+//
+//	/__echo          the request method, URL, headers and body as JSON
+//	/__headers       the request headers as JSON
+//	/__status/{code} an empty response with the given status
+//	/__delay/{ms}    the echo response after waiting ms milliseconds
+//
+// Debug requests are recorded like any other but the endpoints are skipped
+// by Verify, and like Health they are removed by Reset and
+// ResetExpectations.
+func (s *Server) EnableDebugEndpoints() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Expectations = append(s.Expectations,
+		debugExpectation("/__echo", serveEcho),
+		debugExpectation("/__headers", func(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, map[string]http.Header{"headers": r.Header})
+		}),
+		debugExpectation("/__status/{code}", func(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+			code, err := strconv.Atoi(ctx.Param("code"))
+			if err != nil || code < 100 || code > 999 {
+				http.Error(w, "aduket: invalid status code", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(code)
+		}),
+		debugExpectation("/__delay/{ms}", func(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+			ms, err := strconv.Atoi(ctx.Param("ms"))
+			if err != nil || ms < 0 {
+				http.Error(w, "aduket: invalid delay", http.StatusBadRequest)
+				return
+			}
+			timer := time.NewTimer(time.Duration(ms) * time.Millisecond)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+			serveEcho(ctx, w, r)
+		}),
+	)
+}
+
+// debugExpectation returns a built-in expectation matching any method.
+func debugExpectation(path string, f CtxResponder) *Expectation {
+	return &Expectation{
+		Path:    path,
+		Header:  make(http.Header),
+		CtxFunc: f,
+		builtin: true,
+	}
+}
+
+// echoResponse is the body sent by /__echo.
+type echoResponse struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Query   map[string][]string `json:"query,omitempty"`
+	Headers http.Header         `json:"headers"`
+	Body    string              `json:"body,omitempty"`
+	JSON    json.RawMessage     `json:"json,omitempty"` // Body, if it is JSON
+}
+
+func serveEcho(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	resp := echoResponse{
+		Method:  r.Method,
+		URL:     r.URL.String(),
+		Query:   r.URL.Query(),
+		Headers: r.Header,
+	}
+	if body, _ := io.ReadAll(r.Body); len(body) > 0 {
+		resp.Body = string(body)
+		if json.Valid(body) {
+			resp.JSON = body
+		}
+	}
+	if len(resp.Query) == 0 {
+		resp.Query = nil
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,158 @@
+package aduket
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LatencyDistribution draws response delays from a random source, see
+// Dependency.Latency.
+type LatencyDistribution func(r *rand.Rand) time.Duration
+
+// Constant returns a distribution that always draws d.
+func Constant(d time.Duration) LatencyDistribution {
+	return func(*rand.Rand) time.Duration { return d }
+}
+
+// Uniform returns a distribution drawing uniformly from [min, max].
+func Uniform(min, max time.Duration) LatencyDistribution {
+	if min < 0 || max < min {
+		panic(fmt.Sprintf("aduket: invalid uniform latency [%v, %v]", min, max))
+	}
+	return func(r *rand.Rand) time.Duration {
+		return min + time.Duration(r.Int63n(int64(max-min)+1))
+	}
+}
+
+// Normal returns a normal distribution, with draws below zero clamped to
+// zero.
+func Normal(mean, stddev time.Duration) LatencyDistribution {
+	return func(r *rand.Rand) time.Duration {
+		return clampLatency(float64(mean) + r.NormFloat64()*float64(stddev))
+	}
+}
+
+// LogNormal returns a log-normal distribution with the given median and
+// shape sigma, the usual model of service latency: most responses are close
+// to the median with a long tail of slow ones. With sigma 0.5 about 1% of
+// the draws exceed 3.2 times the median.
+func LogNormal(median time.Duration, sigma float64) LatencyDistribution {
+	if median <= 0 || sigma < 0 {
+		panic(fmt.Sprintf("aduket: invalid log-normal latency with median %v and sigma %v", median, sigma))
+	}
+	return func(r *rand.Rand) time.Duration {
+		return clampLatency(float64(median) * math.Exp(sigma*r.NormFloat64()))
+	}
+}
+
+func clampLatency(ns float64) time.Duration {
+	if ns < 0 {
+		return 0
+	}
+	if ns > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(ns)
+}
+
+// Dependency is a named group of expectations standing for one downstream
+// service, whose latency and error rate are configured once for all of
+// them, e.g.
+//
+//	billing := s.Dependency("billing").Latency(aduket.LogNormal(80*time.Millisecond, 0.5)).ErrorRate(0.02)
+//	billing.Expect("POST", "/invoices").Response(201, `{}`)
+//
+// The latency adds to the expectations' own delays. Requests served by the
+// dependency are tagged "dependency:NAME", and those failed by its error
+// rate also "injected-failure". See Server.Dependency.
+type Dependency struct {
+	Name   string
+	server *Server
+
+	mu        sync.Mutex
+	latency   LatencyDistribution
+	errorRate float64
+	failure   *failure
+}
+
+// Dependency returns the dependency called name, creating it if needed.
+func (s *Server) Dependency(name string) *Dependency {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dependency(name)
+}
+
+// dependency returns the dependency called name, creating it if needed. The
+// caller must hold s.mu.
+func (s *Server) dependency(name string) *Dependency {
+	if d, ok := s.dependencies[name]; ok {
+		return d
+	}
+	if s.dependencies == nil {
+		s.dependencies = make(map[string]*Dependency)
+	}
+	d := &Dependency{
+		Name:    name,
+		server:  s,
+		failure: &failure{status: http.StatusServiceUnavailable},
+	}
+	s.dependencies[name] = d
+	return d
+}
+
+// Expect registers an expectation belonging to the dependency.
+func (d *Dependency) Expect(method, path string) *Expectation {
+	exp := d.server.Expect(method, path)
+	exp.mu.Lock()
+	exp.dependency = d
+	exp.mu.Unlock()
+	return exp
+}
+
+// Latency sets the distribution the delays of the dependency's responses
+// are drawn from, using the server's random source, see Server.Seed.
+func (d *Dependency) Latency(dist LatencyDistribution) *Dependency {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.latency = dist
+	return d
+}
+
+// ErrorRate makes a share p (from 0 to 1) of the dependency's requests fail
+// with 503 Service Unavailable, or the response set with ErrorResponse.
+func (d *Dependency) ErrorRate(p float64) *Dependency {
+	if p < 0 || p > 1 {
+		panic(fmt.Sprintf("aduket: error rate %v out of range [0, 1]", p))
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errorRate = p
+	return d
+}
+
+// ErrorResponse sets the response of requests failed by ErrorRate.
+func (d *Dependency) ErrorResponse(status int, body string) *Dependency {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failure = &failure{status: status, body: []byte(body)}
+	return d
+}
+
+// settings returns the latency, error rate and error response of d.
+func (d *Dependency) settings() (LatencyDistribution, float64, *failure) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.latency, d.errorRate, d.failure
+}
+
+// copyTo returns a dependency of c with the settings of d.
+func (d *Dependency) copyTo(c *Server) *Dependency {
+	latency, rate, failure := d.settings()
+	cd := c.dependency(d.Name)
+	cd.latency, cd.errorRate, cd.failure = latency, rate, failure
+	return cd
+}
@@ -0,0 +1,159 @@
+package aduket
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	diffContext = 3
+
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+	colorReset = "\x1b[0m"
+)
+
+// colorDiffs reports whether failure diffs are colored. Color is used when
+// stdout is a terminal and NO_COLOR is not set.
+var colorDiffs = func() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}()
+
+// diffOp is one line of a diff: ' ' for context, '-' for removed and '+' for
+// added.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns a unified diff of the lines of expected and actual, or
+// an empty string if they are equal.
+func unifiedDiff(expected, actual string, color bool) string {
+	if expected == actual {
+		return ""
+	}
+	ops := diffLines(strings.Split(expected, "\n"), strings.Split(actual, "\n"))
+
+	var b strings.Builder
+	b.WriteString(paint("--- expected", colorCyan, color) + "\n")
+	b.WriteString(paint("+++ actual", colorCyan, color) + "\n")
+
+	for start := 0; start < len(ops); {
+		// Find the next change and the run of changes that belong to its hunk.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		b.WriteString(paint(fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldLine, oldCount, newLine, newCount), colorCyan, color) + "\n")
+
+		for _, op := range ops[from:to] {
+			line := string(op.kind) + op.line
+			switch op.kind {
+			case '-':
+				line = paint(line, colorRed, color)
+			case '+':
+				line = paint(line, colorGreen, color)
+			}
+			b.WriteString(line + "\n")
+		}
+		start = to
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// diffLines computes a line diff from the longest common subsequence of a
+// and b.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// paint wraps a line in an ANSI color code when color is enabled.
+func paint(line, code string, color bool) string {
+	if !color {
+		return line
+	}
+	return code + line + colorReset
+}
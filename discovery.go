@@ -0,0 +1,102 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DiscoveryPath is the well-known path served by EnableDiscovery.
+const DiscoveryPath = "/.well-known/aduket"
+
+// DiscoveryInfo describes a running server and the services it mocks.
+type DiscoveryInfo struct {
+	URL       string              `json:"url"`
+	PID       int                 `json:"pid"`
+	StartedAt time.Time           `json:"startedAt"`
+	Services  []DiscoveredService `json:"services"`
+}
+
+// DiscoveredService is a mocked endpoint listed in DiscoveryInfo.
+type DiscoveredService struct {
+	Name   string `json:"name,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// Discovery returns the discovery information of the server.
+func (s *Server) Discovery() DiscoveryInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := DiscoveryInfo{
+		URL:       s.URL,
+		PID:       os.Getpid(),
+		StartedAt: s.historyStart,
+		Services:  make([]DiscoveredService, 0, len(s.Expectations)),
+	}
+	for _, exp := range s.Expectations {
+		exp.mu.Lock()
+		if !exp.builtin {
+			info.Services = append(info.Services, DiscoveredService{
+				Name:   exp.Name,
+				Method: exp.Method,
+				Path:   exp.Path,
+			})
+		}
+		exp.mu.Unlock()
+	}
+	return info
+}
+
+// EnableDiscovery serves the discovery information as JSON on DiscoveryPath,
+// so orchestration scripts can find what a dynamically bound server mocks.
+// Discovery requests are not recorded.
+func (s *Server) EnableDiscovery() {
+	s.handleInternal(DiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Discovery())
+	})
+}
+
+// WriteDiscoveryFile writes the discovery information to path. The file is
+// replaced atomically so readers never observe a partial write.
+func (s *Server) WriteDiscoveryFile(path string) error {
+	data, err := json.MarshalIndent(s.Discovery(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never observe a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".aduket-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// handleInternal registers a handler served by the server itself, ahead of
+// expectations and without recording the request.
+func (s *Server) handleInternal(path string, h http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.internal == nil {
+		s.internal = make(map[string]http.HandlerFunc)
+	}
+	s.internal[path] = h
+}
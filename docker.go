@@ -0,0 +1,371 @@
+package aduket
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DockerAPIVersion is the Docker Engine API version reported by
+// DockerEngine.
+const DockerAPIVersion = "1.43"
+
+// DockerEngine emulates the common endpoints of the Docker Engine API, see
+// Server.DockerEngine.
+type DockerEngine struct {
+	mu         sync.Mutex
+	images     map[string]*DockerImage
+	containers []*DockerContainer
+}
+
+// DockerImage configures the containers created from an image, see
+// DockerEngine.Image.
+type DockerImage struct {
+	mu       sync.Mutex
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+// DockerContainer is a container created through the emulated API.
+type DockerContainer struct {
+	ID      string
+	Name    string
+	Image   string
+	Cmd     []string
+	Env     []string
+	Tty     bool
+	State   string // "created", "running", "exited" or "removed"
+	Created time.Time
+}
+
+// dockerCreateRequest is the body of POST /containers/create.
+type dockerCreateRequest struct {
+	Image string
+	Cmd   []string
+	Env   []string
+	Tty   bool
+}
+
+// DockerEngine serves common Docker Engine API endpoints, so tools talking
+// to the Docker daemon can be tested hermetically. Combine it with
+// ListenUnix to stand in for /var/run/docker.sock:
+//
+//	GET    /_ping, /version
+//	GET    /containers/json             list containers (?all=1 for stopped ones)
+//	POST   /containers/create           create a container (?name=)
+//	GET    /containers/{id}/json        inspect
+//	POST   /containers/{id}/start       start (304 if running)
+//	POST   /containers/{id}/stop        stop (304 if not running)
+//	POST   /containers/{id}/wait        wait, returning the exit code
+//	GET    /containers/{id}/logs        logs, multiplexed unless Tty is set
+//	DELETE /containers/{id}
+//
+// Paths may carry a version prefix such as /v1.43. Containers are looked up
+// by ID, ID prefix or name. Their output and exit code are configured by
+// image, see Image. Like JSON-RPC methods, the endpoints are skipped by
+// Verify.
+func (s *Server) DockerEngine() *DockerEngine {
+	d := &DockerEngine{images: make(map[string]*DockerImage)}
+	routes := []struct {
+		method, path string
+		serve        CtxResponder
+	}{
+		{"GET", "/_ping", d.servePing},
+		{"HEAD", "/_ping", d.servePing},
+		{"GET", "/version", d.serveVersion},
+		{"GET", "/containers/json", d.serveList},
+		{"POST", "/containers/create", d.serveCreate},
+		{"GET", "/containers/{id}/json", d.serveInspect},
+		{"POST", "/containers/{id}/start", d.serveStart},
+		{"POST", "/containers/{id}/stop", d.serveStop},
+		{"POST", "/containers/{id}/wait", d.serveWait},
+		{"GET", "/containers/{id}/logs", d.serveLogs},
+		{"DELETE", "/containers/{id}", d.serveRemove},
+	}
+	for _, route := range routes {
+		for _, path := range []string{route.path, "/{version}" + route.path} {
+			serve := route.serve
+			exp := s.Expect(route.method, path).RespondWithCtx(func(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+				if v := ctx.Param("version"); v != "" && !strings.HasPrefix(v, "v") {
+					dockerError(w, http.StatusNotFound, "page not found")
+					return
+				}
+				w.Header().Set("Api-Version", DockerAPIVersion)
+				serve(ctx, w, r)
+			})
+			exp.mu.Lock()
+			exp.builtin = true
+			exp.mu.Unlock()
+		}
+	}
+	return d
+}
+
+// Image returns the configuration of the containers created from image,
+// registering it if needed. Images that were never configured are accepted
+// too and produce no output and a zero exit code.
+func (d *DockerEngine) Image(image string) *DockerImage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	img, ok := d.images[image]
+	if !ok {
+		img = &DockerImage{}
+		d.images[image] = img
+	}
+	return img
+}
+
+// Logs sets the output of the image's containers.
+func (i *DockerImage) Logs(stdout, stderr string) *DockerImage {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.stdout = stdout
+	i.stderr = stderr
+	return i
+}
+
+// ExitCode sets the exit code reported when waiting for the image's
+// containers.
+func (i *DockerImage) ExitCode(code int) *DockerImage {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.exitCode = code
+	return i
+}
+
+// Containers returns a snapshot of the containers created so far, including
+// removed ones, in creation order.
+func (d *DockerEngine) Containers() []DockerContainer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]DockerContainer, len(d.containers))
+	for i, c := range d.containers {
+		out[i] = *c
+	}
+	return out
+}
+
+// container finds a live container by ID, ID prefix or name. It must be
+// called with d.mu held.
+func (d *DockerEngine) container(ref string) *DockerContainer {
+	ref = strings.TrimPrefix(ref, "/")
+	for _, c := range d.containers {
+		if c.State == "removed" {
+			continue
+		}
+		if c.Name == ref || strings.HasPrefix(c.ID, ref) {
+			return c
+		}
+	}
+	return nil
+}
+
+// withContainer runs f with the container named by the id path parameter
+// and d.mu held, or answers 404.
+func (d *DockerEngine) withContainer(ctx Ctx, w http.ResponseWriter, f func(c *DockerContainer)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.container(ctx.Param("id"))
+	if c == nil {
+		dockerError(w, http.StatusNotFound, "No such container: "+ctx.Param("id"))
+		return
+	}
+	f(c)
+}
+
+// image returns the output and exit code configured for image. It must be
+// called with d.mu held.
+func (d *DockerEngine) image(image string) (stdout, stderr string, exitCode int) {
+	img, ok := d.images[image]
+	if !ok {
+		return "", "", 0
+	}
+	img.mu.Lock()
+	defer img.mu.Unlock()
+	return img.stdout, img.stderr, img.exitCode
+}
+
+func (d *DockerEngine) servePing(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write([]byte("OK"))
+	}
+}
+
+func (d *DockerEngine) serveVersion(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Version":       "24.0.0-aduket",
+		"ApiVersion":    DockerAPIVersion,
+		"MinAPIVersion": "1.12",
+		"Os":            runtime.GOOS,
+		"Arch":          runtime.GOARCH,
+		"GoVersion":     runtime.Version(),
+	})
+}
+
+func (d *DockerEngine) serveList(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	all := r.URL.Query().Get("all")
+	d.mu.Lock()
+	list := []map[string]interface{}{}
+	for _, c := range d.containers {
+		if c.State == "removed" || (c.State != "running" && all != "1" && all != "true") {
+			continue
+		}
+		list = append(list, map[string]interface{}{
+			"Id":      c.ID,
+			"Names":   []string{"/" + c.Name},
+			"Image":   c.Image,
+			"Command": strings.Join(c.Cmd, " "),
+			"Created": c.Created.Unix(),
+			"State":   c.State,
+		})
+	}
+	d.mu.Unlock()
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (d *DockerEngine) serveCreate(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	var req dockerCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Image == "" {
+		dockerError(w, http.StatusBadRequest, "invalid container config: an image is required")
+		return
+	}
+	id := make([]byte, 32)
+	rand.Read(id)
+	c := &DockerContainer{
+		ID:      hex.EncodeToString(id),
+		Name:    strings.TrimPrefix(r.URL.Query().Get("name"), "/"),
+		Image:   req.Image,
+		Cmd:     req.Cmd,
+		Env:     req.Env,
+		Tty:     req.Tty,
+		State:   "created",
+		Created: time.Now(),
+	}
+	if c.Name == "" {
+		c.Name = c.ID[:12]
+	}
+
+	d.mu.Lock()
+	if d.container(c.Name) != nil {
+		d.mu.Unlock()
+		dockerError(w, http.StatusConflict, "Conflict. The container name \"/"+c.Name+"\" is already in use")
+		return
+	}
+	d.containers = append(d.containers, c)
+	d.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"Id": c.ID, "Warnings": []string{}})
+}
+
+func (d *DockerEngine) serveInspect(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	d.withContainer(ctx, w, func(c *DockerContainer) {
+		_, _, exitCode := d.image(c.Image)
+		if c.State != "exited" {
+			exitCode = 0
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"Id":      c.ID,
+			"Name":    "/" + c.Name,
+			"Image":   c.Image,
+			"Created": c.Created.Format(time.RFC3339Nano),
+			"Config":  map[string]interface{}{"Image": c.Image, "Cmd": c.Cmd, "Env": c.Env, "Tty": c.Tty},
+			"State": map[string]interface{}{
+				"Status":   c.State,
+				"Running":  c.State == "running",
+				"ExitCode": exitCode,
+			},
+		})
+	})
+}
+
+func (d *DockerEngine) serveStart(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	d.withContainer(ctx, w, func(c *DockerContainer) {
+		if c.State == "running" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		c.State = "running"
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (d *DockerEngine) serveStop(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	d.withContainer(ctx, w, func(c *DockerContainer) {
+		if c.State != "running" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		c.State = "exited"
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// serveWait reports the container as exited right away with the exit code
+// configured for its image.
+func (d *DockerEngine) serveWait(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	d.withContainer(ctx, w, func(c *DockerContainer) {
+		_, _, exitCode := d.image(c.Image)
+		c.State = "exited"
+		writeJSON(w, http.StatusOK, map[string]interface{}{"StatusCode": exitCode})
+	})
+}
+
+// serveLogs writes the configured output, framed in the multiplexed stream
+// format with an 8-byte header per frame unless the container has a TTY.
+func (d *DockerEngine) serveLogs(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	d.withContainer(ctx, w, func(c *DockerContainer) {
+		stdout, stderr, _ := d.image(c.Image)
+		if q.Get("stdout") != "1" && q.Get("stdout") != "true" {
+			stdout = ""
+		}
+		if q.Get("stderr") != "1" && q.Get("stderr") != "true" {
+			stderr = ""
+		}
+		if c.Tty {
+			w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(stdout + stderr))
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+		w.WriteHeader(http.StatusOK)
+		for _, frame := range []struct {
+			stream byte
+			data   string
+		}{{1, stdout}, {2, stderr}} {
+			if frame.data == "" {
+				continue
+			}
+			header := make([]byte, 8)
+			header[0] = frame.stream
+			binary.BigEndian.PutUint32(header[4:], uint32(len(frame.data)))
+			w.Write(append(header, frame.data...))
+		}
+	})
+}
+
+func (d *DockerEngine) serveRemove(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+	force := r.URL.Query().Get("force")
+	d.withContainer(ctx, w, func(c *DockerContainer) {
+		if c.State == "running" && force != "1" && force != "true" {
+			dockerError(w, http.StatusConflict, "You cannot remove a running container "+c.ID+". Stop the container before attempting removal or force remove")
+			return
+		}
+		c.State = "removed"
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// dockerError writes an error in the Docker Engine API format.
+func dockerError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
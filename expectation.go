@@ -1,16 +1,42 @@
 package aduket
 
 import (
+	"context"
 	"net/http"
+	"regexp"
 	"sync"
+	"text/template"
 	"time"
 )
 
 // Responder is a function that generates a response based on the request.
 type Responder func(w http.ResponseWriter, r *http.Request)
 
+// Matcher is a custom request predicate. It receives the request and its
+// body, which has already been read. Matchers run without the server lock, so
+// they may run concurrently for different requests and must be safe for
+// concurrent use.
+type Matcher func(r *http.Request, body []byte) bool
+
+// Ctx carries per-request information to a CtxResponder.
+type Ctx struct {
+	context.Context
+	Server      *Server
+	Expectation *Expectation
+	Params      map[string]string // Path parameters, see Server.Expect
+}
+
+// Param returns the value of the named path parameter.
+func (c Ctx) Param(name string) string {
+	return c.Params[name]
+}
+
+// CtxResponder is a Responder that also receives the request context.
+type CtxResponder func(ctx Ctx, w http.ResponseWriter, r *http.Request)
+
 // Expectation represents a mocked request and its response.
 type Expectation struct {
+	Name         string // Optional name used to look up the expectation, see Named
 	Method       string
 	Path         string
 	StatusCode   int
@@ -18,10 +44,44 @@ type Expectation struct {
 	Header       http.Header
 	Times        int // Number of times this expectation can be matched, 0 means unlimited
 	MatchedTimes int
-	DelayTime    time.Duration
+	DelayTime    time.Duration // Time to first byte, see Delay and TTFB
+	DelayMax     time.Duration // Upper bound of a random time to first byte, see DelayRange
+	BodyTime     time.Duration // Time to stream the body over, see BodyDuration
 	Func         Responder
+	CtxFunc      CtxResponder
+	RequestMap   func(*http.Request) *http.Request // See MapRequest
 	QueryParams  map[string]string
-	mu           sync.Mutex
+	// RequestHeaders and RequestHeaderPatterns hold the request headers that
+	// must be present, see WithHeader and WithHeaderRegex.
+	RequestHeaders        map[string]string
+	RequestHeaderPatterns map[string]*regexp.Regexp
+	Variants              []Variant         // See ResponseOneOf
+	Localized             map[string]string // Bodies by language, see LocalizedResponse
+	Vary                  []VaryRule        // Response variants by request header, see VaryBy
+	Matchers              []Matcher         // Custom matchers, see MatchFunc
+	Transform             string            // jq-like response transform, see TransformJSON
+	Template              string            // Response body template, see TemplateResponse
+	// RequiredState and NewState drive the expectation's scenario, see
+	// WhenState and WillSetState.
+	RequiredState string
+	NewState      string
+	priority      int
+	rand          *lockedRand
+	builtin       bool // Registered by the server itself, skipped by Verify
+	transform     jqFilter
+	template      *template.Template
+	schema        *Schema
+	bomb          *bomb
+	stream        *stream
+	abTest        *abTest
+	webSocket     *WebSocketScript
+	fault         fault
+	failure       *failure
+	breaker       *circuitBreaker
+	auth          *credentials
+	scenario      *Scenario
+	dependency    *Dependency
+	mu            sync.Mutex
 }
 
 // Response sets the response status and body for the expectation.
@@ -43,6 +103,18 @@ func (e *Expectation) Headers(headers map[string]string) *Expectation {
 	return e
 }
 
+// Priority sets the priority of the expectation, 0 by default. When several
+// expectations match a request, the one with the highest priority answers
+// it; ties go to the most specific one, counting its method, query, header
+// and custom matchers, and then to the first registered. This lets specific
+// expectations override broad catch-alls whatever the registration order.
+func (e *Expectation) Priority(n int) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.priority = n
+	return e
+}
+
 // TimesSet sets how many times this expectation should match.
 func (e *Expectation) TimesSet(n int) *Expectation {
 	e.mu.Lock()
@@ -51,11 +123,14 @@ func (e *Expectation) TimesSet(n int) *Expectation {
 	return e
 }
 
-// Delay sets a simulated delay before responding.
+// Delay sets a simulated delay before responding. If the client gives up
+// during the delay, e.g. on a timeout, the server stops waiting and marks
+// the request ClientAborted instead of responding.
 func (e *Expectation) Delay(d time.Duration) *Expectation {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.DelayTime = d
+	e.DelayMax = 0
 	return e
 }
 
@@ -64,6 +139,36 @@ func (e *Expectation) RespondWith(f Responder) *Expectation {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	e.Func = f
+	e.CtxFunc = nil
+	return e
+}
+
+// RespondWithCtx sets a dynamic responder function that receives the matched
+// expectation, path parameters and server through a Ctx.
+func (e *Expectation) RespondWithCtx(f CtxResponder) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.CtxFunc = f
+	e.Func = nil
+	return e
+}
+
+// MapRequest sets a function that rewrites the matched request before the
+// response is produced, e.g. to inject headers or change the body seen by a
+// responder. The recorded request is not affected.
+func (e *Expectation) MapRequest(f func(*http.Request) *http.Request) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.RequestMap = f
+	return e
+}
+
+// MatchFunc adds a custom matcher that must accept the request for the
+// expectation to match.
+func (e *Expectation) MatchFunc(m Matcher) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Matchers = append(e.Matchers, m)
 	return e
 }
 
@@ -77,3 +182,118 @@ func (e *Expectation) WithQuery(key, value string) *Expectation {
 	e.QueryParams[key] = value
 	return e
 }
+
+// WithHeader makes the expectation match only requests carrying the header
+// with the given value. For headers with several values, any of them may
+// match.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.RequestHeaders == nil {
+		e.RequestHeaders = make(map[string]string)
+	}
+	e.RequestHeaders[http.CanonicalHeaderKey(key)] = value
+	return e
+}
+
+// WithHeaderRegex makes the expectation match only requests carrying the
+// header with a value matching pattern. It panics if pattern is invalid.
+func (e *Expectation) WithHeaderRegex(key, pattern string) *Expectation {
+	re := regexp.MustCompile(pattern)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.RequestHeaderPatterns == nil {
+		e.RequestHeaderPatterns = make(map[string]*regexp.Regexp)
+	}
+	e.RequestHeaderPatterns[http.CanonicalHeaderKey(key)] = re
+	return e
+}
+
+// Named assigns a name to the expectation so it can be referenced later,
+// e.g. by Server.ResetExpectation.
+func (e *Expectation) Named(name string) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Name = name
+	return e
+}
+
+// id returns the name of the expectation, falling back to "METHOD path".
+// The caller must hold e.mu.
+func (e *Expectation) id() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.Method + " " + e.Path
+}
+
+// clone returns a copy of the expectation with its match counter reset.
+func (e *Expectation) clone() *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	c := &Expectation{
+		Name:          e.Name,
+		Method:        e.Method,
+		Path:          e.Path,
+		StatusCode:    e.StatusCode,
+		Body:          append([]byte(nil), e.Body...),
+		Header:        e.Header.Clone(),
+		Times:         e.Times,
+		DelayTime:     e.DelayTime,
+		DelayMax:      e.DelayMax,
+		BodyTime:      e.BodyTime,
+		Func:          e.Func,
+		CtxFunc:       e.CtxFunc,
+		RequestMap:    e.RequestMap,
+		Variants:      append([]Variant(nil), e.Variants...),
+		rand:          e.rand.clone(),
+		Matchers:      append([]Matcher(nil), e.Matchers...),
+		builtin:       e.builtin,
+		priority:      e.priority,
+		Transform:     e.Transform,
+		transform:     e.transform,
+		Template:      e.Template,
+		template:      e.template,
+		schema:        e.schema,
+		bomb:          e.bomb,
+		stream:        e.stream,
+		abTest:        e.abTest,
+		webSocket:     e.webSocket,
+		fault:         e.fault,
+		failure:       e.failure,
+		breaker:       e.breaker.clone(),
+		auth:          e.auth,
+		scenario:      e.scenario,
+		dependency:    e.dependency,
+		RequiredState: e.RequiredState,
+		NewState:      e.NewState,
+	}
+	if e.QueryParams != nil {
+		c.QueryParams = make(map[string]string, len(e.QueryParams))
+		for k, v := range e.QueryParams {
+			c.QueryParams[k] = v
+		}
+	}
+	c.Vary = append([]VaryRule(nil), e.Vary...)
+	if e.Localized != nil {
+		c.Localized = make(map[string]string, len(e.Localized))
+		for k, v := range e.Localized {
+			c.Localized[k] = v
+		}
+	}
+	if e.RequestHeaders != nil {
+		c.RequestHeaders = make(map[string]string, len(e.RequestHeaders))
+		for k, v := range e.RequestHeaders {
+			c.RequestHeaders[k] = v
+		}
+	}
+	if e.RequestHeaderPatterns != nil {
+		c.RequestHeaderPatterns = make(map[string]*regexp.Regexp, len(e.RequestHeaderPatterns))
+		for k, v := range e.RequestHeaderPatterns {
+			c.RequestHeaderPatterns[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,369 @@
+package aduket
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// expectationJSON is the wire representation of an Expectation.
+type expectationJSON struct {
+	Name                  string            `json:"name,omitempty"`
+	Method                string            `json:"method"`
+	Path                  string            `json:"path,omitempty"`
+	Status                int               `json:"status,omitempty"`
+	Body                  string            `json:"body,omitempty"`
+	BodyBase64            string            `json:"bodyBase64,omitempty"`
+	Headers               http.Header       `json:"headers,omitempty"`
+	Times                 int               `json:"times,omitempty"`
+	Priority              int               `json:"priority,omitempty"`
+	Delay                 duration          `json:"delay,omitempty"`
+	DelayMax              duration          `json:"delayMax,omitempty"`
+	BodyTime              duration          `json:"bodyDuration,omitempty"`
+	Query                 map[string]string `json:"query,omitempty"`
+	RequestHeaders        map[string]string `json:"requestHeaders,omitempty"`
+	RequestHeaderPatterns map[string]string `json:"requestHeaderPatterns,omitempty"`
+	Variants              []Variant         `json:"variants,omitempty"`
+	Localized             map[string]string `json:"localized,omitempty"`
+	Vary                  []VaryRule        `json:"vary,omitempty"`
+	Transform             string            `json:"transform,omitempty"`
+	Template              string            `json:"template,omitempty"`
+	Scenario              string            `json:"scenario,omitempty"`
+	WhenState             string            `json:"whenState,omitempty"`
+	WillSetState          string            `json:"willSetState,omitempty"`
+	Failure               *failureJSON      `json:"failure,omitempty"`
+	CircuitBreaker        *breakerJSON      `json:"circuitBreaker,omitempty"`
+	Auth                  *credentials      `json:"auth,omitempty"`
+	Stream                *streamJSON       `json:"stream,omitempty"`
+	Bomb                  *bombJSON         `json:"bomb,omitempty"`
+	Generate              *Schema           `json:"generate,omitempty"`
+	Fault                 string            `json:"fault,omitempty"` // "reset" or "close"
+	ABTest                *abTestJSON       `json:"abTest,omitempty"`
+}
+
+// failureJSON encodes FailWithProbability.
+type failureJSON struct {
+	Probability float64 `json:"probability"`
+	Status      int     `json:"status,omitempty"`
+	Body        string  `json:"body,omitempty"`
+}
+
+// breakerJSON encodes CircuitBreaker.
+type breakerJSON struct {
+	Threshold    int      `json:"threshold"`
+	OpenDuration duration `json:"openDuration"`
+}
+
+// streamJSON encodes StreamResponse and AbortStreamAfter. Chunks that are
+// not all valid UTF-8 are base64 encoded, like bodies.
+type streamJSON struct {
+	Chunks       []string `json:"chunks,omitempty"`
+	ChunksBase64 [][]byte `json:"chunksBase64,omitempty"`
+	Interval     duration `json:"interval,omitempty"`
+	AbortAfter   *int     `json:"abortAfter,omitempty"`
+}
+
+// bombJSON encodes ResponseBomb.
+type bombJSON struct {
+	Size       int64 `json:"size"`
+	Compressed bool  `json:"compressed,omitempty"`
+}
+
+// abTestJSON encodes ABTest.
+type abTestJSON struct {
+	Variants map[string]Variant `json:"variants"`
+	StickyBy string             `json:"stickyBy,omitempty"`
+}
+
+// faultNames are the names of faults in the JSON format.
+var faultNames = map[fault]string{faultReset: "reset", faultClose: "close"}
+
+// MarshalJSON encodes the expectation. Bodies that are not valid UTF-8 are
+// base64 encoded. Responder functions and custom matchers cannot be
+// serialized and are omitted.
+func (e *Expectation) MarshalJSON() ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	v := expectationJSON{
+		Name:           e.Name,
+		Method:         e.Method,
+		Path:           e.Path,
+		Status:         e.StatusCode,
+		Times:          e.Times,
+		Priority:       e.priority,
+		Delay:          duration(e.DelayTime),
+		DelayMax:       duration(e.DelayMax),
+		BodyTime:       duration(e.BodyTime),
+		Query:          e.QueryParams,
+		RequestHeaders: e.RequestHeaders,
+		Headers:        e.Header,
+		Variants:       e.Variants,
+		Localized:      e.Localized,
+		Vary:           e.Vary,
+		Transform:      e.Transform,
+		Template:       e.Template,
+		WhenState:      e.RequiredState,
+		WillSetState:   e.NewState,
+		Auth:           e.auth,
+		Generate:       e.schema,
+		Fault:          faultNames[e.fault],
+	}
+	if e.scenario != nil {
+		v.Scenario = e.scenario.Name
+	}
+	if f := e.failure; f != nil {
+		v.Failure = &failureJSON{Probability: f.probability, Status: f.status, Body: string(f.body)}
+	}
+	if b := e.breaker; b != nil {
+		v.CircuitBreaker = &breakerJSON{Threshold: b.threshold, OpenDuration: duration(b.openFor)}
+	}
+	if st := e.stream; st != nil {
+		v.Stream = &streamJSON{Interval: duration(st.interval)}
+		if st.abortAfter >= 0 {
+			n := st.abortAfter
+			v.Stream.AbortAfter = &n
+		}
+		if validChunks(st.chunks) {
+			for _, chunk := range st.chunks {
+				v.Stream.Chunks = append(v.Stream.Chunks, string(chunk))
+			}
+		} else {
+			v.Stream.ChunksBase64 = st.chunks
+		}
+	}
+	if b := e.bomb; b != nil {
+		v.Bomb = &bombJSON{Size: b.size, Compressed: b.compressed}
+	}
+	if ab := e.abTest; ab != nil {
+		v.ABTest = &abTestJSON{Variants: ab.variants, StickyBy: ab.stickyBy}
+	}
+	if len(v.Headers) == 0 {
+		v.Headers = nil
+	}
+	for k, re := range e.RequestHeaderPatterns {
+		if v.RequestHeaderPatterns == nil {
+			v.RequestHeaderPatterns = make(map[string]string)
+		}
+		v.RequestHeaderPatterns[k] = re.String()
+	}
+	if utf8.Valid(e.Body) {
+		v.Body = string(e.Body)
+	} else {
+		v.BodyBase64 = base64.StdEncoding.EncodeToString(e.Body)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes an expectation previously encoded with MarshalJSON.
+func (e *Expectation) UnmarshalJSON(data []byte) error {
+	var v expectationJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Method == "" {
+		return fmt.Errorf("aduket: expectation method cannot be empty")
+	}
+
+	body := []byte(v.Body)
+	if v.BodyBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(v.BodyBase64)
+		if err != nil {
+			return fmt.Errorf("aduket: invalid bodyBase64: %v", err)
+		}
+		body = decoded
+	}
+
+	var patterns map[string]*regexp.Regexp
+	for k, pattern := range v.RequestHeaderPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("aduket: invalid pattern for header %s: %v", k, err)
+		}
+		if patterns == nil {
+			patterns = make(map[string]*regexp.Regexp)
+		}
+		patterns[http.CanonicalHeaderKey(k)] = re
+	}
+	var headers map[string]string
+	for k, value := range v.RequestHeaders {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[http.CanonicalHeaderKey(k)] = value
+	}
+
+	var transform jqFilter
+	if v.Transform != "" {
+		var err error
+		if transform, err = parseJQ(v.Transform); err != nil {
+			return fmt.Errorf("aduket: invalid transform %q: %v", v.Transform, err)
+		}
+	}
+
+	var tmpl *template.Template
+	if v.Template != "" {
+		var err error
+		if tmpl, err = parseTemplate(v.Template); err != nil {
+			return fmt.Errorf("aduket: invalid template: %v", err)
+		}
+	}
+
+	var sc *Scenario
+	if v.Scenario != "" {
+		// Bound to the scenario of the same name once registered, see
+		// Server.bindScenarios.
+		sc = &Scenario{Name: v.Scenario, state: ScenarioStarted}
+	} else if v.WhenState != "" || v.WillSetState != "" {
+		return fmt.Errorf("aduket: whenState and willSetState require a scenario")
+	}
+	var fail *failure
+	if f := v.Failure; f != nil {
+		if f.Probability < 0 || f.Probability > 1 {
+			return fmt.Errorf("aduket: failure probability %v out of range [0, 1]", f.Probability)
+		}
+		fail = &failure{probability: f.Probability, status: f.Status, body: []byte(f.Body)}
+	}
+	var breaker *circuitBreaker
+	if b := v.CircuitBreaker; b != nil {
+		if b.Threshold <= 0 || b.OpenDuration <= 0 {
+			return fmt.Errorf("aduket: invalid circuit breaker threshold %d or open duration %v", b.Threshold, time.Duration(b.OpenDuration))
+		}
+		breaker = &circuitBreaker{threshold: b.Threshold, openFor: time.Duration(b.OpenDuration)}
+	}
+	if a := v.Auth; a != nil && a.Scheme != authBasic && a.Scheme != authBearer {
+		return fmt.Errorf("aduket: unknown auth scheme %q", a.Scheme)
+	}
+	var st *stream
+	if s := v.Stream; s != nil {
+		st = &stream{chunks: s.ChunksBase64, interval: time.Duration(s.Interval), abortAfter: -1}
+		for _, chunk := range s.Chunks {
+			st.chunks = append(st.chunks, []byte(chunk))
+		}
+		if s.AbortAfter != nil {
+			st.abortAfter = *s.AbortAfter
+		}
+	}
+	var bm *bomb
+	if b := v.Bomb; b != nil {
+		bm = &bomb{size: b.Size, compressed: b.Compressed}
+	}
+	var flt fault
+	if v.Fault != "" {
+		for f, name := range faultNames {
+			if name == v.Fault {
+				flt = f
+			}
+		}
+		if flt == 0 {
+			return fmt.Errorf("aduket: unknown fault %q", v.Fault)
+		}
+	}
+	var ab *abTest
+	if a := v.ABTest; a != nil {
+		if len(a.Variants) == 0 {
+			return fmt.Errorf("aduket: A/B test without variants")
+		}
+		ab = newABTest(a.Variants, a.StickyBy)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Name = v.Name
+	e.Method = v.Method
+	e.Path = v.Path
+	e.StatusCode = v.Status
+	e.Body = body
+	e.Header = v.Headers
+	if e.Header == nil {
+		e.Header = make(http.Header)
+	}
+	e.Times = v.Times
+	e.priority = v.Priority
+	e.DelayTime = time.Duration(v.Delay)
+	e.DelayMax = time.Duration(v.DelayMax)
+	e.BodyTime = time.Duration(v.BodyTime)
+	e.QueryParams = v.Query
+	e.RequestHeaders = headers
+	e.RequestHeaderPatterns = patterns
+	e.Variants = v.Variants
+	e.Localized = v.Localized
+	e.Vary = v.Vary
+	e.Transform = v.Transform
+	e.transform = transform
+	e.Template = v.Template
+	e.template = tmpl
+	e.scenario = sc
+	e.RequiredState = v.WhenState
+	e.NewState = v.WillSetState
+	e.failure = fail
+	e.breaker = breaker
+	e.auth = v.Auth
+	e.stream = st
+	e.bomb = bm
+	e.schema = v.Generate
+	e.fault = flt
+	e.abTest = ab
+	return nil
+}
+
+// validChunks reports whether all chunks are valid UTF-8.
+func validChunks(chunks [][]byte) bool {
+	for _, chunk := range chunks {
+		if !utf8.Valid(chunk) {
+			return false
+		}
+	}
+	return true
+}
+
+// bindScenarios joins decoded expectations to the scenarios of s with the
+// same names, so they share state with each other and with Server.Scenario.
+// The caller must hold s.mu.
+func (s *Server) bindScenarios(exps []*Expectation) {
+	for _, exp := range exps {
+		exp.mu.Lock()
+		if exp.scenario != nil && exp.scenario.server == nil {
+			exp.scenario = s.scenario(exp.scenario.Name)
+		}
+		exp.mu.Unlock()
+	}
+}
+
+// duration is a time.Duration encoded as a string such as "1.5s". Plain
+// numbers are accepted when decoding and interpreted as nanoseconds.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	if d == 0 {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("aduket: invalid duration %s", data)
+		}
+		*d = duration(n)
+		return nil
+	}
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("aduket: invalid duration %q: %v", s, err)
+	}
+	*d = duration(parsed)
+	return nil
+}
@@ -0,0 +1,81 @@
+package aduket
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// fault is a network-level failure injected instead of a response.
+type fault int
+
+const (
+	faultClose fault = iota + 1
+	faultReset
+)
+
+// ResetConnection makes the expectation reset the TCP connection instead of
+// responding, so clients see "connection reset by peer". Requests failed
+// this way are recorded with a StatusCode of 0.
+func (e *Expectation) ResetConnection() *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fault = faultReset
+	return e
+}
+
+// CloseWithoutResponse makes the expectation close the connection without
+// sending anything, so clients see an unexpected EOF. Requests failed this
+// way are recorded with a StatusCode of 0.
+func (e *Expectation) CloseWithoutResponse() *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fault = faultClose
+	return e
+}
+
+// failure is an error response served instead of the expectation's own for
+// a share of requests, see FailWithProbability.
+type failure struct {
+	probability float64
+	status      int
+	header      http.Header
+	body        []byte
+}
+
+// FailWithProbability makes a share p (from 0 to 1) of the matched requests
+// fail with status and body instead of getting the expectation's response,
+// e.g. to exercise retries and circuit breakers. Failed requests are tagged
+// "injected-failure". The draws use the server's random source, see
+// Server.Seed, or the expectation's own, see Seed.
+func (e *Expectation) FailWithProbability(p float64, status int, body string) *Expectation {
+	if p < 0 || p > 1 {
+		panic(fmt.Sprintf("aduket: failure probability %v out of range [0, 1]", p))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failure = &failure{probability: p, status: status, body: []byte(body)}
+	return e
+}
+
+// apply hijacks the connection and terminates it. It reports false if the
+// connection cannot be hijacked, as with HTTP/2.
+func (f fault) apply(w http.ResponseWriter) bool {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return false
+	}
+	if f == faultReset {
+		raw := conn
+		if tc, ok := raw.(*tls.Conn); ok {
+			raw = tc.NetConn()
+		}
+		if tcp, ok := raw.(*net.TCPConn); ok {
+			// Closing with a zero linger sends RST instead of FIN.
+			tcp.SetLinger(0)
+		}
+	}
+	conn.Close()
+	return true
+}
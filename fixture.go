@@ -0,0 +1,62 @@
+package aduket
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResponseBytes sets a binary response body, such as an image or an encoded
+// protobuf. Unless a Content-Type header was already set, it is sniffed from
+// the body.
+func (e *Expectation) ResponseBytes(status int, body []byte) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.StatusCode = status
+	e.Body = append([]byte(nil), body...)
+	if e.Header.Get("Content-Type") == "" {
+		e.Header.Set("Content-Type", http.DetectContentType(body))
+	}
+	return e
+}
+
+// ResponseFile serves the contents of a fixture file. Unless a Content-Type
+// header was already set, it is derived from the file extension, or sniffed
+// from the contents when the extension is unknown. Files ending in .gz are
+// served as is with Content-Encoding: gzip and the type of the inner file.
+// It panics if the file cannot be read.
+func (e *Expectation) ResponseFile(status int, path string) *Expectation {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		panic(fmt.Sprintf("aduket: reading fixture: %v", err))
+	}
+
+	name := path
+	encoding := ""
+	if strings.HasSuffix(name, ".gz") {
+		name = strings.TrimSuffix(name, ".gz")
+		encoding = "gzip"
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.StatusCode = status
+	e.Body = body
+	if encoding != "" {
+		e.Header.Set("Content-Encoding", encoding)
+	}
+	if e.Header.Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" && encoding == "" {
+			contentType = http.DetectContentType(body)
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		e.Header.Set("Content-Type", contentType)
+	}
+	return e
+}
@@ -0,0 +1,132 @@
+package aduket
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// FuzzTarget returns a function for testing.F.Fuzz that sends a
+// fuzzer-generated request through the matching and handling pipeline of s,
+// without going over the network. The header argument holds "Key: value"
+// lines. A test fails when the handler or a custom matcher panics, when a
+// matcher gives different answers for the same request, or when the request
+// is not served by the expectation the matcher selected.
+//
+// The history and match counters of s are reset before every input, so s
+// should be dedicated to fuzzing.
+//
+//	func FuzzMatching(f *testing.F) {
+//		s := aduket.NewUnstartedServer()
+//		s.Expect("GET", "/users/{id}").Response(http.StatusOK, "{}")
+//		aduket.FuzzSeeds(f, s)
+//		f.Fuzz(aduket.FuzzTarget(s))
+//	}
+func FuzzTarget(s *Server) func(t *testing.T, method, target, header string, body []byte) {
+	handler := s.handler()
+
+	return func(t *testing.T, method, target, header string, body []byte) {
+		r, err := http.NewRequest(method, "http://aduket.invalid"+target, bytes.NewReader(body))
+		if err != nil || !strings.HasPrefix(target, "/") {
+			return // Not a request a client could send.
+		}
+		for _, line := range strings.Split(header, "\n") {
+			if k, v, ok := strings.Cut(line, ":"); ok && k != "" {
+				r.Header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+			}
+		}
+
+		s.ResetRequests()
+
+		s.mu.Lock()
+		_, internal := s.internal[r.URL.Path]
+		set := s.matchSet()
+		s.mu.Unlock()
+		predicted, panicked := set.safePeek(r, body)
+		again, _ := set.safePeek(r, body)
+
+		if panicked != nil {
+			t.Errorf("matcher panicked on %s %s: %v", method, target, panicked)
+			return
+		}
+		if predicted != again {
+			t.Errorf("matching %s %s is not deterministic: got %s, then %s", method, target, describe(predicted), describe(again))
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code == http.StatusInternalServerError && strings.HasPrefix(rec.Body.String(), "mock server panic:") {
+			t.Errorf("handler panicked on %s %s: %s", method, target, rec.Body.String())
+			return
+		}
+		if internal {
+			return
+		}
+
+		reqs := s.requestsSnapshot()
+		if len(reqs) != 1 {
+			t.Errorf("expected %s %s to be recorded once, got %d records", method, target, len(reqs))
+			return
+		}
+		if served := reqs[0].Expectation; served != predicted {
+			t.Errorf("%s %s matched %s but was served by %s", method, target, describe(predicted), describe(served))
+		}
+	}
+}
+
+// FuzzSeeds adds a corpus entry for every expectation of s, with path
+// parameters filled in, so fuzzing starts from requests that match.
+func FuzzSeeds(f *testing.F, s *Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, exp := range s.Expectations {
+		exp.mu.Lock()
+		method, path := exp.Method, exp.Path
+		query := make([]string, 0, len(exp.QueryParams))
+		for k, v := range exp.QueryParams {
+			query = append(query, k+"="+v)
+		}
+		body := exp.Body
+		exp.mu.Unlock()
+
+		parts := strings.Split(path, "/")
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				parts[i] = "1"
+			}
+		}
+		target := strings.Join(parts, "/")
+		if target == "" {
+			target = "/"
+		}
+		if len(query) > 0 {
+			target += "?" + strings.Join(query, "&")
+		}
+		f.Add(method, target, "", body)
+	}
+}
+
+// safePeek is like peek but recovers from panicking matchers.
+func (set matchSet) safePeek(r *http.Request, body []byte) (exp *Expectation, panicked interface{}) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			exp, panicked = nil, rec
+		}
+	}()
+	exp, _ = set.peek(r, body)
+	return exp, nil
+}
+
+// describe names an expectation in fuzzing failures.
+func describe(exp *Expectation) string {
+	if exp == nil {
+		return "no expectation"
+	}
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	return exp.id()
+}
@@ -0,0 +1,238 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// GoldenUpdateEnv names the environment variable that makes
+// Server.MatchInteractionsGolden write the golden file instead of comparing
+// against it, e.g. ADUKET_UPDATE_GOLDEN=1 go test ./...
+const GoldenUpdateEnv = "ADUKET_UPDATE_GOLDEN"
+
+// redactedValue replaces redacted fields in golden files.
+const redactedValue = "[REDACTED]"
+
+// GoldenOption configures Server.MatchInteractionsGolden.
+type GoldenOption func(*goldenConfig)
+
+type goldenConfig struct {
+	ignore []string
+	redact []string
+}
+
+// defaultGoldenIgnore lists fields that vary between runs or Go versions
+// and are left out of golden files.
+var defaultGoldenIgnore = []string{
+	"request.header.Accept-Encoding",
+	"request.header.Content-Length",
+	"request.header.User-Agent",
+	"response.header.Content-Length",
+	"response.header.Date",
+}
+
+// IgnoreFields leaves fields out of the golden file. Fields are dot
+// separated paths into the normalized interaction, such as
+// "request.header.X-Request-Id" or "response.body.createdAt"; a "*" segment
+// matches every array element or object key.
+func IgnoreFields(paths ...string) GoldenOption {
+	return func(c *goldenConfig) {
+		c.ignore = append(c.ignore, paths...)
+	}
+}
+
+// RedactFields replaces the values of fields with "[REDACTED]", keeping
+// their presence in the golden file but not their contents, e.g.
+// "request.header.Authorization". Paths are written as for IgnoreFields.
+func RedactFields(paths ...string) GoldenOption {
+	return func(c *goldenConfig) {
+		c.redact = append(c.redact, paths...)
+	}
+}
+
+func newGoldenConfig(opts []GoldenOption) *goldenConfig {
+	cfg := &goldenConfig{ignore: append([]string(nil), defaultGoldenIgnore...)}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// MatchInteractionsGolden compares every captured interaction, in order,
+// against the golden file at path. Interactions are normalized to JSON with
+// the request method, path, query, headers and body and the response
+// status, headers and body; JSON bodies are compared structurally and
+// timestamps are left out. With $ADUKET_UPDATE_GOLDEN set the golden file is
+// written instead.
+func (s *Server) MatchInteractionsGolden(t *testing.T, path string, opts ...GoldenOption) {
+	cfg := newGoldenConfig(opts)
+
+	reqs := s.requestsSnapshot()
+	actual := make([]interface{}, 0, len(reqs))
+	for _, req := range reqs {
+		actual = append(actual, cfg.normalize(req))
+	}
+	actualJSON := goldenJSON(actual)
+
+	if os.Getenv(GoldenUpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			s.fatalf(t, reqs, "writing golden file: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(actualJSON), 0o644); err != nil {
+			s.fatalf(t, reqs, "writing golden file: %v", err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.fatalf(t, reqs, "reading golden file: %v (set %s=1 to create it)", err, GoldenUpdateEnv)
+	}
+	var expected interface{}
+	if err := decodeJSONNumbers(data, &expected); err != nil {
+		s.fatalf(t, reqs, "golden file %s is not valid JSON: %v", path, err)
+	}
+	if diff := unifiedDiff(goldenJSON(expected), actualJSON, colorDiffs); diff != "" {
+		s.errorf(t, reqs, "interactions do not match golden file %s (set %s=1 to update it):\n%s", path, GoldenUpdateEnv, diff)
+	}
+}
+
+// normalize returns the golden form of an interaction.
+func (c *goldenConfig) normalize(req *CapturedRequest) interface{} {
+	request := map[string]interface{}{
+		"method": req.Method,
+		"path":   req.URL.Path,
+	}
+	if query := req.URL.Query(); len(query) > 0 {
+		request["query"] = query.Encode()
+	}
+	if header := goldenHeader(req.Header); header != nil {
+		request["header"] = header
+	}
+	if body := goldenBody(req.RequestBodyBytes()); body != nil {
+		request["body"] = body
+	}
+
+	response := map[string]interface{}{
+		"status": req.StatusCode,
+	}
+	if header := goldenHeader(req.ResponseHeader); header != nil {
+		response["header"] = header
+	}
+	if body := goldenBody(req.ResponseBodyBytes()); body != nil {
+		response["body"] = body
+	}
+
+	var v interface{} = map[string]interface{}{
+		"request":  request,
+		"response": response,
+	}
+	for _, p := range c.ignore {
+		v = applyFieldPath(v, strings.Split(p, "."), nil)
+	}
+	for _, p := range c.redact {
+		v = applyFieldPath(v, strings.Split(p, "."), redactedValue)
+	}
+	return v
+}
+
+// goldenHeader flattens a header, joining repeated values with ", ".
+func goldenHeader(h http.Header) map[string]interface{} {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(h))
+	for k, v := range h {
+		out[http.CanonicalHeaderKey(k)] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// goldenBody returns body decoded if it is JSON and as a string otherwise,
+// or nil if it is empty.
+func goldenBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := decodeJSONNumbers(body, &v); err == nil {
+		return v
+	}
+	return string(body)
+}
+
+// applyFieldPath removes the field at path from v, or replaces its value
+// with replacement if that is not nil, and returns the updated v.
+func applyFieldPath(v interface{}, path []string, replacement interface{}) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+	key, rest := path[0], path[1:]
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := []string{key}
+		if key == "*" {
+			keys = sortedKeys(v)
+		}
+		for _, k := range keys {
+			child, ok := v[k]
+			switch {
+			case !ok:
+			case len(rest) > 0:
+				v[k] = applyFieldPath(child, rest, replacement)
+			case replacement == nil:
+				delete(v, k)
+			default:
+				v[k] = replacement
+			}
+		}
+	case []interface{}:
+		if key != "*" {
+			return v
+		}
+		if len(rest) == 0 {
+			if replacement == nil {
+				return []interface{}{}
+			}
+			for i := range v {
+				v[i] = replacement
+			}
+			return v
+		}
+		for i, child := range v {
+			v[i] = applyFieldPath(child, rest, replacement)
+		}
+	}
+	return v
+}
+
+// decodeJSONNumbers decodes a single JSON value, keeping numbers as
+// json.Number so they round-trip unchanged.
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// goldenJSON renders v as indented JSON with sorted keys, the format of
+// golden files.
+func goldenJSON(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+	return buf.String()
+}
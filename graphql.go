@@ -0,0 +1,111 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// GraphQLRequest is a GraphQL operation sent over HTTP, either as a JSON POST
+// body or as GET query parameters.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// operationPattern finds the name of the first named operation in a query.
+var operationPattern = regexp.MustCompile(`(?:^|[\s{}])(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+// Operation returns the operation name, taken from operationName or, when
+// that is empty, from the first named operation of the query.
+func (g GraphQLRequest) Operation() string {
+	if g.OperationName != "" {
+		return g.OperationName
+	}
+	if m := operationPattern.FindStringSubmatch(g.Query); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// parseGraphQL decodes the GraphQL operation of a request.
+func parseGraphQL(r *http.Request, body []byte) (GraphQLRequest, bool) {
+	var g GraphQLRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		g.Query = q.Get("query")
+		g.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &g.Variables); err != nil {
+				return g, false
+			}
+		}
+		return g, g.Query != ""
+	}
+	if err := json.Unmarshal(body, &g); err != nil {
+		return g, false
+	}
+	return g, g.Query != ""
+}
+
+// GraphQL returns the GraphQL operation carried by the request, if any.
+func (c *CapturedRequest) GraphQL() (GraphQLRequest, bool) {
+	return parseGraphQL(c.Request, c.RequestBodyBytes())
+}
+
+// WithGraphQLOperation makes the expectation match only GraphQL requests for
+// the named operation, so operations sharing a single /graphql endpoint can
+// be mocked independently.
+func (e *Expectation) WithGraphQLOperation(name string) *Expectation {
+	return e.MatchFunc(func(r *http.Request, body []byte) bool {
+		g, ok := parseGraphQL(r, body)
+		return ok && g.Operation() == name
+	})
+}
+
+// WithGraphQLQueryContains makes the expectation match only GraphQL requests
+// whose query contains fragment. Runs of whitespace are treated as a single
+// space on both sides.
+func (e *Expectation) WithGraphQLQueryContains(fragment string) *Expectation {
+	fragment = collapseSpace(fragment)
+	return e.MatchFunc(func(r *http.Request, body []byte) bool {
+		g, ok := parseGraphQL(r, body)
+		return ok && strings.Contains(collapseSpace(g.Query), fragment)
+	})
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// AssertGraphQLVariables checks the variables of the GraphQL operation sent
+// with the i-th request.
+func (s *Server) AssertGraphQLVariables(t *testing.T, i int, vars map[string]interface{}) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+	g, ok := req.GraphQL()
+	if !ok {
+		s.fatalf(t, []*CapturedRequest{req}, "request %d is not a GraphQL request", i)
+	}
+
+	expectedJSON := normalizedJSON(vars)
+	actualJSON := normalizedJSON(g.Variables)
+	if expectedJSON != actualJSON {
+		s.errorf(t, []*CapturedRequest{req}, "GraphQL variables mismatch:\n%s", unifiedDiff(expectedJSON, actualJSON, colorDiffs))
+	}
+}
+
+// normalizedJSON encodes v as indented JSON with numbers and key order
+// normalized, so equal values encode equally.
+func normalizedJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	var generic interface{}
+	json.Unmarshal(data, &generic)
+	out, _ := json.MarshalIndent(generic, "", "  ")
+	return string(out)
+}
@@ -0,0 +1,129 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthState is the state reported by a simulated health endpoint.
+type HealthState string
+
+// Health states reported by Health.
+const (
+	HealthOK       HealthState = "ok"
+	HealthDegraded HealthState = "degraded"
+	HealthDown     HealthState = "down"
+)
+
+// Health simulates a health endpoint whose state changes over a timeline.
+type Health struct {
+	exp    *Expectation
+	mu     sync.Mutex
+	base   HealthState
+	phases []healthPhase
+}
+
+type healthPhase struct {
+	state      HealthState
+	start, end time.Time
+}
+
+// Health returns the simulated health endpoint of the server, registering
+// GET /health on first use. It reports HealthOK until changed.
+func (s *Server) Health() *Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.health != nil {
+		return s.health
+	}
+
+	h := &Health{base: HealthOK}
+	h.exp = newExpectation("GET", "/health").RespondWith(h.serve)
+	h.exp.builtin = true
+	s.Expectations = append(s.Expectations, h.exp)
+	s.health = h
+	return h
+}
+
+// clone returns a copy of h answering through exp, the clone of h.exp.
+func (h *Health) clone(exp *Expectation) *Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := &Health{exp: exp, base: h.base, phases: append([]healthPhase(nil), h.phases...)}
+	exp.Func = c.serve
+	return c
+}
+
+// Path moves the health endpoint to another path.
+func (h *Health) Path(path string) *Health {
+	h.exp.mu.Lock()
+	defer h.exp.mu.Unlock()
+	h.exp.Path = path
+	return h
+}
+
+// Set reports state from now on and clears any scheduled phases.
+func (h *Health) Set(state HealthState) *Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.base = state
+	h.phases = nil
+	return h
+}
+
+// Degrade schedules a degraded phase lasting d, starting now or after the
+// previously scheduled phase.
+func (h *Health) Degrade(d time.Duration) *Health {
+	return h.schedule(HealthDegraded, d)
+}
+
+// Down schedules a down phase lasting d, starting now or after the previously
+// scheduled phase.
+func (h *Health) Down(d time.Duration) *Health {
+	return h.schedule(HealthDown, d)
+}
+
+// Up schedules a healthy phase lasting d, which is useful between other
+// phases of a timeline.
+func (h *Health) Up(d time.Duration) *Health {
+	return h.schedule(HealthOK, d)
+}
+
+func (h *Health) schedule(state HealthState, d time.Duration) *Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := time.Now()
+	if n := len(h.phases); n > 0 && h.phases[n-1].end.After(start) {
+		start = h.phases[n-1].end
+	}
+	h.phases = append(h.phases, healthPhase{state: state, start: start, end: start.Add(d)})
+	return h
+}
+
+// State returns the state currently reported.
+func (h *Health) State() HealthState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for _, p := range h.phases {
+		if !now.Before(p.start) && now.Before(p.end) {
+			return p.state
+		}
+	}
+	return h.base
+}
+
+func (h *Health) serve(w http.ResponseWriter, r *http.Request) {
+	state := h.State()
+	status := http.StatusOK
+	if state == HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]HealthState{"status": state})
+}
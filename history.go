@@ -0,0 +1,176 @@
+package aduket
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// minCompressSize is the body size below which compression is not worth it.
+const minCompressSize = 512
+
+// CompressHistory enables or disables in-memory compression of the request
+// and response bodies of recorded requests. When enabled, BodyContent and
+// ResponseBody are cleared once a request is recorded and the bodies must be
+// read through RequestBodyBytes and ResponseBodyBytes, which decompress them
+// transparently. This keeps long capture sessions with large payloads from
+// exhausting memory.
+func (s *Server) CompressHistory(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compressHistory = enabled
+}
+
+// SetMaxCapturedRequests bounds the history to the n most recent requests,
+// evicting the oldest as new ones arrive, so long running sessions and high
+// volume tests do not grow memory without limit. Assertions and RequestCount
+// only see the requests kept; match counters and the totals of Report are
+// not affected. n <= 0, the default, keeps every request.
+func (s *Server) SetMaxCapturedRequests(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxRequests = n
+	if n > 0 && len(s.Requests) > n {
+		kept := make([]*CapturedRequest, n, 2*n)
+		copy(kept, s.Requests[len(s.Requests)-n:])
+		s.Requests = kept
+	}
+}
+
+// CaptureBodies enables or disables keeping request and response bodies in
+// the history, which is enabled by default. When disabled, bodies are still
+// used for matching and responding, but are dropped before OnRequest sees
+// the request and before it is recorded or stored.
+func (s *Server) CaptureBodies(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discardBodies = !enabled
+}
+
+// record appends a captured request to the history and the storage, if any,
+// and notifies OnRequest. Only the append holds s.mu, so slow callbacks,
+// compression and storage writes do not hold up other requests. The caller
+// must not hold s.mu.
+func (s *Server) record(c *CapturedRequest) {
+	s.mu.Lock()
+	compress := s.compressHistory
+	discardBodies := s.discardBodies
+	storage := s.storage
+	s.mu.Unlock()
+
+	if discardBodies {
+		c.discardBodies()
+	}
+	if s.OnRequest != nil {
+		s.OnRequest(c)
+	}
+	if compress {
+		c.compress()
+	}
+	s.mu.Lock()
+	s.appendRequest(c)
+	s.mu.Unlock()
+	if storage != nil {
+		// The response is already sent, so a storage failure can only be
+		// reported out of band.
+		if err := storage.Append(c.stored()); err != nil {
+			fmt.Fprintf(os.Stderr, "aduket: storing request: %v\n", err)
+		}
+	}
+}
+
+// appendRequest adds c to the history and counts it, evicting the oldest
+// request if the history is full. A bounded history lives in a buffer twice
+// its size: the history slides through it and is copied back to the start
+// when it reaches the end, so eviction is amortized O(1) and Requests stays
+// an ordered slice.
+// The caller must hold s.mu.
+func (s *Server) appendRequest(c *CapturedRequest) {
+	s.requestCount++
+	if c.Expectation == nil {
+		s.unmatchedCount++
+	}
+	if s.maxRequests <= 0 {
+		s.Requests = append(s.Requests, c)
+		return
+	}
+	for len(s.Requests) >= s.maxRequests {
+		// Clears the evicted slot so the request can be garbage collected.
+		s.Requests[0] = nil
+		s.Requests = s.Requests[1:]
+	}
+	if len(s.Requests) == cap(s.Requests) {
+		buf := make([]*CapturedRequest, len(s.Requests), 2*s.maxRequests)
+		copy(buf, s.Requests)
+		s.Requests = buf
+	}
+	s.Requests = append(s.Requests, c)
+}
+
+// discardBodies drops the bodies of the request and its response.
+func (c *CapturedRequest) discardBodies() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.BodyContent = nil
+	c.ResponseBody = nil
+	c.compressedBody = nil
+	c.compressedResponse = nil
+	if c.Request != nil {
+		c.Request.Body = http.NoBody
+	}
+}
+
+// RequestBodyBytes returns the request body, decompressing it if needed.
+func (c *CapturedRequest) RequestBodyBytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.compressedBody != nil {
+		return inflate(c.compressedBody)
+	}
+	return c.BodyContent
+}
+
+// ResponseBodyBytes returns the response body, decompressing it if needed.
+func (c *CapturedRequest) ResponseBodyBytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.compressedResponse != nil {
+		return inflate(c.compressedResponse)
+	}
+	return c.ResponseBody
+}
+
+// compress moves large bodies into their compressed form.
+func (c *CapturedRequest) compress() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.BodyContent) >= minCompressSize {
+		c.compressedBody = deflate(c.BodyContent)
+		c.BodyContent = nil
+		// Drop the replayable body buffer, it still references the raw bytes.
+		if c.Request != nil {
+			c.Request.Body = http.NoBody
+		}
+	}
+	if len(c.ResponseBody) >= minCompressSize {
+		c.compressedResponse = deflate(c.ResponseBody)
+		c.ResponseBody = nil
+	}
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func inflate(data []byte) []byte {
+	out, _ := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	return out
+}
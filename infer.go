@@ -0,0 +1,224 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// InferSchema returns a schema describing all of the given JSON documents.
+// Object properties present in every document are marked as required, and
+// string formats are detected when every sample has them.
+func InferSchema(docs ...[]byte) (*Schema, error) {
+	values := make([]interface{}, 0, len(docs))
+	for i, doc := range docs {
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(doc))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("aduket: document %d is not JSON: %v", i, err)
+		}
+		values = append(values, v)
+	}
+	return inferValues(values), nil
+}
+
+// InferRequestSchema infers the schema of the JSON bodies the client sent to
+// method and path, which may use {name} segments. Requests without a body are
+// skipped.
+func (s *Server) InferRequestSchema(method, path string) (*Schema, error) {
+	var docs [][]byte
+	for _, req := range s.requestsSnapshot() {
+		if body := req.RequestBodyBytes(); len(body) > 0 && req.matchesRoute(method, path) {
+			docs = append(docs, body)
+		}
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("aduket: no request bodies captured for %s %s", method, path)
+	}
+	return InferSchema(docs...)
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func inferValues(values []interface{}) *Schema {
+	types := make(map[string]bool)
+	var objects []map[string]interface{}
+	var items, strs []interface{}
+	for _, v := range values {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			types["object"] = true
+			objects = append(objects, v)
+		case []interface{}:
+			types["array"] = true
+			items = append(items, v...)
+		case string:
+			types["string"] = true
+			strs = append(strs, v)
+		case json.Number:
+			if _, err := v.Int64(); err == nil {
+				types["integer"] = true
+			} else {
+				types["number"] = true
+			}
+		case bool:
+			types["boolean"] = true
+		case nil:
+			types["null"] = true
+		}
+	}
+	if types["integer"] && types["number"] {
+		delete(types, "integer")
+	}
+	if len(types) > 1 {
+		delete(types, "null") // A nullable value is described by its other type.
+	}
+	if len(types) != 1 {
+		return &Schema{}
+	}
+
+	sc := &Schema{}
+	for t := range types {
+		sc.Type = t
+	}
+	switch sc.Type {
+	case "object":
+		sc.Properties = make(map[string]*Schema)
+		seen := make(map[string][]interface{})
+		for _, obj := range objects {
+			for k, v := range obj {
+				seen[k] = append(seen[k], v)
+			}
+		}
+		for k, vals := range seen {
+			sc.Properties[k] = inferValues(vals)
+			if len(vals) == len(objects) {
+				sc.Required = append(sc.Required, k)
+			}
+		}
+		sort.Strings(sc.Required)
+	case "array":
+		if len(items) > 0 {
+			sc.Items = inferValues(items)
+		}
+	case "string":
+		sc.Format = inferFormat(strs)
+	}
+	return sc
+}
+
+// inferFormat returns the format shared by all strings, if any.
+func inferFormat(strs []interface{}) string {
+	checks := []struct {
+		format string
+		ok     func(string) bool
+	}{
+		{"uuid", uuidRegexp.MatchString},
+		{"date-time", func(s string) bool { _, err := time.Parse(time.RFC3339, s); return err == nil }},
+		{"email", func(s string) bool { a, err := mail.ParseAddress(s); return err == nil && a.Address == s }},
+	}
+	for _, check := range checks {
+		all := true
+		for _, s := range strs {
+			if !check.ok(s.(string)) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return check.format
+		}
+	}
+	return ""
+}
+
+// GoStruct returns Go source declaring a type named name that the JSON
+// values described by the schema decode into.
+func (sc *Schema) GoStruct(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "type %s %s\n", name, sc.goType())
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return b.String()
+	}
+	return string(src)
+}
+
+func (sc *Schema) goType() string {
+	switch sc.Type {
+	case "object":
+		names := make([]string, 0, len(sc.Properties))
+		for k := range sc.Properties {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		required := make(map[string]bool, len(sc.Required))
+		for _, k := range sc.Required {
+			required[k] = true
+		}
+
+		var b strings.Builder
+		b.WriteString("struct {\n")
+		for _, k := range names {
+			tag := k
+			if !required[k] {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "%s %s `json:%q`\n", goFieldName(k), sc.Properties[k].goType(), tag)
+		}
+		b.WriteString("}")
+		return b.String()
+	case "array":
+		if sc.Items == nil {
+			return "[]interface{}"
+		}
+		return "[]" + sc.Items.goType()
+	case "string":
+		if sc.Format == "date-time" {
+			return "time.Time"
+		}
+		return "string"
+	case "integer":
+		return "int64"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	default:
+		return "interface{}"
+	}
+}
+
+// commonInitialisms are written in upper case in Go identifiers.
+var commonInitialisms = map[string]bool{"ID": true, "URL": true, "URI": true, "API": true, "HTTP": true, "UUID": true, "IP": true, "JSON": true}
+
+// goFieldName turns a JSON key such as "user_id" into a Go field name such
+// as "UserID".
+func goFieldName(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, w := range words {
+		if upper := strings.ToUpper(w); commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		runes := []rune(w)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	name := b.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "F" + name
+	}
+	return name
+}
@@ -0,0 +1,62 @@
+package aduket
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// inFlightGrace is how long AssertNoInFlight waits for handlers that have
+// sent their response but not yet returned.
+const inFlightGrace = 50 * time.Millisecond
+
+// InFlight returns the number of requests currently being handled.
+func (s *Server) InFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.inFlight)
+}
+
+// InFlightRequests returns the requests currently being handled, oldest
+// first. They are not yet part of Requests.
+func (s *Server) InFlightRequests() []*CapturedRequest {
+	s.mu.Lock()
+	reqs := make([]*CapturedRequest, 0, len(s.inFlight))
+	for req := range s.inFlight {
+		reqs = append(reqs, req)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].ReceivedAt.Before(reqs[j].ReceivedAt) })
+	return reqs
+}
+
+// AssertNoInFlight checks that no request is being handled, so tests can
+// verify that their client drained all requests before teardown. Handlers
+// get a short grace period to finish recording requests whose response the
+// client has already received.
+func (s *Server) AssertNoInFlight(t *testing.T) {
+	deadline := time.Now().Add(inFlightGrace)
+	for s.InFlight() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if reqs := s.InFlightRequests(); len(reqs) > 0 {
+		s.errorf(t, reqs, "expected no requests in flight, got %d (oldest %s %s)", len(reqs), reqs[0].Method, reqs[0].URL.Path)
+	}
+}
+
+// trackInFlight registers c as in flight and returns a function removing it.
+func (s *Server) trackInFlight(c *CapturedRequest) func() {
+	s.mu.Lock()
+	if s.inFlight == nil {
+		s.inFlight = make(map[*CapturedRequest]struct{})
+	}
+	s.inFlight[c] = struct{}{}
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		delete(s.inFlight, c)
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,257 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// Standard JSON-RPC 2.0 error codes.
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+)
+
+// JSONRPCError is a JSON-RPC 2.0 error object.
+type JSONRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// JSONRPCExpectation is a mocked JSON-RPC 2.0 method.
+type JSONRPCExpectation struct {
+	Method       string
+	Params       interface{} // Expected params, nil matches any
+	Result       interface{}
+	Error        *JSONRPCError
+	Times        int // Number of times this call can be matched, 0 means unlimited
+	MatchedTimes int
+	hasParams    bool
+	mu           sync.Mutex
+}
+
+// ExpectJSONRPC registers a JSON-RPC 2.0 method. JSON-RPC requests are
+// recognized by their body on any POST path, and batch requests are answered
+// call by call.
+func (s *Server) ExpectJSONRPC(method string) *JSONRPCExpectation {
+	call := &JSONRPCExpectation{Method: method}
+
+	s.mu.Lock()
+	first := len(s.jsonrpc) == 0
+	s.jsonrpc = append(s.jsonrpc, call)
+	s.mu.Unlock()
+
+	if first {
+		// The dispatcher answers from the registry of the server handling
+		// the request, so it keeps working on clones.
+		exp := s.Expect("POST", "").
+			MatchFunc(isJSONRPCBody).
+			RespondWithCtx(func(ctx Ctx, w http.ResponseWriter, r *http.Request) {
+				ctx.Server.serveJSONRPC(w, r)
+			})
+		exp.mu.Lock()
+		exp.builtin = true
+		exp.mu.Unlock()
+	}
+	return call
+}
+
+// WithParams requires the call params to equal v once both are encoded as
+// JSON.
+func (c *JSONRPCExpectation) WithParams(v interface{}) *JSONRPCExpectation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Params = v
+	c.hasParams = true
+	return c
+}
+
+// Respond sets the result returned for the call.
+func (c *JSONRPCExpectation) Respond(result interface{}) *JSONRPCExpectation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Result = result
+	c.Error = nil
+	return c
+}
+
+// RespondError makes the call fail with the given error.
+func (c *JSONRPCExpectation) RespondError(code int, message string, data interface{}) *JSONRPCExpectation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Error = &JSONRPCError{Code: code, Message: message, Data: data}
+	return c
+}
+
+// TimesSet sets how many times this call should match.
+func (c *JSONRPCExpectation) TimesSet(n int) *JSONRPCExpectation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Times = n
+	return c
+}
+
+// clone returns an unmatched copy of the call.
+func (c *JSONRPCExpectation) clone() *JSONRPCExpectation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &JSONRPCExpectation{
+		Method:    c.Method,
+		Params:    c.Params,
+		Result:    c.Result,
+		Error:     c.Error,
+		Times:     c.Times,
+		hasParams: c.hasParams,
+	}
+}
+
+func (c *JSONRPCExpectation) matchedTimes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.MatchedTimes
+}
+
+// jsonrpcRequest is a single JSON-RPC 2.0 call.
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// jsonrpcResponse is a single JSON-RPC 2.0 response.
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// isJSONRPCBody reports whether body holds a JSON-RPC 2.0 call or batch.
+func isJSONRPCBody(r *http.Request, body []byte) bool {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return false
+	}
+	var probe jsonrpcRequest
+	if body[0] == '[' {
+		var batch []jsonrpcRequest
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			return false
+		}
+		probe = batch[0]
+	} else if err := json.Unmarshal(body, &probe); err != nil {
+		return false
+	}
+	return probe.JSONRPC == "2.0"
+}
+
+func (s *Server) serveJSONRPC(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	body.ReadFrom(r.Body)
+	data := bytes.TrimSpace(body.Bytes())
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if len(data) > 0 && data[0] == '[' {
+		var batch []jsonrpcRequest
+		json.Unmarshal(data, &batch)
+		var responses []jsonrpcResponse
+		for _, req := range batch {
+			if resp, ok := s.callJSONRPC(req); ok {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+
+	var req jsonrpcRequest
+	json.Unmarshal(data, &req)
+	resp, ok := s.callJSONRPC(req)
+	if !ok {
+		// Notifications do not get a response.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// callJSONRPC answers a single call. It returns false for notifications.
+func (s *Server) callJSONRPC(req jsonrpcRequest) (jsonrpcResponse, bool) {
+	resp := jsonrpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if len(req.ID) == 0 {
+		resp.ID = json.RawMessage("null")
+	}
+
+	s.mu.Lock()
+	calls := append([]*JSONRPCExpectation(nil), s.jsonrpc...)
+	s.mu.Unlock()
+
+	var matched *JSONRPCExpectation
+	for _, call := range calls {
+		if call.matches(req) {
+			matched = call
+			break
+		}
+	}
+
+	switch {
+	case matched == nil:
+		resp.Error = &JSONRPCError{Code: JSONRPCMethodNotFound, Message: "Method not found: " + req.Method}
+	default:
+		matched.mu.Lock()
+		resp.Result = matched.Result
+		resp.Error = matched.Error
+		matched.mu.Unlock()
+		if resp.Error == nil && resp.Result == nil {
+			resp.Result = json.RawMessage("null")
+		}
+	}
+	return resp, len(req.ID) > 0
+}
+
+// matches checks a call against the expectation and counts the match.
+func (c *JSONRPCExpectation) matches(req jsonrpcRequest) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Method != req.Method {
+		return false
+	}
+	if c.Times > 0 && c.MatchedTimes >= c.Times {
+		return false
+	}
+	if c.hasParams && !jsonEqual(c.Params, req.Params) {
+		return false
+	}
+	c.MatchedTimes++
+	return true
+}
+
+// jsonEqual compares a Go value with raw JSON by decoding both into generic
+// JSON values.
+func jsonEqual(expected interface{}, actual json.RawMessage) bool {
+	encoded, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+	var want, got interface{}
+	json.Unmarshal(encoded, &want)
+	if len(actual) > 0 {
+		if err := json.Unmarshal(actual, &got); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(want, got)
+}
@@ -0,0 +1,103 @@
+package aduket
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit converts the report into JUnit XML so verification results show up
+// in CI test views. Every expectation becomes a test case, as do unmatched
+// traffic and each failed assertion.
+func (r Report) JUnit() ([]byte, error) {
+	suite := junitSuite{
+		Name:      "aduket",
+		Timestamp: r.GeneratedAt.Format("2006-01-02T15:04:05"),
+	}
+
+	for _, exp := range r.Expectations {
+		name := exp.Method + " " + exp.Path
+		if exp.Name != "" {
+			name = exp.Name + " (" + name + ")"
+		}
+		c := junitCase{Name: name, ClassName: "aduket.expectations"}
+		if !exp.Satisfied {
+			msg := fmt.Sprintf("expected %s %s to be called, but it was not", exp.Method, exp.Path)
+			if exp.MatchedTimes > 0 {
+				msg = fmt.Sprintf("expected %s %s to be called %d times, but it was called %d times", exp.Method, exp.Path, exp.Times, exp.MatchedTimes)
+			}
+			c.Failure = &junitFailure{Message: msg, Text: msg}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	unmatched := junitCase{Name: "no unmatched requests", ClassName: "aduket.traffic"}
+	if n := r.UnmatchedCount; n > 0 {
+		var lines []string
+		for _, req := range r.Unmatched {
+			lines = append(lines, fmt.Sprintf("%s %s -> %d", req.Method, req.URL, req.StatusCode))
+		}
+		if evicted := n - len(r.Unmatched); evicted > 0 {
+			lines = append(lines, fmt.Sprintf("and %d more evicted from the history", evicted))
+		}
+		unmatched.Failure = &junitFailure{
+			Message: fmt.Sprintf("%d requests matched no expectation", n),
+			Text:    strings.Join(lines, "\n"),
+		}
+	}
+	suite.Cases = append(suite.Cases, unmatched)
+
+	for i, failure := range r.Failures {
+		suite.Cases = append(suite.Cases, junitCase{
+			Name:      fmt.Sprintf("assertion %d", i+1),
+			ClassName: "aduket.assertions",
+			Failure:   &junitFailure{Message: strings.SplitN(failure, "\n", 2)[0], Text: failure},
+		})
+	}
+
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	data, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// WriteJUnit writes the report as JUnit XML to path, replacing it atomically.
+func (s *Server) WriteJUnit(path string) error {
+	data, err := s.Report().JUnit()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
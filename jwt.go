@@ -0,0 +1,85 @@
+package aduket
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ismailtsdln/aduket/auth"
+)
+
+// JWKSPath is where a server serves the public part of its JWT key, see
+// Server.JWTKey.
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWTKey returns the RS256 key the server signs tokens with, generated on
+// first use. From then on the server also serves its public part as a JWKS
+// at JWKSPath, so code fetching keys from the issuer can verify the tokens.
+func (s *Server) JWTKey() *auth.Key {
+	s.mu.Lock()
+	key := s.jwtKey
+	s.mu.Unlock()
+	if key != nil {
+		return key
+	}
+
+	key, err := auth.NewRSAKey("aduket")
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	if s.jwtKey != nil {
+		key = s.jwtKey
+		s.mu.Unlock()
+		return key
+	}
+	s.jwtKey = key
+	s.mu.Unlock()
+
+	s.handleInternal(JWKSPath, serveJWKS(key))
+	return key
+}
+
+// serveJWKS serves the public part of key as a JWKS.
+func serveJWKS(key *auth.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(auth.NewJWKS(key))
+	}
+}
+
+// IssueJWT returns a token carrying claims, signed with the server's key,
+// see JWTKey. The "iss" claim defaults to the server URL, and "iat" and
+// "exp" to now and an hour from now.
+func (s *Server) IssueJWT(claims auth.Claims) string {
+	key := s.JWTKey()
+	now := time.Now()
+	full := auth.Claims{
+		"iss": s.URL,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+	token, err := key.Sign(full)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// WithValidJWT makes the expectation match only requests with a bearer
+// token that v verifies, such as the server's own key, a JWKS parsed with
+// auth.ParseJWKS, or either wrapped with auth.RequireClaims to check claims
+// such as the audience.
+func (e *Expectation) WithValidJWT(v auth.Verifier) *Expectation {
+	return e.MatchFunc(func(r *http.Request, body []byte) bool {
+		token, ok := bearerToken(r)
+		if !ok {
+			return false
+		}
+		_, err := v.Verify(token)
+		return err == nil
+	})
+}
@@ -0,0 +1,419 @@
+package aduket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KubeResource is an in-memory collection of Kubernetes objects of one
+// resource type, served with the list, get and watch semantics of the API
+// server, see Server.KubernetesResource.
+type KubeResource struct {
+	APIVersion string // e.g. "v1" or "apps/v1"
+	Kind       string // e.g. "Pod"
+	Resource   string // Plural name used in paths, e.g. "pods"
+
+	mu        sync.Mutex
+	rv        int64
+	objects   map[string]map[string]interface{} // By "namespace/name"
+	events    []kubeEvent
+	compacted int64         // Events up to this version were dropped, see Compact
+	changed   chan struct{} // Closed and replaced on every change
+	stop      chan struct{} // Closed and replaced by StopWatches
+}
+
+// kubeEvent is a watch event.
+type kubeEvent struct {
+	Type   string                 `json:"type"`
+	Object map[string]interface{} `json:"object"`
+	rv     int64
+}
+
+// KubernetesResource serves a Kubernetes resource type, so controllers and
+// clients built on client-go's list and watch patterns can run against the
+// mock. The collection starts empty; change it with Add, Update and Delete.
+// Core resources (apiVersion "v1") are served under /api/v1, others under
+// /apis/GROUP/VERSION, at the usual paths:
+//
+//	GET .../RESOURCE                           list across namespaces
+//	GET .../namespaces/{namespace}/RESOURCE    list in a namespace
+//	GET .../namespaces/{namespace}/RESOURCE/{name}
+//	GET .../RESOURCE/{name}                    cluster-scoped objects
+//
+// Lists carry the current resourceVersion and honor equality-based
+// labelSelector and metadata.name and metadata.namespace fieldSelector
+// queries. With ?watch=true the response is a stream of JSON watch events
+// starting after the requested resourceVersion; versions dropped by Compact
+// get an ERROR event with a 410 Gone status, as from a real API server.
+// Watches end with timeoutSeconds, when the client goes away or on
+// StopWatches. Server.Close waits for open watches, so stop them or cancel
+// the client first. Like JSON-RPC methods, the endpoints are skipped by
+// Verify.
+func (s *Server) KubernetesResource(apiVersion, kind, resource string) *KubeResource {
+	r := &KubeResource{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Resource:   resource,
+		objects:    make(map[string]map[string]interface{}),
+		changed:    make(chan struct{}),
+		stop:       make(chan struct{}),
+	}
+
+	prefix := "/apis/" + apiVersion
+	if !strings.Contains(apiVersion, "/") {
+		prefix = "/api/" + apiVersion
+	}
+	for _, path := range []string{
+		prefix + "/" + resource,
+		prefix + "/" + resource + "/{name}",
+		prefix + "/namespaces/{namespace}/" + resource,
+		prefix + "/namespaces/{namespace}/" + resource + "/{name}",
+	} {
+		exp := s.Expect("GET", path).RespondWithCtx(r.serve)
+		exp.mu.Lock()
+		exp.builtin = true
+		exp.mu.Unlock()
+	}
+	return r
+}
+
+// Add adds an object, given as a map or any value encoding to a Kubernetes
+// JSON object, and sends an ADDED event. It returns the object's new
+// resourceVersion. The apiVersion and kind are filled in when missing. It
+// panics if the object has no metadata.name or already exists.
+func (r *KubeResource) Add(obj interface{}) string {
+	return r.put(obj, "ADDED")
+}
+
+// Update replaces an existing object and sends a MODIFIED event. It returns
+// the object's new resourceVersion and panics if the object does not exist.
+func (r *KubeResource) Update(obj interface{}) string {
+	return r.put(obj, "MODIFIED")
+}
+
+// Delete removes an object and sends a DELETED event. Cluster-scoped
+// objects have an empty namespace. It panics if the object does not exist.
+func (r *KubeResource) Delete(namespace, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := namespace + "/" + name
+	obj, ok := r.objects[key]
+	if !ok {
+		panic(fmt.Sprintf("aduket: %s %s not found", r.Kind, key))
+	}
+	delete(r.objects, key)
+	obj = copyKubeObject(obj)
+	r.emit("DELETED", obj)
+}
+
+// ResourceVersion returns the current resourceVersion of the collection.
+func (r *KubeResource) ResourceVersion() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strconv.FormatInt(r.rv, 10)
+}
+
+// Compact drops the event history, like etcd compaction: watches resuming
+// from an earlier resourceVersion get 410 Gone and must list again.
+func (r *KubeResource) Compact() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+	r.compacted = r.rv
+}
+
+// StopWatches ends every open watch, as the API server does when a watch
+// times out, so clients have to resume watching.
+func (r *KubeResource) StopWatches() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	close(r.stop)
+	r.stop = make(chan struct{})
+}
+
+func (r *KubeResource) put(obj interface{}, eventType string) string {
+	m := copyKubeObject(obj)
+	meta, _ := m["metadata"].(map[string]interface{})
+	name, _ := meta["name"].(string)
+	if name == "" {
+		panic(fmt.Sprintf("aduket: %s has no metadata.name", r.Kind))
+	}
+	namespace, _ := meta["namespace"].(string)
+	if _, ok := m["apiVersion"]; !ok {
+		m["apiVersion"] = r.APIVersion
+	}
+	if _, ok := m["kind"]; !ok {
+		m["kind"] = r.Kind
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := namespace + "/" + name
+	if _, exists := r.objects[key]; exists != (eventType == "MODIFIED") {
+		if exists {
+			panic(fmt.Sprintf("aduket: %s %s already exists", r.Kind, key))
+		}
+		panic(fmt.Sprintf("aduket: %s %s not found", r.Kind, key))
+	}
+	r.emit(eventType, m)
+	r.objects[key] = m
+	return strconv.FormatInt(r.rv, 10)
+}
+
+// emit bumps the resourceVersion, stamps it on obj and records the event.
+// It must be called with r.mu held.
+func (r *KubeResource) emit(eventType string, obj map[string]interface{}) {
+	r.rv++
+	obj["metadata"].(map[string]interface{})["resourceVersion"] = strconv.FormatInt(r.rv, 10)
+	r.events = append(r.events, kubeEvent{Type: eventType, Object: obj, rv: r.rv})
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// copyKubeObject returns a deep copy of obj as a JSON object with metadata.
+func copyKubeObject(obj interface{}) map[string]interface{} {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		panic(fmt.Sprintf("aduket: encoding Kubernetes object: %v", err))
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil || m == nil {
+		panic("aduket: Kubernetes objects must encode to JSON objects")
+	}
+	if _, ok := m["metadata"].(map[string]interface{}); !ok {
+		m["metadata"] = map[string]interface{}{}
+	}
+	return m
+}
+
+func (r *KubeResource) serve(ctx Ctx, w http.ResponseWriter, req *http.Request) {
+	namespace, name := ctx.Param("namespace"), ctx.Param("name")
+	if name != "" {
+		r.mu.Lock()
+		obj, ok := r.objects[namespace+"/"+name]
+		r.mu.Unlock()
+		if !ok {
+			writeKubeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("%s %q not found", r.Resource, name))
+			return
+		}
+		writeJSON(w, http.StatusOK, obj)
+		return
+	}
+
+	q := req.URL.Query()
+	match, err := kubeSelector(namespace, q.Get("labelSelector"), q.Get("fieldSelector"))
+	if err != nil {
+		writeKubeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	if watch := q.Get("watch"); watch == "true" || watch == "1" {
+		r.watch(w, req, match)
+		return
+	}
+
+	r.mu.Lock()
+	items := r.snapshot(match)
+	rv := strconv.FormatInt(r.rv, 10)
+	r.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"apiVersion": r.APIVersion,
+		"kind":       r.Kind + "List",
+		"metadata":   map[string]interface{}{"resourceVersion": rv},
+		"items":      items,
+	})
+}
+
+// snapshot returns the objects accepted by match, ordered by namespace and
+// name. It must be called with r.mu held.
+func (r *KubeResource) snapshot(match func(map[string]interface{}) bool) []map[string]interface{} {
+	keys := make([]string, 0, len(r.objects))
+	for k := range r.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := []map[string]interface{}{}
+	for _, k := range keys {
+		if obj := r.objects[k]; match(obj) {
+			items = append(items, obj)
+		}
+	}
+	return items
+}
+
+func (r *KubeResource) watch(w http.ResponseWriter, req *http.Request, match func(map[string]interface{}) bool) {
+	q := req.URL.Query()
+	var timeout <-chan time.Time
+	if secs, err := strconv.Atoi(q.Get("timeoutSeconds")); err == nil && secs > 0 {
+		timer := time.NewTimer(time.Duration(secs) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var pending []kubeEvent
+	var from int64
+	r.mu.Lock()
+	switch v := q.Get("resourceVersion"); v {
+	case "", "0":
+		// Start with the current state, like a list.
+		for _, obj := range r.snapshot(match) {
+			pending = append(pending, kubeEvent{Type: "ADDED", Object: obj})
+		}
+		from = r.rv
+	default:
+		var err error
+		if from, err = strconv.ParseInt(v, 10, 64); err != nil {
+			r.mu.Unlock()
+			writeKubeStatus(w, http.StatusBadRequest, "BadRequest", fmt.Sprintf("invalid resourceVersion %q", v))
+			return
+		}
+	}
+	compacted := r.compacted
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	if from < compacted {
+		enc.Encode(kubeEvent{Type: "ERROR", Object: kubeStatus(http.StatusGone, "Expired",
+			fmt.Sprintf("too old resource version: %d (%d)", from, compacted))})
+		return
+	}
+
+	for {
+		for _, ev := range pending {
+			if enc.Encode(ev) != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		r.mu.Lock()
+		pending = pending[:0]
+		for _, ev := range r.events {
+			if ev.rv > from && match(ev.Object) {
+				pending = append(pending, ev)
+			}
+		}
+		from = r.rv
+		changed, stop := r.changed, r.stop
+		r.mu.Unlock()
+		if len(pending) > 0 {
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-stop:
+			return
+		case <-timeout:
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// kubeSelector returns a filter for the namespace and the equality-based
+// label and field selectors of a list or watch request.
+func kubeSelector(namespace, labels, fields string) (func(map[string]interface{}) bool, error) {
+	type requirement struct {
+		key, value string
+		field      bool
+		negate     bool
+		exists     bool // Label presence only, "key" or "!key"
+	}
+	var reqs []requirement
+	parse := func(selector string, field bool) error {
+		for _, term := range strings.Split(selector, ",") {
+			term = strings.TrimSpace(term)
+			if term == "" {
+				continue
+			}
+			req := requirement{field: field}
+			switch {
+			case strings.Contains(term, "!="):
+				req.key, req.value, _ = strings.Cut(term, "!=")
+				req.negate = true
+			case strings.Contains(term, "=="):
+				req.key, req.value, _ = strings.Cut(term, "==")
+			case strings.Contains(term, "="):
+				req.key, req.value, _ = strings.Cut(term, "=")
+			case !field && strings.HasPrefix(term, "!"):
+				req.key, req.exists, req.negate = term[1:], true, true
+			case !field:
+				req.key, req.exists = term, true
+			default:
+				return fmt.Errorf("invalid field selector %q", term)
+			}
+			req.key, req.value = strings.TrimSpace(req.key), strings.TrimSpace(req.value)
+			if field && req.key != "metadata.name" && req.key != "metadata.namespace" {
+				return fmt.Errorf("unsupported field selector %q", req.key)
+			}
+			reqs = append(reqs, req)
+		}
+		return nil
+	}
+	if err := parse(labels, false); err != nil {
+		return nil, err
+	}
+	if err := parse(fields, true); err != nil {
+		return nil, err
+	}
+
+	return func(obj map[string]interface{}) bool {
+		meta, _ := obj["metadata"].(map[string]interface{})
+		if namespace != "" && meta["namespace"] != namespace {
+			return false
+		}
+		objLabels, _ := meta["labels"].(map[string]interface{})
+		for _, req := range reqs {
+			var value string
+			var ok bool
+			if req.field {
+				value, _ = meta[strings.TrimPrefix(req.key, "metadata.")].(string)
+				ok = true
+			} else {
+				value, ok = objLabels[req.key].(string)
+			}
+			if req.exists {
+				ok = ok != req.negate
+			} else {
+				ok = ok && value == req.value
+				if req.negate {
+					ok = !ok
+				}
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// kubeStatus returns a Kubernetes Status object for a failure.
+func kubeStatus(code int, reason, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Status",
+		"metadata":   map[string]interface{}{},
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       code,
+	}
+}
+
+func writeKubeStatus(w http.ResponseWriter, code int, reason, message string) {
+	writeJSON(w, code, kubeStatus(code, reason, message))
+}
@@ -0,0 +1,104 @@
+package aduket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxBodyChunks is the number of writes a body is split into by BodyDuration.
+const maxBodyChunks = 20
+
+// TTFB sets the time to first byte: how long the server waits before sending
+// the response headers. It is the same delay as set by Delay, named to pair
+// with BodyDuration.
+func (e *Expectation) TTFB(d time.Duration) *Expectation {
+	return e.Delay(d)
+}
+
+// DelayRange makes the time to first byte vary uniformly between min and
+// max for every request, so timeout and retry logic can be tested under
+// jitter. The delays are drawn from the server's random source, see
+// Server.SetRandSeed, or from the expectation's own, see Seed.
+func (e *Expectation) DelayRange(min, max time.Duration) *Expectation {
+	if min < 0 || max < min {
+		panic(fmt.Sprintf("aduket: invalid delay range [%v, %v]", min, max))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.DelayTime = min
+	e.DelayMax = max
+	return e
+}
+
+// randomDelay returns a delay drawn uniformly from [min, max], or min when
+// the range is empty.
+func randomDelay(rng *lockedRand, min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rng.Int63n(int64(max-min)+1))
+}
+
+// BodyDuration makes a static response body stream over d once the headers
+// are sent, so client timeouts on body completion can be tested separately
+// from those on header receipt.
+func (e *Expectation) BodyDuration(d time.Duration) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.BodyTime = d
+	return e
+}
+
+// writeSlowly writes the headers immediately and spreads body over d in
+// evenly sized, flushed chunks. It stops early when the client goes away.
+func writeSlowly(w http.ResponseWriter, r *http.Request, status int, body []byte, d time.Duration) {
+	if w.Header().Get("Content-Length") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	chunks := maxBodyChunks
+	if len(body) < chunks {
+		chunks = len(body)
+	}
+	if chunks == 0 {
+		return
+	}
+	interval := d / time.Duration(chunks)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for i := 0; i < chunks; i++ {
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+		start, end := len(body)*i/chunks, len(body)*(i+1)/chunks
+		w.Write(body[start:end])
+		if flusher != nil {
+			flusher.Flush()
+		}
+		timer.Reset(interval)
+	}
+}
+
+// sleepContext waits for d, or until ctx is done, and reports whether the
+// full d elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,92 @@
+package aduket
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// leakGrace is how long VerifyNoLeaks waits for the server to settle.
+const leakGrace = 200 * time.Millisecond
+
+// connState tracks the state of the server's connections.
+func (s *Server) connState(c net.Conn, state http.ConnState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch state {
+	case http.StateNew, http.StateActive, http.StateIdle:
+		if s.conns == nil {
+			s.conns = make(map[net.Conn]http.ConnState)
+		}
+		s.conns[c] = state
+	default:
+		// Closed and hijacked connections are no longer served by net/http.
+		delete(s.conns, c)
+	}
+}
+
+// activeConns returns the number of connections with a request or response
+// in progress.
+func (s *Server) activeConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, state := range s.conns {
+		if state == http.StateActive {
+			n++
+		}
+	}
+	return n
+}
+
+// handlerGoroutines returns the number of goroutines running a handler of
+// any Server, including scripted WebSocket connections.
+func handlerGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	count := 0
+	for _, g := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.Contains(g, []byte("aduket.(*Server).handler.")) {
+			count++
+		}
+	}
+	return count
+}
+
+// VerifyNoLeaks checks, at the end of a test and before closing s, that the
+// client under test left nothing behind: no requests still being handled,
+// including scripted WebSocket connections, no connections with a response
+// that was not fully read, typically a response body that was not closed,
+// and no handler goroutines still running, in the spirit of goleak. It
+// allows a short grace period for the server to settle. Handler goroutines
+// of other servers in the same process are counted too, so avoid running it
+// alongside parallel tests that use their own servers.
+func VerifyNoLeaks(t *testing.T, s *Server) {
+	deadline := time.Now().Add(leakGrace)
+	for time.Now().Before(deadline) {
+		if s.InFlight() == 0 && s.activeConns() == 0 && handlerGoroutines() == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if reqs := s.InFlightRequests(); len(reqs) > 0 {
+		s.errorf(t, reqs, "leak: %d requests still in flight (oldest %s %s)", len(reqs), reqs[0].Method, reqs[0].URL.Path)
+	}
+	if n := s.activeConns(); n > 0 {
+		s.errorf(t, nil, "leak: %d connections still active, a response body was probably not read and closed", n)
+	}
+	if n := handlerGoroutines(); n > 0 {
+		s.errorf(t, nil, "leak: %d handler goroutines still running", n)
+	}
+}
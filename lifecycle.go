@@ -0,0 +1,142 @@
+package aduket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	// ErrAlreadyStarted is returned when starting a server that is running.
+	ErrAlreadyStarted = errors.New("aduket: server already started")
+	// ErrNotStarted is returned when an operation needs a running server.
+	ErrNotStarted = errors.New("aduket: server not started")
+)
+
+// Start starts an unstarted server on a random local port.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrAlreadyStarted
+	}
+	s.Server.Start()
+	s.started = true
+	s.historyStart = time.Now()
+	return nil
+}
+
+// StartTLS starts an unstarted server with TLS on a random local port.
+func (s *Server) StartTLS() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrAlreadyStarted
+	}
+	s.Server.StartTLS()
+	s.started = true
+	s.historyStart = time.Now()
+	return nil
+}
+
+// Listen starts an unstarted server on a specific TCP address. The port may
+// be a range such as "localhost:8080-8090", see ListenOn. Expectations can be
+// registered before or after calling Listen.
+func (s *Server) Listen(addr string) error {
+	return s.listen(addr, false)
+}
+
+// ListenTLS starts an unstarted server with TLS on a specific TCP address.
+func (s *Server) ListenTLS(addr string) error {
+	return s.listen(addr, true)
+}
+
+// ListenOn starts an unstarted server on the first free port of portRange,
+// written as "8080" or "8080-8090". When no port is free, the error lists a
+// *PortConflictError for every port tried, naming the process holding it
+// where the platform allows.
+func (s *Server) ListenOn(host, portRange string) error {
+	return s.listen(net.JoinHostPort(host, portRange), false)
+}
+
+// ListenUnix starts an unstarted server on a unix domain socket at path, for
+// clients such as Docker tools that talk HTTP over a socket file. A stale
+// socket file left at path is replaced. The server's URL becomes
+// "http://localhost" and Client dials the socket for any address. The socket
+// file is removed by Close.
+func (s *Server) ListenUnix(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrAlreadyStarted
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	if s.Server.Listener != nil {
+		s.Server.Listener.Close()
+	}
+	s.Server.Listener = l
+	s.Server.Start()
+	s.URL = "http://localhost"
+	if t, ok := s.Server.Client().Transport.(*http.Transport); ok {
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+	}
+	s.started = true
+	s.historyStart = time.Now()
+	return nil
+}
+
+func (s *Server) listen(addr string, useTLS bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrAlreadyStarted
+	}
+
+	l, err := listenRange(addr)
+	if err != nil {
+		return err
+	}
+
+	// Swap the listener picked by httptest but keep the server itself so its
+	// configuration, including TLS settings, is preserved.
+	if s.Server.Listener != nil {
+		s.Server.Listener.Close()
+	}
+	s.Server.Listener = l
+	if useTLS {
+		s.Server.StartTLS()
+	} else {
+		s.Server.Start()
+	}
+	s.started = true
+	s.historyStart = time.Now()
+	return nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() (net.Addr, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return nil, ErrNotStarted
+	}
+	return s.Server.Listener.Addr(), nil
+}
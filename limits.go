@@ -0,0 +1,51 @@
+package aduket
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// serverLimits holds the strict server limits of a Server, see MaxHeaders,
+// MaxURLLength and AllowedMethods.
+type serverLimits struct {
+	maxHeaders   int
+	maxURLLength int
+	methods      []string
+}
+
+// check returns the status and reason to reject r with, or a zero status if
+// r is within the limits. For disallowed methods it sets the Allow header.
+func (l serverLimits) check(w http.ResponseWriter, r *http.Request) (int, string) {
+	if l.maxURLLength > 0 && len(r.RequestURI) > l.maxURLLength {
+		return http.StatusRequestURITooLong, fmt.Sprintf("request URI longer than %d bytes", l.maxURLLength)
+	}
+	if l.maxHeaders > 0 {
+		n := 0
+		for _, values := range r.Header {
+			n += len(values)
+		}
+		if n > l.maxHeaders {
+			return http.StatusRequestHeaderFieldsTooLarge, fmt.Sprintf("more than %d request headers", l.maxHeaders)
+		}
+	}
+	if len(l.methods) > 0 && !containsString(l.methods, r.Method) {
+		w.Header().Set("Allow", strings.Join(l.methods, ", "))
+		return http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method)
+	}
+	return 0, ""
+}
+
+// reject answers a request with status without reading its body or matching
+// it against expectations, and records it.
+func (s *Server) reject(w http.ResponseWriter, captured *CapturedRequest, status int, reason string) {
+	w.WriteHeader(status)
+	if reason != "" {
+		fmt.Fprintf(w, "aduket: %s", reason)
+		captured.ResponseBody = []byte("aduket: " + reason)
+	}
+	captured.StatusCode = status
+	captured.RespondedAt = time.Now()
+	s.record(captured)
+}
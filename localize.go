@@ -0,0 +1,106 @@
+package aduket
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocalizedResponse makes the expectation respond with the body of the
+// language preferred by the request's Accept-Language header, honoring
+// quality values, e.g.
+//
+//	e.LocalizedResponse(map[string]string{"en": "Hello", "tr": "Merhaba", "*": "Hello"})
+//
+// A language range such as "en-US" also matches the body for "en". Requests
+// accepting none of the languages get the body for "*" or, without one, the
+// body of the first language in alphabetical order. The chosen language is
+// sent in Content-Language. The status defaults to 200.
+func (e *Expectation) LocalizedResponse(bodies map[string]string) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Localized = make(map[string]string, len(bodies))
+	for lang, body := range bodies {
+		e.Localized[lang] = body
+	}
+	if e.StatusCode == 0 {
+		e.StatusCode = http.StatusOK
+	}
+	return e
+}
+
+// pickLanguage returns the language and body best matching acceptLanguage.
+// The language is empty for the "*" fallback.
+func pickLanguage(acceptLanguage string, bodies map[string]string) (string, string) {
+	langs := make([]string, 0, len(bodies))
+	for lang := range bodies {
+		if lang != "*" {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+
+	for _, want := range parseAcceptLanguage(acceptLanguage) {
+		if want == "*" {
+			break
+		}
+		for _, lang := range langs {
+			if strings.EqualFold(lang, want) {
+				return lang, bodies[lang]
+			}
+		}
+		// Fall back from "en-US" to "en".
+		for prefix := want; strings.Contains(prefix, "-"); {
+			prefix = prefix[:strings.LastIndex(prefix, "-")]
+			for _, lang := range langs {
+				if strings.EqualFold(lang, prefix) {
+					return lang, bodies[lang]
+				}
+			}
+		}
+	}
+
+	if body, ok := bodies["*"]; ok {
+		return "", body
+	}
+	if len(langs) == 0 {
+		return "", ""
+	}
+	return langs[0], bodies[langs[0]]
+}
+
+// parseAcceptLanguage returns the language ranges of an Accept-Language
+// header ordered by quality, dropping those with a quality of 0.
+func parseAcceptLanguage(header string) []string {
+	type ranged struct {
+		lang string
+		q    float64
+	}
+	var ranges []ranged
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, ranged{lang, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	langs := make([]string, len(ranges))
+	for i, r := range ranges {
+		langs[i] = r.lang
+	}
+	return langs
+}
@@ -0,0 +1,222 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+)
+
+// match returns the expectation matching r together with the path
+// parameters extracted from it, and counts the match. Matching runs without
+// s.mu held, so concurrent requests and slow custom matchers do not queue
+// behind each other. The match is then claimed under the expectation's own
+// lock, and matching starts over if a concurrent request used up its Times
+// or moved its scenario on first. The caller must not hold s.mu.
+func (s *Server) match(r *http.Request, body []byte) (*Expectation, map[string]string) {
+	for {
+		s.mu.Lock()
+		set := s.matchSet()
+		s.mu.Unlock()
+
+		exp, params := set.peek(r, body)
+		if exp == nil || exp.claim() {
+			return exp, params
+		}
+	}
+}
+
+// claim counts a match of the expectation and moves its scenario on, and
+// reports whether the expectation still matched when it was claimed.
+func (e *Expectation) claim() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Times > 0 && e.MatchedTimes >= e.Times {
+		return false
+	}
+	if e.scenario != nil {
+		if e.RequiredState != "" {
+			if !e.scenario.transition(e.RequiredState, e.NewState) {
+				return false
+			}
+		} else if e.NewState != "" {
+			e.scenario.SetState(e.NewState)
+		}
+	}
+	e.MatchedTimes++
+	return true
+}
+
+// matchSet is what requests are matched against: a snapshot of the
+// expectations and version fallbacks of a server.
+type matchSet struct {
+	// The expectations slice is only ever appended to or replaced, never
+	// modified in place, so sharing its backing array is safe.
+	expectations []*Expectation
+	fallbacks    []versionFallback
+}
+
+// matchSet returns a snapshot of what requests are matched against. The
+// caller must hold s.mu.
+func (s *Server) matchSet() matchSet {
+	set := matchSet{expectations: s.Expectations}
+	for _, v := range s.versions {
+		if v.fallback != "" {
+			set.fallbacks = append(set.fallbacks, versionFallback{prefix: v.prefix, fallback: v.fallback})
+		}
+	}
+	return set
+}
+
+// peek is like match but does not count the match. Among the matching
+// expectations, the one with the highest priority wins, then the most
+// specific, then the first registered, see Expectation.Priority. Requests
+// under a version prefix that match nothing are retried under its fallback,
+// see VersionGroup.FallbackTo.
+func (set matchSet) peek(r *http.Request, body []byte) (*Expectation, map[string]string) {
+	for i := 0; r != nil && i <= maxFallbacks; i++ {
+		var best *Expectation
+		var bestParams map[string]string
+		var bestRank matchRank
+		for _, exp := range set.expectations {
+			rank := exp.rank()
+			if best != nil && !rank.above(bestRank) {
+				// Skip custom matchers that could not win anyway.
+				continue
+			}
+			if params, ok := matchExpectation(exp, r, body); ok {
+				best, bestParams, bestRank = exp, params, rank
+			}
+		}
+		if best != nil {
+			return best, bestParams
+		}
+		r = set.fallbackRequest(r)
+	}
+	return nil, nil
+}
+
+// matchRank orders expectations matching the same request.
+type matchRank struct {
+	priority    int
+	specificity int // Number of method, query, header and custom matchers
+}
+
+func (a matchRank) above(b matchRank) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.specificity > b.specificity
+}
+
+func (e *Expectation) rank() matchRank {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rank := matchRank{
+		priority:    e.priority,
+		specificity: len(e.QueryParams) + len(e.RequestHeaders) + len(e.RequestHeaderPatterns) + len(e.Matchers),
+	}
+	if e.Method != "" && e.Method != MethodAny {
+		rank.specificity++
+	}
+	return rank
+}
+
+// matchExpectation internally checks if a request matches an expectation.
+func matchExpectation(exp *Expectation, r *http.Request, body []byte) (map[string]string, bool) {
+	params, matchers, ok := matchStatic(exp, r)
+	if !ok {
+		return nil, false
+	}
+	// Custom matchers run without the expectation lock held.
+	for _, m := range matchers {
+		if !m(r, body) {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// matchStatic checks the declarative requirements of an expectation and
+// returns its custom matchers.
+func matchStatic(exp *Expectation, r *http.Request) (map[string]string, []Matcher, bool) {
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if exp.Method != "" && exp.Method != MethodAny && exp.Method != r.Method {
+		return nil, nil, false
+	}
+	params, ok := matchPath(exp.Path, r.URL.Path)
+	if !ok {
+		return nil, nil, false
+	}
+	if exp.Times > 0 && exp.MatchedTimes >= exp.Times {
+		return nil, nil, false
+	}
+	if exp.scenario != nil && exp.RequiredState != "" && exp.scenario.State() != exp.RequiredState {
+		return nil, nil, false
+	}
+
+	// Match Query Params
+	if len(exp.QueryParams) > 0 {
+		query := r.URL.Query()
+		for k, v := range exp.QueryParams {
+			if query.Get(k) != v {
+				return nil, nil, false
+			}
+		}
+	}
+
+	for k, v := range exp.RequestHeaders {
+		if !anyHeaderValue(r.Header.Values(k), func(got string) bool { return got == v }) {
+			return nil, nil, false
+		}
+	}
+	for k, re := range exp.RequestHeaderPatterns {
+		if !anyHeaderValue(r.Header.Values(k), re.MatchString) {
+			return nil, nil, false
+		}
+	}
+
+	return params, exp.Matchers, true
+}
+
+// anyHeaderValue reports whether any of the header values satisfies ok.
+func anyHeaderValue(values []string, ok func(string) bool) bool {
+	for _, v := range values {
+		if ok(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches a request path against an expectation path. An empty
+// pattern matches every path. Segments written as {name} match any single
+// non-empty segment and are returned as path parameters.
+func matchPath(pattern, path string) (map[string]string, bool) {
+	if pattern == "" {
+		return nil, true
+	}
+	if !strings.Contains(pattern, "{") {
+		return nil, pattern == path
+	}
+
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if pathParts[i] == "" {
+				return nil, false
+			}
+			params[part[1:len(part)-1]] = pathParts[i]
+			continue
+		}
+		if part != pathParts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,145 @@
+package aduket
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// MergedRequest is a captured request labeled with the server that
+// received it, see MergeHistory.
+type MergedRequest struct {
+	*CapturedRequest
+	Server *Server
+	Label  string // Server.Name, or the server URL when it has no name
+}
+
+// MergedHistory is the requests of several servers in the order they were
+// received.
+type MergedHistory []MergedRequest
+
+// MergeHistory interleaves the requests recorded by servers in the order
+// they were received, labeling each with its server, so calls across
+// several mocked services can be inspected and asserted together. Requests
+// received at the same instant keep the order of servers.
+func MergeHistory(servers ...*Server) MergedHistory {
+	var h MergedHistory
+	for _, s := range servers {
+		s.mu.Lock()
+		label := s.Name
+		if label == "" {
+			label = s.URL
+		}
+		s.mu.Unlock()
+		for _, req := range s.requestsSnapshot() {
+			h = append(h, MergedRequest{CapturedRequest: req, Server: s, Label: label})
+		}
+	}
+	sort.SliceStable(h, func(i, j int) bool {
+		return h[i].ReceivedAt.Before(h[j].ReceivedAt)
+	})
+	return h
+}
+
+// String lists the requests one per line as "LABEL METHOD /path".
+func (h MergedHistory) String() string {
+	var b strings.Builder
+	for _, req := range h {
+		fmt.Fprintf(&b, "%s %s %s\n", req.Label, req.Method, req.URL.Path)
+	}
+	return b.String()
+}
+
+// AssertSequence checks that requests matching the steps were received in
+// the given order across servers. Steps are written as "LABEL METHOD /path",
+// e.g. "orders POST /orders", and paths may use {name} segments. Other
+// requests may be interleaved.
+func (h MergedHistory) AssertSequence(t *testing.T, steps []string) {
+	t.Helper()
+	next := 0
+	for i, step := range steps {
+		label, route, ok := strings.Cut(strings.TrimSpace(step), " ")
+		if !ok {
+			t.Fatalf("aduket: invalid step %q, expected \"LABEL METHOD /path\"", step)
+		}
+		method, path, err := parseRoute(route)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		found := -1
+		for j := next; j < len(h); j++ {
+			if h[j].Label == label && h[j].matchesRoute(method, path) {
+				found = j
+				break
+			}
+		}
+		if found < 0 {
+			t.Errorf("expected sequence %s, but %s (step %d) was not called in order; received:\n%s",
+				strings.Join(steps, " -> "), step, i+1, h)
+			return
+		}
+		next = found + 1
+	}
+}
+
+// Find returns the first recorded request matching route, written as
+// "METHOD /path" with optional {name} segments, or nil. It panics if the
+// route is invalid.
+func (s *Server) Find(route string) *CapturedRequest {
+	method, path, err := parseRoute(route)
+	if err != nil {
+		panic(err)
+	}
+	for _, req := range s.requestsSnapshot() {
+		if req.matchesRoute(method, path) {
+			return req
+		}
+	}
+	return nil
+}
+
+// AssertHappenedBefore checks that request a was received before the
+// response to request b was complete, e.g. that a saga sent a compensating
+// call to one service while another was still answering. The requests may
+// come from different servers, see Server.Find.
+func AssertHappenedBefore(t *testing.T, a, b *CapturedRequest) {
+	t.Helper()
+	if !checkPair(t, a, b) {
+		return
+	}
+	if !a.ReceivedAt.Before(b.RespondedAt) {
+		t.Errorf("expected %s %s to be called before %s %s responded, but it was called %v after",
+			a.Method, a.URL.Path, b.Method, b.URL.Path, a.ReceivedAt.Sub(b.RespondedAt))
+	}
+}
+
+// AssertCompletedBefore checks that the response to request a was complete
+// before request b was received, i.e. that b cannot have started before a
+// was done. The requests may come from different servers, see Server.Find.
+func AssertCompletedBefore(t *testing.T, a, b *CapturedRequest) {
+	t.Helper()
+	if !checkPair(t, a, b) {
+		return
+	}
+	if !a.RespondedAt.Before(b.ReceivedAt) {
+		t.Errorf("expected %s %s to complete before %s %s was called, but it completed %v after",
+			a.Method, a.URL.Path, b.Method, b.URL.Path, a.RespondedAt.Sub(b.ReceivedAt))
+	}
+}
+
+// checkPair reports an error for requests that were not found.
+func checkPair(t *testing.T, a, b *CapturedRequest) bool {
+	t.Helper()
+	switch {
+	case a == nil && b == nil:
+		t.Errorf("expected requests to compare, but neither was found")
+	case a == nil:
+		t.Errorf("expected a request before %s %s, but it was not found", b.Method, b.URL.Path)
+	case b == nil:
+		t.Errorf("expected a request after %s %s, but it was not found", a.Method, a.URL.Path)
+	default:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package aduket
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"testing"
+)
+
+// FormFile is a file uploaded in a multipart/form-data request.
+type FormFile struct {
+	Field       string // Name of the form field
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// FormValues returns the fields of a multipart/form-data or
+// application/x-www-form-urlencoded request body. Uploaded files are left
+// out, see FormFiles.
+func (c *CapturedRequest) FormValues() (url.Values, error) {
+	values, _, err := c.parseForm()
+	return values, err
+}
+
+// FormFiles returns the files uploaded in a multipart/form-data request
+// body, in order.
+func (c *CapturedRequest) FormFiles() ([]FormFile, error) {
+	_, files, err := c.parseForm()
+	return files, err
+}
+
+func (c *CapturedRequest) parseForm() (url.Values, []FormFile, error) {
+	body := c.RequestBodyBytes()
+	mediaType, params, err := mime.ParseMediaType(c.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		return values, nil, err
+	case "multipart/form-data":
+	default:
+		return nil, nil, errors.New("aduket: not a form body: " + mediaType)
+	}
+	if params["boundary"] == "" {
+		return nil, nil, errors.New("aduket: multipart body without boundary")
+	}
+
+	values := url.Values{}
+	var files []FormFile
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return values, files, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		if part.FileName() == "" {
+			values.Add(part.FormName(), string(content))
+			continue
+		}
+		files = append(files, FormFile{
+			Field:       part.FormName(),
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Content:     content,
+		})
+	}
+}
+
+// AssertFormField checks that the i-th request carried the form field name
+// with value, in a multipart or URL-encoded body.
+func (s *Server) AssertFormField(t *testing.T, i int, name, value string) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+
+	values, err := req.FormValues()
+	if err != nil {
+		s.errorf(t, []*CapturedRequest{req}, "failed to parse form: %v", err)
+		return
+	}
+	actual, ok := values[name]
+	if !ok {
+		s.errorf(t, []*CapturedRequest{req}, "expected form field %s: %s, got none", name, value)
+		return
+	}
+	for _, v := range actual {
+		if v == value {
+			return
+		}
+	}
+	s.errorf(t, []*CapturedRequest{req}, "expected form field %s: %s, got %q", name, value, actual)
+}
+
+// AssertUploadedFile checks that the i-th request uploaded a file named
+// filename with content in the multipart field fieldName.
+func (s *Server) AssertUploadedFile(t *testing.T, i int, fieldName, filename string, content []byte) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+
+	files, err := req.FormFiles()
+	if err != nil {
+		s.errorf(t, []*CapturedRequest{req}, "failed to parse multipart body: %v", err)
+		return
+	}
+	var found []string
+	for _, f := range files {
+		if f.Field != fieldName {
+			continue
+		}
+		if f.Filename == filename && bytes.Equal(f.Content, content) {
+			return
+		}
+		found = append(found, f.Filename)
+	}
+	if len(found) == 0 {
+		s.errorf(t, []*CapturedRequest{req}, "expected file %s in field %s, got no files", filename, fieldName)
+		return
+	}
+	s.errorf(t, []*CapturedRequest{req}, "expected file %s with %d bytes in field %s, got %q with different names or contents", filename, len(content), fieldName, found)
+}
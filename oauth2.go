@@ -0,0 +1,385 @@
+package aduket
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ismailtsdln/aduket/auth"
+)
+
+// Paths of the endpoints of an OAuth2Server.
+const (
+	OAuth2AuthorizePath = "/authorize"
+	OAuth2TokenPath     = "/token"
+	OAuth2UserInfoPath  = "/userinfo"
+	OIDCDiscoveryPath   = "/.well-known/openid-configuration"
+)
+
+// oauth2CodeLifetime is how long authorization codes can be exchanged.
+const oauth2CodeLifetime = time.Minute
+
+// OAuth2Server is a mock OAuth 2.0 and OpenID Connect provider, see
+// NewOAuth2Server.
+type OAuth2Server struct {
+	*Server
+
+	mu              sync.Mutex
+	clients         map[string]*oauth2Client
+	subject         string
+	userClaims      auth.Claims
+	accessLifetime  time.Duration
+	refreshLifetime time.Duration
+	codes           map[string]*oauth2Grant
+	refreshTokens   map[string]*oauth2Grant
+}
+
+type oauth2Client struct {
+	secret       string
+	redirectURIs []string
+}
+
+// oauth2Grant is what an authorization code or refresh token stands for.
+type oauth2Grant struct {
+	clientID      string
+	subject       string
+	scope         string
+	nonce         string
+	redirectURI   string
+	codeChallenge string
+	method        string
+	expires       time.Time
+}
+
+// NewOAuth2Server starts a mock identity provider serving the
+// authorization code (with optional PKCE), client credentials and refresh
+// token grants:
+//
+//	GET  /authorize                          approves at once and redirects with a code
+//	POST /token                              issues access, refresh and ID tokens
+//	GET  /userinfo                           claims of the user, for a bearer access token
+//	GET  /.well-known/openid-configuration   discovery document
+//	GET  /.well-known/jwks.json              signing keys
+//
+// Access and ID tokens are RS256 JWTs signed with the server's JWTKey, with
+// the server URL as issuer. Clients are registered with AddClient. Like
+// JSON-RPC methods, the endpoints are skipped by Verify, and further
+// expectations can be added to the embedded Server.
+func NewOAuth2Server() *OAuth2Server {
+	o := &OAuth2Server{
+		Server:          NewServer(),
+		clients:         make(map[string]*oauth2Client),
+		subject:         "user",
+		accessLifetime:  time.Hour,
+		refreshLifetime: 24 * time.Hour,
+		codes:           make(map[string]*oauth2Grant),
+		refreshTokens:   make(map[string]*oauth2Grant),
+	}
+	o.JWTKey()
+
+	routes := []struct {
+		method, path string
+		serve        Responder
+	}{
+		{"GET", OAuth2AuthorizePath, o.serveAuthorize},
+		{"POST", OAuth2TokenPath, o.serveToken},
+		{"GET", OAuth2UserInfoPath, o.serveUserInfo},
+		{"GET", OIDCDiscoveryPath, o.serveDiscovery},
+	}
+	for _, route := range routes {
+		exp := o.Expect(route.method, route.path).RespondWith(route.serve)
+		exp.mu.Lock()
+		exp.builtin = true
+		exp.mu.Unlock()
+	}
+	return o
+}
+
+// AddClient registers a client. Confidential clients authenticate to the
+// token endpoint with their secret, using HTTP Basic authentication or
+// client_id and client_secret form fields; public clients have an empty
+// secret and should use PKCE. Authorization requests must use one of the
+// redirect URIs, and may leave it out if there is only one.
+func (o *OAuth2Server) AddClient(id, secret string, redirectURIs ...string) *OAuth2Server {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.clients[id] = &oauth2Client{secret: secret, redirectURIs: append([]string(nil), redirectURIs...)}
+	return o
+}
+
+// TokenLifetime sets how long access and ID tokens, and refresh tokens, are
+// valid, an hour and a day by default.
+func (o *OAuth2Server) TokenLifetime(access, refresh time.Duration) *OAuth2Server {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.accessLifetime = access
+	o.refreshLifetime = refresh
+	return o
+}
+
+// User sets the subject that authorization requests log in as, "user" by
+// default, and claims such as "email" added to its ID tokens and user info.
+func (o *OAuth2Server) User(subject string, claims auth.Claims) *OAuth2Server {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.subject = subject
+	o.userClaims = claims
+	return o
+}
+
+func (o *OAuth2Server) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := o.URL
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + OAuth2AuthorizePath,
+		"token_endpoint":                        issuer + OAuth2TokenPath,
+		"userinfo_endpoint":                     issuer + OAuth2UserInfoPath,
+		"jwks_uri":                              issuer + JWKSPath,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{auth.RS256},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"scopes_supported":                      []string{"openid", "profile", "email", "offline_access"},
+	})
+}
+
+func (o *OAuth2Server) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	clientID := q.Get("client_id")
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Without a valid client and redirect URI, errors cannot be sent back
+	// to the client and are shown to the user instead.
+	client, ok := o.clients[clientID]
+	if !ok {
+		oauth2Error(w, http.StatusBadRequest, "invalid_client", "unknown client "+clientID)
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if redirectURI == "" && len(client.redirectURIs) == 1 {
+		redirectURI = client.redirectURIs[0]
+	}
+	if !containsString(client.redirectURIs, redirectURI) {
+		oauth2Error(w, http.StatusBadRequest, "invalid_request", "redirect_uri not registered for the client")
+		return
+	}
+
+	params := url.Values{}
+	if state := q.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	method := q.Get("code_challenge_method")
+	switch {
+	case q.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	case method != "" && method != "S256" && method != "plain":
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "unsupported code_challenge_method")
+	default:
+		if method == "" && q.Get("code_challenge") != "" {
+			method = "plain"
+		}
+		code := randomToken()
+		o.codes[code] = &oauth2Grant{
+			clientID:      clientID,
+			subject:       o.subject,
+			scope:         q.Get("scope"),
+			nonce:         q.Get("nonce"),
+			redirectURI:   q.Get("redirect_uri"),
+			codeChallenge: q.Get("code_challenge"),
+			method:        method,
+			expires:       time.Now().Add(oauth2CodeLifetime),
+		}
+		params.Set("code", code)
+	}
+
+	sep := "?"
+	if strings.Contains(redirectURI, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, redirectURI+sep+params.Encode(), http.StatusFound)
+}
+
+func (o *OAuth2Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauth2Error(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	client, ok := o.clients[clientID]
+	if !ok || subtle.ConstantTimeCompare([]byte(client.secret), []byte(secret)) != 1 {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+authRealm+`"`)
+		}
+		oauth2Error(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	var grant *oauth2Grant
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		grant = o.codes[code]
+		delete(o.codes, code) // Codes are single use.
+		switch {
+		case grant == nil || grant.clientID != clientID || time.Now().After(grant.expires):
+			oauth2Error(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+			return
+		case grant.redirectURI != r.PostForm.Get("redirect_uri"):
+			oauth2Error(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+			return
+		case !pkceVerifies(grant, r.PostForm.Get("code_verifier")):
+			oauth2Error(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+			return
+		}
+	case "refresh_token":
+		token := r.PostForm.Get("refresh_token")
+		grant = o.refreshTokens[token]
+		delete(o.refreshTokens, token) // Refresh tokens are rotated.
+		if grant == nil || grant.clientID != clientID || time.Now().After(grant.expires) {
+			oauth2Error(w, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+			return
+		}
+	case "client_credentials":
+		grant = &oauth2Grant{clientID: clientID, subject: clientID, scope: r.PostForm.Get("scope")}
+	default:
+		oauth2Error(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant_type "+r.PostForm.Get("grant_type"))
+		return
+	}
+
+	now := time.Now()
+	access, err := o.JWTKey().Sign(auth.Claims{
+		"iss":       o.URL,
+		"sub":       grant.subject,
+		"aud":       clientID,
+		"client_id": clientID,
+		"scope":     grant.scope,
+		"iat":       now.Unix(),
+		"exp":       now.Add(o.accessLifetime).Unix(),
+		"jti":       randomToken(),
+	})
+	if err != nil {
+		oauth2Error(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	resp := map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   int(o.accessLifetime / time.Second),
+	}
+	if grant.scope != "" {
+		resp["scope"] = grant.scope
+	}
+
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		refresh := randomToken()
+		renewed := *grant
+		renewed.expires = now.Add(o.refreshLifetime)
+		o.refreshTokens[refresh] = &renewed
+		resp["refresh_token"] = refresh
+
+		if hasScope(grant.scope, "openid") {
+			claims := auth.Claims{}
+			for k, v := range o.userClaims {
+				claims[k] = v
+			}
+			claims["iss"] = o.URL
+			claims["sub"] = grant.subject
+			claims["aud"] = clientID
+			claims["iat"] = now.Unix()
+			claims["exp"] = now.Add(o.accessLifetime).Unix()
+			if grant.nonce != "" {
+				claims["nonce"] = grant.nonce
+			}
+			idToken, err := o.JWTKey().Sign(claims)
+			if err != nil {
+				oauth2Error(w, http.StatusInternalServerError, "server_error", err.Error())
+				return
+			}
+			resp["id_token"] = idToken
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (o *OAuth2Server) serveUserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	claims, err := o.JWTKey().Verify(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+authRealm+`", error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	o.mu.Lock()
+	info := map[string]interface{}{}
+	if claims["sub"] == o.subject {
+		for k, v := range o.userClaims {
+			info[k] = v
+		}
+	}
+	o.mu.Unlock()
+	info["sub"] = claims["sub"]
+	writeJSON(w, http.StatusOK, info)
+}
+
+// pkceVerifies checks the code_verifier of a token request against the
+// code_challenge of the authorization request, as in RFC 7636.
+func pkceVerifies(grant *oauth2Grant, verifier string) bool {
+	switch grant.method {
+	case "":
+		return true
+	case "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:]) == grant.codeChallenge
+	default:
+		return verifier == grant.codeChallenge
+	}
+}
+
+// oauth2Error writes an error response as in RFC 6749 section 5.2.
+func oauth2Error(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// randomToken returns an unguessable token for codes and refresh tokens.
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,30 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MethodOverrideHeader is the header honored by MethodOverride.
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+// MethodOverride makes the server treat POST requests carrying
+// MethodOverrideHeader as requests with the method named in the header, the
+// way common web frameworks do for clients restricted to GET and POST. The
+// captured request reports the overriding method, with the method actually
+// sent in OriginalMethod.
+func (s *Server) MethodOverride(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methodOverride = enabled
+}
+
+// overrideMethod applies MethodOverrideHeader to the captured request.
+func overrideMethod(c *CapturedRequest) {
+	method := strings.ToUpper(strings.TrimSpace(c.Header.Get(MethodOverrideHeader)))
+	if c.Method != http.MethodPost || method == "" || method == c.Method {
+		return
+	}
+	c.OriginalMethod = c.Method
+	c.Method = method
+}
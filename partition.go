@@ -0,0 +1,93 @@
+package aduket
+
+import (
+	"sort"
+	"testing"
+)
+
+// PartitionBy makes the server tag every captured request with the value of
+// the given header, e.g. a tenant ID, so traffic and assertions can be scoped
+// per client with Partition.
+func (s *Server) PartitionBy(header string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partitionHeader = header
+}
+
+// Partition returns a view of the traffic captured for one client identity.
+func (s *Server) Partition(id string) *Partition {
+	return &Partition{server: s, id: id}
+}
+
+// Partitions returns the identities seen so far, sorted.
+func (s *Server) Partitions() []string {
+	seen := make(map[string]bool)
+	for _, req := range s.requestsSnapshot() {
+		seen[req.Partition] = true
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Partition is the traffic captured for a single client identity.
+type Partition struct {
+	server *Server
+	id     string
+}
+
+// Requests returns the requests captured for this partition.
+func (p *Partition) Requests() []*CapturedRequest {
+	var reqs []*CapturedRequest
+	for _, req := range p.server.requestsSnapshot() {
+		if req.Partition == p.id {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// RequestCount returns the number of requests captured for this partition.
+func (p *Partition) RequestCount() int {
+	return len(p.Requests())
+}
+
+// GetRequest returns the i-th request of this partition.
+func (p *Partition) GetRequest(i int) *CapturedRequest {
+	reqs := p.Requests()
+	if i < 0 || i >= len(reqs) {
+		return nil
+	}
+	return reqs[i]
+}
+
+// AssertRequestCount checks the number of requests made by this partition.
+func (p *Partition) AssertRequestCount(t *testing.T, count int) {
+	if reqs := p.Requests(); len(reqs) != count {
+		p.server.errorf(t, reqs, "expected %d requests from %q, got %d", count, p.id, len(reqs))
+	}
+}
+
+// AssertCalled checks that this partition called method and path.
+func (p *Partition) AssertCalled(t *testing.T, method, path string) {
+	reqs := p.Requests()
+	for _, req := range reqs {
+		if req.matchesRoute(method, path) {
+			return
+		}
+	}
+	p.server.errorf(t, reqs, "expected %s %s to be called by %q, but it was not", method, path, p.id)
+}
+
+// AssertNotCalled checks that this partition never called method and path.
+func (p *Partition) AssertNotCalled(t *testing.T, method, path string) {
+	for _, req := range p.Requests() {
+		if req.matchesRoute(method, path) {
+			p.server.errorf(t, []*CapturedRequest{req}, "expected %s %s NOT to be called by %q, but it was", method, path, p.id)
+			return
+		}
+	}
+}
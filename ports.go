@@ -0,0 +1,82 @@
+package aduket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// PortConflictError reports a port that could not be bound, together with
+// the process holding it when it can be determined.
+type PortConflictError struct {
+	Addr    string
+	PID     int    // Process listening on the port, 0 if unknown
+	Process string // Name of that process, if known
+	Err     error
+}
+
+func (e *PortConflictError) Error() string {
+	msg := fmt.Sprintf("aduket: cannot listen on %s: %v", e.Addr, e.Err)
+	if e.PID > 0 {
+		msg += fmt.Sprintf(" (held by pid %d", e.PID)
+		if e.Process != "" {
+			msg += " " + e.Process
+		}
+		msg += ")"
+	}
+	return msg
+}
+
+func (e *PortConflictError) Unwrap() error {
+	return e.Err
+}
+
+// listenRange listens on addr, whose port may be a range such as
+// "8080-8090". Ports are tried in order.
+func listenRange(addr string) (net.Listener, error) {
+	host, ports, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := parsePortRange(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for port := from; port <= to; port++ {
+		portAddr := net.JoinHostPort(host, strconv.Itoa(port))
+		l, err := net.Listen("tcp", portAddr)
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+		conflict := &PortConflictError{Addr: portAddr, Err: err}
+		conflict.PID, conflict.Process = portOwner(port)
+		errs = append(errs, conflict)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// parsePortRange parses "8080" or "8080-8090".
+func parsePortRange(ports string) (from, to int, err error) {
+	lo, hi, isRange := strings.Cut(ports, "-")
+	if from, err = strconv.Atoi(lo); err != nil {
+		return 0, 0, fmt.Errorf("aduket: invalid port %q", ports)
+	}
+	to = from
+	if isRange {
+		if to, err = strconv.Atoi(hi); err != nil || to < from {
+			return 0, 0, fmt.Errorf("aduket: invalid port range %q", ports)
+		}
+	}
+	if from < 0 || to > 65535 {
+		return 0, 0, fmt.Errorf("aduket: invalid port range %q", ports)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,63 @@
+package aduket
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// portOwner returns the process listening on a TCP port, found through
+// /proc. Processes of other users are usually not visible.
+func portOwner(port int) (pid int, name string) {
+	inodes := make(map[string]bool)
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		listeningInodes(table, port, inodes)
+	}
+	if len(inodes) == 0 {
+		return 0, ""
+	}
+
+	procs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, proc := range procs {
+		fds, _ := filepath.Glob(filepath.Join(proc, "fd", "*"))
+		for _, fd := range fds {
+			link, err := os.Readlink(fd)
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			if inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] {
+				pid, _ = strconv.Atoi(filepath.Base(proc))
+				comm, _ := os.ReadFile(filepath.Join(proc, "comm"))
+				return pid, strings.TrimSpace(string(comm))
+			}
+		}
+	}
+	return 0, ""
+}
+
+// listeningInodes adds the socket inodes listening on port in a
+// /proc/net/tcp table to inodes.
+func listeningInodes(table string, port int, inodes map[string]bool) {
+	f, err := os.Open(table)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	const listen = "0A"
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != listen {
+			continue
+		}
+		i := strings.LastIndexByte(fields[1], ':')
+		p, err := strconv.ParseInt(fields[1][i+1:], 16, 32)
+		if err == nil && int(p) == port {
+			inodes[fields[9]] = true
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package aduket
+
+// portOwner returns the process listening on a TCP port. It is only
+// implemented on Linux.
+func portOwner(port int) (pid int, name string) {
+	return 0, ""
+}
@@ -0,0 +1,97 @@
+package aduket
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"unicode/utf8"
+)
+
+var errInvalidProtobuf = errors.New("aduket: invalid protobuf wire data")
+
+// decodeProtobufWire decodes a protobuf message without its schema, like
+// protoc --decode_raw: fields are keyed by number, repeated fields become
+// arrays, and length-delimited fields are decoded as nested messages when
+// possible, else as strings or bytes.
+func decodeProtobufWire(data []byte) (interface{}, error) {
+	return decodeProtobufMessage(data, 0)
+}
+
+// maxProtobufDepth bounds the nested message guesses.
+const maxProtobufDepth = 64
+
+func decodeProtobufMessage(data []byte, depth int) (map[string]interface{}, error) {
+	msg := make(map[string]interface{})
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 {
+			return nil, errInvalidProtobuf
+		}
+		data = data[n:]
+
+		var v interface{}
+		switch key & 7 {
+		case 0: // Varint
+			x, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errInvalidProtobuf
+			}
+			v, data = x, data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return nil, errInvalidProtobuf
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2: // Length-delimited
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, errInvalidProtobuf
+			}
+			raw := data[n : n+int(size)]
+			data = data[n+int(size):]
+			v = guessLengthDelimited(raw, depth)
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return nil, errInvalidProtobuf
+			}
+			v, data = binary.LittleEndian.Uint32(data), data[4:]
+		default:
+			return nil, errInvalidProtobuf
+		}
+
+		field := strconv.FormatUint(key>>3, 10)
+		switch prev := msg[field].(type) {
+		case nil:
+			msg[field] = v
+		case []interface{}:
+			msg[field] = append(prev, v)
+		default:
+			msg[field] = []interface{}{prev, v}
+		}
+	}
+	return msg, nil
+}
+
+// guessLengthDelimited interprets a length-delimited field as a nested
+// message, a string or raw bytes, in that order of preference. Printable
+// text is preferred over a message when both decode.
+func guessLengthDelimited(raw []byte, depth int) interface{} {
+	if utf8.Valid(raw) && printable(raw) {
+		return string(raw)
+	}
+	if depth < maxProtobufDepth && len(raw) > 0 {
+		if nested, err := decodeProtobufMessage(raw, depth+1); err == nil {
+			return nested
+		}
+	}
+	return append([]byte(nil), raw...)
+}
+
+func printable(b []byte) bool {
+	for _, r := range string(b) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
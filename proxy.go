@@ -0,0 +1,176 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// hopHeaders are not forwarded by the proxy, nor recorded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// proxy forwards unmatched requests to an upstream and optionally records
+// the exchanges, see ProxyTo and RecordTo.
+type proxy struct {
+	upstream  *url.URL
+	client    *http.Client
+	transform jqFilter // See TransformProxied
+
+	mu         sync.Mutex // Serializes writes of the recording file
+	recordPath string
+	recorded   []*Expectation
+}
+
+// ProxyTo forwards requests that match no expectation to upstream and relays
+// its responses. Proxied requests are captured with the "proxied" tag.
+func (s *Server) ProxyTo(upstream string) error {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("aduket: upstream %q must be an absolute URL", upstream)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxy == nil {
+		s.proxy = &proxy{}
+	}
+	s.proxy.upstream = u
+	s.proxy.client = &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return nil
+}
+
+// RecordTo turns the server into a fixture recorder. Expectations previously
+// recorded to path are loaded and replayed. Every new exchange forwarded by
+// ProxyTo is registered as an expectation, so it is replayed from then on,
+// and saved to path in the Expectation JSON format. Without an upstream, the
+// recordings are only replayed.
+func (s *Server) RecordTo(path string) error {
+	recorded, err := loadRecordings(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxy == nil {
+		s.proxy = &proxy{}
+	}
+	s.proxy.recordPath = path
+	s.proxy.recorded = recorded
+	s.bindScenarios(recorded)
+	s.Expectations = append(s.Expectations, recorded...)
+	return nil
+}
+
+// ReplayFrom registers the expectations recorded to path by RecordTo.
+func (s *Server) ReplayFrom(path string) error {
+	recorded, err := loadRecordings(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bindScenarios(recorded)
+	s.Expectations = append(s.Expectations, recorded...)
+	return nil
+}
+
+func loadRecordings(path string) ([]*Expectation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var recorded []*Expectation
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return nil, fmt.Errorf("aduket: invalid recording %s: %v", path, err)
+	}
+	return recorded, nil
+}
+
+// serve forwards r to the upstream and writes its response to w, after
+// applying transform if it is not nil. It returns the exchange as an
+// expectation when recording.
+func (p *proxy) serve(w http.ResponseWriter, r *http.Request, body []byte, transform jqFilter) (*Expectation, error) {
+	target := *p.upstream
+	target.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+
+	out, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	out.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	resp, err := p.client.Do(out)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if transform != nil {
+		if respBody, err = applyTransform(transform, respBody); err != nil {
+			return nil, err
+		}
+	}
+
+	header := resp.Header.Clone()
+	for _, h := range append(hopHeaders, "Content-Length", "Date") {
+		header.Del(h)
+	}
+	addHeaders(w.Header(), header)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+
+	if p.recordPath == "" {
+		return nil, nil
+	}
+	exp := newExpectation(r.Method, r.URL.Path)
+	exp.StatusCode = resp.StatusCode
+	exp.Body = respBody
+	exp.Header = header
+	for k, v := range r.URL.Query() {
+		exp.WithQuery(k, v[0])
+	}
+	return exp, nil
+}
+
+// recordExchange registers a recorded exchange and saves all recordings.
+func (s *Server) recordExchange(exp *Expectation) error {
+	s.mu.Lock()
+	p := s.proxy
+	s.Expectations = append(s.Expectations, exp)
+	p.recorded = append(p.recorded, exp)
+	recorded := append([]*Expectation(nil), p.recorded...)
+	path := p.recordPath
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return writeFileAtomic(path, data)
+}
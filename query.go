@@ -0,0 +1,490 @@
+package aduket
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// QueryResult is the result of Server.Query.
+type QueryResult struct {
+	Count    int                // Number of matching requests
+	Requests []*CapturedRequest // Matching requests, nil for SELECT count(*)
+}
+
+// RequestQuery is a parsed query over captured requests, see ParseQuery.
+type RequestQuery struct {
+	count bool
+	where queryExpr
+	order string
+	desc  bool
+	limit int
+}
+
+// Query runs a SQL-like query over the captured requests, e.g.
+//
+//	SELECT count(*) WHERE method = 'POST' AND status >= 500
+//	SELECT * WHERE path LIKE '/users/%' AND tag = 'retry' ORDER BY status DESC LIMIT 10
+//
+// See ParseQuery for the supported syntax.
+func (s *Server) Query(q string) (QueryResult, error) {
+	query, err := ParseQuery(q)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	return query.Run(s.requestsSnapshot()), nil
+}
+
+// ParseQuery parses a query of the form
+//
+//	SELECT count(*) | * [FROM requests] [WHERE cond] [ORDER BY field [ASC|DESC]] [LIMIT n]
+//
+// A bare condition is accepted as well. Conditions compare a field with a
+// string or number using =, !=, <>, <, <=, >, >= or LIKE (with % and _
+// wildcards), and are combined with AND, OR, NOT and parentheses. The fields
+// are method, path, url, query, status, body, response, partition, tag (true
+// if the request carries the tag), expectation (the matched expectation's
+// name or "METHOD path") and header.<Name>. Keywords are case insensitive.
+func ParseQuery(q string) (*RequestQuery, error) {
+	tokens, err := tokenizeQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	query := &RequestQuery{}
+
+	if p.keyword("SELECT") {
+		switch {
+		case p.keyword("COUNT"):
+			if !p.symbol("(") || !p.symbol("*") || !p.symbol(")") {
+				return nil, p.errorf("expected count(*)")
+			}
+			query.count = true
+		case p.symbol("*"):
+		default:
+			return nil, p.errorf("expected * or count(*)")
+		}
+		if p.keyword("FROM") && !p.keyword("REQUESTS") {
+			return nil, p.errorf("only FROM requests is supported")
+		}
+		if p.keyword("WHERE") {
+			if query.where, err = p.parseOr(); err != nil {
+				return nil, err
+			}
+		}
+	} else if !p.done() && !p.peekKeyword("ORDER") && !p.peekKeyword("LIMIT") {
+		p.keyword("WHERE")
+		if query.where, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.keyword("ORDER") {
+		if !p.keyword("BY") {
+			return nil, p.errorf("expected BY")
+		}
+		field, ok := p.ident()
+		if !ok {
+			return nil, p.errorf("expected field to order by")
+		}
+		query.order = strings.ToLower(field)
+		if p.keyword("DESC") {
+			query.desc = true
+		} else {
+			p.keyword("ASC")
+		}
+	}
+	if p.keyword("LIMIT") {
+		n, ok := p.number()
+		if !ok || n < 0 {
+			return nil, p.errorf("expected limit")
+		}
+		query.limit = int(n)
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return query, nil
+}
+
+// Match reports whether the captured request satisfies the query's
+// condition.
+func (q *RequestQuery) Match(c *CapturedRequest) bool {
+	return q.where == nil || q.where(c)
+}
+
+// Run applies the query to reqs.
+func (q *RequestQuery) Run(reqs []*CapturedRequest) QueryResult {
+	var matched []*CapturedRequest
+	for _, req := range reqs {
+		if q.Match(req) {
+			matched = append(matched, req)
+		}
+	}
+	if q.order != "" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := queryField(matched[i], q.order), queryField(matched[j], q.order)
+			if q.desc {
+				return compareValues(a, b) > 0
+			}
+			return compareValues(a, b) < 0
+		})
+	}
+	if q.limit > 0 && len(matched) > q.limit {
+		matched = matched[:q.limit]
+	}
+	if q.count {
+		return QueryResult{Count: len(matched)}
+	}
+	return QueryResult{Count: len(matched), Requests: matched}
+}
+
+// queryExpr evaluates a condition on a captured request.
+type queryExpr func(*CapturedRequest) bool
+
+type queryToken struct {
+	kind byte // 'i' identifier, 's' string, 'n' number, 'o' operator or symbol
+	text string
+}
+
+func tokenizeQuery(q string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(q); j++ {
+				if q[j] == c {
+					if j+1 < len(q) && q[j+1] == c {
+						b.WriteByte(c) // Doubled quotes escape themselves.
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(q[j])
+			}
+			if j >= len(q) {
+				return nil, fmt.Errorf("aduket: unterminated string in query")
+			}
+			tokens = append(tokens, queryToken{'s', b.String()})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(q) && (q[j] >= '0' && q[j] <= '9' || q[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, queryToken{'n', q[i:j]})
+			i = j
+		case unicode.IsLetter(rune(c)) || c == '_':
+			j := i
+			for j < len(q) && (unicode.IsLetter(rune(q[j])) || unicode.IsDigit(rune(q[j])) || strings.IndexByte("_.-", q[j]) >= 0) {
+				j++
+			}
+			tokens = append(tokens, queryToken{'i', q[i:j]})
+			i = j
+		default:
+			op := string(c)
+			if i+1 < len(q) {
+				switch two := q[i : i+2]; two {
+				case "!=", "<>", "<=", ">=":
+					op = two
+				}
+			}
+			if !strings.Contains("=!<>()*,", op[:1]) || op == "!" {
+				return nil, fmt.Errorf("aduket: unexpected %q in query", op)
+			}
+			tokens = append(tokens, queryToken{'o', op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("aduket: invalid query: "+format, args...)
+}
+
+func (p *queryParser) peekKeyword(kw string) bool {
+	return !p.done() && p.tokens[p.pos].kind == 'i' && strings.EqualFold(p.tokens[p.pos].text, kw)
+}
+
+func (p *queryParser) keyword(kw string) bool {
+	if p.peekKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) symbol(sym string) bool {
+	if !p.done() && p.tokens[p.pos].kind == 'o' && p.tokens[p.pos].text == sym {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) ident() (string, bool) {
+	if !p.done() && p.tokens[p.pos].kind == 'i' {
+		p.pos++
+		return p.tokens[p.pos-1].text, true
+	}
+	return "", false
+}
+
+func (p *queryParser) number() (float64, bool) {
+	if !p.done() && p.tokens[p.pos].kind == 'n' {
+		n, err := strconv.ParseFloat(p.tokens[p.pos].text, 64)
+		p.pos++
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		a, b := left, right
+		left = func(c *CapturedRequest) bool { return a(c) || b(c) }
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		a, b := left, right
+		left = func(c *CapturedRequest) bool { return a(c) && b(c) }
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryExpr, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(c *CapturedRequest) bool { return !inner(c) }, nil
+	}
+	if p.symbol("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, p.errorf("missing )")
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryExpr, error) {
+	field, ok := p.ident()
+	if !ok {
+		return nil, p.errorf("expected field")
+	}
+	field = strings.ToLower(field)
+	if !isQueryField(field) {
+		return nil, p.errorf("unknown field %q", field)
+	}
+
+	var op string
+	switch {
+	case p.keyword("LIKE"):
+		op = "like"
+	case p.done() || p.tokens[p.pos].kind != 'o':
+		return nil, p.errorf("expected operator after %s", field)
+	default:
+		op = p.tokens[p.pos].text
+		p.pos++
+		if op == "<>" {
+			op = "!="
+		}
+		switch op {
+		case "=", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, p.errorf("unexpected %q", op)
+		}
+	}
+
+	if p.done() || (p.tokens[p.pos].kind != 's' && p.tokens[p.pos].kind != 'n') {
+		return nil, p.errorf("expected value after %s %s", field, op)
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	var value interface{} = tok.text
+	if tok.kind == 'n' {
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		value = n
+	}
+
+	if field == "tag" {
+		tag := tok.text
+		switch op {
+		case "=":
+			return func(c *CapturedRequest) bool { return c.HasTag(tag) }, nil
+		case "!=":
+			return func(c *CapturedRequest) bool { return !c.HasTag(tag) }, nil
+		default:
+			return nil, p.errorf("tag only supports = and !=")
+		}
+	}
+
+	// Methods compare case insensitively.
+	pattern := tok.text
+	fold := field == "method"
+	if fold {
+		pattern = strings.ToUpper(pattern)
+		value = pattern
+	}
+	return func(c *CapturedRequest) bool {
+		actual := queryField(c, field)
+		if fold {
+			actual = strings.ToUpper(fmt.Sprint(actual))
+		}
+		if op == "like" {
+			return likeMatch(fmt.Sprint(actual), pattern)
+		}
+		cmp := compareValues(actual, value)
+		switch op {
+		case "=":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+	}, nil
+}
+
+func isQueryField(field string) bool {
+	switch field {
+	case "method", "path", "url", "query", "status", "body", "response", "partition", "tag", "expectation":
+		return true
+	}
+	return strings.HasPrefix(field, "header.") && len(field) > len("header.")
+}
+
+// queryField returns the value of a field of a captured request: a float64
+// for status and a string otherwise.
+func queryField(c *CapturedRequest, field string) interface{} {
+	switch field {
+	case "method":
+		return c.Method
+	case "path":
+		return c.URL.Path
+	case "url":
+		return c.URL.RequestURI()
+	case "query":
+		return c.URL.RawQuery
+	case "status":
+		return float64(c.StatusCode)
+	case "body":
+		return string(c.RequestBodyBytes())
+	case "response":
+		return string(c.ResponseBodyBytes())
+	case "partition":
+		return c.Partition
+	case "expectation":
+		if c.Expectation == nil {
+			return ""
+		}
+		c.Expectation.mu.Lock()
+		defer c.Expectation.mu.Unlock()
+		return c.Expectation.id()
+	}
+	if name, ok := strings.CutPrefix(field, "header."); ok {
+		return c.Header.Get(name)
+	}
+	return ""
+}
+
+// compareValues compares numbers numerically and everything else as
+// strings.
+func compareValues(a, b interface{}) int {
+	af, aNum := a.(float64)
+	bf, bNum := b.(float64)
+	if aNum && !bNum {
+		bf, bNum = parseFloat(fmt.Sprint(b))
+	}
+	if bNum && !aNum {
+		af, aNum = parseFloat(fmt.Sprint(a))
+	}
+	if aNum && bNum {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func parseFloat(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// likeMatch implements SQL LIKE, where % matches any run of characters and
+// _ any single character.
+func likeMatch(s, pattern string) bool {
+	var glob strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			glob.WriteByte('*')
+		case '_':
+			glob.WriteByte('?')
+		case '*', '?', '[', ']', '\\':
+			glob.WriteByte('\\')
+			glob.WriteRune(r)
+		default:
+			glob.WriteRune(r)
+		}
+	}
+	// path.Match stops * at slashes, so hide them from it.
+	ok, _ := path.Match(strings.ReplaceAll(glob.String(), "/", "\x00"), strings.ReplaceAll(s, "/", "\x00"))
+	return ok
+}
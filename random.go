@@ -0,0 +1,78 @@
+package aduket
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Seed makes the randomized behavior of the server reproducible. Every
+// random choice made while serving requests, such as picking between
+// response variants, draws from the server's source unless an expectation
+// was given its own seed with Expectation.Seed.
+func (s *Server) Seed(seed int64) {
+	s.rand.Seed(seed)
+}
+
+// SetRandSeed is the same as Seed, e.g. to make the delays chosen by
+// Expectation.DelayRange reproducible.
+func (s *Server) SetRandSeed(seed int64) {
+	s.Seed(seed)
+}
+
+// lockedRand is a math/rand source that is safe for concurrent use.
+type lockedRand struct {
+	mu   sync.Mutex
+	r    *rand.Rand
+	seed int64 // Seed r started from, see clone
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed)), seed: seed}
+}
+
+func newTimeSeededRand() *lockedRand {
+	return newLockedRand(time.Now().UnixNano())
+}
+
+func (l *lockedRand) Seed(seed int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.r = rand.New(rand.NewSource(seed))
+	l.seed = seed
+}
+
+// clone returns a new source starting from the seed of l, so a cloned server
+// or expectation repeats the random choices of the original from the start.
+func (l *lockedRand) clone() *lockedRand {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return newLockedRand(l.seed)
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Int63n(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+func (l *lockedRand) sample(dist LatencyDistribution) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return dist(l.r)
+}
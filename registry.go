@@ -0,0 +1,255 @@
+package aduket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RegistryEnv names the environment variable that overrides the default
+// registry directory.
+const RegistryEnv = "ADUKET_REGISTRY"
+
+// Registry coordinates servers across test binaries running in parallel,
+// e.g. with go test ./... -p N. It is a directory holding one discovery file
+// per named server and one lock file per reserved port. Entries of processes
+// that have exited are treated as stale and cleaned up.
+type Registry struct {
+	dir string
+}
+
+// OpenRegistry opens the registry in dir, creating it if needed. An empty dir
+// uses $ADUKET_REGISTRY, or an aduket-registry directory in the system
+// temporary directory.
+func OpenRegistry(dir string) (*Registry, error) {
+	if dir == "" {
+		dir = os.Getenv(RegistryEnv)
+	}
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "aduket-registry")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Registry{dir: dir}, nil
+}
+
+// Register publishes the discovery information of s under name so other
+// processes can find it with Lookup. It fails if a live process other than
+// this one registered the name.
+func (r *Registry) Register(name string, s *Server) error {
+	path, err := r.entryPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.Discovery(), "", "  ")
+	if err != nil {
+		return err
+	}
+	existing, err := createExclusive(path, data, entryPID)
+	if err != nil || existing == nil {
+		return err
+	}
+	var info DiscoveryInfo
+	json.Unmarshal(existing, &info)
+	if info.PID != os.Getpid() {
+		return fmt.Errorf("aduket: %q is already registered by process %d at %s", name, info.PID, info.URL)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Unregister removes the entry for name.
+func (r *Registry) Unregister(name string) error {
+	path, err := r.entryPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Lookup returns the discovery information registered under name by a live
+// process.
+func (r *Registry) Lookup(name string) (DiscoveryInfo, bool) {
+	path, err := r.entryPath(name)
+	if err != nil {
+		return DiscoveryInfo{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DiscoveryInfo{}, false
+	}
+	var info DiscoveryInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return DiscoveryInfo{}, false
+	}
+	if !processAlive(info.PID) {
+		reclaim(path, entryPID)
+		return DiscoveryInfo{}, false
+	}
+	return info, true
+}
+
+// Instances returns the servers registered by live processes, by name.
+func (r *Registry) Instances() (map[string]DiscoveryInfo, error) {
+	matches, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	instances := make(map[string]DiscoveryInfo, len(matches))
+	for _, m := range matches {
+		name := strings.TrimSuffix(filepath.Base(m), ".json")
+		if info, ok := r.Lookup(name); ok {
+			instances[name] = info
+		}
+	}
+	return instances, nil
+}
+
+// ReservePort reserves a fixed port for this process until release is
+// called, so parallel test binaries do not fight over it. Reservations of
+// exited processes are reclaimed.
+func (r *Registry) ReservePort(port int) (release func(), err error) {
+	path := filepath.Join(r.dir, "port-"+strconv.Itoa(port)+".lock")
+	existing, err := createExclusive(path, []byte(strconv.Itoa(os.Getpid())+"\n"), lockPID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("aduket: port %d is reserved by process %d", port, lockPID(existing))
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// ReserveFreePort reserves the first port in [from, to] that is neither
+// reserved by another process nor bound.
+func (r *Registry) ReserveFreePort(from, to int) (port int, release func(), err error) {
+	for port := from; port <= to; port++ {
+		release, err := r.ReservePort(port)
+		if err != nil {
+			continue
+		}
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			release()
+			continue
+		}
+		l.Close()
+		return port, release, nil
+	}
+	return 0, nil, fmt.Errorf("aduket: no free port in %d-%d", from, to)
+}
+
+// entryPath returns the discovery file of name.
+func (r *Registry) entryPath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("aduket: invalid registry name %q", name)
+	}
+	return filepath.Join(r.dir, name+".json"), nil
+}
+
+// staleAge is how old an unreadable registry file must be before it is
+// reclaimed. Younger ones may still be being written by their owner.
+const staleAge = 10 * time.Second
+
+// reclaims numbers the files moved aside by reclaim within this process.
+var reclaims atomic.Uint64
+
+// entryPID returns the pid recorded in a discovery file, or 0.
+func entryPID(data []byte) int {
+	var info DiscoveryInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return 0
+	}
+	return info.PID
+}
+
+// lockPID returns the pid recorded in a port lock file, or 0.
+func lockPID(data []byte) int {
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// createExclusive creates path holding data. If path already exists and is
+// owned by a live process, as read by pid, its content is returned instead.
+// Stale files are reclaimed first.
+func createExclusive(path string, data []byte, pid func([]byte) int) (existing []byte, err error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+			}
+			return nil, err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		existing, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !stale(path, existing, pid) {
+			return existing, nil
+		}
+		if err := reclaim(path, pid); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("aduket: could not create %s", path)
+}
+
+// stale reports whether the registry file at path with the given content is
+// abandoned: its owner has exited, or it is unreadable and older than
+// staleAge.
+func stale(path string, data []byte, pid func([]byte) int) bool {
+	if p := pid(data); p > 0 {
+		return !processAlive(p)
+	}
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) > staleAge
+}
+
+// reclaim removes the stale file at path without deleting one another process
+// created in its place meanwhile: the file is moved aside under a unique name
+// and only removed if what was moved is still stale. Otherwise it is put
+// back.
+func reclaim(path string, pid func([]byte) int) error {
+	aside := fmt.Sprintf("%s.%d-%d.stale", path, os.Getpid(), reclaims.Add(1))
+	if err := os.Rename(path, aside); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer os.Remove(aside)
+
+	data, err := os.ReadFile(aside)
+	if err != nil {
+		return err
+	}
+	if stale(aside, data, pid) {
+		return nil
+	}
+	if err := os.Link(aside, path); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return nil
+}
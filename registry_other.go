@@ -0,0 +1,9 @@
+//go:build !unix
+
+package aduket
+
+// processAlive reports whether a process with the given pid exists. Without a
+// portable check, every positive pid is assumed to be alive.
+func processAlive(pid int) bool {
+	return pid > 0
+}
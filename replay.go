@@ -0,0 +1,94 @@
+package aduket
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ReplayResult is a captured interaction replayed against a handler.
+type ReplayResult struct {
+	Original *CapturedRequest           // Interaction as captured by the mock
+	Response *httptest.ResponseRecorder // Response of the handler
+}
+
+// Replay sends a copy of every request in reqs, in order, to h in process
+// and records the responses, e.g. to check that traffic recorded against a
+// mock gets the same answers from the real implementation. Requests rebuilt
+// from a Storage with StoredRequest.Captured can be replayed too.
+func Replay(h http.Handler, reqs []*CapturedRequest) []ReplayResult {
+	results := make([]ReplayResult, 0, len(reqs))
+	for _, c := range reqs {
+		r := httptest.NewRequest(c.Method, c.URL.String(), bytes.NewReader(c.RequestBodyBytes()))
+		r.Header = c.Header.Clone()
+		if c.Trailer != nil {
+			r.Trailer = c.Trailer.Clone()
+		}
+		if c.Host != "" {
+			r.Host = c.Host
+		}
+		if c.RemoteAddr != "" {
+			r.RemoteAddr = c.RemoteAddr
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		results = append(results, ReplayResult{Original: c, Response: rec})
+	}
+	return results
+}
+
+// Replay replays the requests captured by the server against h, see Replay.
+func (s *Server) Replay(h http.Handler) []ReplayResult {
+	return Replay(h, s.requestsSnapshot())
+}
+
+// AssertReplayEquivalent replays the requests captured by the server against
+// h and reports every response that differs from the one the mock gave.
+// Responses are normalized and compared as by MatchInteractionsGolden, so
+// opts can ignore or redact fields that legitimately differ, such as
+// generated IDs.
+func (s *Server) AssertReplayEquivalent(t *testing.T, h http.Handler, opts ...GoldenOption) {
+	cfg := newGoldenConfig(opts)
+
+	for i, result := range s.Replay(h) {
+		original := result.Original
+		res := result.Response.Result()
+		replayed := &CapturedRequest{
+			Request:        original.Request,
+			BodyContent:    original.RequestBodyBytes(),
+			StatusCode:     res.StatusCode,
+			ResponseHeader: res.Header,
+			ResponseBody:   result.Response.Body.Bytes(),
+		}
+
+		expected := goldenJSON(cfg.normalize(sentResponse(original)))
+		actual := goldenJSON(cfg.normalize(replayed))
+		if diff := unifiedDiff(expected, actual, colorDiffs); diff != "" {
+			s.errorf(t, []*CapturedRequest{original}, "replay of request %d (%s %s) differs from the mock:\n%s", i, original.Method, original.URL.Path, diff)
+		}
+	}
+}
+
+// sentResponse returns c with the response headers the client received.
+// Like the recorder of a replay, net/http adds a sniffed Content-Type to
+// responses that set none, which the captured headers do not show.
+func sentResponse(c *CapturedRequest) *CapturedRequest {
+	body := c.ResponseBodyBytes()
+	if len(body) == 0 || c.ResponseHeader.Get("Content-Type") != "" {
+		return c
+	}
+	header := c.ResponseHeader.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", http.DetectContentType(body))
+	return &CapturedRequest{
+		Request:        c.Request,
+		BodyContent:    c.RequestBodyBytes(),
+		StatusCode:     c.StatusCode,
+		ResponseHeader: header,
+		ResponseBody:   body,
+	}
+}
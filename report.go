@@ -0,0 +1,106 @@
+package aduket
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Report is a machine-readable summary of a server's expectations, traffic and
+// failed assertions, suitable for CI artifacts. See Server.Report.
+type Report struct {
+	GeneratedAt    time.Time           `json:"generatedAt"`
+	Passed         bool                `json:"passed"`
+	Expectations   []ExpectationReport `json:"expectations"`
+	Requests       int                 `json:"requests"`       // Including requests evicted from the history
+	Unmatched      []RequestReport     `json:"unmatched"`      // Unmatched requests still in the history
+	UnmatchedCount int                 `json:"unmatchedCount"` // Including requests evicted from the history
+	Failures       []string            `json:"failures"`
+}
+
+// ExpectationReport describes how often an expectation was matched.
+type ExpectationReport struct {
+	Name         string `json:"name,omitempty"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Times        int    `json:"times,omitempty"`
+	MatchedTimes int    `json:"matchedTimes"`
+	Satisfied    bool   `json:"satisfied"`
+}
+
+// RequestReport describes a captured request.
+type RequestReport struct {
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// Report summarizes the registered expectations and their match counts, the
+// requests no expectation matched and the assertions that failed so far.
+// JSON-RPC calls are reported with the method "JSON-RPC". Expectations
+// registered by the server itself are left out.
+func (s *Server) Report() Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := Report{
+		GeneratedAt:    time.Now(),
+		Expectations:   []ExpectationReport{},
+		Requests:       s.requestCount,
+		UnmatchedCount: s.unmatchedCount,
+		Unmatched:      []RequestReport{},
+		Failures:       append([]string{}, s.failures...),
+	}
+	for _, exp := range s.Expectations {
+		if exp.builtin {
+			continue
+		}
+		exp.mu.Lock()
+		report.Expectations = append(report.Expectations, ExpectationReport{
+			Name:         exp.Name,
+			Method:       exp.Method,
+			Path:         exp.Path,
+			Times:        exp.Times,
+			MatchedTimes: exp.MatchedTimes,
+			Satisfied:    exp.MatchedTimes > 0 && (exp.Times == 0 || exp.MatchedTimes >= exp.Times),
+		})
+		exp.mu.Unlock()
+	}
+	for _, call := range s.jsonrpc {
+		n := call.matchedTimes()
+		report.Expectations = append(report.Expectations, ExpectationReport{
+			Method:       "JSON-RPC",
+			Path:         call.Method,
+			Times:        call.Times,
+			MatchedTimes: n,
+			Satisfied:    n > 0,
+		})
+	}
+	for _, req := range s.Requests {
+		if req.Expectation == nil {
+			report.Unmatched = append(report.Unmatched, RequestReport{
+				Method:     req.Method,
+				URL:        req.URL.RequestURI(),
+				StatusCode: req.StatusCode,
+				ReceivedAt: req.ReceivedAt,
+			})
+		}
+	}
+
+	report.Passed = len(report.Failures) == 0 && report.UnmatchedCount == 0
+	for _, exp := range report.Expectations {
+		if !exp.Satisfied {
+			report.Passed = false
+		}
+	}
+	return report
+}
+
+// WriteReport writes the JSON report to path, replacing it atomically.
+func (s *Server) WriteReport(path string) error {
+	data, err := json.MarshalIndent(s.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
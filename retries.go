@@ -0,0 +1,84 @@
+package aduket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// DefaultRetryWindow is the default value of Server.RetryWindow.
+const DefaultRetryWindow = 30 * time.Second
+
+// Retry describes a request detected as a retry of an earlier one.
+type Retry struct {
+	Request  *CapturedRequest
+	Attempt  int           // 1 for the first retry of a request
+	Interval time.Duration // Time elapsed since the previous attempt
+}
+
+// RetriesFor returns the retries detected for method and path. A request is
+// considered a retry when it carries the same body as the previous request to
+// the same route and arrives within RetryWindow of it.
+func (s *Server) RetriesFor(method, path string) []Retry {
+	var retries []Retry
+	for _, group := range s.retryGroups(method, path) {
+		retries = append(retries, group...)
+	}
+	return retries
+}
+
+// AssertExponentialBackoff checks that the intervals between retries of
+// method and path grow by factor, allowing each interval to deviate from the
+// expected value by the jitter fraction (e.g. 0.2 for 20%).
+func (s *Server) AssertExponentialBackoff(t *testing.T, method, path string, factor, jitter float64) {
+	groups := s.retryGroups(method, path)
+	if len(groups) == 0 {
+		s.errorf(t, s.requestsSnapshot(), "expected %s %s to be retried with exponential backoff, but no retries were detected", method, path)
+		return
+	}
+
+	for _, group := range groups {
+		for i := 1; i < len(group); i++ {
+			expected := float64(group[i-1].Interval) * factor
+			actual := float64(group[i].Interval)
+			if actual < expected*(1-jitter) || actual > expected*(1+jitter) {
+				s.errorf(t, []*CapturedRequest{group[i-1].Request, group[i].Request}, "expected retry %d of %s %s after ~%v, got %v",
+					group[i].Attempt, method, path, time.Duration(expected), group[i].Interval)
+			}
+		}
+	}
+}
+
+// retryGroups returns the retries for method and path grouped by the original
+// request they repeat.
+func (s *Server) retryGroups(method, path string) [][]Retry {
+	s.mu.Lock()
+	window := s.RetryWindow
+	s.mu.Unlock()
+
+	var groups [][]Retry
+	var current []Retry
+	var prev *CapturedRequest
+	for _, req := range s.requestsSnapshot() {
+		if !req.matchesRoute(method, path) {
+			continue
+		}
+		if prev != nil &&
+			bytes.Equal(prev.RequestBodyBytes(), req.RequestBodyBytes()) &&
+			req.ReceivedAt.Sub(prev.ReceivedAt) <= window {
+			current = append(current, Retry{
+				Request:  req,
+				Attempt:  len(current) + 1,
+				Interval: req.ReceivedAt.Sub(prev.ReceivedAt),
+			})
+		} else if len(current) > 0 {
+			groups = append(groups, current)
+			current = nil
+		}
+		prev = req
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
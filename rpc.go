@@ -0,0 +1,214 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// gRPC status codes commonly used with RPCError.
+const (
+	RPCOK                 = 0
+	RPCCanceled           = 1
+	RPCUnknown            = 2
+	RPCInvalidArgument    = 3
+	RPCDeadlineExceeded   = 4
+	RPCNotFound           = 5
+	RPCAlreadyExists      = 6
+	RPCPermissionDenied   = 7
+	RPCResourceExhausted  = 8
+	RPCFailedPrecondition = 9
+	RPCAborted            = 10
+	RPCOutOfRange         = 11
+	RPCUnimplemented      = 12
+	RPCInternal           = 13
+	RPCUnavailable        = 14
+	RPCDataLoss           = 15
+	RPCUnauthenticated    = 16
+)
+
+// connectCodes maps gRPC status codes to Connect error codes and HTTP statuses.
+var connectCodes = map[int]struct {
+	name   string
+	status int
+}{
+	RPCCanceled:           {"canceled", 499},
+	RPCUnknown:            {"unknown", http.StatusInternalServerError},
+	RPCInvalidArgument:    {"invalid_argument", http.StatusBadRequest},
+	RPCDeadlineExceeded:   {"deadline_exceeded", http.StatusGatewayTimeout},
+	RPCNotFound:           {"not_found", http.StatusNotFound},
+	RPCAlreadyExists:      {"already_exists", http.StatusConflict},
+	RPCPermissionDenied:   {"permission_denied", http.StatusForbidden},
+	RPCResourceExhausted:  {"resource_exhausted", http.StatusTooManyRequests},
+	RPCFailedPrecondition: {"failed_precondition", http.StatusBadRequest},
+	RPCAborted:            {"aborted", http.StatusConflict},
+	RPCOutOfRange:         {"out_of_range", http.StatusBadRequest},
+	RPCUnimplemented:      {"unimplemented", http.StatusNotImplemented},
+	RPCInternal:           {"internal", http.StatusInternalServerError},
+	RPCUnavailable:        {"unavailable", http.StatusServiceUnavailable},
+	RPCDataLoss:           {"data_loss", http.StatusInternalServerError},
+	RPCUnauthenticated:    {"unauthenticated", http.StatusUnauthorized},
+}
+
+// Frame flags used by gRPC-Web and Connect envelopes.
+const (
+	frameTrailer   = 0x80 // gRPC-Web trailers frame
+	frameEndStream = 0x02 // Connect end-of-stream message
+)
+
+// ExpectRPC registers an expectation for a gRPC-Web or Connect call to
+// service and method, e.g. ExpectRPC("acme.v1.UserService", "GetUser").
+func (s *Server) ExpectRPC(service, method string) *Expectation {
+	return s.Expect("POST", "/"+service+"/"+method)
+}
+
+// RPCResponse makes the expectation answer a gRPC-Web or Connect call with
+// the given encoded messages and an OK status. The framing is chosen from the
+// request content type.
+func (e *Expectation) RPCResponse(messages ...[]byte) *Expectation {
+	return e.RespondWith(rpcResponder(messages, RPCOK, ""))
+}
+
+// RPCError makes the expectation answer a gRPC-Web or Connect call with the
+// given status code and message.
+func (e *Expectation) RPCError(code int, message string) *Expectation {
+	return e.RespondWith(rpcResponder(nil, code, message))
+}
+
+func rpcResponder(messages [][]byte, code int, message string) Responder {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		switch {
+		case strings.HasPrefix(contentType, "application/grpc-web"):
+			writeGRPCWeb(w, contentType, messages, code, message)
+		case strings.HasPrefix(contentType, "application/connect+"):
+			writeConnectStream(w, contentType, messages, code, message)
+		default:
+			writeConnectUnary(w, contentType, messages, code, message)
+		}
+	}
+}
+
+// writeGRPCWeb writes length-prefixed messages followed by a trailers frame,
+// since browsers cannot read HTTP trailers.
+func writeGRPCWeb(w http.ResponseWriter, contentType string, messages [][]byte, code int, message string) {
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		buf.Write(frame(0, msg))
+	}
+	trailers := fmt.Sprintf("grpc-status: %d\r\ngrpc-message: %s\r\n", code, message)
+	buf.Write(frame(frameTrailer, []byte(trailers)))
+
+	body := buf.Bytes()
+	if strings.HasPrefix(contentType, "application/grpc-web-text") {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// writeConnectStream writes Connect streaming envelopes and the end-of-stream
+// message carrying the error, if any.
+func writeConnectStream(w http.ResponseWriter, contentType string, messages [][]byte, code int, message string) {
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		buf.Write(frame(0, msg))
+	}
+	end := map[string]interface{}{}
+	if code != RPCOK {
+		end["error"] = connectError(code, message)
+	}
+	endJSON, _ := json.Marshal(end)
+	buf.Write(frame(frameEndStream, endJSON))
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeConnectUnary writes a Connect unary response, where errors are JSON
+// documents sent with a matching HTTP status.
+func writeConnectUnary(w http.ResponseWriter, contentType string, messages [][]byte, code int, message string) {
+	if code != RPCOK {
+		status := http.StatusInternalServerError
+		if c, ok := connectCodes[code]; ok {
+			status = c.status
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(connectError(code, message))
+		return
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(http.StatusOK)
+	if len(messages) > 0 {
+		w.Write(messages[0])
+	}
+}
+
+func connectError(code int, message string) map[string]string {
+	name := "unknown"
+	if c, ok := connectCodes[code]; ok {
+		name = c.name
+	}
+	return map[string]string{"code": name, "message": message}
+}
+
+// frame encodes a message with the 5-byte envelope shared by gRPC-Web and
+// Connect: one flag byte and a big-endian length.
+func frame(flags byte, msg []byte) []byte {
+	out := make([]byte, 5+len(msg))
+	out[0] = flags
+	binary.BigEndian.PutUint32(out[1:5], uint32(len(msg)))
+	copy(out[5:], msg)
+	return out
+}
+
+// RPCMessages decodes the messages of a captured gRPC-Web or Connect request.
+// Unary Connect requests are returned as a single message.
+func (c *CapturedRequest) RPCMessages() ([][]byte, error) {
+	body := c.RequestBodyBytes()
+	contentType := c.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web-text"):
+		decoded, err := base64.StdEncoding.DecodeString(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("aduket: invalid grpc-web-text body: %v", err)
+		}
+		return decodeFrames(decoded)
+	case strings.HasPrefix(contentType, "application/grpc"),
+		strings.HasPrefix(contentType, "application/connect+"):
+		return decodeFrames(body)
+	default:
+		return [][]byte{body}, nil
+	}
+}
+
+// decodeFrames splits enveloped messages, skipping trailer and end-of-stream
+// frames.
+func decodeFrames(data []byte) ([][]byte, error) {
+	var messages [][]byte
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, fmt.Errorf("aduket: truncated frame header")
+		}
+		flags := data[0]
+		n := binary.BigEndian.Uint32(data[1:5])
+		if uint32(len(data)-5) < n {
+			return nil, fmt.Errorf("aduket: truncated frame of %d bytes", n)
+		}
+		if flags&(frameTrailer|frameEndStream) == 0 {
+			messages = append(messages, data[5:5+n])
+		}
+		data = data[5+n:]
+	}
+	return messages, nil
+}
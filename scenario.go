@@ -0,0 +1,104 @@
+package aduket
+
+import "sync"
+
+// ScenarioStarted is the state every scenario begins in.
+const ScenarioStarted = "started"
+
+// Scenario is a named state machine shared by a group of expectations, for
+// stateful flows such as create, get and delete. Expectations created with
+// Scenario.Expect can require a state with WhenState and move the scenario to
+// another one when they match with WillSetState.
+type Scenario struct {
+	Name   string
+	server *Server
+	mu     sync.Mutex
+	state  string
+}
+
+// Scenario returns the scenario with the given name, creating it in the
+// ScenarioStarted state if needed.
+func (s *Server) Scenario(name string) *Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scenario(name)
+}
+
+// scenario is Scenario for callers holding s.mu.
+func (s *Server) scenario(name string) *Scenario {
+	if sc, ok := s.scenarios[name]; ok {
+		return sc
+	}
+	if s.scenarios == nil {
+		s.scenarios = make(map[string]*Scenario)
+	}
+	sc := &Scenario{Name: name, server: s, state: ScenarioStarted}
+	s.scenarios[name] = sc
+	return sc
+}
+
+// State returns the current state of the scenario.
+func (sc *Scenario) State() string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.state
+}
+
+// SetState moves the scenario to state.
+func (sc *Scenario) SetState(state string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.state = state
+}
+
+// transition moves the scenario from state from to state to, if to is not
+// empty, and reports whether it was in state from.
+func (sc *Scenario) transition(from, to string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.state != from {
+		return false
+	}
+	if to != "" {
+		sc.state = to
+	}
+	return true
+}
+
+// Reset moves the scenario back to ScenarioStarted.
+func (sc *Scenario) Reset() {
+	sc.SetState(ScenarioStarted)
+}
+
+// Expect registers an expectation that belongs to the scenario.
+func (sc *Scenario) Expect(method, path string) *Expectation {
+	exp := sc.server.Expect(method, path)
+	exp.mu.Lock()
+	exp.scenario = sc
+	exp.mu.Unlock()
+	return exp
+}
+
+// WhenState makes a scenario expectation match only while its scenario is in
+// state. It panics if the expectation was not created by Scenario.Expect.
+func (e *Expectation) WhenState(state string) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.scenario == nil {
+		panic("aduket: WhenState requires an expectation created by Scenario.Expect")
+	}
+	e.RequiredState = state
+	return e
+}
+
+// WillSetState moves the scenario to state whenever the expectation matches.
+// It panics if the expectation was not created by Scenario.Expect.
+func (e *Expectation) WillSetState(state string) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.scenario == nil {
+		panic("aduket: WillSetState requires an expectation created by Scenario.Expect")
+	}
+	e.NewState = state
+	return e
+}
@@ -0,0 +1,108 @@
+package aduket
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultShapeWindow is the window length of a TrafficShape without one.
+const DefaultShapeWindow = time.Second
+
+// TrafficShape describes degradation that affects the whole server for
+// stretches of time, see Server.Shape. Time is cut into windows and each
+// window is independently a latency spike and/or an error burst, so every
+// request arriving during a bad window sees the same trouble, as it would
+// with an overloaded upstream.
+type TrafficShape struct {
+	Window time.Duration // Length of a window, DefaultShapeWindow if 0
+
+	SpikeProbability float64       // Share of windows with a latency spike, from 0 to 1
+	SpikeLatency     time.Duration // Delay added to responses during a spike
+
+	BurstProbability float64 // Share of windows with an error burst, from 0 to 1
+	BurstStatus      int     // Status served during a burst, 503 if 0
+	BurstBody        string  // Body served during a burst
+}
+
+// Shape degrades the responses of every expectation according to shape,
+// e.g. to test circuit breakers, which react to runs of slow or failed
+// calls rather than to isolated ones. Requests served during a spike are
+// tagged "latency-spike" and those failed by a burst "error-burst". Whether
+// a window is bad is drawn from the server's random source when its first
+// request arrives, see Server.Seed. A zero TrafficShape removes the shaping.
+func (s *Server) Shape(shape TrafficShape) {
+	checkShape(shape)
+	if shape.Window == 0 {
+		shape.Window = DefaultShapeWindow
+	}
+	if shape.BurstStatus == 0 {
+		shape.BurstStatus = http.StatusServiceUnavailable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chaos = ""
+	if shape.SpikeProbability == 0 && shape.BurstProbability == 0 {
+		s.shaper = nil
+		return
+	}
+	s.shaper = newShaper(shape)
+}
+
+// checkShape panics if shape is invalid.
+func checkShape(shape TrafficShape) {
+	if err := validateShape(shape); err != nil {
+		panic("aduket: " + err.Error())
+	}
+}
+
+// validateShape reports why shape is invalid, or nil if it is not.
+func validateShape(shape TrafficShape) error {
+	for _, p := range []float64{shape.SpikeProbability, shape.BurstProbability} {
+		if p < 0 || p > 1 {
+			return fmt.Errorf("traffic shape probability %v out of range [0, 1]", p)
+		}
+	}
+	if shape.Window < 0 {
+		return fmt.Errorf("invalid traffic shape window %v", shape.Window)
+	}
+	return nil
+}
+
+// shaper tracks the state of the current window of a TrafficShape.
+type shaper struct {
+	shape   TrafficShape
+	failure *failure // Response served during a burst
+
+	mu     sync.Mutex
+	start  time.Time
+	window int64 // Index of the current window, -1 before the first request
+	spike  bool
+	burst  bool
+}
+
+func newShaper(shape TrafficShape) *shaper {
+	return &shaper{
+		shape:   shape,
+		failure: &failure{probability: 1, status: shape.BurstStatus, body: []byte(shape.BurstBody)},
+		start:   time.Now(),
+		window:  -1,
+	}
+}
+
+// state reports whether the window containing now is a latency spike and
+// an error burst, drawing the state from rng when the window is entered.
+func (sh *shaper) state(now time.Time, rng *lockedRand) (spike, burst bool) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	window := int64(now.Sub(sh.start) / sh.shape.Window)
+	if window != sh.window {
+		sh.window = window
+		sh.spike = sh.shape.SpikeProbability > 0 && rng.Float64() < sh.shape.SpikeProbability
+		sh.burst = sh.shape.BurstProbability > 0 && rng.Float64() < sh.shape.BurstProbability
+	}
+	return sh.spike, sh.burst
+}
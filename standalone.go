@@ -0,0 +1,212 @@
+package aduket
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultStandaloneAddr is the address of a standalone server without one.
+const DefaultStandaloneAddr = ":8080"
+
+// configPollInterval is how often a watched config is polled where file
+// system events are unavailable.
+const configPollInterval = 2 * time.Second
+
+// StandaloneOptions configures a standalone server, the server the aduket
+// command runs, see StartStandalone. Zero values leave features off.
+type StandaloneOptions struct {
+	Addr           string // TCP address to listen on, DefaultStandaloneAddr if empty
+	UnixSocket     string // Listen on this unix socket instead of Addr
+	Config         string // Config file or directory, see LoadConfig
+	WatchConfig    bool   // Reload Config when it changes
+	Timeline       string // Timeline file to play, see LoadTimeline
+	AdminAPI       bool   // See EnableAdminAPI
+	DockerEngine   bool   // See DockerEngine
+	DebugEndpoints bool   // See EnableDebugEndpoints
+	Discovery      bool   // See EnableDiscovery
+	DiscoveryFile  string // See WriteDiscoveryFile; removed on Close
+	ProxyTo        string // Upstream for unmatched requests, see ProxyTo
+	RecordTo       string // See RecordTo
+	HistoryFile    string // Captured requests are appended as JSON lines, see OpenFileStorage
+	JUnitFile      string // Verification results are written on Close, see WriteJUnit
+
+	MaxCapturedRequests int  // Requests kept in memory, see SetMaxCapturedRequests
+	DiscardBodies       bool // Keep no bodies in the history, see CaptureBodies
+
+	OnRequest func(*CapturedRequest)           // See Server.OnRequest
+	OnStatus  func(string)                     // Receives config reloads and their errors
+	OnPhase   func(i int, phase TimelinePhase) // See Play
+}
+
+// Standalone is a running standalone server.
+type Standalone struct {
+	*Server
+	Timeline *Timeline // Timeline being played, nil if none
+
+	opts      StandaloneOptions
+	done      chan struct{}
+	stopPlay  func()
+	history   *FileStorage
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// StartStandalone starts a standalone server configured by opts, so other
+// Go tools can embed what the aduket command serves without shelling out to
+// it. Without Config and Timeline, the server answers GET / with a
+// greeting. Close it when done.
+func StartStandalone(opts StandaloneOptions) (*Standalone, error) {
+	st := &Standalone{opts: opts, done: make(chan struct{})}
+	if opts.Timeline != "" {
+		tl, err := LoadTimeline(opts.Timeline)
+		if err != nil {
+			return nil, fmt.Errorf("reading timeline: %v", err)
+		}
+		st.Timeline = tl
+	}
+
+	s := NewUnstartedServer()
+	s.CompressHistory(true)
+	s.SetMaxCapturedRequests(opts.MaxCapturedRequests)
+	s.CaptureBodies(!opts.DiscardBodies)
+	s.OnRequest = opts.OnRequest
+	st.Server = s
+	if err := st.configure(); err != nil {
+		st.Close()
+		return nil, err
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = DefaultStandaloneAddr
+	}
+	listen := func() error { return s.Listen(addr) }
+	if opts.UnixSocket != "" {
+		addr = opts.UnixSocket
+		listen = func() error { return s.ListenUnix(addr) }
+	}
+	if err := listen(); err != nil {
+		st.Close()
+		return nil, fmt.Errorf("starting server on %s: %v", addr, err)
+	}
+
+	if err := st.start(); err != nil {
+		st.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// configure sets up the expectations and features of the server before it
+// listens, so the first requests already see them.
+func (st *Standalone) configure() error {
+	s, opts := st.Server, st.opts
+	if opts.Config != "" {
+		cfg, err := LoadConfig(opts.Config)
+		if err != nil {
+			return fmt.Errorf("reading config: %v", err)
+		}
+		s.ExpectAll(cfg.Rules())
+	} else if st.Timeline == nil {
+		s.Expect("GET", "/").Response(200, "{\"message\": \"Aduket CLI is running!\"}")
+	}
+
+	if opts.ProxyTo != "" {
+		if err := s.ProxyTo(opts.ProxyTo); err != nil {
+			return fmt.Errorf("configuring proxy: %v", err)
+		}
+	}
+	if opts.RecordTo != "" {
+		if err := s.RecordTo(opts.RecordTo); err != nil {
+			return fmt.Errorf("loading recordings: %v", err)
+		}
+	}
+	if opts.HistoryFile != "" {
+		history, err := OpenFileStorage(opts.HistoryFile)
+		if err != nil {
+			return fmt.Errorf("opening history file: %v", err)
+		}
+		st.history = history
+		s.UseStorage(history)
+	}
+
+	if opts.AdminAPI {
+		s.EnableAdminAPI()
+	}
+	if opts.DockerEngine {
+		s.DockerEngine()
+	}
+	if opts.DebugEndpoints {
+		s.EnableDebugEndpoints()
+	}
+	if opts.Discovery {
+		s.EnableDiscovery()
+	}
+	return nil
+}
+
+// start writes the discovery file and starts the timeline and config
+// watcher of the listening server.
+func (st *Standalone) start() error {
+	s, opts := st.Server, st.opts
+	if opts.DiscoveryFile != "" {
+		if err := s.WriteDiscoveryFile(opts.DiscoveryFile); err != nil {
+			return fmt.Errorf("writing discovery file: %v", err)
+		}
+	}
+
+	if st.Timeline != nil {
+		st.stopPlay = s.Play(st.Timeline, opts.OnPhase)
+	}
+	if opts.Config != "" && opts.WatchConfig {
+		report := opts.OnStatus
+		if report == nil {
+			report = func(string) {}
+		}
+		go watchConfig(s, opts.Config, configPollInterval, report, st.done)
+	}
+	return nil
+}
+
+// Close stops the server, its config watcher and timeline, writes the
+// JUnit report and closes the history file. It returns the first error of
+// these steps.
+func (st *Standalone) Close() error {
+	st.closeOnce.Do(func() {
+		close(st.done)
+		if st.stopPlay != nil {
+			st.stopPlay()
+		}
+		st.Server.Close()
+
+		if st.opts.JUnitFile != "" {
+			if err := st.Server.WriteJUnit(st.opts.JUnitFile); err != nil {
+				st.closeErr = fmt.Errorf("writing JUnit report: %v", err)
+			}
+		}
+		if st.history != nil {
+			if err := st.history.Close(); err != nil && st.closeErr == nil {
+				st.closeErr = fmt.Errorf("closing history file: %v", err)
+			}
+		}
+		if st.opts.DiscoveryFile != "" {
+			os.Remove(st.opts.DiscoveryFile)
+		}
+	})
+	return st.closeErr
+}
+
+// RunStandalone starts a standalone server configured by opts, without the
+// TUI, and serves until ctx is done. Use StartStandalone to get hold of the
+// server, e.g. for its URL.
+func RunStandalone(ctx context.Context, opts StandaloneOptions) error {
+	st, err := StartStandalone(opts)
+	if err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return st.Close()
+}
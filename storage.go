@@ -0,0 +1,239 @@
+package aduket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Storage persists captured traffic beyond the in-memory history, so long
+// running instances keep their history durably and tools can analyze it
+// after the process exits. MemoryStorage and FileStorage are provided; other
+// backends, e.g. a database or a remote collector, implement the interface.
+// Implementations must be safe for concurrent use.
+type Storage interface {
+	// Append stores a captured request, once the response has been sent.
+	// It is called without the server lock, concurrently for concurrent
+	// requests, so implementations synchronize it themselves.
+	Append(StoredRequest) error
+	// Load returns the stored requests in the order they were appended.
+	Load() ([]StoredRequest, error)
+	// Clear removes all stored requests.
+	Clear() error
+	// Close releases the resources held by the storage.
+	Close() error
+}
+
+// StoredRequest is the serializable form of a CapturedRequest.
+type StoredRequest struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	Header         http.Header `json:"header,omitempty"`
+	Trailer        http.Header `json:"trailer,omitempty"`
+	ExpectContinue bool        `json:"expectContinue,omitempty"`
+	ClientAborted  bool        `json:"clientAborted,omitempty"`
+	Body           []byte      `json:"body,omitempty"`
+	StatusCode     int         `json:"status"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	ResponseBody   []byte      `json:"responseBody,omitempty"`
+	ReceivedAt     time.Time   `json:"receivedAt"`
+	RespondedAt    time.Time   `json:"respondedAt,omitempty"`
+	Partition      string      `json:"partition,omitempty"`
+	Expectation    string      `json:"expectation,omitempty"` // Name or "METHOD path" of the matched expectation
+	Tags           []string    `json:"tags,omitempty"`
+}
+
+// Captured rebuilds a CapturedRequest from the stored form, e.g. to run a
+// RequestQuery over a history loaded from a Storage. The Expectation field
+// is left nil.
+func (sr StoredRequest) Captured() (*CapturedRequest, error) {
+	r, err := http.NewRequest(sr.Method, sr.URL, bytes.NewReader(sr.Body))
+	if err != nil {
+		return nil, err
+	}
+	if sr.Header != nil {
+		r.Header = sr.Header.Clone()
+	}
+	r.Trailer = sr.Trailer.Clone()
+	return &CapturedRequest{
+		Request:        r,
+		BodyContent:    sr.Body,
+		StatusCode:     sr.StatusCode,
+		ResponseBody:   sr.ResponseBody,
+		ResponseHeader: sr.ResponseHeader.Clone(),
+		ReceivedAt:     sr.ReceivedAt,
+		RespondedAt:    sr.RespondedAt,
+		Partition:      sr.Partition,
+		ExpectContinue: sr.ExpectContinue,
+		ClientAborted:  sr.ClientAborted,
+		tags:           append([]string(nil), sr.Tags...),
+	}, nil
+}
+
+// stored returns the serializable form of the captured request.
+func (c *CapturedRequest) stored() StoredRequest {
+	sr := StoredRequest{
+		Method:         c.Method,
+		URL:            c.URL.String(),
+		Header:         c.Header.Clone(),
+		Trailer:        c.Trailer.Clone(),
+		ExpectContinue: c.ExpectContinue,
+		ClientAborted:  c.ClientAborted,
+		Body:           c.RequestBodyBytes(),
+		StatusCode:     c.StatusCode,
+		ResponseHeader: c.ResponseHeader.Clone(),
+		ResponseBody:   c.ResponseBodyBytes(),
+		ReceivedAt:     c.ReceivedAt,
+		RespondedAt:    c.RespondedAt,
+		Partition:      c.Partition,
+		Tags:           c.Tags(),
+	}
+	if c.Expectation != nil {
+		c.Expectation.mu.Lock()
+		sr.Expectation = c.Expectation.id()
+		c.Expectation.mu.Unlock()
+	}
+	return sr
+}
+
+// UseStorage makes the server append every captured request to st, in
+// addition to the in-memory history. Tags added after a request has been
+// recorded are not stored. Reset and ResetRequests leave the storage alone;
+// clear it explicitly if needed. Pass nil to stop storing requests. The
+// caller remains responsible for closing st.
+func (s *Server) UseStorage(st Storage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.storage = st
+}
+
+// MemoryStorage is a Storage that keeps the requests in memory.
+type MemoryStorage struct {
+	mu   sync.Mutex
+	reqs []StoredRequest
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+// Append implements Storage.
+func (m *MemoryStorage) Append(sr StoredRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reqs = append(m.reqs, sr)
+	return nil
+}
+
+// Load implements Storage.
+func (m *MemoryStorage) Load() ([]StoredRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]StoredRequest(nil), m.reqs...), nil
+}
+
+// Clear implements Storage.
+func (m *MemoryStorage) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reqs = nil
+	return nil
+}
+
+// Close implements Storage.
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// FileStorage is a Storage that appends the requests to a file as JSON
+// lines, which other tools can read while the server is running.
+type FileStorage struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenFileStorage opens or creates the file at path for appending.
+// Requests already stored in it are kept.
+func OpenFileStorage(path string) (*FileStorage, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStorage{path: path, f: f}, nil
+}
+
+// Append implements Storage.
+func (fs *FileStorage) Append(sr StoredRequest) error {
+	line, err := json.Marshal(sr)
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.f == nil {
+		return os.ErrClosed
+	}
+	_, err = fs.f.Write(append(line, '\n'))
+	return err
+}
+
+// Load implements Storage. It can also be used on a file written by another
+// process, see LoadStoredRequests.
+func (fs *FileStorage) Load() ([]StoredRequest, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return LoadStoredRequests(fs.path)
+}
+
+// Clear implements Storage.
+func (fs *FileStorage) Clear() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.f == nil {
+		return os.ErrClosed
+	}
+	return fs.f.Truncate(0)
+}
+
+// Close implements Storage.
+func (fs *FileStorage) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.f == nil {
+		return nil
+	}
+	err := fs.f.Close()
+	fs.f = nil
+	return err
+}
+
+// LoadStoredRequests reads the requests stored in a FileStorage file.
+func LoadStoredRequests(path string) ([]StoredRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reqs []StoredRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var sr StoredRequest
+		if err := json.Unmarshal(scanner.Bytes(), &sr); err != nil {
+			return nil, fmt.Errorf("aduket: %s:%d: %w", path, line, err)
+		}
+		reqs = append(reqs, sr)
+	}
+	return reqs, scanner.Err()
+}
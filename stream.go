@@ -0,0 +1,101 @@
+package aduket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// stream describes a chunked response, see StreamResponse.
+type stream struct {
+	chunks     [][]byte
+	interval   time.Duration
+	abortAfter int // Number of chunks sent before aborting, -1 to send all
+}
+
+// StreamResponse makes the expectation respond with a chunked body, writing
+// and flushing every chunk after waiting interval, to test clients consuming
+// streaming HTTP responses. No Content-Length is sent. The status defaults
+// to 200.
+func (e *Expectation) StreamResponse(chunks [][]byte, interval time.Duration) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stream = &stream{
+		chunks:     append([][]byte(nil), chunks...),
+		interval:   interval,
+		abortAfter: -1,
+	}
+	if e.StatusCode == 0 {
+		e.StatusCode = http.StatusOK
+	}
+	return e
+}
+
+// NDJSONStream streams items as newline-delimited JSON (JSON Lines), one
+// item per line and flush every interval, as used by watch and log APIs.
+// The Content-Type is set to application/x-ndjson. Items that cannot be
+// encoded panic, like other configuration errors.
+func (e *Expectation) NDJSONStream(items []interface{}, interval time.Duration) *Expectation {
+	lines := make([][]byte, len(items))
+	for i, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			panic(fmt.Sprintf("aduket: encoding NDJSON item %d: %v", i, err))
+		}
+		lines[i] = append(line, '\n')
+	}
+	e.StreamResponse(lines, interval)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Header.Set("Content-Type", "application/x-ndjson")
+	return e
+}
+
+// AbortStreamAfter makes a streamed response drop the connection after n
+// chunks, so clients see a truncated body. It panics if the expectation has
+// no StreamResponse.
+func (e *Expectation) AbortStreamAfter(n int) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stream == nil {
+		panic("aduket: AbortStreamAfter requires StreamResponse")
+	}
+	s := *e.stream
+	s.abortAfter = n
+	e.stream = &s
+	return e
+}
+
+// write streams the chunks to w and reports whether the response must be
+// aborted. It stops early when the client goes away.
+func (st *stream) write(w http.ResponseWriter, r *http.Request, status int) bool {
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	timer := time.NewTimer(st.interval)
+	defer timer.Stop()
+	for i, chunk := range st.chunks {
+		if i == st.abortAfter {
+			return true
+		}
+		if st.interval > 0 {
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return false
+			}
+			timer.Reset(st.interval)
+		}
+		w.Write(chunk)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return st.abortAfter >= 0 && st.abortAfter >= len(st.chunks)
+}
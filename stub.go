@@ -0,0 +1,151 @@
+package aduket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Rule is a declarative description of an expectation, convenient for
+// table-driven tests. See Server.ExpectAll.
+type Rule struct {
+	Name           string
+	Method         string
+	Path           string
+	Query          map[string]string // Query parameters the request must carry
+	RequestHeaders map[string]string // Request headers the request must carry
+	Status         int
+	Body           string
+	File           string            // Response body fixture, see Expectation.ResponseFile
+	Headers        map[string]string // Response headers
+	Delay          time.Duration
+	Times          int
+	Priority       int       // See Expectation.Priority
+	Transform      string    // jq-like response transform, see Expectation.TransformJSON
+	Template       string    // Response body template, see Expectation.TemplateResponse
+	Responder      Responder // Optional, takes precedence over Status and Body
+}
+
+// ExpectAll registers an expectation for every rule, in order, and returns
+// them.
+func (s *Server) ExpectAll(rules []Rule) []*Expectation {
+	exps := rulesToExpectations(rules)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Expectations = append(s.Expectations, exps...)
+	return exps
+}
+
+// ReplaceExpectations atomically replaces the registered expectations with
+// the given rules, so concurrent requests never observe a partially updated
+// set. Expectations registered by the server itself, such as the simulated
+// health endpoint, are kept.
+func (s *Server) ReplaceExpectations(rules []Rule) []*Expectation {
+	exps := rulesToExpectations(rules)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := make([]*Expectation, 0, len(s.Expectations)+len(exps))
+	for _, exp := range s.Expectations {
+		if exp.builtin {
+			kept = append(kept, exp)
+		}
+	}
+	s.Expectations = append(kept, exps...)
+	return exps
+}
+
+// rulesToExpectations builds unregistered expectations from rules.
+func rulesToExpectations(rules []Rule) []*Expectation {
+	exps := make([]*Expectation, 0, len(rules))
+	for _, rule := range rules {
+		exp := newExpectation(rule.Method, rule.Path).
+			Named(rule.Name).
+			Response(rule.Status, rule.Body).
+			Headers(rule.Headers).
+			Delay(rule.Delay).
+			TimesSet(rule.Times).
+			Priority(rule.Priority)
+		for k, v := range rule.Query {
+			exp.WithQuery(k, v)
+		}
+		for k, v := range rule.RequestHeaders {
+			exp.WithHeader(k, v)
+		}
+		if rule.File != "" {
+			exp.ResponseFile(rule.Status, rule.File)
+		}
+		if rule.Template != "" {
+			exp.TemplateResponse(rule.Status, rule.Template)
+		}
+		if rule.Transform != "" {
+			exp.TransformJSON(rule.Transform)
+		}
+		if rule.Responder != nil {
+			exp.RespondWith(rule.Responder)
+		}
+		exps = append(exps, exp)
+	}
+	return exps
+}
+
+// StubJSON registers an expectation from a "METHOD /path" route that responds
+// with 200 and the given payload. Strings and byte slices are sent as is,
+// other values are encoded as JSON. The Content-Type header is inferred from
+// the payload.
+func (s *Server) StubJSON(route string, payload interface{}) *Expectation {
+	method, path, err := parseRoute(route)
+	if err != nil {
+		panic(err)
+	}
+
+	var body []byte
+	switch v := payload.(type) {
+	case string:
+		body = []byte(v)
+	case []byte:
+		body = v
+	default:
+		body, err = json.Marshal(v)
+		if err != nil {
+			panic(fmt.Sprintf("aduket: cannot encode payload for %s: %v", route, err))
+		}
+	}
+
+	return s.Expect(method, path).
+		Headers(map[string]string{"Content-Type": inferContentType(body)}).
+		Response(http.StatusOK, string(body))
+}
+
+// parseRoute splits a "METHOD /path" string.
+func parseRoute(route string) (string, string, error) {
+	fields := strings.Fields(route)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("aduket: invalid route %q, expected \"METHOD /path\"", route)
+	}
+	return strings.ToUpper(fields[0]), fields[1], nil
+}
+
+// InferContentType enables or disables setting a Content-Type header on
+// static responses that do not declare one. JSON bodies are served as
+// application/json, anything else is sniffed with http.DetectContentType.
+// Responders are never affected.
+func (s *Server) InferContentType(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoContentType = enabled
+}
+
+// inferContentType guesses the content type of a response body, preferring
+// JSON over the generic sniffing done by net/http.
+func inferContentType(body []byte) string {
+	trimmed := strings.TrimSpace(string(body))
+	if trimmed != "" && json.Valid([]byte(trimmed)) {
+		return "application/json"
+	}
+	return http.DetectContentType(body)
+}
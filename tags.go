@@ -0,0 +1,70 @@
+package aduket
+
+import (
+	"context"
+	"net/http"
+)
+
+// capturedKey is the context key under which the handler stores the
+// CapturedRequest of the request being served.
+type capturedKey struct{}
+
+// Tag attaches tags to the captured request, e.g. from an OnRequest hook, so
+// it can be found later with Server.RequestsTagged.
+func (c *CapturedRequest) Tag(tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tag := range tags {
+		if !containsString(c.tags, tag) {
+			c.tags = append(c.tags, tag)
+		}
+	}
+}
+
+// Tags returns the tags attached to the captured request.
+func (c *CapturedRequest) Tags() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.tags...)
+}
+
+// HasTag reports whether the captured request carries tag.
+func (c *CapturedRequest) HasTag(tag string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return containsString(c.tags, tag)
+}
+
+// TagRequest attaches tags to the captured request of r. It lets matchers and
+// responders, which only see the *http.Request, tag the traffic they handle.
+// It does nothing for requests not served by aduket.
+func TagRequest(r *http.Request, tags ...string) {
+	if c, ok := r.Context().Value(capturedKey{}).(*CapturedRequest); ok {
+		c.Tag(tags...)
+	}
+}
+
+// RequestsTagged returns the captured requests carrying tag, in order.
+func (s *Server) RequestsTagged(tag string) []*CapturedRequest {
+	var reqs []*CapturedRequest
+	for _, req := range s.requestsSnapshot() {
+		if req.HasTag(tag) {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// withCaptured returns r carrying c in its context, see TagRequest.
+func withCaptured(r *http.Request, c *CapturedRequest) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), capturedKey{}, c))
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
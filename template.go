@@ -0,0 +1,166 @@
+package aduket
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/ismailtsdln/aduket/auth"
+)
+
+// TemplateData is the data available to response templates, see
+// TemplateResponse.
+type TemplateData struct {
+	Request *http.Request
+	Body    string            // Request body
+	JSON    interface{}       // Request body decoded as JSON, nil if it is not JSON
+	Decoded interface{}       // Request body decoded by the codec for its Content-Type, see RegisterCodec
+	Params  map[string]string // Path parameters, see Server.Expect
+}
+
+// TemplateResponse sets the response status and a text/template rendered
+// into the body for every request, e.g.
+//
+//	e.TemplateResponse(200, `{"echo": "{{.Request.URL.Query.Get "q"}}", "id": "{{.Params.id}}"}`)
+//
+// Templates receive a TemplateData and can use the functions listed by
+// Server.TemplateFuncs. Invalid templates panic, like other configuration
+// errors; a template failing to render answers the request with 500.
+func (e *Expectation) TemplateResponse(status int, tmpl string) *Expectation {
+	t := mustParseTemplate(tmpl)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.StatusCode = status
+	e.Body = nil
+	e.Template = tmpl
+	e.template = t
+	return e
+}
+
+// mustParseTemplate parses a response template or panics.
+func mustParseTemplate(tmpl string) *template.Template {
+	t, err := parseTemplate(tmpl)
+	if err != nil {
+		panic(fmt.Sprintf("aduket: invalid response template: %v", err))
+	}
+	return t
+}
+
+// parseTemplate parses a response template. The functions are bound to a
+// server when the template is rendered; only their names and signatures
+// matter here.
+func parseTemplate(tmpl string) (*template.Template, error) {
+	return template.New("response").Funcs((*Server)(nil).TemplateFuncs()).Parse(tmpl)
+}
+
+// renderTemplate renders a response template for r.
+func (s *Server) renderTemplate(t *template.Template, r *http.Request, body []byte, params map[string]string) ([]byte, error) {
+	t, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	data := TemplateData{Request: r, Body: string(body), Params: params}
+	if len(body) > 0 {
+		var v interface{}
+		if json.Unmarshal(body, &v) == nil {
+			data.JSON = v
+		}
+		if v, err := decodeBody(r.Header.Get("Content-Type"), body); err == nil {
+			data.Decoded = v
+		}
+	}
+	var buf bytes.Buffer
+	if err := t.Funcs(s.TemplateFuncs()).Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// TemplateFuncs returns the functions available to response templates. They
+// can also be used with text/template directly:
+//
+//	now                  current UTC time
+//	unix                 current Unix timestamp in seconds
+//	uuid                 random version 4 UUID
+//	randInt MIN MAX      random integer in [MIN, MAX)
+//	b64 S / b64dec S     base64 encode or decode a string
+//	sha256 S             hex encoded SHA-256 digest
+//	hmac KEY S           hex encoded HMAC-SHA256 of S
+//	signJWT SECRET CLAIMS  HS256 signed JWT, CLAIMS built with dict
+//	dict K V ...         map from alternating keys and values
+//	json V               JSON encoding of V
+//
+// Random values are drawn from the server's source, see Seed.
+func (s *Server) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"now":  func() time.Time { return time.Now().UTC() },
+		"unix": func() int64 { return time.Now().Unix() },
+		"uuid": func() string { return s.uuid() },
+		"randInt": func(min, max int) int {
+			if max <= min {
+				return min
+			}
+			return min + s.rand.Intn(max-min)
+		},
+		"b64": func(v string) string { return base64.StdEncoding.EncodeToString([]byte(v)) },
+		"b64dec": func(v string) (string, error) {
+			out, err := base64.StdEncoding.DecodeString(v)
+			return string(out), err
+		},
+		"sha256": func(v string) string {
+			sum := sha256.Sum256([]byte(v))
+			return hex.EncodeToString(sum[:])
+		},
+		"hmac": func(key, v string) string {
+			mac := hmac.New(sha256.New, []byte(key))
+			mac.Write([]byte(v))
+			return hex.EncodeToString(mac.Sum(nil))
+		},
+		"signJWT": signHS256JWT,
+		"dict":    dict,
+		"json": func(v interface{}) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+	}
+}
+
+// uuid returns a random version 4 UUID drawn from the server's source.
+func (s *Server) uuid() string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(s.rand.Intn(256))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// signHS256JWT returns a JWT signed with HMAC-SHA256.
+func signHS256JWT(secret string, claims map[string]interface{}) (string, error) {
+	return auth.NewHMACKey("", []byte(secret)).Sign(claims)
+}
+
+// dict builds a map from alternating keys and values.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("aduket: dict expects an even number of arguments")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("aduket: dict key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
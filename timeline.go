@@ -0,0 +1,155 @@
+package aduket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Timeline is a sequence of phases that change the behavior of a server
+// over time, e.g. healthy for a minute, degraded for the next, then
+// recovered, for resilience game days and demos. See LoadTimeline and
+// Server.Play.
+type Timeline struct {
+	Phases []TimelinePhase `json:"phases"`
+	Loop   bool            `json:"loop,omitempty"` // Start over after the last phase
+}
+
+// TimelinePhase is a single phase of a Timeline. A phase without
+// expectations keeps those of the phase before it, so a degraded phase can
+// reuse the endpoints of a healthy one and only add a Shape.
+type TimelinePhase struct {
+	Name         string              `json:"name"`
+	Duration     duration            `json:"duration,omitempty"` // Only the last phase may be 0, lasting forever
+	Expectations []ConfigExpectation `json:"expectations,omitempty"`
+	Shape        *ConfigShape        `json:"shape,omitempty"`
+}
+
+// ConfigShape is a TrafficShape as written in config files.
+type ConfigShape struct {
+	Window           duration `json:"window,omitempty"`
+	SpikeProbability float64  `json:"spikeProbability,omitempty"`
+	SpikeLatency     duration `json:"spikeLatency,omitempty"`
+	BurstProbability float64  `json:"burstProbability,omitempty"`
+	BurstStatus      int      `json:"burstStatus,omitempty"`
+	BurstBody        string   `json:"burstBody,omitempty"`
+}
+
+// TrafficShape converts the config into a shape for Server.Shape. A nil
+// config is the zero shape.
+func (c *ConfigShape) TrafficShape() TrafficShape {
+	if c == nil {
+		return TrafficShape{}
+	}
+	return TrafficShape{
+		Window:           time.Duration(c.Window),
+		SpikeProbability: c.SpikeProbability,
+		SpikeLatency:     time.Duration(c.SpikeLatency),
+		BurstProbability: c.BurstProbability,
+		BurstStatus:      c.BurstStatus,
+		BurstBody:        c.BurstBody,
+	}
+}
+
+// LoadTimeline reads a timeline file, YAML if its extension is .yaml or
+// .yml and JSON otherwise. Expectations use the fields of Config.
+func LoadTimeline(path string) (*Timeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	var tl Timeline
+	if err := json.Unmarshal(data, &tl); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := tl.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, phase := range tl.Phases {
+		if err := resolveResponseFiles(phase.Expectations, filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return &tl, nil
+}
+
+func (tl *Timeline) validate() error {
+	if len(tl.Phases) == 0 {
+		return errors.New("aduket: timeline without phases")
+	}
+	for i, phase := range tl.Phases {
+		if phase.Duration < 0 {
+			return fmt.Errorf("aduket: phase %q has negative duration %v", phase.Name, time.Duration(phase.Duration))
+		}
+		if phase.Duration == 0 && (i < len(tl.Phases)-1 || tl.Loop) {
+			return fmt.Errorf("aduket: phase %q needs a duration", phase.Name)
+		}
+		// Play applies phases in a goroutine, where a panic on an invalid
+		// shape or expectation would take the process down.
+		if err := validateShape(phase.Shape.TrafficShape()); err != nil {
+			return fmt.Errorf("aduket: phase %q: %v", phase.Name, err)
+		}
+		if err := validateExpectations(phase.Expectations); err != nil {
+			return fmt.Errorf("aduket: phase %q: %v", phase.Name, err)
+		}
+	}
+	return nil
+}
+
+// Play applies the phases of tl to s in order and returns a function that
+// stops the playback, leaving the current phase in effect. The first phase
+// is applied before Play returns. Each phase replaces the expectations, see
+// Server.ReplaceExpectations, and the traffic shape of s; onPhase, if not
+// nil, is called with the index of every phase as it starts. Play panics on
+// a timeline that LoadTimeline would reject.
+func (s *Server) Play(tl *Timeline, onPhase func(i int, phase TimelinePhase)) (stop func()) {
+	if err := tl.validate(); err != nil {
+		panic(err.Error())
+	}
+
+	apply := func(i int) {
+		phase := tl.Phases[i]
+		if phase.Expectations != nil {
+			cfg := Config{Expectations: phase.Expectations}
+			s.ReplaceExpectations(cfg.Rules())
+		}
+		s.Shape(phase.Shape.TrafficShape())
+		if onPhase != nil {
+			onPhase(i, phase)
+		}
+	}
+	apply(0)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; tl.Phases[i].Duration > 0; {
+			timer := time.NewTimer(time.Duration(tl.Phases[i].Duration))
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if i++; i == len(tl.Phases) {
+				if !tl.Loop {
+					return
+				}
+				i = 0
+			}
+			apply(i)
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,130 @@
+package aduket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+// TLSVersion returns the name of the negotiated TLS version, such as
+// "TLS 1.3", or "" for plain HTTP requests.
+func (c *CapturedRequest) TLSVersion() string {
+	if c.TLS == nil {
+		return ""
+	}
+	return tls.VersionName(c.TLS.Version)
+}
+
+// CipherSuite returns the name of the negotiated cipher suite, or "" for
+// plain HTTP requests.
+func (c *CapturedRequest) CipherSuite() string {
+	if c.TLS == nil {
+		return ""
+	}
+	return tls.CipherSuiteName(c.TLS.CipherSuite)
+}
+
+// ALPN returns the protocol negotiated with ALPN, such as "h2", or "".
+func (c *CapturedRequest) ALPN() string {
+	if c.TLS == nil {
+		return ""
+	}
+	return c.TLS.NegotiatedProtocol
+}
+
+// SetTLSConfig sets the TLS configuration StartTLS and ListenTLS use. The
+// generated test certificate is presented only if cfg has no certificates.
+// Unless cfg sets GetConfigForClient itself, RequireClientCert keeps
+// working. It returns ErrAlreadyStarted on a running server.
+func (s *Server) SetTLSConfig(cfg *tls.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return ErrAlreadyStarted
+	}
+	cfg = cfg.Clone()
+	if cfg.GetConfigForClient == nil {
+		cfg.GetConfigForClient = s.clientTLSConfig
+	}
+	s.Server.TLS = cfg
+	return nil
+}
+
+// ClientCert returns the certificate the client presented, or nil for
+// plain HTTP requests and TLS requests without one.
+func (c *CapturedRequest) ClientCert() *x509.Certificate {
+	if c.TLS == nil || len(c.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return c.TLS.PeerCertificates[0]
+}
+
+// RequireClientCert makes a TLS server require mutual TLS: clients must
+// present a certificate signed by a CA in caPool, or the handshake fails.
+// It applies to connections made after the call, so it can be used on a
+// running server. A nil pool stops requiring client certificates.
+func (s *Server) RequireClientCert(caPool *x509.CertPool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientCAs = caPool
+}
+
+// clientTLSConfig returns the config for a new TLS connection, requiring a
+// client certificate if RequireClientCert was called.
+func (s *Server) clientTLSConfig(*tls.ClientHelloInfo) (*tls.Config, error) {
+	s.mu.Lock()
+	pool := s.clientCAs
+	s.mu.Unlock()
+	if pool == nil {
+		return nil, nil
+	}
+	cfg := s.Server.TLS.Clone()
+	cfg.GetConfigForClient = nil
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = pool
+	return cfg, nil
+}
+
+// AssertMinTLSVersion checks that the i-th request was made over TLS with
+// at least the given version, e.g. tls.VersionTLS12.
+func (s *Server) AssertMinTLSVersion(t *testing.T, i int, version uint16) {
+	req := s.GetRequest(i)
+	switch {
+	case req == nil:
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	case req.TLS == nil:
+		s.errorf(t, []*CapturedRequest{req}, "expected request %d to use %s or later, but it was not made over TLS", i, tls.VersionName(version))
+	case req.TLS.Version < version:
+		s.errorf(t, []*CapturedRequest{req}, "expected request %d to use %s or later, got %s", i, tls.VersionName(version), req.TLSVersion())
+	}
+}
+
+// AssertALPN checks the protocol negotiated with ALPN for the i-th request,
+// e.g. "h2" to verify that a client uses HTTP/2. Enable HTTP/2 on the server
+// with EnableHTTP2 before StartTLS.
+func (s *Server) AssertALPN(t *testing.T, i int, protocol string) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+	if got := req.ALPN(); got != protocol {
+		s.errorf(t, []*CapturedRequest{req}, "expected request %d to negotiate %q, got %q", i, protocol, got)
+	}
+}
+
+// AssertClientCertCN checks the common name of the certificate the client
+// presented with the i-th request, see RequireClientCert.
+func (s *Server) AssertClientCertCN(t *testing.T, i int, cn string) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+	cert := req.ClientCert()
+	switch {
+	case cert == nil:
+		s.errorf(t, []*CapturedRequest{req}, "expected request %d to present a client certificate for %q, got none", i, cn)
+	case cert.Subject.CommonName != cn:
+		s.errorf(t, []*CapturedRequest{req}, "expected request %d to present a client certificate for %q, got %q", i, cn, cert.Subject.CommonName)
+	}
+}
@@ -0,0 +1,502 @@
+package aduket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TransformJSON applies a jq-like expression to the JSON response body before
+// it is sent, so large recorded payloads can be trimmed or altered
+// declaratively. The supported subset is:
+//
+//	.  .a.b  .[0]  .["key"]  .[1:3]      paths, indexes and slices
+//	PATH |= EXPR                         update the value at PATH
+//	PATH = JSON                          set the value at PATH
+//	del(PATH)                            delete the value at PATH
+//	map(EXPR)  length  keys              array and object helpers
+//	EXPR | EXPR                          pipes and (EXPR) grouping
+//
+// Invalid expressions panic, like other configuration errors.
+func (e *Expectation) TransformJSON(expr string) *Expectation {
+	filter, err := parseJQ(expr)
+	if err != nil {
+		panic(fmt.Sprintf("aduket: invalid transform %q: %v", expr, err))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Transform = expr
+	e.transform = filter
+	return e
+}
+
+// TransformProxied applies a jq-like expression, see TransformJSON, to the
+// JSON responses relayed from the upstream of ProxyTo. Recorded exchanges
+// hold the transformed body. Upstream responses that are not JSON are
+// answered with 502 Bad Gateway.
+func (s *Server) TransformProxied(expr string) {
+	filter, err := parseJQ(expr)
+	if err != nil {
+		panic(fmt.Sprintf("aduket: invalid transform %q: %v", expr, err))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.proxy == nil {
+		s.proxy = &proxy{}
+	}
+	s.proxy.transform = filter
+}
+
+// applyTransform runs a compiled transform over a JSON body.
+func applyTransform(filter jqFilter, body []byte) ([]byte, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("response is not JSON: %v", err)
+	}
+	out, err := filter(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// jqFilter transforms a decoded JSON value.
+type jqFilter func(v interface{}) (interface{}, error)
+
+// pathStep is one step of a path such as .a or .[1:3].
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	isSlice  bool
+	from, to *int
+}
+
+type jqParser struct {
+	src string
+	pos int
+}
+
+func parseJQ(expr string) (jqFilter, error) {
+	p := &jqParser{src: expr}
+	f, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos:], p.pos)
+	}
+	return f, nil
+}
+
+func (p *jqParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *jqParser) consume(s string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *jqParser) parsePipe() (jqFilter, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !strings.HasPrefix(p.src[p.pos:], "|") || strings.HasPrefix(p.src[p.pos:], "|=") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		first, second := left, right
+		left = func(v interface{}) (interface{}, error) {
+			mid, err := first(v)
+			if err != nil {
+				return nil, err
+			}
+			return second(mid)
+		}
+	}
+}
+
+func (p *jqParser) parseTerm() (jqFilter, error) {
+	p.skipSpace()
+	switch {
+	case p.consume("("):
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ) at offset %d", p.pos)
+		}
+		return f, nil
+	case p.consume("del("):
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ) at offset %d", p.pos)
+		}
+		return func(v interface{}) (interface{}, error) { return deletePath(v, path) }, nil
+	case p.consume("map("):
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ) at offset %d", p.pos)
+		}
+		return func(v interface{}) (interface{}, error) {
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot map over %T", v)
+			}
+			out := make([]interface{}, len(arr))
+			for i, item := range arr {
+				mapped, err := f(item)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = mapped
+			}
+			return out, nil
+		}, nil
+	case p.consume("length"):
+		return jqLength, nil
+	case p.consume("keys"):
+		return jqKeys, nil
+	case p.pos < len(p.src) && p.src[p.pos] == '.':
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if p.consume("|=") {
+			rhs, err := p.parseTerm()
+			if err != nil {
+				return nil, err
+			}
+			return func(v interface{}) (interface{}, error) { return updatePath(v, path, rhs) }, nil
+		}
+		if p.consume("=") {
+			lit, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			return func(v interface{}) (interface{}, error) {
+				return updatePath(v, path, func(interface{}) (interface{}, error) { return lit, nil })
+			}, nil
+		}
+		return func(v interface{}) (interface{}, error) { return getPath(v, path) }, nil
+	default:
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return func(interface{}) (interface{}, error) { return lit, nil }, nil
+	}
+}
+
+func (p *jqParser) parseLiteral() (interface{}, error) {
+	p.skipSpace()
+	dec := json.NewDecoder(strings.NewReader(p.src[p.pos:]))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid literal at offset %d: %v", p.pos, err)
+	}
+	p.pos += int(dec.InputOffset())
+	return v, nil
+}
+
+func (p *jqParser) parsePath() ([]pathStep, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != '.' {
+		return nil, fmt.Errorf("expected path at offset %d", p.pos)
+	}
+	var steps []pathStep
+	for p.pos < len(p.src) {
+		switch {
+		case p.src[p.pos] == '.' && p.pos+1 < len(p.src) && p.src[p.pos+1] == '[':
+			p.pos++
+		case p.src[p.pos] == '.':
+			p.pos++
+			start := p.pos
+			for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+				p.pos++
+			}
+			if p.pos > start {
+				steps = append(steps, pathStep{key: p.src[start:p.pos]})
+			}
+		case p.src[p.pos] == '[':
+			step, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		default:
+			return steps, nil
+		}
+	}
+	return steps, nil
+}
+
+func (p *jqParser) parseBracket() (pathStep, error) {
+	end := strings.IndexByte(p.src[p.pos:], ']')
+	if end < 0 {
+		return pathStep{}, fmt.Errorf("missing ] at offset %d", p.pos)
+	}
+	inner := strings.TrimSpace(p.src[p.pos+1 : p.pos+end])
+	p.pos += end + 1
+
+	if strings.HasPrefix(inner, `"`) {
+		key, err := strconv.Unquote(inner)
+		if err != nil {
+			return pathStep{}, fmt.Errorf("invalid key %s", inner)
+		}
+		return pathStep{key: key}, nil
+	}
+	if i := strings.IndexByte(inner, ':'); i >= 0 {
+		step := pathStep{isSlice: true}
+		if from := strings.TrimSpace(inner[:i]); from != "" {
+			n, err := strconv.Atoi(from)
+			if err != nil {
+				return pathStep{}, fmt.Errorf("invalid slice %s", inner)
+			}
+			step.from = &n
+		}
+		if to := strings.TrimSpace(inner[i+1:]); to != "" {
+			n, err := strconv.Atoi(to)
+			if err != nil {
+				return pathStep{}, fmt.Errorf("invalid slice %s", inner)
+			}
+			step.to = &n
+		}
+		return step, nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil {
+		return pathStep{}, fmt.Errorf("invalid index %s", inner)
+	}
+	return pathStep{index: n, isIndex: true}, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// getPath returns the value at path, or nil when it does not exist.
+func getPath(v interface{}, path []pathStep) (interface{}, error) {
+	for _, step := range path {
+		var err error
+		v, err = getStep(v, step)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func getStep(v interface{}, step pathStep) (interface{}, error) {
+	switch {
+	case step.isSlice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot slice %T", v)
+		}
+		from, to := sliceBounds(len(arr), step)
+		return append([]interface{}{}, arr[from:to]...), nil
+	case step.isIndex:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %T", v)
+		}
+		i := step.index
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i >= len(arr) {
+			return nil, nil
+		}
+		return arr[i], nil
+	default:
+		if v == nil {
+			return nil, nil
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot get key %q of %T", step.key, v)
+		}
+		return obj[step.key], nil
+	}
+}
+
+// updatePath replaces the value at path with the result of f.
+func updatePath(v interface{}, path []pathStep, f jqFilter) (interface{}, error) {
+	if len(path) == 0 {
+		return f(v)
+	}
+	step, rest := path[0], path[1:]
+	switch {
+	case step.isSlice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot slice %T", v)
+		}
+		from, to := sliceBounds(len(arr), step)
+		updated, err := updatePath(append([]interface{}{}, arr[from:to]...), rest, f)
+		if err != nil {
+			return nil, err
+		}
+		part, ok := updated.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("slice update must produce an array")
+		}
+		out := append([]interface{}{}, arr[:from]...)
+		out = append(out, part...)
+		return append(out, arr[to:]...), nil
+	case step.isIndex:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index %T", v)
+		}
+		i := step.index
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i >= len(arr) {
+			return nil, fmt.Errorf("index %d out of range", step.index)
+		}
+		out := append([]interface{}(nil), arr...)
+		updated, err := updatePath(arr[i], rest, f)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = updated
+		return out, nil
+	default:
+		obj, ok := v.(map[string]interface{})
+		if v == nil {
+			obj, ok = map[string]interface{}{}, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("cannot set key %q of %T", step.key, v)
+		}
+		out := make(map[string]interface{}, len(obj)+1)
+		for k, val := range obj {
+			out[k] = val
+		}
+		updated, err := updatePath(obj[step.key], rest, f)
+		if err != nil {
+			return nil, err
+		}
+		out[step.key] = updated
+		return out, nil
+	}
+}
+
+// deletePath removes the value at path.
+func deletePath(v interface{}, path []pathStep) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	parent, last := path[:len(path)-1], path[len(path)-1]
+	return updatePath(v, parent, func(container interface{}) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			out := make(map[string]interface{}, len(c))
+			for k, val := range c {
+				if k != last.key {
+					out[k] = val
+				}
+			}
+			return out, nil
+		case []interface{}:
+			if last.isSlice {
+				from, to := sliceBounds(len(c), last)
+				return append(append([]interface{}(nil), c[:from]...), c[to:]...), nil
+			}
+			i := last.index
+			if i < 0 {
+				i += len(c)
+			}
+			if !last.isIndex || i < 0 || i >= len(c) {
+				return c, nil
+			}
+			return append(append([]interface{}(nil), c[:i]...), c[i+1:]...), nil
+		default:
+			return container, nil
+		}
+	})
+}
+
+func sliceBounds(n int, step pathStep) (int, int) {
+	from, to := 0, n
+	if step.from != nil {
+		from = *step.from
+	}
+	if step.to != nil {
+		to = *step.to
+	}
+	if from < 0 {
+		from += n
+	}
+	if to < 0 {
+		to += n
+	}
+	to = min(max(to, 0), n)
+	from = min(max(from, 0), to)
+	return from, to
+}
+
+func jqLength(v interface{}) (interface{}, error) {
+	switch c := v.(type) {
+	case []interface{}:
+		return len(c), nil
+	case map[string]interface{}:
+		return len(c), nil
+	case string:
+		return len(c), nil
+	case nil:
+		return 0, nil
+	default:
+		return nil, fmt.Errorf("%T has no length", v)
+	}
+}
+
+func jqKeys(v interface{}) (interface{}, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%T has no keys", v)
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]interface{}, len(keys))
+	for i, k := range keys {
+		out[i] = k
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package aduket
+
+// Variant is one of several possible responses of an expectation.
+type Variant struct {
+	Status  int               `json:"status"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Weight  int               `json:"weight,omitempty"` // Relative weight, defaults to 1
+}
+
+// ResponseOneOf makes every match respond with one of the variants, picked at
+// random according to their weights.
+func (e *Expectation) ResponseOneOf(variants ...Variant) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Variants = append([]Variant(nil), variants...)
+	return e
+}
+
+// Seed makes the random choices of this expectation deterministic. Without a
+// seed the server's random source is used.
+func (e *Expectation) Seed(seed int64) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rand = newLockedRand(seed)
+	return e
+}
+
+// pickVariant chooses a variant according to the weights.
+func pickVariant(variants []Variant, rng *lockedRand) Variant {
+	total := 0
+	for _, v := range variants {
+		total += variantWeight(v)
+	}
+	n := rng.Intn(total)
+	for _, v := range variants {
+		n -= variantWeight(v)
+		if n < 0 {
+			return v
+		}
+	}
+	return variants[len(variants)-1]
+}
+
+func variantWeight(v Variant) int {
+	if v.Weight <= 0 {
+		return 1
+	}
+	return v.Weight
+}
@@ -0,0 +1,93 @@
+package aduket
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// VaryRule picks a response variant by the value of a request header, see
+// Expectation.VaryBy.
+type VaryRule struct {
+	Header   string             `json:"header"`
+	Variants map[string]Variant `json:"variants"`
+}
+
+// VaryBy makes the response depend on the request header, the way a CDN
+// keys its cache on the headers listed in Vary, e.g.
+//
+//	e.VaryBy("Accept-Encoding", map[string]aduket.Variant{
+//		"gzip": {Body: gzipped, Headers: map[string]string{"Content-Encoding": "gzip"}},
+//		"*":    {Body: plain},
+//	})
+//
+// A variant is chosen if its key equals the header value or one of its
+// comma separated elements, ignoring case and parameters such as ";q=0.8",
+// so "gzip" matches "Accept-Encoding: br, gzip". Requests matching no key
+// get the "*" variant or, without one, the expectation's own response. A
+// variant with a zero Status or an empty Body keeps the status or body of
+// the response, so a variant can just add headers. The header is added to
+// the Vary response header. VaryBy can be called for several
+// headers; the variants are applied in order.
+func (e *Expectation) VaryBy(header string, variants map[string]Variant) *Expectation {
+	rule := VaryRule{Header: http.CanonicalHeaderKey(header), Variants: make(map[string]Variant, len(variants))}
+	for k, v := range variants {
+		rule.Variants[k] = v
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Vary = append(e.Vary, rule)
+	return e
+}
+
+// pick returns the variant for the header value of a request.
+func (rule VaryRule) pick(value string) (Variant, bool) {
+	keys := make([]string, 0, len(rule.Variants))
+	for k := range rule.Variants {
+		if k != "*" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	value = strings.TrimSpace(value)
+	for _, k := range keys {
+		if strings.EqualFold(k, value) {
+			return rule.Variants[k], true
+		}
+	}
+	for _, element := range strings.Split(value, ",") {
+		element, _, _ = strings.Cut(element, ";")
+		element = strings.TrimSpace(element)
+		for _, k := range keys {
+			if strings.EqualFold(k, element) {
+				return rule.Variants[k], true
+			}
+		}
+	}
+	v, ok := rule.Variants["*"]
+	return v, ok
+}
+
+// applyVary applies the vary rules to a response for r.
+func applyVary(rules []VaryRule, r *http.Request, status int, headers http.Header, body []byte) (int, http.Header, []byte) {
+	for _, rule := range rules {
+		if v, ok := rule.pick(r.Header.Get(rule.Header)); ok {
+			if v.Status == 0 {
+				v.Status = status
+			}
+			if v.Body == "" {
+				v.Body = string(body)
+			}
+			status, headers, body = applyVariant(v, headers)
+		} else {
+			headers = headers.Clone()
+			if headers == nil {
+				headers = make(http.Header)
+			}
+		}
+		headers.Add("Vary", rule.Header)
+	}
+	return status, headers, body
+}
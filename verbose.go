@@ -0,0 +1,95 @@
+package aduket
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	// maxDumpedRequests limits how many requests a failure message shows.
+	maxDumpedRequests = 10
+	// maxDumpedBody limits how much of each body a failure message shows.
+	maxDumpedBody = 1024
+)
+
+// VerboseFailures makes failing assertions include a dump of the relevant
+// captured requests (method, URL, headers and a truncated body) in their
+// message, so CI logs can be understood without rerunning the test.
+func (s *Server) VerboseFailures(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.verboseFailures = enabled
+}
+
+// errorf reports an assertion failure about reqs. The caller must not hold
+// s.mu.
+func (s *Server) errorf(t *testing.T, reqs []*CapturedRequest, format string, args ...interface{}) {
+	t.Helper()
+	t.Error(s.failure(reqs, format, args...))
+}
+
+// fatalf is like errorf but stops the test.
+func (s *Server) fatalf(t *testing.T, reqs []*CapturedRequest, format string, args ...interface{}) {
+	t.Helper()
+	t.Fatal(s.failure(reqs, format, args...))
+}
+
+// failure records a failure for the report and formats its message, followed
+// by a dump of reqs when verbose failures are enabled.
+func (s *Server) failure(reqs []*CapturedRequest, format string, args ...interface{}) string {
+	msg := fmt.Sprintf(format, args...)
+
+	s.mu.Lock()
+	verbose := s.verboseFailures
+	s.failures = append(s.failures, msg)
+	s.mu.Unlock()
+	if !verbose {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	if len(reqs) == 0 {
+		b.WriteString("\n\nno requests were captured")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "\n\ncaptured requests (%d):", len(reqs))
+	if len(reqs) > maxDumpedRequests {
+		fmt.Fprintf(&b, "\n  ... %d earlier requests omitted", len(reqs)-maxDumpedRequests)
+		reqs = reqs[len(reqs)-maxDumpedRequests:]
+	}
+	for _, req := range reqs {
+		b.WriteString("\n")
+		b.WriteString(dumpRequest(req))
+	}
+	return b.String()
+}
+
+// dumpRequest formats a captured request for failure messages.
+func dumpRequest(c *CapturedRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  %s %s -> %d\n", c.Method, c.URL.RequestURI(), c.StatusCode)
+
+	keys := make([]string, 0, len(c.Header))
+	for k := range c.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "    %s: %s\n", k, strings.Join(c.Header[k], ", "))
+	}
+
+	body := c.RequestBodyBytes()
+	switch {
+	case len(body) == 0:
+		b.WriteString("    [empty body]\n")
+	case len(body) > maxDumpedBody:
+		fmt.Fprintf(&b, "    %s... (%d bytes truncated)\n", body[:maxDumpedBody], len(body)-maxDumpedBody)
+	default:
+		fmt.Fprintf(&b, "    %s\n", body)
+	}
+	return b.String()
+}
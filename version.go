@@ -0,0 +1,78 @@
+package aduket
+
+import (
+	"net/http"
+	"strings"
+)
+
+// maxFallbacks bounds chains of version fallbacks such as v3 -> v2 -> v1.
+const maxFallbacks = 8
+
+// VersionGroup is a namespace of expectations under a path prefix, such as
+// an API version. See Server.Version.
+type VersionGroup struct {
+	server   *Server
+	prefix   string
+	fallback string
+}
+
+// Version returns the group of expectations under prefix, e.g. "/v2",
+// creating it if needed.
+func (s *Server) Version(prefix string) *VersionGroup {
+	prefix = "/" + strings.Trim(prefix, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.versions {
+		if v.prefix == prefix {
+			return v
+		}
+	}
+	v := &VersionGroup{server: s, prefix: prefix}
+	s.versions = append(s.versions, v)
+	return v
+}
+
+// FallbackTo makes requests under the group's prefix that match none of its
+// expectations be served by the expectations under prefix instead, with the
+// path rewritten. This keeps mocks short while an API migrates from one
+// version to the next:
+//
+//	s.Version("/v2").FallbackTo("/v1")
+//	s.Expect("GET", "/v1/users").Response(200, "[]") // also serves /v2/users
+func (v *VersionGroup) FallbackTo(prefix string) *VersionGroup {
+	v.server.mu.Lock()
+	defer v.server.mu.Unlock()
+	v.fallback = "/" + strings.Trim(prefix, "/")
+	return v
+}
+
+// Expect registers an expectation for path under the group's prefix.
+func (v *VersionGroup) Expect(method, path string) *Expectation {
+	return v.server.Expect(method, v.prefix+"/"+strings.TrimPrefix(path, "/"))
+}
+
+// versionFallback is the fallback of a version group, see matchSet.
+type versionFallback struct {
+	prefix   string
+	fallback string
+}
+
+// fallbackRequest returns r with its path moved to the fallback of the
+// version group it belongs to, or nil if there is none.
+func (set matchSet) fallbackRequest(r *http.Request) *http.Request {
+	for _, v := range set.fallbacks {
+		rest, ok := strings.CutPrefix(r.URL.Path, v.prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+		rewritten := new(http.Request)
+		*rewritten = *r
+		u := *r.URL
+		u.Path = v.fallback + rest
+		u.RawPath = ""
+		rewritten.URL = &u
+		return rewritten
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package aduket
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configVersion returns a value that changes whenever the config changes.
+// For ConfigMap mounts this is the target of the ..data symlink, which
+// Kubernetes swaps atomically on update.
+func configVersion(path string) string {
+	if target, err := os.Readlink(filepath.Join(path, "..data")); err == nil {
+		return target
+	}
+
+	files := []string{path}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		files, _ = ConfigFiles(path)
+	}
+	var version strings.Builder
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&version, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return version.String()
+}
+
+// configSettle is how long config file events must be quiet before a
+// reload, since editors and ConfigMap updates write in several steps.
+const configSettle = 100 * time.Millisecond
+
+// watchConfig replaces the expectations of s whenever the config at path
+// changes, until done is closed. Changes are picked up from file system
+// events, falling back to polling every interval where those are
+// unavailable. The outcome of every reload is passed to report; invalid
+// configs leave the current expectations in place.
+func watchConfig(s *Server, path string, interval time.Duration, report func(string), done <-chan struct{}) {
+	last := configVersion(path)
+	reload := func() {
+		current := configVersion(path)
+		if current == last {
+			return
+		}
+		last = current
+
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			report(fmt.Sprintf("config error: %v", err))
+			return
+		}
+		if err := replaceExpectations(s, cfg.Rules()); err != nil {
+			report(fmt.Sprintf("config error: %v", err))
+			return
+		}
+		report("config reloaded")
+	}
+
+	watcher, err := newConfigWatcher(path)
+	if err != nil {
+		report(fmt.Sprintf("polling config: %v", err))
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				reload()
+			}
+		}
+	}
+	defer watcher.Close()
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			settle = time.After(configSettle)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			report(fmt.Sprintf("config watch error: %v", err))
+		case <-settle:
+			settle = nil
+			reload()
+		}
+	}
+}
+
+// replaceExpectations is Server.ReplaceExpectations returning the panic of
+// an invalid rule as an error, so a bad reload cannot crash the watcher. The
+// rules are built before the expectations are swapped, so on error the
+// current ones stay in place.
+func replaceExpectations(s *Server, rules []Rule) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	s.ReplaceExpectations(rules)
+	return nil
+}
+
+// newConfigWatcher watches the directory holding the config, rather than
+// the file itself, so editors replacing the file on save and Kubernetes
+// swapping the ..data symlink of a ConfigMap are both seen.
+func newConfigWatcher(path string) (*fsnotify.Watcher, error) {
+	dir := path
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
@@ -0,0 +1,190 @@
+package aduket
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a webhook signature does not match
+// its payload.
+var ErrInvalidSignature = errors.New("aduket: invalid webhook signature")
+
+// WebhookScheme is a way of signing webhook payloads with a shared secret,
+// such as GitHubSignature or StripeSignature.
+type WebhookScheme interface {
+	// Sign sets the signature headers for body, signed at now.
+	Sign(h http.Header, body []byte, secret string, now time.Time)
+	// Verify checks the signature headers against body. Timestamps are
+	// not checked for age, so captured requests can be verified later.
+	Verify(h http.Header, body []byte, secret string) error
+}
+
+var (
+	// GitHubSignature signs with HMAC-SHA256 in X-Hub-Signature-256 as
+	// "sha256=HEX".
+	GitHubSignature WebhookScheme = HMACSignature("X-Hub-Signature-256", "sha256=")
+	// StripeSignature signs "TIMESTAMP.BODY" with HMAC-SHA256 in
+	// Stripe-Signature as "t=TIMESTAMP,v1=HEX".
+	StripeSignature WebhookScheme = stripeScheme{}
+	// SlackSignature signs "v0:TIMESTAMP:BODY" with HMAC-SHA256 in
+	// X-Slack-Signature as "v0=HEX", with the timestamp in
+	// X-Slack-Request-Timestamp.
+	SlackSignature WebhookScheme = slackScheme{}
+)
+
+// HMACSignature returns a scheme putting the hex HMAC-SHA256 of the body in
+// header, after prefix, e.g. HMACSignature("X-Signature", "sha256=").
+func HMACSignature(header, prefix string) WebhookScheme {
+	return hmacScheme{header: header, prefix: prefix}
+}
+
+// SignWebhook signs req, a simulated webhook delivery, with scheme and
+// secret. The body is read and restored.
+func SignWebhook(req *http.Request, scheme WebhookScheme, secret string) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	scheme.Sign(req.Header, body, secret, time.Now())
+	return nil
+}
+
+// NewWebhookRequest returns a signed JSON POST request delivering body to
+// url, to simulate a webhook provider calling the code under test.
+func NewWebhookRequest(url string, body []byte, scheme WebhookScheme, secret string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	scheme.Sign(req.Header, body, secret, time.Now())
+	return req, nil
+}
+
+// VerifyWebhookSignature checks that the request was signed with scheme and
+// secret.
+func (c *CapturedRequest) VerifyWebhookSignature(scheme WebhookScheme, secret string) error {
+	return scheme.Verify(c.Header, c.RequestBodyBytes(), secret)
+}
+
+// AssertWebhookSignature checks that the i-th request was signed with scheme
+// and secret, e.g. a webhook sent by the code under test.
+func (s *Server) AssertWebhookSignature(t *testing.T, i int, scheme WebhookScheme, secret string) {
+	req := s.GetRequest(i)
+	if req == nil {
+		s.fatalf(t, s.requestsSnapshot(), "request index %d not found", i)
+	}
+	if err := req.VerifyWebhookSignature(scheme, secret); err != nil {
+		s.errorf(t, []*CapturedRequest{req}, "expected request %d to be signed: %v", i, err)
+	}
+}
+
+// WithWebhookSignature makes the expectation match only requests signed with
+// scheme and secret, so unsigned or tampered deliveries fall through to
+// other expectations.
+func (e *Expectation) WithWebhookSignature(scheme WebhookScheme, secret string) *Expectation {
+	return e.MatchFunc(func(r *http.Request, body []byte) bool {
+		return scheme.Verify(r.Header, body, secret) == nil
+	})
+}
+
+func hmacHex(secret string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, p := range parts {
+		mac.Write([]byte(p))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// equalSignature compares hex signatures in constant time.
+func equalSignature(got, want string) bool {
+	return hmac.Equal([]byte(strings.ToLower(got)), []byte(want))
+}
+
+type hmacScheme struct {
+	header, prefix string
+}
+
+func (s hmacScheme) Sign(h http.Header, body []byte, secret string, now time.Time) {
+	h.Set(s.header, s.prefix+hmacHex(secret, string(body)))
+}
+
+func (s hmacScheme) Verify(h http.Header, body []byte, secret string) error {
+	got := h.Get(s.header)
+	if got == "" {
+		return fmt.Errorf("aduket: missing %s header", s.header)
+	}
+	if !strings.HasPrefix(got, s.prefix) || !equalSignature(got[len(s.prefix):], hmacHex(secret, string(body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type stripeScheme struct{}
+
+func (stripeScheme) Sign(h http.Header, body []byte, secret string, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	h.Set("Stripe-Signature", "t="+ts+",v1="+hmacHex(secret, ts, ".", string(body)))
+}
+
+func (stripeScheme) Verify(h http.Header, body []byte, secret string) error {
+	header := h.Get("Stripe-Signature")
+	if header == "" {
+		return errors.New("aduket: missing Stripe-Signature header")
+	}
+	var ts string
+	var signatures []string
+	for _, item := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			signatures = append(signatures, v)
+		}
+	}
+	if ts == "" || len(signatures) == 0 {
+		return errors.New("aduket: malformed Stripe-Signature header")
+	}
+	want := hmacHex(secret, ts, ".", string(body))
+	for _, sig := range signatures {
+		if equalSignature(sig, want) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+type slackScheme struct{}
+
+func (slackScheme) Sign(h http.Header, body []byte, secret string, now time.Time) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	h.Set("X-Slack-Request-Timestamp", ts)
+	h.Set("X-Slack-Signature", "v0="+hmacHex(secret, "v0:", ts, ":", string(body)))
+}
+
+func (slackScheme) Verify(h http.Header, body []byte, secret string) error {
+	ts, sig := h.Get("X-Slack-Request-Timestamp"), h.Get("X-Slack-Signature")
+	if ts == "" || sig == "" {
+		return errors.New("aduket: missing X-Slack-Request-Timestamp or X-Slack-Signature header")
+	}
+	if !strings.HasPrefix(sig, "v0=") || !equalSignature(sig[3:], hmacHex(secret, "v0:", ts, ":", string(body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
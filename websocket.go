@@ -0,0 +1,199 @@
+package aduket
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketFrame is a WebSocket message exchanged on a captured connection.
+type WebSocketFrame struct {
+	Inbound bool // Sent by the client
+	Type    int  // websocket.TextMessage or websocket.BinaryMessage
+	Data    []byte
+	At      time.Time
+}
+
+// Text returns the frame data as a string.
+func (f WebSocketFrame) Text() string {
+	return string(f.Data)
+}
+
+// Frames returns the WebSocket messages exchanged on the request's
+// connection, in order. Scripted WebSocket connections are recorded once
+// they close.
+func (c *CapturedRequest) Frames() []WebSocketFrame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]WebSocketFrame(nil), c.frames...)
+}
+
+func (c *CapturedRequest) addFrame(f WebSocketFrame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frames = append(c.frames, f)
+}
+
+// WebSocketScript scripts the messages of a WebSocket connection, see
+// Expectation.WebSocket. Steps run in order:
+//
+//	e.WebSocket().Send("welcome").
+//		OnMessage("ping").Reply("pong").
+//		Then().Echo()
+type WebSocketScript struct {
+	mu    sync.Mutex
+	steps []wsStep
+}
+
+type wsStepKind int
+
+const (
+	wsSend wsStepKind = iota
+	wsAwait
+	wsWait
+	wsEcho
+	wsClose
+)
+
+type wsStep struct {
+	kind wsStepKind
+	text string
+	d    time.Duration
+}
+
+// WebSocket makes the expectation upgrade the connection to a WebSocket and
+// run the returned script on it. Every message is captured, see
+// CapturedRequest.Frames. Once the script ends, incoming messages are still
+// read and captured until the client closes the connection.
+func (e *Expectation) WebSocket() *WebSocketScript {
+	ws := &WebSocketScript{}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.webSocket = ws
+	return ws
+}
+
+func (ws *WebSocketScript) add(step wsStep) *WebSocketScript {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.steps = append(ws.steps, step)
+	return ws
+}
+
+// OnMessage waits for a text message equal to msg, ignoring others. An
+// empty msg accepts any message.
+func (ws *WebSocketScript) OnMessage(msg string) *WebSocketScript {
+	return ws.add(wsStep{kind: wsAwait, text: msg})
+}
+
+// Reply sends a text message, typically after OnMessage.
+func (ws *WebSocketScript) Reply(msg string) *WebSocketScript {
+	return ws.Send(msg)
+}
+
+// Send pushes a text message to the client.
+func (ws *WebSocketScript) Send(msg string) *WebSocketScript {
+	return ws.add(wsStep{kind: wsSend, text: msg})
+}
+
+// Then does nothing; it only makes scripts read naturally.
+func (ws *WebSocketScript) Then() *WebSocketScript {
+	return ws
+}
+
+// Wait pauses the script for d.
+func (ws *WebSocketScript) Wait(d time.Duration) *WebSocketScript {
+	return ws.add(wsStep{kind: wsWait, d: d})
+}
+
+// Echo sends every further message back to the client until it closes the
+// connection.
+func (ws *WebSocketScript) Echo() *WebSocketScript {
+	return ws.add(wsStep{kind: wsEcho})
+}
+
+// Close closes the connection with a normal closure.
+func (ws *WebSocketScript) Close() *WebSocketScript {
+	return ws.add(wsStep{kind: wsClose})
+}
+
+// serve upgrades the connection and runs the script.
+func (ws *WebSocketScript) serve(s *Server, w http.ResponseWriter, r *http.Request, c *CapturedRequest) {
+	ws.mu.Lock()
+	steps := append([]wsStep(nil), ws.steps...)
+	ws.mu.Unlock()
+
+	s.mu.Lock()
+	upgrader := s.Upgrader
+	s.mu.Unlock()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // The upgrader has already answered with an error.
+	}
+	defer conn.Close()
+
+	read := func() (int, []byte, bool) {
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			return 0, nil, false
+		}
+		c.addFrame(WebSocketFrame{Inbound: true, Type: typ, Data: data, At: time.Now()})
+		return typ, data, true
+	}
+	send := func(typ int, data []byte) bool {
+		if err := conn.WriteMessage(typ, data); err != nil {
+			return false
+		}
+		c.addFrame(WebSocketFrame{Type: typ, Data: data, At: time.Now()})
+		return true
+	}
+
+	for _, step := range steps {
+		switch step.kind {
+		case wsSend:
+			if !send(websocket.TextMessage, []byte(step.text)) {
+				return
+			}
+		case wsAwait:
+			for {
+				typ, data, ok := read()
+				if !ok {
+					return
+				}
+				if typ == websocket.TextMessage && (step.text == "" || string(data) == step.text) {
+					break
+				}
+			}
+		case wsWait:
+			select {
+			case <-time.After(step.d):
+			case <-r.Context().Done():
+				return
+			}
+		case wsEcho:
+			for {
+				typ, data, ok := read()
+				if !ok || !send(typ, data) {
+					return
+				}
+			}
+		case wsClose:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			// Wait for the client to acknowledge the close.
+			for {
+				if _, _, ok := read(); !ok {
+					return
+				}
+			}
+		}
+	}
+	for {
+		if _, _, ok := read(); !ok {
+			return
+		}
+	}
+}